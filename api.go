@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -28,7 +30,9 @@ type ConceptGUID2CIDMap map[ConceptGUID]CID
 // Peer_i represents a peer in the network
 type Peer_i interface {
 	GetID() PeerID
-	GetStewardID() SeedGUID
+	GetStewardIDs() []SeedGUID
+	HasSteward(id SeedGUID) bool
+	GetStewardClaims() map[SeedGUID]string
 
 	AddConceptCID(cid CID)
 	RemoveConceptCID(cid CID)
@@ -39,6 +43,8 @@ type Peer_i interface {
 	GetSeedCIDs() []CID
 
 	GetTimestamp() time.Time
+	GetLastSeen() time.Time
+	GetLatency() time.Duration
 }
 
 // Network_i defines the interface for interacting with the network
@@ -65,21 +71,31 @@ type Network_i interface {
 	Publish(ctx context.Context, topic string, data []byte) error
 
 	// Subscribe subscribes to a topic and returns a channel for receiving messages
-	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+	Subscribe(ctx context.Context, topic string) (<-chan NetworkMessage, error)
 
 	// Connect connects to a peer
 	Connect(ctx context.Context, peerID PeerID) error
 
 	// ListPeers returns a list of connected peers
 	ListPeers(ctx context.Context) ([]Peer_i, error)
+
+	// TopicPeers returns the peers subscribed to a topic
+	TopicPeers(ctx context.Context, topic string) ([]PeerID, error)
 }
 
 // Node_i represents a node in the network
 type Node_i interface {
 	Network_i
 
-	// Bootstrap connects to bootstrap nodes
-	Bootstrap(ctx context.Context) error
+	// Bootstrap connects to the given bootstrap nodes
+	Bootstrap(ctx context.Context, addrs []string) error
+
+	// AddStaticPeer keeps the node connected to a peer, reconnecting when the
+	// connection drops
+	AddStaticPeer(ctx context.Context, addr string) error
+
+	// RemoveBootstrapNodes clears the bootstrap list the node dials by itself
+	RemoveBootstrapNodes(ctx context.Context) error
 
 	// ID returns the ID of this node
 	ID(ctx context.Context) (PeerID, error)
@@ -103,6 +119,8 @@ type Concept struct {
 	ConceptType   string
 	Relationships []RelationshipGUID
 	Timestamp     time.Time
+	PreviousCID   CID `json:",omitempty"` // the version this one replaced
+	Version       int `json:",omitempty"`
 }
 
 func (c *Concept) GetID() EntityGUID                    { return EntityGUID(c.ID) }
@@ -121,12 +139,14 @@ func (c Concept) String() string          { return fmt.Sprintf("%s: %s (%s)", c.
 
 // Relationship represents a connection between two entities
 type Relationship struct {
-	ID         RelationshipGUID
-	SourceID   EntityGUID
-	TargetID   EntityGUID
-	Type       ConceptGUID
-	Properties map[string]interface{}
-	Timestamp  time.Time
+	ID           RelationshipGUID
+	SourceID     EntityGUID
+	TargetID     EntityGUID
+	Type         ConceptGUID
+	Properties   map[string]interface{}
+	Timestamp    time.Time
+	InferredFrom RelationshipGUID      `json:",omitempty"` // set on edges implied by an inverse or symmetric type
+	Dynamics     *RelationshipDynamics `json:",omitempty"`
 }
 
 func (r Relationship) String() string {
@@ -153,26 +173,41 @@ func CreateRelationship(sourceID, targetID EntityGUID, relationType ConceptGUID,
 	}
 }
 
-// Function to update a relationship
-// func (r *Relationship) Deepen() {
-// 	r.EnergyFlow *= 1.1
-// 	r.Amplitude *= 1.05
-// 	r.Volume *= 1.05
-// 	r.FrequencySpec = append(r.FrequencySpec, float64(len(r.FrequencySpec)+1))
-// 	r.Timestamp = time.Now()
-// }
-
 // ConcretePeer implements the Peer_i interface
 type Peer struct {
-	ID          PeerID
-	StewardID   SeedGUID
-	ConceptCIDs map[CID]bool
-	SeedCIDs    map[CID]bool
-	Timestamp   time.Time
+	ID            PeerID
+	StewardIDs    map[SeedGUID]bool   // the stewards the node runs, as far as their claims prove
+	StewardClaims map[SeedGUID]string // the claims the node announced, by steward
+	ConceptCIDs   map[CID]bool
+	SeedCIDs      map[CID]bool
+	Timestamp     time.Time     // when the node first heard of the peer
+	LastSeen      time.Time     // when it last heard from or saw the peer
+	Latency       time.Duration // round trip to the peer while connected, else 0
 }
 
-func (p Peer) GetID() PeerID          { return p.ID }
-func (p Peer) GetStewardID() SeedGUID { return p.StewardID }
+func (p Peer) GetID() PeerID { return p.ID }
+
+// GetStewardIDs returns the peer's stewards, sorted
+func (p Peer) GetStewardIDs() []SeedGUID {
+	ret := make([]SeedGUID, 0, len(p.StewardIDs))
+	for id := range p.StewardIDs {
+		ret = append(ret, id)
+	}
+	slices.Sort(ret)
+	return ret
+}
+func (p Peer) HasSteward(id SeedGUID) bool { return p.StewardIDs[id] }
+
+func (p Peer) GetStewardClaims() map[SeedGUID]string { return maps.Clone(p.StewardClaims) }
+
+func (p *Peer) SetStewardIDs(ids []SeedGUID) {
+	p.StewardIDs = make(map[SeedGUID]bool, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			p.StewardIDs[id] = true
+		}
+	}
+}
 
 func (p *Peer) AddConceptCID(cid CID)    { p.ConceptCIDs[cid] = true }
 func (p *Peer) RemoveConceptCID(cid CID) { delete(p.ConceptCIDs, cid) }
@@ -194,31 +229,44 @@ func (p Peer) GetSeedCIDs() []CID {
 	return ret
 }
 
-func (p Peer) GetTimestamp() time.Time { return p.Timestamp }
+func (p Peer) GetTimestamp() time.Time   { return p.Timestamp }
+func (p Peer) GetLastSeen() time.Time    { return p.LastSeen }
+func (p Peer) GetLatency() time.Duration { return p.Latency }
 
 func (p *Peer) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
-		ID          PeerID
-		StewardID   SeedGUID
-		ConceptCIDs []CID
-		SeedCIDs    []CID
-		Timestamp   time.Time
+		ID            PeerID
+		StewardIDs    []SeedGUID
+		StewardClaims map[SeedGUID]string `json:",omitempty"`
+		ConceptCIDs   []CID
+		SeedCIDs      []CID
+		Timestamp     time.Time
+		LastSeen      time.Time
+		Latency       time.Duration
 	}{
-		ID:          p.ID,
-		StewardID:   p.StewardID,
-		ConceptCIDs: p.GetConceptCIDs(),
-		SeedCIDs:    p.GetSeedCIDs(),
-		Timestamp:   p.Timestamp,
+		ID:            p.ID,
+		StewardIDs:    p.GetStewardIDs(),
+		StewardClaims: p.StewardClaims,
+		ConceptCIDs:   p.GetConceptCIDs(),
+		SeedCIDs:      p.GetSeedCIDs(),
+		Timestamp:     p.Timestamp,
+		LastSeen:      p.LastSeen,
+		Latency:       p.Latency,
 	})
 }
 
+// UnmarshalJSON also reads peers saved with a single StewardID
 func (p *Peer) UnmarshalJSON(data []byte) error {
 	var temp struct {
-		ID          PeerID
-		StewardID   SeedGUID
-		ConceptCIDs []CID
-		SeedCIDs    []CID
-		Timestamp   time.Time
+		ID            PeerID
+		StewardID     SeedGUID
+		StewardIDs    []SeedGUID
+		StewardClaims map[SeedGUID]string
+		ConceptCIDs   []CID
+		SeedCIDs      []CID
+		Timestamp     time.Time
+		LastSeen      time.Time
+		Latency       time.Duration
 	}
 
 	if err := json.Unmarshal(data, &temp); err != nil {
@@ -226,8 +274,11 @@ func (p *Peer) UnmarshalJSON(data []byte) error {
 	}
 
 	p.ID = temp.ID
-	p.StewardID = temp.StewardID
+	p.SetStewardIDs(append(temp.StewardIDs, temp.StewardID))
+	p.StewardClaims = temp.StewardClaims
 	p.Timestamp = temp.Timestamp
+	p.LastSeen = temp.LastSeen
+	p.Latency = temp.Latency
 	p.ConceptCIDs = make(map[CID]bool)
 	for _, cid := range temp.ConceptCIDs {
 		p.ConceptCIDs[cid] = true
@@ -240,9 +291,15 @@ func (p *Peer) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// PeerMessage is what a node announces. StewardID is its default steward,
+// for nodes that know only one per peer. A node is only taken to run the
+// stewards whose StewardClaims prove it: each claim is signed with the
+// steward's key over stewardClaimMessage.
 type PeerMessage struct {
 	PeerID        PeerID
 	StewardID     SeedGUID
+	StewardIDs    []SeedGUID          `json:",omitempty"`
+	StewardClaims map[SeedGUID]string `json:",omitempty"`
 	ConceptCIDs   []CID
 	SeedCIDs      []CID
 	Relationships RelationshipMap
@@ -250,6 +307,13 @@ type PeerMessage struct {
 
 type PeerMap map[PeerID]Peer_i
 
+// NetworkMessage is a message received on a topic. From is the peer that
+// signed it, when the network tells.
+type NetworkMessage struct {
+	From PeerID
+	Data []byte
+}
+
 type ConceptFilter struct {
 	CID            CID
 	GUID           ConceptGUID
@@ -260,50 +324,16 @@ type ConceptFilter struct {
 }
 
 var (
-	conceptMap    ConceptMap
-	conceptID2CID ConceptGUID2CIDMap
-	conceptMu     sync.RWMutex
-
-	relationshipMap RelationshipMap
-	relationshipMu  sync.RWMutex
-
-	peerMap   PeerMap
-	peerMapMu sync.RWMutex
-	peerID    PeerID
+	peerID PeerID
 
+	// stewardID is the node's default steward; the node acts for it unless a
+	// request is authenticated as another
 	stewardID SeedGUID
 	stewardMu sync.RWMutex
-
-	seedMap    SeedMap
-	seedID2CID SeedGUID2CIDMap
 )
 
-func addOrUpdateRelationship(_ context.Context, relationship *Relationship) error {
-	relationshipMu.Lock()
-	defer relationshipMu.Unlock()
-
-	relationshipMap[relationship.ID] = relationship
-
-	return nil
-}
-
-func (g EntityGUID) AsEntity() Entity {
-	c, ok := conceptMap[ConceptGUID(g)]
-	if ok {
-		return c
-	}
-	s, ok := seedMap[SeedGUID(g)]
-	if ok {
-		return s
-	}
-	return nil
-}
-
-func (g ConceptGUID) AsConcept() *Concept {
-	c, ok := conceptMap[g]
-	if ok {
-		return c
-	}
+func (s *Server) addOrUpdateRelationship(ctx context.Context, relationship *Relationship) error {
+	s.relationships.Put(ctx, relationship)
 	return nil
 }
 
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenRequest struct {
+	Name      string   `json:"name"`
+	StewardID SeedGUID `json:"stewardId"`
+	Admin     bool     `json:"admin"`
+}
+
+func requestPrincipal(c *gin.Context) *Principal {
+	if p, ok := principalFrom(c.Request.Context()); ok {
+		return p
+	}
+	return &Principal{}
+}
+
+// whoami_h returns who the request's credentials act for
+func (s *Server) whoami_h(c *gin.Context) {
+	c.JSON(http.StatusOK, requestPrincipal(c))
+}
+
+// createToken_h issues an API token. Stewards get tokens for themselves;
+// admins for any steward, with admin rights if they ask. The token itself is
+// in this response only.
+func (s *Server) createToken_h(c *gin.Context) {
+	var req tokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+	p := requestPrincipal(c)
+	if req.StewardID == "" {
+		req.StewardID = p.StewardID
+	}
+	if !p.Admin && (req.StewardID != p.StewardID || req.Admin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins issue tokens for other stewards or with admin rights"})
+		return
+	}
+	if seed, ok := s.seeds.Get(req.StewardID); !ok || seed.GetCoreSeed().ConceptID != StewardConcept {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stewardId must be a steward seed"})
+		return
+	}
+
+	token, secret, err := s.auth.createToken(c.Request.Context(), req.Name, req.StewardID, req.Admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, struct {
+		APIToken
+		Token string `json:"token"`
+	}{token.public(), secret})
+}
+
+// listTokens_h lists the caller's tokens, or every token for admins
+func (s *Server) listTokens_h(c *gin.Context) {
+	p := requestPrincipal(c)
+	if err := p.requireAuthenticated(); err != nil {
+		abortAuth(c, err)
+		return
+	}
+	if p.Admin {
+		c.JSON(http.StatusOK, s.auth.listTokens(""))
+		return
+	}
+	c.JSON(http.StatusOK, s.auth.listTokens(p.StewardID))
+}
+
+func (s *Server) revokeToken_h(c *gin.Context) {
+	p := requestPrincipal(c)
+	token, ok := s.auth.getToken(c.Param("id"))
+	if !ok || (!p.Admin && token.StewardID != p.StewardID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err := s.auth.revokeToken(c.Request.Context(), token.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	apiTokensPath = "/ccn/api-tokens.json"
+
+	apiTokenPrefix   = "ccn_"
+	signatureScheme  = "CCN-Ed25519"
+	signatureMaxSkew = 5 * time.Minute
+)
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errForbidden       = errors.New("forbidden")
+)
+
+// adminRoutes change the ontology or the node itself rather than a steward's
+// own seeds. Every other route that is not a read needs an authenticated
+// steward, and seeds and relationships are checked against their owner.
+var adminRoutes = map[string]bool{
+	"POST /concept":                         true,
+	"PUT /concept/:guid":                    true,
+	"PATCH /concept/:guid":                  true,
+	"DELETE /concept/:guid":                 true,
+	"POST /concept/:guid/rollback":          true,
+	"POST /interactions/replay":             true,
+	"POST /import":                          true,
+	"POST /ontology/migrate":                true,
+	"POST /integrity/repair":                true,
+	"POST /stewards":                        true,
+	"PUT /stewards/default":                 true,
+	"DELETE /stewards/:guid":                true,
+	"POST /webhooks":                        true,
+	"GET /webhooks":                         true,
+	"GET /webhooks/dead-letters":            true,
+	"POST /webhooks/dead-letters/:id/retry": true,
+	"DELETE /webhooks/dead-letters/:id":     true,
+	"GET /webhooks/:id":                     true,
+	"PUT /webhooks/:id":                     true,
+	"DELETE /webhooks/:id":                  true,
+	"GET /webhooks/:id/deliveries":          true,
+}
+
+// Principal is who a request acts for. Requests without credentials get one
+// with no steward; work the node does itself carries none at all.
+type Principal struct {
+	StewardID SeedGUID `json:"stewardId,omitempty"`
+	Admin     bool     `json:"admin"`
+	TokenID   string   `json:"tokenId,omitempty"` // set when authenticated by an API token
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFrom returns the principal of a request; ok is false for the
+// node's own work, which is not checked
+func principalFrom(ctx context.Context) (p *Principal, ok bool) {
+	p, ok = ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+func (p *Principal) authenticated() bool {
+	return p.StewardID != ""
+}
+
+func (p *Principal) requireAuthenticated() error {
+	if !p.authenticated() {
+		return errUnauthenticated
+	}
+	return nil
+}
+
+func (p *Principal) requireAdmin() error {
+	if err := p.requireAuthenticated(); err != nil {
+		return err
+	}
+	if !p.Admin {
+		return fmt.Errorf("%w: admin rights required", errForbidden)
+	}
+	return nil
+}
+
+// APIToken is a bearer token acting for a steward. Only its hash is kept.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	StewardID SeedGUID  `json:"stewardId"`
+	Admin     bool      `json:"admin"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// public is the token as the API shows it, without its hash
+func (t APIToken) public() APIToken {
+	t.Hash = ""
+	return t
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticator checks the credentials of requests: API tokens, and requests
+// signed with the ed25519 key of a steward seed
+type Authenticator struct {
+	mu     sync.Mutex
+	tokens map[string]*APIToken // by ID
+	byHash map[string]*APIToken
+	seen   map[string]time.Time // signatures used, until they expire
+	admins map[SeedGUID]bool
+}
+
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{
+		tokens: make(map[string]*APIToken),
+		byHash: make(map[string]*APIToken),
+		seen:   make(map[string]time.Time),
+		admins: make(map[SeedGUID]bool),
+	}
+}
+
+// load reads the API tokens and the admin stewards from CCN_ADMIN_STEWARDS
+func (a *Authenticator) load(ctx context.Context, admins []string) {
+	var tokens []*APIToken
+	if err := loadData(ctx, apiTokensPath, &tokens); err != nil {
+		log.Printf("No API tokens loaded: %v\n", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, token := range tokens {
+		a.tokens[token.ID] = token
+		a.byHash[token.Hash] = token
+	}
+	for _, id := range admins {
+		a.admins[SeedGUID(id)] = true
+	}
+}
+
+// save writes the tokens; the caller holds a.mu
+func (a *Authenticator) save(ctx context.Context) error {
+	tokens := make([]*APIToken, 0, len(a.tokens))
+	for _, token := range a.tokens {
+		tokens = append(tokens, token)
+	}
+	slices.SortFunc(tokens, func(x, y *APIToken) int { return x.CreatedAt.Compare(y.CreatedAt) })
+	return saveData(ctx, apiTokensPath, tokens)
+}
+
+// createToken issues a token for a steward and returns it with its secret,
+// which is not kept
+func (a *Authenticator) createToken(ctx context.Context, name string, steward SeedGUID, admin bool) (*APIToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := apiTokenPrefix + hex.EncodeToString(b)
+	token := &APIToken{
+		ID:        uuid.New().String(),
+		Name:      name,
+		StewardID: steward,
+		Admin:     admin,
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now(),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[token.ID] = token
+	a.byHash[token.Hash] = token
+	if err := a.save(ctx); err != nil {
+		delete(a.tokens, token.ID)
+		delete(a.byHash, token.Hash)
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+func (a *Authenticator) revokeToken(ctx context.Context, id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	token, ok := a.tokens[id]
+	if !ok {
+		return fmt.Errorf("token %w: %s", errEntityNotFound, id)
+	}
+	delete(a.tokens, id)
+	delete(a.byHash, token.Hash)
+	if err := a.save(ctx); err != nil {
+		a.tokens[id] = token
+		a.byHash[token.Hash] = token
+		return err
+	}
+	return nil
+}
+
+func (a *Authenticator) getToken(id string) (APIToken, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	token, ok := a.tokens[id]
+	if !ok {
+		return APIToken{}, false
+	}
+	return token.public(), true
+}
+
+// listTokens returns the tokens of a steward, or all of them for "", oldest first
+func (a *Authenticator) listTokens(steward SeedGUID) []APIToken {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	tokens := []APIToken{}
+	for _, token := range a.tokens {
+		if steward == "" || token.StewardID == steward {
+			tokens = append(tokens, token.public())
+		}
+	}
+	slices.SortFunc(tokens, func(x, y APIToken) int { return x.CreatedAt.Compare(y.CreatedAt) })
+	return tokens
+}
+
+func (a *Authenticator) hasTokens() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.tokens) > 0
+}
+
+// isAdmin reports whether a steward signing its requests has admin rights: the
+// node's default steward and those in CCN_ADMIN_STEWARDS do
+func (a *Authenticator) isAdmin(steward SeedGUID) bool {
+	own := steward == defaultSteward()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return own || a.admins[steward]
+}
+
+// authenticate returns who a request acts for. A request without credentials
+// is anonymous; wrong credentials are an error.
+func (s *Server) authenticate(r *http.Request) (*Principal, error) {
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	// Browsers cannot set headers on a WebSocket, so it may pass the token in the URL
+	if scheme == "" && websocket.IsWebSocketUpgrade(r) && r.URL.Query().Get("access_token") != "" {
+		scheme, credentials = "Bearer", r.URL.Query().Get("access_token")
+	}
+
+	switch {
+	case scheme == "":
+		return &Principal{}, nil
+	case strings.EqualFold(scheme, "Bearer"):
+		s.auth.mu.Lock()
+		token, ok := s.auth.byHash[hashToken(strings.TrimSpace(credentials))]
+		s.auth.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid token", errUnauthenticated)
+		}
+		return &Principal{StewardID: token.StewardID, Admin: token.Admin, TokenID: token.ID}, nil
+	case scheme == signatureScheme:
+		return s.verifySignature(r, credentials)
+	}
+	return nil, fmt.Errorf("%w: unsupported scheme %q", errUnauthenticated, scheme)
+}
+
+// verifySignature checks a request signed by a steward:
+//
+//	Authorization: CCN-Ed25519 steward=<guid>, timestamp=<unix seconds>, signature=<base64>
+//
+// The signature covers the method, the request URI, the timestamp and the
+// SHA-256 of the body, one per line, the hash in hex. A signature is accepted
+// once, within five minutes of its timestamp.
+func (s *Server) verifySignature(r *http.Request, credentials string) (*Principal, error) {
+	params := make(map[string]string)
+	for _, param := range strings.Split(credentials, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+	steward := SeedGUID(params["steward"])
+	if steward == "" || params["timestamp"] == "" || params["signature"] == "" {
+		return nil, fmt.Errorf("%w: signature needs steward, timestamp and signature", errUnauthenticated)
+	}
+	unix, err := strconv.ParseInt(params["timestamp"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid timestamp", errUnauthenticated)
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := time.Since(signedAt); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return nil, fmt.Errorf("%w: timestamp outside the allowed window", errUnauthenticated)
+	}
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", errUnauthenticated)
+	}
+
+	seed, ok := s.seeds.Get(steward)
+	stewardSeed, isSteward := seed.(*StewardSeed)
+	if !ok || !isSteward || stewardSeed.PublicKey == "" {
+		return nil, fmt.Errorf("%w: steward %s has no public key", errUnauthenticated, steward)
+	}
+	publicKey, err := parsePublicKey(stewardSeed.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnauthenticated, err)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if !ed25519.Verify(publicKey, signedMessage(r.Method, r.URL.RequestURI(), params["timestamp"], body), signature) {
+		return nil, fmt.Errorf("%w: invalid signature", errUnauthenticated)
+	}
+
+	a := s.auth
+	a.mu.Lock()
+	now := time.Now()
+	for sig, expiry := range a.seen {
+		if now.After(expiry) {
+			delete(a.seen, sig)
+		}
+	}
+	_, replayed := a.seen[params["signature"]]
+	a.seen[params["signature"]] = signedAt.Add(signatureMaxSkew)
+	a.mu.Unlock()
+	if replayed {
+		return nil, fmt.Errorf("%w: signature already used", errUnauthenticated)
+	}
+	return &Principal{StewardID: steward, Admin: a.isAdmin(steward)}, nil
+}
+
+// signedMessage is what a steward signs for a request
+func signedMessage(method, requestURI, timestamp string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(method + "\n" + requestURI + "\n" + timestamp + "\n" + hex.EncodeToString(sum[:]))
+}
+
+func parsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("PublicKey must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// authErrorStatus is the HTTP status that reports an authorization error
+func authErrorStatus(err error) int {
+	if errors.Is(err, errUnauthenticated) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+func abortAuth(c *gin.Context, err error) {
+	if errors.Is(err, errUnauthenticated) {
+		c.Header("WWW-Authenticate", "Bearer, "+signatureScheme)
+	}
+	c.AbortWithStatusJSON(authErrorStatus(err), gin.H{"error": err.Error()})
+}
+
+// authMiddleware authenticates each request and lets reads through; other
+// requests need a steward, and admin routes an admin
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := s.authenticate(c.Request)
+		if err != nil {
+			abortAuth(c, err)
+			return
+		}
+		c.Request = c.Request.WithContext(withPrincipal(c.Request.Context(), p))
+
+		switch method := c.Request.Method; {
+		case adminRoutes[method+" "+c.FullPath()]:
+			err = p.requireAdmin()
+		case method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions:
+			err = p.requireAuthenticated()
+		}
+		if err != nil {
+			abortAuth(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizeAdmin checks that a request may change the ontology
+func authorizeAdmin(ctx context.Context) error {
+	if p, ok := principalFrom(ctx); ok {
+		return p.requireAdmin()
+	}
+	return nil
+}
+
+// seedOwner returns the steward a seed belongs to; seeds without one, like
+// coins and contracts, belong to the admins
+func seedOwner(seed Seed_i) (SeedGUID, bool) {
+	switch seed := seed.(type) {
+	case *StewardSeed:
+		return seed.SeedID, true
+	case *AssetSeed:
+		return seed.StewardID, true
+	case *ConceptInvestmentSeed:
+		return seed.InvestorID, true
+	case *SeedInvestmentSeed:
+		return seed.InvestorID, true
+	case *TransactionSeed:
+		return seed.FromSteward, true
+	case *Proposal:
+		return seed.StewardID, true
+	}
+	return "", false
+}
+
+// authorizeSeed checks that a request may replace existing with updated;
+// either is nil for a create or a delete. A steward changes only its own seeds
+// and creates them only in its own name. The steward of an asset may hand it
+// to another, and only it can move the asset in a transaction. A steward may
+// not change its own energy balance.
+func (s *Server) authorizeSeed(ctx context.Context, existing, updated Seed_i) error {
+	p, ok := principalFrom(ctx)
+	if !ok || p.Admin {
+		return nil
+	}
+	if err := p.requireAuthenticated(); err != nil {
+		return err
+	}
+
+	if existing != nil {
+		if owner, _ := seedOwner(existing); owner != p.StewardID {
+			return fmt.Errorf("%w: seed %s is not yours", errForbidden, existing.GetSeedID())
+		}
+	}
+	if updated == nil {
+		return nil
+	}
+	owner, owned := seedOwner(updated)
+	_, wasAsset := existing.(*AssetSeed)
+	_, isAsset := updated.(*AssetSeed)
+	_, isSteward := updated.(*StewardSeed)
+	switch {
+	case !owned, isSteward && existing == nil:
+		return fmt.Errorf("%w: only admins create or change %T seeds", errForbidden, updated)
+	case owner != p.StewardID && !(wasAsset && isAsset):
+		return fmt.Errorf("%w: a seed can only be made in your own steward's name", errForbidden)
+	}
+
+	switch seed := updated.(type) {
+	case *StewardSeed:
+		if previous, _ := existing.(*StewardSeed); previous == nil || previous.EnergyBalance != seed.EnergyBalance {
+			return fmt.Errorf("%w: only admins change an energy balance", errForbidden)
+		}
+	case *TransactionSeed:
+		if seed.Asset != "" {
+			asset, ok := s.seeds.Get(seed.Asset)
+			if owner, _ := seedOwner(asset); !ok || owner != p.StewardID {
+				return fmt.Errorf("%w: only the steward of asset %s can move it", errForbidden, seed.Asset)
+			}
+		}
+	}
+	return nil
+}
+
+// authorizeRelationship checks that a request may change relationships from
+// the given sources. Relationships from a seed belong to the seed's steward;
+// those from a concept are part of the ontology.
+func (s *Server) authorizeRelationship(ctx context.Context, sources ...EntityGUID) error {
+	p, ok := principalFrom(ctx)
+	if !ok || p.Admin {
+		return nil
+	}
+	if err := p.requireAuthenticated(); err != nil {
+		return err
+	}
+	for _, source := range sources {
+		seed, ok := s.seeds.Get(SeedGUID(source))
+		if !ok {
+			return fmt.Errorf("%w: only admins link concepts", errForbidden)
+		}
+		if owner, _ := seedOwner(seed); owner != p.StewardID {
+			return fmt.Errorf("%w: seed %s is not yours", errForbidden, source)
+		}
+	}
+	return nil
+}
+
+// authorizePeerSeed checks that a peer may publish a seed version replacing
+// existing, which is nil for a new seed. The peer has to run the steward owning
+// the seed before and after the change, except when an asset is handed on;
+// seeds nobody owns only come from a peer running an admin steward.
+func (s *Server) authorizePeerSeed(from PeerID, existing, updated Seed_i) error {
+	peer, ok := s.peers.Get(from)
+	if !ok {
+		return fmt.Errorf("%w: unknown peer %s", errForbidden, from)
+	}
+	runsOwner := func(seed Seed_i) bool {
+		if owner, owned := seedOwner(seed); owned {
+			return peer.HasSteward(owner)
+		}
+		return s.runsAdmin(peer)
+	}
+	if steward, ok := updated.(*StewardSeed); ok && existing == nil {
+		// A new steward's seed carries the key its claim is checked against
+		if !verifyStewardClaim(from, steward, peer.GetStewardClaims()[steward.SeedID]) {
+			return fmt.Errorf("%w: peer %s did not claim steward %s", errForbidden, from, steward.SeedID)
+		}
+		return nil
+	}
+	_, wasAsset := existing.(*AssetSeed)
+	_, isAsset := updated.(*AssetSeed)
+	if existing != nil && !runsOwner(existing) || !(wasAsset && isAsset) && !runsOwner(updated) {
+		return fmt.Errorf("%w: peer %s does not run the steward of seed %s", errForbidden, from, updated.GetSeedID())
+	}
+	return nil
+}
+
+// authorizePeerConcept checks that a peer may publish a concept version: the
+// ontology is changed by admins only
+func (s *Server) authorizePeerConcept(from PeerID) error {
+	if peer, ok := s.peers.Get(from); ok && s.runsAdmin(peer) {
+		return nil
+	}
+	return fmt.Errorf("%w: peer %s runs no admin steward", errForbidden, from)
+}
+
+// authorizePeerRelationship checks that a peer may publish a relationship, as
+// authorizeRelationship does for a request: one from a seed comes from a peer
+// running the seed's steward, one from a concept from a peer running an admin
+func (s *Server) authorizePeerRelationship(from PeerID, rel *Relationship) error {
+	peer, ok := s.peers.Get(from)
+	if !ok {
+		return fmt.Errorf("%w: unknown peer %s", errForbidden, from)
+	}
+	allowed := s.runsAdmin(peer)
+	if seed, ok := s.seeds.Get(SeedGUID(rel.SourceID)); ok {
+		if owner, owned := seedOwner(seed); owned {
+			allowed = peer.HasSteward(owner)
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: peer %s may not link from %s", errForbidden, from, rel.SourceID)
+	}
+	return nil
+}
+
+func (s *Server) runsAdmin(peer Peer_i) bool {
+	for _, id := range peer.GetStewardIDs() {
+		if s.auth.isAdmin(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyStewardClaim checks a peer's claim to run a steward: a signature with
+// the key in the steward's seed over stewardClaimMessage
+func verifyStewardClaim(peer PeerID, steward Seed_i, claim string) bool {
+	seed, ok := steward.(*StewardSeed)
+	if !ok || seed.PublicKey == "" || claim == "" {
+		return false
+	}
+	publicKey, err := parsePublicKey(seed.PublicKey)
+	if err != nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(claim)
+	return err == nil && ed25519.Verify(publicKey, stewardClaimMessage(peer, seed.PublicKey), signature)
+}
+
+// verifiedStewards returns the stewards a peer claims to run whose claims
+// check out against the seeds we hold
+func (s *Server) verifiedStewards(peer PeerID, claims map[SeedGUID]string) []SeedGUID {
+	var verified []SeedGUID
+	for id, claim := range claims {
+		if seed, ok := s.seeds.Get(id); ok && verifyStewardClaim(peer, seed, claim) {
+			verified = append(verified, id)
+		}
+	}
+	return verified
+}
+
+// loadAuth loads the API tokens. A node without any issues an admin token for
+// its own steward and logs it, so the operator can make the first calls. A
+// default steward without a seed gets none, as no token can act for it.
+func (s *Server) loadAuth(ctx context.Context) {
+	s.auth.load(ctx, nodeConfig.AdminStewards)
+	if s.auth.hasTokens() {
+		return
+	}
+	steward := defaultSteward()
+	if _, ok := s.seeds.Get(steward); !ok {
+		log.Printf("No bootstrap API token issued: the default steward %s has no seed; set steward_name and restart", steward)
+		return
+	}
+	_, secret, err := s.auth.createToken(ctx, "bootstrap", steward, true)
+	if err != nil {
+		log.Printf("Failed to create the bootstrap API token: %v", err)
+		return
+	}
+	log.Printf("Created an admin API token for steward %s; it is not shown again: %s", steward, secret)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAuthorizeSeed(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := newTestSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+
+	asset := NewAssetSeed("Bike", "", alice.SeedID)
+	if err := s.addOrUpdateSeed(context.Background(), asset, peerID); err != nil {
+		t.Fatal(err)
+	}
+	handedOn := cloneOf(t, asset)
+	handedOn.StewardID = bob.SeedID
+	richer := cloneOf(t, alice)
+	richer.EnergyBalance += 10
+	renamed := cloneOf(t, alice)
+	renamed.Name = "Alice B."
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		existing Seed_i
+		updated  Seed_i
+		want     error
+	}{
+		{"node's own work", context.Background(), nil, NewCoinSeed(1), nil},
+		{"anonymous", withPrincipal(context.Background(), &Principal{}), nil, NewAssetSeed("Car", "", alice.SeedID), errUnauthenticated},
+		{"create own asset", asSteward(alice.SeedID, false), nil, NewAssetSeed("Car", "", alice.SeedID), nil},
+		{"create asset for another", asSteward(alice.SeedID, false), nil, NewAssetSeed("Car", "", bob.SeedID), errForbidden},
+		{"create unowned seed", asSteward(alice.SeedID, false), nil, NewCoinSeed(1), errForbidden},
+		{"create steward", asSteward(alice.SeedID, false), nil, NewStewardSeed("Carol", ""), errForbidden},
+		{"admin creates anything", asSteward(bob.SeedID, true), nil, NewCoinSeed(1), nil},
+		{"change own steward", asSteward(alice.SeedID, false), alice, renamed, nil},
+		{"change own energy", asSteward(alice.SeedID, false), alice, richer, errForbidden},
+		{"change another's steward", asSteward(bob.SeedID, false), alice, renamed, errForbidden},
+		{"hand asset on", asSteward(alice.SeedID, false), asset, handedOn, nil},
+		{"take another's asset", asSteward(bob.SeedID, false), asset, handedOn, errForbidden},
+		{"delete own asset", asSteward(alice.SeedID, false), asset, nil, nil},
+		{"delete another's asset", asSteward(bob.SeedID, false), asset, nil, errForbidden},
+		{"move own asset", asSteward(alice.SeedID, false), nil, NewTransactionSeed("Sale", "", alice.SeedID, bob.SeedID, asset.SeedID, ""), nil},
+		{"move another's asset", asSteward(bob.SeedID, false), nil, NewTransactionSeed("Sale", "", bob.SeedID, alice.SeedID, asset.SeedID, ""), errForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.authorizeSeed(tt.ctx, tt.existing, tt.updated)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRelationship(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := newTestSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+	concept := EntityGUID(s.findConceptGUID("Technology"))
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		sources []EntityGUID
+		want    error
+	}{
+		{"from own seed", asSteward(alice.SeedID, false), []EntityGUID{EntityGUID(alice.SeedID)}, nil},
+		{"from another's seed", asSteward(bob.SeedID, false), []EntityGUID{EntityGUID(alice.SeedID)}, errForbidden},
+		{"moved to another's seed", asSteward(alice.SeedID, false), []EntityGUID{EntityGUID(alice.SeedID), EntityGUID(bob.SeedID)}, errForbidden},
+		{"from a concept", asSteward(alice.SeedID, false), []EntityGUID{concept}, errForbidden},
+		{"admin from a concept", asSteward(alice.SeedID, true), []EntityGUID{concept}, nil},
+		{"anonymous", withPrincipal(context.Background(), &Principal{}), []EntityGUID{EntityGUID(alice.SeedID)}, errUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.authorizeRelationship(tt.ctx, tt.sources...)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizePeerSeed(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice, aliceKey := newKeyedSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+	root, rootKey := newKeyedSteward(t, s, "Root")
+	s.auth.admins[root.SeedID] = true
+	newcomer, newcomerKey := newKeyedSteward(t, nil, "Newcomer")
+	ctx := context.Background()
+	s.addOrUpdatePeer(ctx, "alice-node", map[SeedGUID]string{alice.SeedID: claimOn("alice-node", alice, aliceKey)})
+	s.addOrUpdatePeer(ctx, "admin-node", map[SeedGUID]string{root.SeedID: claimOn("admin-node", root, rootKey)})
+	s.addOrUpdatePeer(ctx, "mallory-node", map[SeedGUID]string{
+		alice.SeedID:     claimOn("alice-node", alice, aliceKey), // replayed from another peer
+		defaultSteward(): "bm90IGEgc2lnbmF0dXJl",
+		newcomer.SeedID:  claimOn("newcomer-node", newcomer, newcomerKey),
+	})
+	s.addOrUpdatePeer(ctx, "newcomer-node", map[SeedGUID]string{newcomer.SeedID: claimOn("newcomer-node", newcomer, newcomerKey)})
+
+	asset := NewAssetSeed("Bike", "", alice.SeedID)
+	handedOn := cloneOf(t, asset)
+	handedOn.StewardID = bob.SeedID
+	taken := cloneOf(t, asset)
+	taken.Name = "Stolen bike"
+
+	tests := []struct {
+		name     string
+		from     PeerID
+		existing Seed_i
+		updated  Seed_i
+		want     error
+	}{
+		{"new seed of a steward it runs", "alice-node", nil, asset, nil},
+		{"new seed of another steward", "admin-node", nil, asset, errForbidden},
+		{"change of a steward it runs", "alice-node", asset, taken, nil},
+		{"change of another steward's seed", "admin-node", asset, taken, errForbidden},
+		{"asset handed on by its steward", "alice-node", asset, handedOn, nil},
+		{"unowned seed from an admin", "admin-node", nil, NewCoinSeed(1), nil},
+		{"unowned seed from a steward", "alice-node", nil, NewCoinSeed(1), errForbidden},
+		{"unknown peer", "stranger", nil, asset, errForbidden},
+		{"replayed claim", "mallory-node", asset, taken, errForbidden},
+		{"unproven claim to the default steward", "mallory-node", nil, NewCoinSeed(1), errForbidden},
+		{"new steward with its claim", "newcomer-node", nil, newcomer, nil},
+		{"new steward claimed for another peer", "mallory-node", nil, newcomer, errForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.authorizePeerSeed(tt.from, tt.existing, tt.updated)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizePeerRelationship(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice, aliceKey := newKeyedSteward(t, s, "Alice")
+	root, rootKey := newKeyedSteward(t, s, "Root")
+	s.auth.admins[root.SeedID] = true
+	ctx := context.Background()
+	s.addOrUpdatePeer(ctx, "alice-node", map[SeedGUID]string{alice.SeedID: claimOn("alice-node", alice, aliceKey)})
+	s.addOrUpdatePeer(ctx, "admin-node", map[SeedGUID]string{root.SeedID: claimOn("admin-node", root, rootKey)})
+	s.addOrUpdatePeer(ctx, "mallory-node", map[SeedGUID]string{defaultSteward(): "bm90IGEgc2lnbmF0dXJl"})
+
+	influences := s.findConceptGUID("Influences")
+	technology := EntityGUID(s.findConceptGUID("Technology"))
+	fromAlice := CreateRelationship(EntityGUID(alice.SeedID), technology, influences, nil)
+	fromConcept := CreateRelationship(technology, EntityGUID(s.findConceptGUID("Society")), influences, nil)
+
+	tests := []struct {
+		name string
+		from PeerID
+		rel  *Relationship
+		want error
+	}{
+		{"from a seed of a steward it runs", "alice-node", fromAlice, nil},
+		{"from another steward's seed", "admin-node", fromAlice, errForbidden},
+		{"from a concept by an admin", "admin-node", fromConcept, nil},
+		{"from a concept by a steward", "alice-node", fromConcept, errForbidden},
+		{"from a concept by an unproven admin", "mallory-node", fromConcept, errForbidden},
+		{"unknown peer", "stranger", fromAlice, errForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.authorizePeerRelationship(tt.from, tt.rel)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := newTestSteward(t, s, "Alice")
+	ctx := context.Background()
+	_, stewardToken, err := s.auth.createToken(ctx, "alice", alice.SeedID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, adminToken, err := s.auth.createToken(ctx, "admin", defaultSteward(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	concept := map[string]string{"name": "Test Concept", "description": "", "type": "FundamentalConcept"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"anonymous read", http.MethodGet, "/concepts", "", nil, http.StatusOK},
+		{"anonymous write", http.MethodPost, "/concept", "", concept, http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/concepts", "ccn_nope", nil, http.StatusUnauthorized},
+		{"steward on admin route", http.MethodPost, "/concept", stewardToken, concept, http.StatusForbidden},
+		{"admin on admin route", http.MethodPost, "/concept", adminToken, concept, http.StatusOK},
+		{"webhooks are admin only to read", http.MethodGet, "/webhooks", stewardToken, nil, http.StatusForbidden},
+		{"old interact route", http.MethodGet, "/interact/some-id", stewardToken, nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, tt.method, tt.path, tt.token, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxBatchOperations = 1000
+
+var errEntityNotFound = errors.New("not found")
+
+// BatchOperation is one step of a batch. Create operations may name a Ref;
+// later operations use "$<ref>" wherever an ID is expected, in ID or in Data.
+type BatchOperation struct {
+	Op      string          `json:"op"`   // create, update or delete
+	Kind    string          `json:"kind"` // concept, seed or relationship
+	ID      string          `json:"id,omitempty"`
+	Ref     string          `json:"ref,omitempty"`
+	IfMatch CID             `json:"ifMatch,omitempty"` // current CID of a concept or seed
+	Cascade bool            `json:"cascade,omitempty"` // delete a concept's dependents too
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type BatchResult struct {
+	Op   string
+	Kind string
+	ID   string
+	Ref  string `json:",omitempty"`
+	CID  CID    `json:",omitempty"`
+}
+
+// BatchError reports the operation that made a batch fail
+type BatchError struct {
+	Index int
+	Op    BatchOperation
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op.Op, e.Op.Kind, e.Err)
+}
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// batch applies operations in order. They all take effect, with a single save
+// and a single peer publish, or none do.
+type batch struct {
+	*Server
+	ctx   context.Context
+	refs  map[string]string
+	unpin []CID // versions of deleted entities, unpinned once the batch commits
+}
+
+// resolveRefs replaces "$<ref>" strings with the IDs created earlier in the batch
+func (b *batch) resolveRefs(v any) any {
+	switch v := v.(type) {
+	case string:
+		if ref, ok := strings.CutPrefix(v, "$"); ok {
+			if id, ok := b.refs[ref]; ok {
+				return id
+			}
+		}
+		return v
+	case map[string]any:
+		for k, e := range v {
+			v[k] = b.resolveRefs(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = b.resolveRefs(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// data decodes an operation's data with references resolved
+func (b *batch) data(op BatchOperation, target any) error {
+	if len(op.Data) == 0 {
+		return fmt.Errorf("data is required")
+	}
+	var raw any
+	if err := json.Unmarshal(op.Data, &raw); err != nil {
+		return fmt.Errorf("invalid data: %v", err)
+	}
+	resolved, _ := json.Marshal(b.resolveRefs(raw))
+	if err := json.Unmarshal(resolved, target); err != nil {
+		return fmt.Errorf("invalid data: %v", err)
+	}
+	return nil
+}
+
+func (b *batch) apply(op BatchOperation) (*BatchResult, error) {
+	op.ID, _ = b.resolveRefs(op.ID).(string)
+	if op.Op != "create" && op.ID == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	if op.Ref != "" {
+		if op.Op != "create" {
+			return nil, fmt.Errorf("only create operations can define a ref")
+		}
+		if _, exists := b.refs[op.Ref]; exists {
+			return nil, fmt.Errorf("ref already defined: %s", op.Ref)
+		}
+	}
+
+	var result *BatchResult
+	var err error
+	switch op.Kind {
+	case "concept":
+		result, err = b.applyConcept(op)
+	case "seed":
+		result, err = b.applySeed(op)
+	case "relationship":
+		result, err = b.applyRelationship(op)
+	default:
+		return nil, fmt.Errorf("unknown kind %q", op.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Op, result.Kind, result.Ref = op.Op, op.Kind, op.Ref
+	if op.Ref != "" {
+		b.refs[op.Ref] = result.ID
+	}
+	return result, nil
+}
+
+func checkIfMatch(op BatchOperation, current CID) error {
+	if op.IfMatch != "" && op.IfMatch != current {
+		return fmt.Errorf("%w: current version is %s", errPreconditionFailed, current)
+	}
+	return nil
+}
+
+func (b *batch) applyConcept(op BatchOperation) (*BatchResult, error) {
+	if err := authorizeAdmin(b.ctx); err != nil {
+		return nil, err
+	}
+	guid := ConceptGUID(op.ID)
+	var existing *Concept
+	if op.Op != "create" {
+		concept, exists := b.concepts.Get(guid)
+		if !exists {
+			return nil, fmt.Errorf("concept %w: %s", errEntityNotFound, guid)
+		}
+		if err := checkIfMatch(op, concept.GetCID()); err != nil {
+			return nil, err
+		}
+		existing = concept
+	}
+
+	switch op.Op {
+	case "create":
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			ConceptType string `json:"type"`
+		}
+		if err := b.data(op, &req); err != nil {
+			return nil, err
+		}
+		if req.Name == "" {
+			return nil, fmt.Errorf("name is required")
+		}
+		if err := b.checkConceptName("", req.Name); err != nil {
+			return nil, err
+		}
+		concept := &Concept{
+			ID:            ConceptGUID(uuid.New().String()),
+			Name:          req.Name,
+			Description:   req.Description,
+			ConceptType:   req.ConceptType,
+			Timestamp:     time.Now(),
+			Relationships: []RelationshipGUID{},
+		}
+		if err := b.storeConcept(b.ctx, concept, peerID); err != nil {
+			return nil, err
+		}
+		return &BatchResult{ID: string(concept.ID), CID: concept.GetCID()}, nil
+
+	case "update":
+		var patch map[string]any
+		if err := b.data(op, &patch); err != nil {
+			return nil, err
+		}
+		original, err := entityDocument(existing)
+		if err != nil {
+			return nil, err
+		}
+		doc, _ := mergePatch(original, patch).(map[string]any)
+		patched, err := b.patchedConcept(existing, original, doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.storeConcept(b.ctx, patched, peerID); err != nil {
+			return nil, err
+		}
+		return &BatchResult{ID: string(guid), CID: patched.GetCID()}, nil
+
+	case "delete":
+		typed, seeds := b.conceptDependents(guid)
+		if (len(typed) > 0 || len(seeds) > 0) && !op.Cascade {
+			return nil, fmt.Errorf("concept is in use by %d relationships and %d seeds; set cascade to delete them", len(typed), len(seeds))
+		}
+		for _, seedID := range seeds {
+			seed, _, err := b.detachSeed(b.ctx, seedID)
+			if err != nil {
+				return nil, err
+			}
+			b.unpin = append(b.unpin, seed.GetCID())
+		}
+		concept, _, err := b.detachConcept(b.ctx, guid)
+		if err != nil {
+			return nil, err
+		}
+		b.unpin = append(b.unpin, concept.GetCID())
+		return &BatchResult{ID: string(guid)}, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+func (b *batch) applySeed(op BatchOperation) (*BatchResult, error) {
+	guid := SeedGUID(op.ID)
+	var existing Seed_i
+	if op.Op != "create" {
+		seed, exists := b.seeds.Get(guid)
+		if !exists {
+			return nil, fmt.Errorf("seed %w: %s", errEntityNotFound, guid)
+		}
+		if err := checkIfMatch(op, seed.GetCID()); err != nil {
+			return nil, err
+		}
+		existing = seed
+	}
+
+	generator := b.nursery()
+	switch op.Op {
+	case "create":
+		var data map[string]any
+		if err := b.data(op, &data); err != nil {
+			return nil, err
+		}
+		conceptID, ok := data["ConceptID"].(string)
+		if !ok {
+			return nil, fmt.Errorf("ConceptID is required")
+		}
+		seed, err := generator.CreateSeed(ConceptGUID(conceptID), data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create seed: %v", err)
+		}
+		if err := b.authorizeSeed(b.ctx, nil, seed); err != nil {
+			return nil, err
+		}
+		if err := b.storeSeed(b.ctx, seed, peerID); err != nil {
+			return nil, err
+		}
+		return &BatchResult{ID: string(seed.GetSeedID()), CID: seed.GetCID()}, nil
+
+	case "update":
+		var patch map[string]any
+		if err := b.data(op, &patch); err != nil {
+			return nil, err
+		}
+		original, err := entityDocument(existing)
+		if err != nil {
+			return nil, err
+		}
+		doc, _ := mergePatch(original, patch).(map[string]any)
+		if err := checkSeedDocID(guid, doc); err != nil {
+			return nil, err
+		}
+		patched, err := generator.ValidateSeed(existing, doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.authorizeSeed(b.ctx, existing, patched); err != nil {
+			return nil, err
+		}
+		patched.SetCID(existing.GetCID())
+		patched.GetCoreSeed().Timestamp = time.Now()
+		if err := b.storeSeed(b.ctx, patched, peerID); err != nil {
+			return nil, err
+		}
+		return &BatchResult{ID: string(guid), CID: patched.GetCID()}, nil
+
+	case "delete":
+		if err := b.authorizeSeed(b.ctx, existing, nil); err != nil {
+			return nil, err
+		}
+		seed, _, err := b.detachSeed(b.ctx, guid)
+		if err != nil {
+			return nil, err
+		}
+		b.unpin = append(b.unpin, seed.GetCID())
+		return &BatchResult{ID: string(guid)}, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+func (b *batch) applyRelationship(op BatchOperation) (*BatchResult, error) {
+	id := RelationshipGUID(op.ID)
+	var existing *Relationship
+	if op.Op != "create" {
+		relationship, exists := b.relationships.Get(id)
+		if !exists {
+			return nil, fmt.Errorf("relationship %w: %s", errEntityNotFound, id)
+		}
+		existing = relationship
+	}
+
+	switch op.Op {
+	case "create":
+		var req relationshipRequest
+		if err := b.data(op, &req); err != nil {
+			return nil, err
+		}
+		if err := b.validateRelationship(req.SourceID, req.TargetID, req.TypeID); err != nil {
+			return nil, err
+		}
+		if err := validateRelationshipProperties(req.TypeID, req.Properties); err != nil {
+			return nil, err
+		}
+		if err := b.authorizeRelationship(b.ctx, req.SourceID); err != nil {
+			return nil, err
+		}
+		if req.Properties == nil {
+			req.Properties = map[string]any{}
+		}
+		relationship := CreateRelationship(req.SourceID, req.TargetID, req.TypeID, req.Properties)
+		if err := b.putRelationship(b.ctx, relationship); err != nil {
+			return nil, err
+		}
+		b.linkRelationship(b.ctx, relationship)
+		return &BatchResult{ID: string(relationship.ID)}, nil
+
+	case "update":
+		var req relationshipRequest
+		if err := b.data(op, &req); err != nil {
+			return nil, err
+		}
+		req = mergeRelationshipRequest(existing, req)
+		if err := b.authorizeRelationship(b.ctx, existing.SourceID, req.SourceID); err != nil {
+			return nil, err
+		}
+		if _, err := b.changeRelationship(b.ctx, existing, req); err != nil {
+			return nil, err
+		}
+		return &BatchResult{ID: string(id)}, nil
+
+	case "delete":
+		if err := b.authorizeRelationship(b.ctx, existing.SourceID); err != nil {
+			return nil, err
+		}
+		b.removeRelationship(b.ctx, id)
+		return &BatchResult{ID: string(id)}, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// applyBatch runs the operations in order. If one fails, or the result cannot be
+// saved, the batch's changes are undone and the error is returned.
+func (s *Server) applyBatch(ctx context.Context, ops []BatchOperation) ([]*BatchResult, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	// The batch's changes are journaled: their events are kept back until it
+	// commits, and a failure undoes exactly them
+	ctx, changes := withJournal(ctx)
+	b := &batch{Server: s, ctx: ctx, refs: make(map[string]string)}
+
+	results := make([]*BatchResult, 0, len(ops))
+	for i, op := range ops {
+		result, err := b.apply(op)
+		if err == nil {
+			results = append(results, result)
+			continue
+		}
+		changes.rollback(ctx)
+		return nil, &BatchError{Index: i, Op: op, Err: err}
+	}
+
+	if err := s.persist(ctx); err != nil {
+		changes.rollback(ctx)
+		if err := s.persist(ctx); err != nil {
+			log.Printf("Failed to save restored state: %v", err)
+		}
+		return nil, fmt.Errorf("failed to save batch: %v", err)
+	}
+	changes.commit()
+	for _, cid := range b.unpin {
+		unpinHistory(ctx, cid)
+	}
+
+	s.announce()
+	return results, nil
+}
+
+func (s *Server) batch_h(c *gin.Context) {
+	var req struct {
+		Operations []BatchOperation `json:"operations"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch needs between 1 and %d operations", maxBatchOperations)})
+		return
+	}
+
+	results, err := s.applyBatch(c.Request.Context(), req.Operations)
+	var batchErr *BatchError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	case errors.As(err, &batchErr):
+		c.JSON(batchErrorStatus(err), gin.H{
+			"error":     batchErr.Error(),
+			"index":     batchErr.Index,
+			"operation": batchErr.Op,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// batchErrorStatus is the HTTP status that reports an error from applyBatch
+func batchErrorStatus(err error) int {
+	var batchErr *BatchError
+	switch {
+	case !errors.As(err, &batchErr):
+		return http.StatusInternalServerError
+	case errors.Is(err, errEntityNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, errConceptNameInUse):
+		return http.StatusConflict
+	case errors.Is(err, errSeedIDMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, errUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusUnprocessableEntity
+}
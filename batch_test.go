@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func batchOp(op, kind, id, ref string, data any) BatchOperation {
+	raw, _ := json.Marshal(data)
+	if data == nil {
+		raw = nil
+	}
+	return BatchOperation{Op: op, Kind: kind, ID: id, Ref: ref, Data: raw}
+}
+
+// graphState is what a failed batch must leave unchanged
+type graphState struct {
+	concepts      ConceptMap
+	relationships RelationshipMap
+	seq           uint64
+}
+
+func stateOf(s *Server) graphState {
+	return graphState{concepts: s.concepts.Snapshot(), relationships: s.relationships.Snapshot(), seq: s.events.Seq()}
+}
+
+func TestApplyBatch(t *testing.T) {
+	s, _ := newTestServer(t)
+	admin := asSteward(defaultSteward(), true)
+	technology := string(s.findConceptGUID("Technology"))
+	society := string(s.findConceptGUID("Society"))
+	influences := s.findConceptGUID("Influences")
+	componentOf := s.findConceptGUID("Component Of")
+	withSpec(t, &RelationshipTypeSpec{TypeID: componentOf, Name: "Component Of", MaxOut: 1})
+
+	results, err := s.applyBatch(admin, []BatchOperation{
+		batchOp("create", "concept", "", "tool", map[string]any{"name": "Tool", "type": "FundamentalConcept"}),
+		batchOp("create", "relationship", "", "", map[string]any{"sourceId": "$tool", "targetId": technology, "typeId": influences}),
+		batchOp("update", "concept", technology, "", map[string]any{"description": "Tools"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool, ok := s.concepts.Get(ConceptGUID(results[0].ID))
+	if !ok || tool.Name != "Tool" {
+		t.Fatalf("created concept %v not stored", results[0].ID)
+	}
+	if !reflect.DeepEqual(tool.Relationships, []RelationshipGUID{RelationshipGUID(results[1].ID)}) {
+		t.Errorf("created concept lists %v, want the batch's relationship", tool.Relationships)
+	}
+	if current, _ := s.concepts.Get(ConceptGUID(technology)); current.Description != "Tools" {
+		t.Errorf("updated description %q, want %q", current.Description, "Tools")
+	}
+
+	tests := []struct {
+		name  string
+		ops   []BatchOperation
+		index int
+	}{
+		{
+			name: "missing entity",
+			ops: []BatchOperation{
+				batchOp("create", "concept", "", "", map[string]any{"name": "Lost"}),
+				batchOp("update", "concept", "no-such-concept", "", map[string]any{"description": "x"}),
+			},
+			index: 1,
+		},
+		{
+			name: "cardinality",
+			ops: []BatchOperation{
+				batchOp("update", "concept", technology, "", map[string]any{"description": "Changed"}),
+				batchOp("create", "concept", "", "part", map[string]any{"name": "Part"}),
+				batchOp("create", "relationship", "", "", map[string]any{"sourceId": "$part", "targetId": technology, "typeId": componentOf}),
+				batchOp("create", "relationship", "", "", map[string]any{"sourceId": "$part", "targetId": society, "typeId": componentOf}),
+			},
+			index: 3,
+		},
+		{
+			name: "delete then fail",
+			ops: []BatchOperation{
+				batchOp("delete", "relationship", results[1].ID, "", nil),
+				batchOp("delete", "concept", results[0].ID, "", nil),
+				batchOp("frobnicate", "concept", technology, "", nil),
+			},
+			index: 2,
+		},
+		{
+			name: "invalid relationship property",
+			ops: []BatchOperation{
+				batchOp("update", "relationship", results[1].ID, "", map[string]any{"properties": map[string]any{"weight": 2}}),
+			},
+			index: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := stateOf(s)
+			_, err := s.applyBatch(admin, tt.ops)
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) {
+				t.Fatalf("got %v, want a batch error", err)
+			}
+			if batchErr.Index != tt.index {
+				t.Errorf("failed at operation %d, want %d: %v", batchErr.Index, tt.index, err)
+			}
+			after := stateOf(s)
+			if !reflect.DeepEqual(after.concepts, before.concepts) {
+				t.Error("concepts changed by a failed batch")
+			}
+			if !reflect.DeepEqual(after.relationships, before.relationships) {
+				t.Error("relationships changed by a failed batch")
+			}
+			if after.seq != before.seq {
+				t.Errorf("a failed batch published %d events", after.seq-before.seq)
+			}
+		})
+	}
+}
+
+func TestApplyBatchRemovesVersionsOnRollback(t *testing.T) {
+	s, mem := newTestServer(t)
+	technology := s.findConceptGUID("Technology")
+	before, _ := s.concepts.Get(technology)
+
+	_, err := s.applyBatch(asSteward(defaultSteward(), true), []BatchOperation{
+		batchOp("update", "concept", string(technology), "", map[string]any{"description": "Rewritten"}),
+		batchOp("update", "concept", "no-such-concept", "", map[string]any{}),
+	})
+	if err == nil {
+		t.Fatal("batch applied, want an error")
+	}
+	after, _ := s.concepts.Get(technology)
+	if after.GetCID() != before.GetCID() {
+		t.Errorf("concept at %s after rollback, want %s", after.GetCID(), before.GetCID())
+	}
+	var added CID
+	cids, _ := mem.List(context.Background())
+	for _, cid := range cids {
+		if content, err := loadVersion(context.Background(), cid); err == nil && content["Description"] == "Rewritten" {
+			added = cid
+		}
+	}
+	if added != "" {
+		t.Errorf("version %s of the rolled back update is still in the network", added)
+	}
+	if !mem.has(before.GetCID()) {
+		t.Errorf("version %s the concept went back to was removed", before.GetCID())
+	}
+}
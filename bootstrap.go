@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var networkNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// pubsubTopic is the topic peers exchange messages on, namespaced with the
+// network's name when it has one
+func pubsubTopic() string {
+	if nodeConfig.Network == "" {
+		return nodeConfig.Topic
+	}
+	return nodeConfig.Network + "/" + nodeConfig.Topic
+}
+
+// bootstrapNodes are the nodes the node dials when it starts. Unless set, these
+// are the public libp2p nodes, or none in a private network.
+func bootstrapNodes() []string {
+	if nodeConfig.Bootstrap == nil && !nodeConfig.Private {
+		return defaultBootstrapNodes
+	}
+	return nodeConfig.Bootstrap
+}
+
+func isPublicBootstrapNode(addr string) bool {
+	return slices.Contains(defaultBootstrapNodes, addr) || strings.Contains(addr, "bootstrap.libp2p.io")
+}
+
+// peerAddrID is the peer ID at the end of a /p2p/ multiaddr, or "" if it has none
+func peerAddrID(addr string) PeerID {
+	i := strings.LastIndex(addr, "/p2p/")
+	if !strings.HasPrefix(addr, "/") || i < 0 {
+		return ""
+	}
+	id := addr[i+len("/p2p/"):]
+	if id == "" || strings.Contains(id, "/") {
+		return ""
+	}
+	return PeerID(id)
+}
+
+// joinNetwork connects the node to its bootstrap nodes and static peers. A
+// private node also clears the IPFS daemon's own bootstrap list, so it does not
+// dial the public nodes the next time it starts either.
+func joinNetwork(ctx context.Context) error {
+	if nodeConfig.Private {
+		if err := network.RemoveBootstrapNodes(ctx); err != nil {
+			log.Printf("Failed to clear the IPFS bootstrap list: %v", err)
+		}
+	}
+	if err := network.Bootstrap(ctx, bootstrapNodes()); err != nil {
+		return err
+	}
+	for _, addr := range nodeConfig.StaticPeers {
+		if err := network.AddStaticPeer(ctx, addr); err != nil {
+			log.Printf("Failed to add static peer %s: %v", addr, err)
+		}
+	}
+	return nil
+}
+
+// acceptPeer tells whether messages from a peer are taken in. Denied peers
+// never are. With an allowlist, or in a private network, only the listed peers
+// and static peers are.
+func acceptPeer(id PeerID) bool {
+	if id == peerID {
+		return true
+	}
+	if slices.Contains(nodeConfig.DenyPeers, string(id)) {
+		return false
+	}
+	if len(nodeConfig.AllowPeers) == 0 && !nodeConfig.Private {
+		return true
+	}
+	if slices.Contains(nodeConfig.AllowPeers, string(id)) {
+		return true
+	}
+	return slices.ContainsFunc(nodeConfig.StaticPeers, func(addr string) bool { return peerAddrID(addr) == id })
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestPubsubTopic(t *testing.T) {
+	newTestServer(t)
+	if topic := pubsubTopic(); topic != "concept-list" {
+		t.Errorf("topic without a network is %q", topic)
+	}
+	nodeConfig.Network = "lab"
+	if topic := pubsubTopic(); topic != "lab/concept-list" {
+		t.Errorf("topic of network lab is %q", topic)
+	}
+}
+
+func TestJoinNetwork(t *testing.T) {
+	const static = "/ip4/10.0.0.2/tcp/4001/p2p/QmStatic"
+	tests := []struct {
+		name          string
+		private       bool
+		bootstrap     []string
+		wantBootstrap []string
+	}{
+		{"public", false, nil, defaultBootstrapNodes},
+		{"public with own nodes", false, []string{"/ip4/10.0.0.1/tcp/4001/p2p/QmOwn"}, []string{"/ip4/10.0.0.1/tcp/4001/p2p/QmOwn"}},
+		{"private", true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mem := newTestServer(t)
+			nodeConfig.Private = tt.private
+			nodeConfig.Bootstrap = tt.bootstrap
+			nodeConfig.StaticPeers = []string{static}
+			if err := joinNetwork(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(mem.bootstrapped, tt.wantBootstrap) {
+				t.Errorf("bootstrapped from %v, want %v", mem.bootstrapped, tt.wantBootstrap)
+			}
+			if mem.clearedBootstrap != tt.private {
+				t.Errorf("cleared the IPFS bootstrap list: %v", mem.clearedBootstrap)
+			}
+			if !slices.Equal(mem.staticPeers, []string{static}) {
+				t.Errorf("static peers %v", mem.staticPeers)
+			}
+		})
+	}
+}
+
+func TestAcceptPeer(t *testing.T) {
+	newTestServer(t)
+	tests := []struct {
+		name    string
+		private bool
+		allow   []string
+		deny    []string
+		id      PeerID
+		want    bool
+	}{
+		{"open network", false, nil, nil, "stranger", true},
+		{"denied", false, nil, []string{"stranger"}, "stranger", false},
+		{"allowlist", false, []string{"friend"}, nil, "stranger", false},
+		{"allowed", false, []string{"friend"}, nil, "friend", true},
+		{"denied over allowed", false, []string{"friend"}, []string{"friend"}, "friend", false},
+		{"private stranger", true, nil, nil, "stranger", false},
+		{"private static peer", true, nil, nil, "QmStatic", true},
+		{"this node", true, nil, []string{string(peerID)}, peerID, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeConfig.Private = tt.private
+			nodeConfig.AllowPeers = tt.allow
+			nodeConfig.DenyPeers = tt.deny
+			nodeConfig.StaticPeers = []string{"/ip4/10.0.0.2/tcp/4001/p2p/QmStatic"}
+			if got := acceptPeer(tt.id); got != tt.want {
+				t.Errorf("acceptPeer(%s) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceivedMessageFromDeniedPeer(t *testing.T) {
+	s, _ := newTestServer(t)
+	nodeConfig.DenyPeers = []string{"mallory-node"}
+	for _, id := range []PeerID{"mallory-node", "other-node"} {
+		data, _ := json.Marshal(PeerMessage{PeerID: id})
+		s.handleReceivedMessage(NetworkMessage{From: id, Data: data})
+	}
+	if peer, _ := s.peers.Get("mallory-node"); peer != nil {
+		t.Error("message from a denied peer taken in")
+	}
+	if peer, _ := s.peers.Get("other-node"); peer == nil {
+		t.Error("message from another peer dropped")
+	}
+}
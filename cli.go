@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"export": {
+		usage: "export -format graphml|dot|cytoscape|jsonld|turtle|yaml [-o file]",
+		run:   exportCommand,
+	},
+	"integrity": {
+		usage: "integrity [-repair]",
+		run:   integrityCommand,
+	},
+	"lint": {
+		usage: "lint [file]",
+		run:   lintCommand,
+	},
+	"replay": {
+		usage: "replay [-dry-run]",
+		run:   replayCommand,
+	},
+	"token": {
+		usage: "token [-name name] [-steward guid] [-admin]",
+		run:   tokenCommand,
+	},
+	"migrate": {
+		usage: "migrate [-dry-run] [-file ontology.yaml]",
+		run:   migrateCommand,
+	},
+}
+
+// runCommand dispatches CLI subcommands; it returns the process exit code
+func runCommand(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[0])
+		printUsage()
+		return 2
+	}
+
+	err := cmd.run(context.Background(), args[1:])
+	if stateStore != nil {
+		if closeErr := stateStore.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: [options] [command]")
+	fmt.Fprintln(os.Stderr, "Without a command the node starts. Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+// loadGraph reads the persisted concept graph and seeds without joining the
+// network. Commands that only read open the store read-only, so they can run
+// next to the node; the others need the node to be stopped.
+func loadGraph(ctx context.Context, readOnly bool) (*Server, error) {
+	network = NewIPFSShell(nodeConfig.IPFSAPI)
+	if err := openStateStore(ctx, nodeConfig.StoreDir, readOnly); err != nil {
+		if errors.Is(err, errStoreLocked) {
+			return nil, fmt.Errorf("%v: stop the node first, or make the change through its API", err)
+		}
+		return nil, err
+	}
+
+	var err error
+	if peerID, err = network.ID(ctx); err != nil {
+		return nil, err
+	}
+	peers := make(PeerMap)
+	if err := loadData(ctx, peerListPath, &peers); err != nil {
+		return nil, err
+	}
+	if _, ok := peers[peerID]; !ok {
+		return nil, fmt.Errorf("peer %s has no saved state", peerID)
+	}
+	loadOntologyState(ctx)
+
+	conceptCIDs := make(ConceptGUID2CIDMap)
+	if err := loadData(ctx, conceptID2CIDPath, &conceptCIDs); err != nil {
+		return nil, err
+	}
+	concepts := make(ConceptMap)
+	if err := loadData(ctx, conceptsPath, &concepts); err != nil {
+		return nil, err
+	}
+	relationships := make(RelationshipMap)
+	if err := loadData(ctx, relationshipsPath, &relationships); err != nil {
+		return nil, err
+	}
+
+	s := NewServer()
+	s.peers.Load(peers)
+	s.concepts.Load(concepts, conceptCIDs)
+	s.relationships.Load(relationships)
+	s.resolveSystemConcepts()
+	initDynamics()
+	loadInteractionLog(ctx)
+
+	seedCIDs := make(SeedGUID2CIDMap)
+	if err := loadData(ctx, seedID2CIDPath, &seedCIDs); err != nil {
+		return nil, err
+	}
+	seeds := make(SeedMap)
+	if err := loadData(ctx, seedsPath, &seeds); err != nil {
+		return nil, err
+	}
+	s.seeds.Load(seeds, seedCIDs)
+	return s, nil
+}
+
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+func exportCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "graphml", "output format: "+strings.Join(exportFormats(), ", "))
+	output := fs.String("o", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := loadGraph(ctx, true)
+	if err != nil {
+		return fmt.Errorf("failed to load graph: %v", err)
+	}
+
+	w, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return s.exportGraph(w, *format)
+}
+
+func exportFormats() []string {
+	formats := make([]string, 0, len(graphExporters))
+	for format := range graphExporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func migrateCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report the operations without applying them")
+	file := fs.String("file", nodeConfig.OntologyFile, "ontology file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := loadGraph(ctx, *dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to load graph: %v", err)
+	}
+
+	report, err := s.migrateOntology(ctx, *file, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Applied"
+	if *dryRun {
+		verb = "Would apply"
+	}
+	fmt.Printf("%s ontology version %d -> %d (%d operations)\n", verb, report.FromVersion, report.ToVersion, len(report.Operations))
+	for _, op := range report.Operations {
+		fmt.Printf("  %s\n", op)
+	}
+	return nil
+}
+
+func lintCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	file := nodeConfig.OntologyFile
+	if fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+
+	issues, err := lintOntologyFile(file)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s:%s\n", file, issue)
+	}
+	if hasLintErrors(issues) {
+		return fmt.Errorf("%s has errors", file)
+	}
+	return nil
+}
+
+func integrityCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("integrity", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "fix broken links instead of only reporting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := loadGraph(ctx, !*repair)
+	if err != nil {
+		return fmt.Errorf("failed to load graph: %v", err)
+	}
+
+	report := s.checkIntegrity(ctx, *repair)
+	for _, issue := range report.Issues {
+		fmt.Println(issue)
+	}
+	fmt.Printf("Checked %d relationships, %d concepts, %d seeds: %d issues, %d repaired\n",
+		report.Relationships, report.Concepts, report.Seeds, len(report.Issues), report.Repaired)
+	if len(report.Issues) > report.Repaired {
+		return fmt.Errorf("%d unrepaired issues", len(report.Issues)-report.Repaired)
+	}
+	return nil
+}
+
+func replayCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report the rebuilt metrics without saving them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := loadGraph(ctx, *dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to load graph: %v", err)
+	}
+
+	report := s.replayInteractions(ctx, *dryRun)
+	fmt.Printf("Replayed %d events for %d relationships: %d changed, %d missing\n",
+		report.Events, len(report.Relationships), len(report.Changed), len(report.Missing))
+	for _, id := range report.Changed {
+		d := report.Relationships[id]
+		fmt.Printf("  %s: energy flow %.4f, amplitude %.4f, volume %.4f, depth %d\n", id, d.EnergyFlow, d.Amplitude, d.Volume, d.Depth)
+	}
+	for _, id := range report.Missing {
+		fmt.Printf("  %s: relationship no longer exists\n", id)
+	}
+	return nil
+}
+
+// tokenCommand issues an API token, by default for the node's steward; with
+// -admin it replaces a lost bootstrap token
+func tokenCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	name := fs.String("name", "cli", "name to tell the token apart by")
+	steward := fs.String("steward", "", "steward the token acts for (default the node's steward)")
+	admin := fs.Bool("admin", false, "give the token admin rights")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := loadGraph(ctx, false)
+	if err != nil {
+		return fmt.Errorf("failed to load graph: %v", err)
+	}
+	guid := SeedGUID(*steward)
+	if guid == "" {
+		if err := loadData(ctx, stewardGUIDPath, &guid); err != nil {
+			return fmt.Errorf("failed to load steward ID: %v", err)
+		}
+	}
+	if seed, ok := s.seeds.Get(guid); !ok || seed.GetCoreSeed().ConceptID != StewardConcept {
+		return fmt.Errorf("%s is not a steward", guid)
+	}
+
+	s.auth.load(ctx, nil)
+	token, secret, err := s.auth.createToken(ctx, *name, guid, *admin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Token %s for steward %s (admin: %t):\n%s\n", token.ID, guid, token.Admin, secret)
+	return nil
+}
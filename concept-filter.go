@@ -31,20 +31,18 @@ func matchesConcept(concept Concept, filter ConceptFilter) bool {
 	return true
 }
 
-func filterConcepts(filter ConceptFilter) []Concept {
-	conceptMu.RLock()
-	defer conceptMu.RUnlock()
-
+func (s *Server) filterConcepts(filter ConceptFilter) []Concept {
+	all := s.concepts.Snapshot()
 	if isEmptyFilter(filter) {
-		concepts := make([]Concept, 0, len(conceptMap))
-		for _, concept := range conceptMap {
+		concepts := make([]Concept, 0, len(all))
+		for _, concept := range all {
 			concepts = append(concepts, *concept)
 		}
 		return concepts
 	}
 
 	var filteredConcepts []Concept
-	for _, concept := range conceptMap {
+	for _, concept := range all {
 		if matchesConcept(*concept, filter) {
 			filteredConcepts = append(filteredConcepts, *concept)
 		}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -9,26 +12,23 @@ import (
 	"github.com/google/uuid"
 )
 
-func getConcept_h(c *gin.Context) {
+func (s *Server) getConcept_h(c *gin.Context) {
 	guid := ConceptGUID(c.Param("guid"))
 
-	conceptMu.RLock()
-	concept, exists := conceptMap[guid]
-	conceptMu.RUnlock()
+	concept, exists := s.concepts.Get(guid)
 
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
 		return
 	}
+	c.Header("ETag", etag(concept.GetCID()))
 	c.JSON(http.StatusOK, concept)
 }
 
-func getConceptName_h(c *gin.Context) {
+func (s *Server) getConceptName_h(c *gin.Context) {
 	guid := ConceptGUID(c.Param("guid"))
 
-	conceptMu.RLock()
-	concept, exists := conceptMap[guid]
-	conceptMu.RUnlock()
+	concept, exists := s.concepts.Get(guid)
 
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
@@ -37,7 +37,10 @@ func getConceptName_h(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"name": concept.Name})
 }
 
-func addConcept_h(c *gin.Context) {
+func (s *Server) addConcept_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
 	var newConcept struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
@@ -58,14 +61,21 @@ func addConcept_h(c *gin.Context) {
 		Relationships: []RelationshipGUID{},
 	}
 
-	addNewConcept(c.Request.Context(), concept, peerID)
+	if err := s.addNewConcept(c.Request.Context(), concept, peerID); err != nil {
+		if errors.Is(err, errConceptNameInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add concept"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"guid": concept.ID,
 		"cid":  string(concept.CID),
 	})
 }
 
-func updateConcept_h(c *gin.Context) {
+func (s *Server) updateConcept_h(c *gin.Context) {
 	// Get the concept ID from the URL parameters
 	conceptID := ConceptGUID(c.Param("guid"))
 
@@ -82,61 +92,189 @@ func updateConcept_h(c *gin.Context) {
 		return
 	}
 
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
 	// Find the existing concept
-	conceptMu.Lock()
-	existingConcept, exists := conceptMap[conceptID]
-	conceptMu.Unlock()
+	existingConcept, exists := s.concepts.Get(conceptID)
 
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
 		return
 	}
+	if !ifMatch(c, existingConcept.GetCID()) {
+		preconditionFailed(c, existingConcept.GetCID(), existingConcept)
+		return
+	}
 
-	// Update the concept fields
-	existingConcept.Name = updatedConcept.Name
-	existingConcept.Description = updatedConcept.Description
-	existingConcept.ConceptType = updatedConcept.Type
-	existingConcept.Timestamp = time.Now()
+	// Update the concept fields on a copy; the stored concept stays as it is
+	concept := existingConcept.clone()
+	concept.Name = updatedConcept.Name
+	concept.Description = updatedConcept.Description
+	concept.ConceptType = updatedConcept.Type
+	concept.Timestamp = time.Now()
+	if err := s.checkConceptName(concept.ID, concept.Name); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Use the existing function to update the concept
-	err := addOrUpdateConcept(c.Request.Context(), existingConcept, peerID)
+	err := s.addOrUpdateConcept(c.Request.Context(), concept, peerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update concept"})
 		return
 	}
 
 	// Return the updated concept
+	c.Header("ETag", etag(concept.CID))
 	c.JSON(http.StatusOK, gin.H{
-		"guid": existingConcept.ID,
-		"cid":  string(existingConcept.CID),
+		"guid": concept.ID,
+		"cid":  string(concept.CID),
 	})
 }
 
-func deleteConcept_h(c *gin.Context) {
-	guid := ConceptGUID(c.Param("guid"))
+// Concept fields that only the server changes
+var immutableConceptFields = []string{"ID", "Relationships", "PreviousCID", "Version"}
 
-	conceptMu.Lock()
-	defer conceptMu.Unlock()
+var errConceptNameInUse = errors.New("concept name already in use")
 
-	concept, exists := conceptMap[guid]
+// checkConceptName returns errConceptNameInUse when another concept already has
+// the name
+func (s *Server) checkConceptName(id ConceptGUID, name string) error {
+	if other, ok := s.concepts.LookupName(name); ok && other != GUID(id) {
+		return fmt.Errorf("%w: %s", errConceptNameInUse, name)
+	}
+	return nil
+}
+
+// patchedConcept checks a changed concept document and returns the concept it
+// describes, ready to be stored in place of existing
+func (s *Server) patchedConcept(existing *Concept, original, doc map[string]any) (*Concept, error) {
+	if err := checkUnchanged(original, doc, immutableConceptFields...); err != nil {
+		return nil, err
+	}
+	var patched Concept
+	if err := decodeStrict(doc, &patched); err != nil {
+		return nil, err
+	}
+	if patched.Name == "" {
+		return nil, fmt.Errorf("Name is required")
+	}
+	if err := s.checkConceptName(existing.ID, patched.Name); err != nil {
+		return nil, err
+	}
+	patched.CID = existing.GetCID()
+	patched.Timestamp = time.Now()
+	return &patched, nil
+}
+
+// patchConcept_h changes a concept with a JSON Merge Patch (RFC 7386) or a JSON
+// Patch (RFC 6902); fields the patch leaves alone keep their values
+func (s *Server) patchConcept_h(c *gin.Context) {
+	conceptID := ConceptGUID(c.Param("guid"))
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	existingConcept, exists := s.concepts.Get(conceptID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
 		return
 	}
+	if !ifMatch(c, existingConcept.GetCID()) {
+		preconditionFailed(c, existingConcept.GetCID(), existingConcept)
+		return
+	}
 
-	if err := network.Remove(c.Request.Context(), concept.GetCID()); err != nil {
-		log.Printf("Failed to remove concept: %v", err)
+	original, err := entityDocument(existingConcept)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode concept"})
+		return
+	}
+	doc, err := applyPatch(original, c.ContentType(), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	patched, err := s.patchedConcept(existingConcept, original, doc)
+	if errors.Is(err, errConceptNameInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Invalid concept: %v", err)})
+		return
+	}
+
+	if err := s.addOrUpdateConcept(c.Request.Context(), patched, peerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update concept"})
+		return
 	}
-	delete(conceptMap, guid)
-	delete(conceptID2CID, guid)
-	if err := saveConcepts(c.Request.Context()); err != nil {
-		log.Printf("Failed to save concept map: %v", err)
+
+	c.Header("ETag", etag(patched.CID))
+	c.JSON(http.StatusOK, patched)
+}
+
+// deleteConcept_h removes a concept and every relationship it is an endpoint of.
+// A relationship type that is still in use, or a concept that seeds were created
+// from, is only deleted with ?cascade=true, which also removes those relationships
+// and seeds.
+func (s *Server) deleteConcept_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	guid := ConceptGUID(c.Param("guid"))
+
+	_, exists := s.concepts.Get(guid)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
+		return
 	}
 
+	typed, seeds := s.conceptDependents(guid)
+	if len(typed) > 0 || len(seeds) > 0 {
+		if c.Query("cascade") != "true" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "Concept is in use; pass cascade=true to delete its dependents",
+				"relationships": typed,
+				"seeds":         seeds,
+			})
+			return
+		}
+		for _, seedID := range seeds {
+			if _, err := s.removeSeed(c.Request.Context(), seedID); err != nil {
+				log.Printf("Failed to remove seed %s: %v", seedID, err)
+			}
+		}
+	}
+
+	if _, err := s.removeConcept(c.Request.Context(), guid); err != nil {
+		log.Printf("Failed to remove concept: %v", err)
+	}
+	s.persist(c.Request.Context())
+
 	c.Status(http.StatusNoContent)
 }
 
-func queryConcepts_h(c *gin.Context) {
+func (s *Server) queryConcepts_h(c *gin.Context) {
+	filter, err := conceptFilterQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	concepts := s.filterConcepts(filter)
+	c.JSON(http.StatusOK, concepts)
+}
+
+// conceptFilterQuery reads a concept filter from the query parameters
+func conceptFilterQuery(c *gin.Context) (ConceptFilter, error) {
 	filter := ConceptFilter{
 		CID:         CID(c.Query("cid")),
 		GUID:        ConceptGUID(c.Query("guid")),
@@ -148,12 +286,9 @@ func queryConcepts_h(c *gin.Context) {
 	if timestamp := c.Query("timestamp"); timestamp != "" {
 		t, err := time.Parse(time.RFC3339, timestamp)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timestamp format"})
-			return
+			return filter, fmt.Errorf("Invalid timestamp format")
 		}
 		filter.TimestampAfter = &t
 	}
-
-	concepts := filterConcepts(filter)
-	c.JSON(http.StatusOK, concepts)
+	return filter, nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestConceptNamesAreUnique(t *testing.T) {
+	s, _ := newTestServer(t)
+	_, adminToken, _ := s.auth.createToken(context.Background(), "admin", defaultSteward(), true)
+	technology := s.findConceptGUID("Technology")
+	society := s.findConceptGUID("Society")
+	before, _ := s.concepts.Get(technology)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"POST with a new name", http.MethodPost, "/concept", map[string]string{"name": "Robotics", "type": "FundamentalConcept"}, http.StatusOK},
+		{"POST with a name in use", http.MethodPost, "/concept", map[string]string{"name": "Society", "type": "FundamentalConcept"}, http.StatusConflict},
+		{"PUT keeping its own name", http.MethodPut, "/concept/" + string(technology), map[string]string{"name": "Technology", "description": "Tools", "type": before.ConceptType}, http.StatusOK},
+		{"PUT renaming to a name in use", http.MethodPut, "/concept/" + string(technology), map[string]string{"name": "Society", "type": before.ConceptType}, http.StatusConflict},
+		{"PATCH renaming to a name in use", http.MethodPatch, "/concept/" + string(technology), map[string]any{"Name": "Society"}, http.StatusConflict},
+		{"batch create with a name in use", http.MethodPost, "/batch", map[string]any{"operations": []BatchOperation{
+			batchOp("create", "concept", "", "", map[string]any{"name": "Society", "type": "FundamentalConcept"}),
+		}}, http.StatusConflict},
+		{"batch creating the same name twice", http.MethodPost, "/batch", map[string]any{"operations": []BatchOperation{
+			batchOp("create", "concept", "", "", map[string]any{"name": "Ethics", "type": "FundamentalConcept"}),
+			batchOp("create", "concept", "", "", map[string]any{"name": "Ethics", "type": "FundamentalConcept"}),
+		}}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, tt.method, tt.path, adminToken, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if guid, _ := s.concepts.LookupName("Society"); guid != GUID(society) {
+				t.Errorf("Society now names %s", guid)
+			}
+		})
+	}
+	if guid, ok := s.concepts.LookupName("Ethics"); ok {
+		t.Errorf("failed batch left Ethics as %s", guid)
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+const conceptStructurePath = "data/concepts_structure.yaml"
+
 type ConceptStructure struct {
+	Version       int                `yaml:"version,omitempty"`
 	Concepts      []ConceptNode      `yaml:"concepts"`
 	Relationships []RelationshipNode `yaml:"relationships"`
 }
@@ -22,6 +25,7 @@ type ConceptNode struct {
 	Type          string             `yaml:"type"`
 	Children      []ConceptNode      `yaml:"children,omitempty"`
 	Relationships []RelationshipType `yaml:"relationships,omitempty"`
+	RenamedFrom   []string           `yaml:"renamed_from,omitempty"`
 }
 
 type RelationshipType struct {
@@ -30,47 +34,41 @@ type RelationshipType struct {
 }
 
 type RelationshipNode struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description"`
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Domain      []string `yaml:"domain,omitempty"`  // concept types or names allowed as source
+	Range       []string `yaml:"range,omitempty"`   // concept types or names allowed as target
+	MaxOut      int      `yaml:"max_out,omitempty"` // most edges of this type per source, 0 is unlimited
+	MaxIn       int      `yaml:"max_in,omitempty"`  // most edges of this type per target, 0 is unlimited
+	Symmetric   bool     `yaml:"symmetric,omitempty"`
+	Inverse     string   `yaml:"inverse,omitempty"`
+	RenamedFrom []string `yaml:"renamed_from,omitempty"`
+
+	Properties map[string]PropertySchema `yaml:"properties,omitempty"`
 }
 
-var guidMap = make(map[string]GUID)
-
-func generateGUID(ctx context.Context, name string) GUID {
-	if guid, exists := guidMap[name]; exists {
+func (s *Server) generateGUID(ctx context.Context, name string) GUID {
+	if guid, exists := s.concepts.LookupName(name); exists {
 		return guid
 	}
 	guid, err := network.Add(ctx, strings.NewReader(name))
 	if err != nil {
 		log.Fatalf("Failed to generate GUID: %v", err)
 	}
-	guidMap[name] = GUID(guid)
+	s.concepts.SetName(name, GUID(guid))
 	return GUID(guid)
 }
 
-func findGUID(name string) GUID {
-	if guid, exists := guidMap[name]; exists {
+func (s *Server) findGUID(name string) GUID {
+	if guid, exists := s.concepts.LookupName(name); exists {
 		return guid
 	}
 	log.Fatalf("GUID for Concept '%s' not found.", name)
 	return ""
 }
 
-func findConceptGUID(name string) ConceptGUID {
-	return ConceptGUID(findGUID(name))
-}
-
-func (guid GUID) findName() string {
-	for name, nameGuid := range guidMap {
-		if guid == nameGuid {
-			return name
-		}
-	}
-	return ""
-}
-
-func (guid EntityGUID) findName() string {
-	return GUID(guid).findName()
+func (s *Server) findConceptGUID(name string) ConceptGUID {
+	return ConceptGUID(s.findGUID(name))
 }
 
 func parseConceptStructure(filename string) (*ConceptStructure, error) {
@@ -88,8 +86,8 @@ func parseConceptStructure(filename string) (*ConceptStructure, error) {
 	return &structure, nil
 }
 
-func createConcepts(ctx context.Context, node ConceptNode, parentGUID ConceptGUID) (*Concept, error) {
-	guid := ConceptGUID(generateGUID(ctx, node.Name))
+func (s *Server) createConcepts(ctx context.Context, node ConceptNode, parentGUID ConceptGUID) (*Concept, error) {
+	guid := ConceptGUID(s.generateGUID(ctx, node.Name))
 	concept := &Concept{
 		ID:          guid,
 		Name:        node.Name,
@@ -99,32 +97,37 @@ func createConcepts(ctx context.Context, node ConceptNode, parentGUID ConceptGUI
 	}
 
 	if len(node.Children) > 0 || parentGUID != "" {
-		err := addOrUpdateConcept(ctx, concept, peerID)
+		err := s.addOrUpdateConcept(ctx, concept, peerID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to add or update concept %s: %v", node.Name, err)
 		}
 	}
 
 	if parentGUID != "" {
-		componentOfRelationType := findConceptGUID("Component Of")
+		componentOfRelationType := s.findConceptGUID("Component Of")
 		if componentOfRelationType == "" {
 			return nil, fmt.Errorf("'Component Of' relationship type not found")
 		}
 
 		relationship := CreateRelationship(EntityGUID(guid), EntityGUID(parentGUID), componentOfRelationType, nil)
-		if err := addOrUpdateRelationship(ctx, relationship); err != nil {
+		if err := s.addOrUpdateRelationship(ctx, relationship); err != nil {
 			return nil, fmt.Errorf("failed to create 'Component Of' relationship for %s: %v", node.Name, err)
 		}
+		s.linkRelationship(ctx, relationship)
 	}
 
 	for _, child := range node.Children {
-		_, err := createConcepts(ctx, child, guid)
+		_, err := s.createConcepts(ctx, child, guid)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err := addOrUpdateConcept(ctx, concept, peerID)
+	// Store the concept again with the relationships its children linked
+	if current, ok := s.concepts.Get(guid); ok {
+		concept = current.clone()
+	}
+	err := s.addOrUpdateConcept(ctx, concept, peerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add or update concept %s: %v", node.Name, err)
 	}
@@ -132,23 +135,22 @@ func createConcepts(ctx context.Context, node ConceptNode, parentGUID ConceptGUI
 	return concept, nil
 }
 
-func createRelationships(ctx context.Context, node ConceptNode) error {
-	sourceGUID := EntityGUID(generateGUID(ctx, node.Name))
+func (s *Server) createRelationships(ctx context.Context, node ConceptNode) error {
+	sourceGUID := EntityGUID(s.generateGUID(ctx, node.Name))
 	for _, rel := range node.Relationships {
-		targetGUID := EntityGUID(generateGUID(ctx, rel.Target))
-		relTypeGUID := ConceptGUID(generateGUID(ctx, rel.Type))
-		c := relTypeGUID.AsConcept()
-		if c == nil {
-			log.Fatalf("Type Description missing: %s in %s\n", rel.Type, node.Name)
+		targetGUID := EntityGUID(s.generateGUID(ctx, rel.Target))
+		relTypeGUID := ConceptGUID(s.generateGUID(ctx, rel.Type))
+		if _, ok := s.concepts.Get(relTypeGUID); !ok {
+			return fmt.Errorf("relationship type %s used by %s is not defined", rel.Type, node.Name)
 		}
-		err := createCoreRelationship(ctx, sourceGUID, relTypeGUID, targetGUID)
+		err := s.createCoreRelationship(ctx, sourceGUID, relTypeGUID, targetGUID)
 		if err != nil {
 			return fmt.Errorf("failed to create relationship %s -> %s -> %s: %v", node.Name, rel.Type, rel.Target, err)
 		}
 	}
 
 	for _, child := range node.Children {
-		err := createRelationships(ctx, child)
+		err := s.createRelationships(ctx, child)
 		if err != nil {
 			return err
 		}
@@ -157,7 +159,18 @@ func createRelationships(ctx context.Context, node ConceptNode) error {
 	return nil
 }
 
-func BootstrapFromStructure(ctx context.Context, filename string) error {
+func (s *Server) BootstrapFromStructure(ctx context.Context, filename string) error {
+	issues, err := lintOntologyFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to lint concept structure: %v", err)
+	}
+	for _, issue := range issues {
+		log.Printf("%s:%s\n", filename, issue)
+	}
+	if hasLintErrors(issues) {
+		return fmt.Errorf("concept structure %s has errors", filename)
+	}
+
 	structure, err := parseConceptStructure(filename)
 	if err != nil {
 		return fmt.Errorf("failed to parse concept structure: %v", err)
@@ -166,13 +179,13 @@ func BootstrapFromStructure(ctx context.Context, filename string) error {
 	// Create relationship types
 	for _, rel := range structure.Relationships {
 		relationship := &Concept{
-			ID:          ConceptGUID(generateGUID(ctx, rel.Name)),
+			ID:          ConceptGUID(s.generateGUID(ctx, rel.Name)),
 			Name:        rel.Name,
 			Description: rel.Description,
 			ConceptType: "RelationshipType",
 			Timestamp:   time.Now(),
 		}
-		err := addOrUpdateConcept(ctx, relationship, peerID)
+		err := s.addOrUpdateConcept(ctx, relationship, peerID)
 		if err != nil {
 			return fmt.Errorf("failed to add relationship type %s: %v", rel.Name, err)
 		}
@@ -180,7 +193,7 @@ func BootstrapFromStructure(ctx context.Context, filename string) error {
 
 	// First pass: create all concepts
 	for _, node := range structure.Concepts {
-		_, err := createConcepts(ctx, node, "")
+		_, err := s.createConcepts(ctx, node, "")
 		if err != nil {
 			return fmt.Errorf("failed to create concept %s: %v", node.Name, err)
 		}
@@ -188,62 +201,65 @@ func BootstrapFromStructure(ctx context.Context, filename string) error {
 
 	// Second pass: create relationships
 	for _, node := range structure.Concepts {
-		err := createRelationships(ctx, node)
+		err := s.createRelationships(ctx, node)
 		if err != nil {
 			return fmt.Errorf("failed to create relationships for concept %s: %v", node.Name, err)
 		}
 	}
 
-	log.Printf("Bootstrapped %d concepts and %d relationship types", len(guidMap)-len(structure.Relationships), len(structure.Relationships))
+	log.Printf("Bootstrapped %d concepts and %d relationship types", s.concepts.Len()-len(structure.Relationships), len(structure.Relationships))
 	return nil
 }
 
-func createCoreRelationship(ctx context.Context, sourceGUID EntityGUID, relationshipTypeGUID ConceptGUID, targetGUID EntityGUID) error {
-	relationshipID := RelationshipGUID(generateGUID(ctx, fmt.Sprintf("%s-%s-%s", sourceGUID, relationshipTypeGUID, targetGUID)))
+func (s *Server) createCoreRelationship(ctx context.Context, sourceGUID EntityGUID, relationshipTypeGUID ConceptGUID, targetGUID EntityGUID) error {
+	relationshipID := RelationshipGUID(s.generateGUID(ctx, fmt.Sprintf("%s-%s-%s", sourceGUID, relationshipTypeGUID, targetGUID)))
 
 	relationship := &Relationship{
-		ID:       relationshipID,
-		SourceID: sourceGUID,
-		TargetID: targetGUID,
-		Type:     relationshipTypeGUID,
-		// EnergyFlow:      1.0,
-		// FrequencySpec:   []float64{1.0},
-		// Amplitude:       1.0,
-		// Volume:          1.0,
-		// Depth:           1,
-		// Interactions:    0,
-		// LastInteraction: time.Now(),
+		ID:        relationshipID,
+		SourceID:  sourceGUID,
+		TargetID:  targetGUID,
+		Type:      relationshipTypeGUID,
 		Timestamp: time.Now(),
 	}
 
-	relationshipMu.Lock()
-	relationshipMap[relationshipID] = relationship
-	relationshipMu.Unlock()
+	s.relationships.Put(ctx, relationship)
 
 	// Update the relationships for the source and target concepts
-	sourceConcept, exists := conceptMap[ConceptGUID(sourceGUID)]
-	if !exists {
-		return fmt.Errorf("source concept with GUID %s => (%s) not found", sourceGUID, sourceGUID.findName())
+	addRelationship := func(concept *Concept) error {
+		if !hasRelationship(concept.Relationships, relationshipID) {
+			concept.Relationships = append(concept.Relationships, relationshipID)
+		}
+		return nil
 	}
-	sourceConcept.Relationships = append(sourceConcept.Relationships, relationshipID)
-
-	targetConcept, exists := conceptMap[ConceptGUID(targetGUID)]
-	if !exists {
-		return fmt.Errorf("target concept with GUID %s => (%s) not found", targetGUID, targetGUID.findName())
+	if err := s.concepts.Update(ctx, ConceptGUID(sourceGUID), addRelationship); err != nil {
+		return fmt.Errorf("source concept with GUID %s => (%s) not found", sourceGUID, s.concepts.NameOf(GUID(sourceGUID)))
+	}
+	if err := s.concepts.Update(ctx, ConceptGUID(targetGUID), addRelationship); err != nil {
+		return fmt.Errorf("target concept with GUID %s => (%s) not found", targetGUID, s.concepts.NameOf(GUID(targetGUID)))
 	}
-	targetConcept.Relationships = append(targetConcept.Relationships, relationshipID)
 
 	return nil
 }
 
-func InitializeSystem(ctx context.Context) error {
+func (s *Server) InitializeSystem(ctx context.Context) error {
 	log.Println("Bootstrapping concepts and relationships...")
 
-	if err := BootstrapFromStructure(ctx, "data/concepts_structure.yaml"); err != nil {
+	if err := s.BootstrapFromStructure(ctx, nodeConfig.OntologyFile); err != nil {
 		log.Printf("Error during bootstrapping concepts: %v\n", err)
 		return err
 	}
 
+	structure, hash, err := readOntology(nodeConfig.OntologyFile)
+	if err != nil {
+		return err
+	}
+	ontologyMu.Lock()
+	err = recordOntology(ctx, structure, hash, nil)
+	ontologyMu.Unlock()
+	if err != nil {
+		log.Printf("Failed to record ontology state: %v\n", err)
+	}
+
 	log.Println("Concepts and relationships bootstrapped successfully")
 	return nil
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+const componentOfRelationship = "Component Of"
+
+// buildConceptStructure converts the live concept graph back into the
+// ConceptStructure read by BootstrapFromStructure. A concept with exactly one
+// "Component Of" parent is nested under it as a child; every other edge is
+// written to the concept's relationships list, so bootstrapping the result
+// recreates the same graph.
+func (s *Server) buildConceptStructure() *ConceptStructure {
+	ds := s.snapshotConcepts()
+
+	concepts := make(map[ConceptGUID]*Concept)
+	for _, c := range ds.Concepts {
+		concepts[c.ID] = c
+	}
+	byAge := func(list []*Concept) {
+		sort.SliceStable(list, func(i, j int) bool {
+			if !list[i].Timestamp.Equal(list[j].Timestamp) {
+				return list[i].Timestamp.Before(list[j].Timestamp)
+			}
+			return list[i].Name < list[j].Name
+		})
+	}
+
+	ontologyMu.Lock()
+	structure := &ConceptStructure{Version: ontologyState.Version}
+	ontologyMu.Unlock()
+	var relTypes []*Concept
+	var componentOf ConceptGUID
+	for _, c := range ds.Concepts {
+		if c.ConceptType == relationshipTypeConceptType {
+			relTypes = append(relTypes, c)
+			if c.Name == componentOfRelationship {
+				componentOf = c.ID
+			}
+		}
+	}
+	byAge(relTypes)
+	for _, c := range relTypes {
+		node := RelationshipNode{Name: c.Name, Description: c.Description}
+		if spec := relationshipTypeSpec(c.ID); spec != nil {
+			node.Domain = spec.Domain
+			node.Range = spec.Range
+			node.MaxOut = spec.MaxOut
+			node.MaxIn = spec.MaxIn
+			node.Symmetric = spec.Symmetric
+			node.Properties = spec.Properties
+			if inverse, ok := concepts[spec.Inverse]; ok {
+				node.Inverse = inverse.Name
+			}
+		}
+		structure.Relationships = append(structure.Relationships, node)
+	}
+
+	// Only edges between ontology concepts belong in the structure file
+	outgoing := make(map[ConceptGUID][]*Relationship)
+	for _, r := range ds.Relationships {
+		source, ok1 := concepts[ConceptGUID(r.SourceID)]
+		target, ok2 := concepts[ConceptGUID(r.TargetID)]
+		_, ok3 := concepts[r.Type]
+		if !ok1 || !ok2 || !ok3 || source.ConceptType == relationshipTypeConceptType || target.ConceptType == relationshipTypeConceptType {
+			continue
+		}
+		outgoing[source.ID] = append(outgoing[source.ID], r)
+	}
+	for _, rels := range outgoing {
+		sort.SliceStable(rels, func(i, j int) bool {
+			if !rels[i].Timestamp.Equal(rels[j].Timestamp) {
+				return rels[i].Timestamp.Before(rels[j].Timestamp)
+			}
+			if rels[i].Type != rels[j].Type {
+				return concepts[rels[i].Type].Name < concepts[rels[j].Type].Name
+			}
+			return concepts[ConceptGUID(rels[i].TargetID)].Name < concepts[ConceptGUID(rels[j].TargetID)].Name
+		})
+	}
+
+	parentOf := make(map[ConceptGUID]ConceptGUID)
+	parentEdge := make(map[ConceptGUID]RelationshipGUID)
+	if componentOf != "" {
+		for id, rels := range outgoing {
+			var parents []*Relationship
+			for _, r := range rels {
+				if r.Type == componentOf {
+					parents = append(parents, r)
+				}
+			}
+			if len(parents) == 1 {
+				parentOf[id] = ConceptGUID(parents[0].TargetID)
+				parentEdge[id] = parents[0].ID
+			}
+		}
+		// Break "Component Of" cycles by leaving the cycle's edges as plain relationships
+		for id := range parentOf {
+			seen := map[ConceptGUID]bool{id: true}
+			for p, ok := parentOf[id]; ok; p, ok = parentOf[p] {
+				if seen[p] {
+					delete(parentOf, id)
+					delete(parentEdge, id)
+					break
+				}
+				seen[p] = true
+			}
+		}
+	}
+
+	children := make(map[ConceptGUID][]*Concept)
+	var roots []*Concept
+	for _, c := range ds.Concepts {
+		if c.ConceptType == relationshipTypeConceptType {
+			continue
+		}
+		if parent, ok := parentOf[c.ID]; ok {
+			children[parent] = append(children[parent], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	var build func(c *Concept) ConceptNode
+	build = func(c *Concept) ConceptNode {
+		node := ConceptNode{Name: c.Name, Description: c.Description, Type: c.ConceptType}
+		kids := children[c.ID]
+		byAge(kids)
+		for _, child := range kids {
+			node.Children = append(node.Children, build(child))
+		}
+		for _, r := range outgoing[c.ID] {
+			if r.ID == parentEdge[c.ID] {
+				continue
+			}
+			node.Relationships = append(node.Relationships, RelationshipType{
+				Type:   concepts[r.Type].Name,
+				Target: concepts[ConceptGUID(r.TargetID)].Name,
+			})
+		}
+		return node
+	}
+
+	byAge(roots)
+	for _, c := range roots {
+		structure.Concepts = append(structure.Concepts, build(c))
+	}
+	return structure
+}
+
+func (s *Server) exportYAML(w io.Writer) error {
+	data, err := yaml.Marshal(s.buildConceptStructure())
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML: %v", err)
+	}
+	if _, err := io.WriteString(w, "# Generated from the live concept graph\n"); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestExportYAMLRoundTrip checks that exporting a node bootstrapped from the
+// shipped ontology writes the same ontology back
+func TestExportYAMLRoundTrip(t *testing.T) {
+	s, _ := newTestServer(t)
+	shipped, _, err := readOntology(conceptStructurePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.exportYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var exported ConceptStructure
+	if err := yaml.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.Version != shipped.Version {
+		t.Errorf("version %d, want %d", exported.Version, shipped.Version)
+	}
+
+	want, got := flattenStructure(shipped), flattenStructure(&exported)
+	sameSet(t, "relationship type", describeConcepts(want.types), describeConcepts(got.types))
+	sameSet(t, "concept", describeConcepts(want.concepts), describeConcepts(got.concepts))
+	_, _, wantEdges := want.names()
+	_, _, gotEdges := got.names()
+	sameSet(t, "edge", wantEdges, gotEdges)
+
+	for _, rel := range shipped.Relationships {
+		i := slices.IndexFunc(exported.Relationships, func(node RelationshipNode) bool { return node.Name == rel.Name })
+		if i < 0 {
+			continue // reported above
+		}
+		rel.RenamedFrom = nil
+		if node := exported.Relationships[i]; !reflect.DeepEqual(node, rel) {
+			t.Errorf("relationship type exported as %+v, want %+v", node, rel)
+		}
+	}
+}
+
+// TestExportYAMLNesting checks that only a concept with one "Component Of"
+// parent is nested, and that its other edges stay relationships
+func TestExportYAMLNesting(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	ids := newConcepts(t, s, "Leaf", "Twig", "Branch", "Trunk")
+	leaf, twig, branch, trunk := ids[0], ids[1], ids[2], ids[3]
+	componentOf := s.findConceptGUID(componentOfRelationship)
+	influences := s.findConceptGUID("Influences")
+	for _, r := range []*Relationship{
+		CreateRelationship(leaf, twig, componentOf, nil),
+		CreateRelationship(leaf, trunk, influences, nil),
+		CreateRelationship(branch, twig, componentOf, nil),
+		CreateRelationship(branch, trunk, componentOf, nil),
+	} {
+		if err := s.putRelationship(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	structure := s.buildConceptStructure()
+	find := func(nodes []ConceptNode, name string) *ConceptNode {
+		for i := range nodes {
+			if nodes[i].Name == name {
+				return &nodes[i]
+			}
+		}
+		return nil
+	}
+	twigNode := find(structure.Concepts, "Twig")
+	if twigNode == nil {
+		t.Fatal("Twig, which has no parent, is not a root")
+	}
+	leafNode := find(twigNode.Children, "Leaf")
+	if leafNode == nil {
+		t.Fatal("Leaf not nested under its one parent")
+	}
+	if !slices.Equal(leafNode.Relationships, []RelationshipType{{Type: "Influences", Target: "Trunk"}}) {
+		t.Errorf("Leaf relationships %+v", leafNode.Relationships)
+	}
+	branchNode := find(structure.Concepts, "Branch")
+	if branchNode == nil || len(branchNode.Relationships) != 2 {
+		t.Errorf("Branch, which has two parents, exported as %+v", branchNode)
+	}
+}
+
+func describeConcepts(concepts []ontologyConcept) []string {
+	var described []string
+	for _, c := range concepts {
+		described = append(described, c.Type+" "+c.Name+": "+c.Description)
+	}
+	return described
+}
+
+func sameSet(t *testing.T, what string, want, got []string) {
+	t.Helper()
+	for _, w := range want {
+		if !slices.Contains(got, w) {
+			t.Errorf("%s %q missing", what, w)
+		}
+	}
+	for _, g := range got {
+		if !slices.Contains(want, g) {
+			t.Errorf("%s %q not in the shipped ontology", what, g)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const configFileEnv = "CCN_CONFIG"
+
+// NodeConfig holds the settings a node runs with. They come from the defaults,
+// then a YAML file, then CCN_* environment variables, then command-line flags;
+// each layer overrides the ones before it.
+type NodeConfig struct {
+	IPFSAPI            string        `yaml:"ipfs_api"`
+	Listen             string        `yaml:"listen"`
+	Topic              string        `yaml:"topic"`
+	Network            string        `yaml:"network"` // namespaces the topic so separate networks do not hear each other
+	PublishInterval    time.Duration `yaml:"publish_interval"`
+	PeerCheckInterval  time.Duration `yaml:"peer_check_interval"`
+	CompactInterval    time.Duration `yaml:"compact_interval"`
+	PeerStaleAfter     time.Duration `yaml:"peer_stale_after"`
+	PeerOfflineAfter   time.Duration `yaml:"peer_offline_after"`
+	PeerEvictAfter     time.Duration `yaml:"peer_evict_after"`
+	Bootstrap          []string      `yaml:"bootstrap"` // multiaddrs; unset means the public nodes unless private
+	Private            bool          `yaml:"private"`
+	StaticPeers        []string      `yaml:"static_peers"`
+	AllowPeers         []string      `yaml:"allow_peers"`
+	DenyPeers          []string      `yaml:"deny_peers"`
+	OntologyFile       string        `yaml:"ontology_file"`
+	DynamicsFile       string        `yaml:"dynamics_file"`
+	StoreDir           string        `yaml:"store_dir"`
+	MFSRoot            string        `yaml:"mfs_root"` // where state was kept in IPFS MFS before the state store
+	CORSOrigins        []string      `yaml:"cors_origins"`
+	AdminStewards      []string      `yaml:"admin_stewards"`
+	StewardName        string        `yaml:"steward_name"` // of the seed created for a new default steward; empty creates none
+	StewardDescription string        `yaml:"steward_description"`
+}
+
+var defaultBootstrapNodes = []string{
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa",
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb",
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+}
+
+func defaultConfig() NodeConfig {
+	return NodeConfig{
+		IPFSAPI:            "localhost:5001",
+		Listen:             ":9090",
+		Topic:              "concept-list",
+		PublishInterval:    1 * time.Minute,
+		PeerCheckInterval:  5 * time.Minute,
+		CompactInterval:    10 * time.Minute,
+		PeerStaleAfter:     3 * time.Minute,
+		PeerOfflineAfter:   15 * time.Minute,
+		PeerEvictAfter:     7 * 24 * time.Hour,
+		OntologyFile:       conceptStructurePath,
+		DynamicsFile:       dynamicsConfigPath,
+		StoreDir:           defaultStoreDir,
+		MFSRoot:            "/ccn",
+		StewardName:        "Urs Muff",
+		StewardDescription: "Creator of this network",
+	}
+}
+
+// nodeConfig is the configuration in effect; main replaces the defaults with
+// what loadConfig reads before anything else runs
+var nodeConfig = defaultConfig()
+
+// configSetting is a setting that can be given as a flag or an environment
+// variable
+type configSetting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *NodeConfig, value string) error
+}
+
+var configSettings = []configSetting{
+	{"ipfs-api", "CCN_IPFS_API", "address of the IPFS HTTP API", func(c *NodeConfig, v string) error {
+		c.IPFSAPI = v
+		return nil
+	}},
+	{"listen", "CCN_LISTEN", "address the HTTP API listens on", func(c *NodeConfig, v string) error {
+		c.Listen = v
+		return nil
+	}},
+	{"topic", "CCN_TOPIC", "pubsub topic peers exchange messages on", func(c *NodeConfig, v string) error {
+		c.Topic = v
+		return nil
+	}},
+	{"network", "CCN_NETWORK", "network name the topic is namespaced with", func(c *NodeConfig, v string) error {
+		c.Network = v
+		return nil
+	}},
+	{"publish-interval", "CCN_PUBLISH_INTERVAL", "how often the node announces itself", func(c *NodeConfig, v string) error {
+		return parseDuration(&c.PublishInterval, v)
+	}},
+	{"peer-check-interval", "CCN_PEER_CHECK_INTERVAL", "how often the node looks for peers", func(c *NodeConfig, v string) error {
+		return parseDuration(&c.PeerCheckInterval, v)
+	}},
+	{"compact-interval", "CCN_COMPACT_INTERVAL", "how often the state store is compacted", func(c *NodeConfig, v string) error {
+		return parseDuration(&c.CompactInterval, v)
+	}},
+	{"peer-stale-after", "CCN_PEER_STALE_AFTER", "silence after which a peer is stale", func(c *NodeConfig, v string) error {
+		return parseDuration(&c.PeerStaleAfter, v)
+	}},
+	{"peer-offline-after", "CCN_PEER_OFFLINE_AFTER", "silence after which a peer is offline", func(c *NodeConfig, v string) error {
+		return parseDuration(&c.PeerOfflineAfter, v)
+	}},
+	{"peer-evict-after", "CCN_PEER_EVICT_AFTER", "silence after which a peer is forgotten", func(c *NodeConfig, v string) error {
+		return parseDuration(&c.PeerEvictAfter, v)
+	}},
+	{"bootstrap", "CCN_BOOTSTRAP", "comma-separated bootstrap multiaddrs; empty for none", func(c *NodeConfig, v string) error {
+		c.Bootstrap = parseList(v)
+		return nil
+	}},
+	{"private", "CCN_PRIVATE", "never contact public bootstrap nodes and accept only known peers", func(c *NodeConfig, v string) error {
+		private, err := strconv.ParseBool(v)
+		c.Private = private
+		return err
+	}},
+	{"static-peers", "CCN_STATIC_PEERS", "comma-separated multiaddrs of peers to stay connected to", func(c *NodeConfig, v string) error {
+		c.StaticPeers = parseList(v)
+		return nil
+	}},
+	{"allow-peers", "CCN_ALLOW_PEERS", "comma-separated peer IDs whose messages are accepted", func(c *NodeConfig, v string) error {
+		c.AllowPeers = parseList(v)
+		return nil
+	}},
+	{"deny-peers", "CCN_DENY_PEERS", "comma-separated peer IDs whose messages are dropped", func(c *NodeConfig, v string) error {
+		c.DenyPeers = parseList(v)
+		return nil
+	}},
+	{"ontology-file", "CCN_ONTOLOGY_FILE", "ontology YAML file", func(c *NodeConfig, v string) error {
+		c.OntologyFile = v
+		return nil
+	}},
+	{"dynamics-file", "CCN_DYNAMICS_FILE", "relationship dynamics rules", func(c *NodeConfig, v string) error {
+		c.DynamicsFile = v
+		return nil
+	}},
+	{"store-dir", "CCN_STORE_DIR", "directory of the state store", func(c *NodeConfig, v string) error {
+		c.StoreDir = v
+		return nil
+	}},
+	{"mfs-root", "CCN_MFS_ROOT", "IPFS MFS directory state is migrated from", func(c *NodeConfig, v string) error {
+		c.MFSRoot = v
+		return nil
+	}},
+	{"cors-origins", "CCN_CORS_ORIGINS", "comma-separated origins allowed to call the API, or *", func(c *NodeConfig, v string) error {
+		c.CORSOrigins = parseOrigins(v)
+		return nil
+	}},
+	{"admin-stewards", "CCN_ADMIN_STEWARDS", "comma-separated steward GUIDs with admin rights", func(c *NodeConfig, v string) error {
+		c.AdminStewards = parseList(v)
+		return nil
+	}},
+	{"steward-name", "CCN_STEWARD_NAME", "name of the seed created for the node's default steward", func(c *NodeConfig, v string) error {
+		c.StewardName = v
+		return nil
+	}},
+	{"steward-description", "CCN_STEWARD_DESCRIPTION", "description of the seed created for the node's default steward", func(c *NodeConfig, v string) error {
+		c.StewardDescription = v
+		return nil
+	}},
+}
+
+// boolSettings take no value on the command line
+var boolSettings = map[string]bool{"private": true}
+
+// loadConfig reads the configuration from the file named by -config or
+// CCN_CONFIG, the environment and the flags in args. It returns the arguments
+// left after the flags, which name a command if there are any.
+func loadConfig(args []string) (NodeConfig, []string, error) {
+	fs := flag.NewFlagSet("ccn", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(configFileEnv), "YAML configuration file ($"+configFileEnv+")")
+	for _, s := range configSettings {
+		usage := fmt.Sprintf("%s ($%s)", s.usage, s.env)
+		if boolSettings[s.flag] {
+			fs.Bool(s.flag, false, usage)
+		} else {
+			fs.String(s.flag, "", usage)
+		}
+	}
+	fs.Usage = func() {
+		printUsage()
+		fmt.Fprintln(fs.Output(), "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return NodeConfig{}, nil, err
+	}
+
+	config := defaultConfig()
+	if *file != "" {
+		if err := readConfigFile(*file, &config); err != nil {
+			return NodeConfig{}, nil, err
+		}
+	}
+	for _, s := range configSettings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(&config, value); err != nil {
+				return NodeConfig{}, nil, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range configSettings {
+			if s.flag == f.Name && err == nil {
+				if setErr := s.set(&config, f.Value.String()); setErr != nil {
+					err = fmt.Errorf("-%s: %v", s.flag, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return NodeConfig{}, nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return NodeConfig{}, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, fs.Args(), nil
+}
+
+// readConfigFile overlays the settings in a YAML file; unknown keys are errors
+func readConfigFile(filename string, config *NodeConfig) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", filename, err)
+	}
+	return nil
+}
+
+// validate reports every setting the node cannot run with
+func (c NodeConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.IPFSAPI != "", "ipfs_api is required")
+	_, port, err := net.SplitHostPort(c.Listen)
+	if err == nil {
+		_, err = net.LookupPort("tcp", port)
+	}
+	check(err == nil, "listen %q is not a host:port address", c.Listen)
+	check(c.Topic != "" && !strings.ContainsAny(c.Topic, " \t\n"), "topic %q must be a non-empty word", c.Topic)
+	check(c.Network == "" || networkNamePattern.MatchString(c.Network), "network %q may only have letters, digits, '.', '_' and '-'", c.Network)
+	check(c.PublishInterval > 0, "publish_interval must be positive")
+	check(c.PeerCheckInterval > 0, "peer_check_interval must be positive")
+	check(c.CompactInterval > 0, "compact_interval must be positive")
+	check(c.PeerStaleAfter > 0, "peer_stale_after must be positive")
+	check(c.PeerOfflineAfter > c.PeerStaleAfter, "peer_offline_after must be longer than peer_stale_after")
+	check(c.PeerEvictAfter > c.PeerOfflineAfter, "peer_evict_after must be longer than peer_offline_after")
+	for _, addr := range c.Bootstrap {
+		check(peerAddrID(addr) != "", "bootstrap address %q must be a multiaddr ending in /p2p/<peer ID>", addr)
+		check(!c.Private || !isPublicBootstrapNode(addr), "bootstrap address %q is a public node, which a private network never contacts", addr)
+	}
+	for _, addr := range c.StaticPeers {
+		check(peerAddrID(addr) != "", "static peer %q must be a multiaddr ending in /p2p/<peer ID>", addr)
+		check(!c.Private || !isPublicBootstrapNode(addr), "static peer %q is a public node, which a private network never contacts", addr)
+	}
+	check(!c.Private || len(c.AllowPeers) > 0 || len(c.StaticPeers) > 0, "a private network needs allow_peers or static_peers")
+	_, err = os.Stat(c.OntologyFile)
+	check(err == nil, "ontology_file: %v", err)
+	check(c.DynamicsFile != "", "dynamics_file is required")
+	check(c.StoreDir != "", "store_dir is required")
+	check(path.IsAbs(c.MFSRoot) && path.Clean(c.MFSRoot) == c.MFSRoot && c.MFSRoot != "/", "mfs_root %q must be a clean absolute path below /", c.MFSRoot)
+	for _, origin := range c.CORSOrigins {
+		check(origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://"), "CORS origin %q must be * or start with http:// or https://", origin)
+	}
+	return errors.Join(errs...)
+}
+
+// mfsPath maps a state path to the node's IPFS MFS root
+func mfsPath(statePath string) string {
+	return path.Join(nodeConfig.MFSRoot, strings.TrimPrefix(statePath, "/ccn/"))
+}
+
+func parseDuration(target *time.Duration, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*target = d
+	return nil
+}
+
+// parseList reads a comma-separated list
+func parseList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
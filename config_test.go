@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ccn.yaml")
+	os.WriteFile(file, []byte("listen: \":1000\"\ntopic: file-topic\nnetwork: file-net\npublish_interval: 2m\n"), 0o644)
+	t.Setenv(configFileEnv, file)
+	t.Setenv("CCN_LISTEN", ":2000")
+	t.Setenv("CCN_TOPIC", "env-topic")
+
+	config, args, err := loadConfig([]string{"-listen", ":3000", "-allow-peers", "a, b,", "-private", "lint", "-fix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		setting   string
+		got, want any
+	}{
+		{"flag over environment", config.Listen, ":3000"},
+		{"environment over file", config.Topic, "env-topic"},
+		{"file over default", config.Network, "file-net"},
+		{"file duration", config.PublishInterval, 2 * time.Minute},
+		{"default", config.PeerCheckInterval, defaultConfig().PeerCheckInterval},
+		{"bool flag", config.Private, true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+	if !slices.Equal(config.AllowPeers, []string{"a", "b"}) {
+		t.Errorf("allow-peers read as %q", config.AllowPeers)
+	}
+	if !slices.Equal(args, []string{"lint", "-fix"}) {
+		t.Errorf("left %q after the flags, want the command", args)
+	}
+
+	if _, _, err := loadConfig([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("missing config file accepted")
+	}
+	os.WriteFile(file, []byte("listen: \":1000\"\nlisten_on: \":1000\"\n"), 0o644)
+	if _, _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), "listen_on") {
+		t.Errorf("unknown key: %v", err)
+	}
+	os.WriteFile(file, nil, 0o644)
+	t.Setenv("CCN_PUBLISH_INTERVAL", "often")
+	if _, _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), "CCN_PUBLISH_INTERVAL") {
+		t.Errorf("invalid environment value: %v", err)
+	}
+	if _, _, err := loadConfig([]string{"-publish-interval", "often"}); err == nil {
+		t.Error("invalid flag value accepted")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	if err := defaultConfig().validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+	tests := []struct {
+		name    string
+		change  func(c *NodeConfig)
+		wantErr string
+	}{
+		{"no IPFS API", func(c *NodeConfig) { c.IPFSAPI = "" }, "ipfs_api"},
+		{"listen without port", func(c *NodeConfig) { c.Listen = "localhost" }, "listen"},
+		{"topic with spaces", func(c *NodeConfig) { c.Topic = "concept list" }, "topic"},
+		{"network with a slash", func(c *NodeConfig) { c.Network = "a/b" }, "network"},
+		{"zero interval", func(c *NodeConfig) { c.PublishInterval = 0 }, "publish_interval"},
+		{"offline before stale", func(c *NodeConfig) { c.PeerOfflineAfter = c.PeerStaleAfter }, "peer_offline_after"},
+		{"evicted before offline", func(c *NodeConfig) { c.PeerEvictAfter = time.Minute }, "peer_evict_after"},
+		{"bootstrap without peer ID", func(c *NodeConfig) { c.Bootstrap = []string{"/ip4/10.0.0.1/tcp/4001"} }, "bootstrap"},
+		{"private without peers", func(c *NodeConfig) { c.Private = true }, "allow_peers"},
+		{"private with a public node", func(c *NodeConfig) {
+			c.Private, c.AllowPeers, c.Bootstrap = true, []string{"friend"}, defaultBootstrapNodes[:1]
+		}, "public node"},
+		{"missing ontology", func(c *NodeConfig) { c.OntologyFile = "missing.yaml" }, "ontology_file"},
+		{"relative MFS root", func(c *NodeConfig) { c.MFSRoot = "ccn" }, "mfs_root"},
+		{"CORS origin without scheme", func(c *NodeConfig) { c.CORSOrigins = []string{"example.com"} }, "CORS origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			tt.change(&config)
+			if err := config.validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	config := defaultConfig()
+	config.IPFSAPI = ""
+	config.Topic = ""
+	if err := config.validate(); err == nil || !strings.Contains(err.Error(), "ipfs_api") || !strings.Contains(err.Error(), "topic") {
+		t.Errorf("got %v, want every problem reported", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	eventBufferSize     = 1024 // events kept for clients resuming after a reconnect
+	subscriberQueueSize = 256  // events a subscriber may fall behind before it is dropped
+)
+
+const (
+	eventCreated = "created"
+	eventUpdated = "updated"
+	eventDeleted = "deleted"
+)
+
+// Event is one change to the state. Data is the entity after the change; it is
+// empty for deletes.
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Kind      string    `json:"kind"` // concept, seed, relationship or peer
+	Op        string    `json:"op"`   // created, updated or deleted
+	ID        string    `json:"id"`
+	Data      any       `json:"data,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventBus numbers the changes the repositories publish, keeps the latest ones
+// and passes them on to subscribers. Sequence numbers start at the time the
+// node started, in microseconds, so a number from before a restart is always
+// older than anything the bus still has and the client is sent a new snapshot.
+type EventBus struct {
+	mu          sync.Mutex
+	seq         uint64
+	ring        []Event // the latest events, oldest first
+	subscribers map[chan Event]bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		seq:         uint64(time.Now().UnixMicro()),
+		subscribers: make(map[chan Event]bool),
+	}
+}
+
+// publish records a change. Repositories call it while they hold their lock,
+// and a batch publishes its journaled changes while it holds the update lock,
+// so the events of an entity are numbered in the order its changes were stored.
+func (b *EventBus) publish(kind, op, id string, data any) {
+	if b == nil {
+		return
+	}
+	event := Event{Kind: kind, Op: op, ID: id, Data: data, Timestamp: time.Now()}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.send(event)
+}
+
+func (b *EventBus) send(event Event) {
+	b.seq++
+	event.Seq = b.seq
+	if len(b.ring) == eventBufferSize {
+		b.ring = append(b.ring[:0], b.ring[1:]...)
+	}
+	b.ring = append(b.ring, event)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Too far behind: drop it, and let the client resume from its last event
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers for events after since. It returns the retained events
+// the subscriber missed and a channel for the ones that follow; if since is
+// zero or older than the retained events, resumed is false and the caller has
+// to send a snapshot instead. seq is the number of the last event published.
+// Changes made while that snapshot is taken also arrive on the channel, so
+// applying an event must not depend on it being new.
+func (b *EventBus) Subscribe(since uint64) (ch chan Event, missed []Event, seq uint64, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch = make(chan Event, subscriberQueueSize)
+	b.subscribers[ch] = true
+
+	oldest := b.seq + 1
+	if len(b.ring) > 0 {
+		oldest = b.ring[0].Seq
+	}
+	if since == 0 || since+1 < oldest || since > b.seq {
+		return ch, nil, b.seq, false
+	}
+	for _, event := range b.ring {
+		if event.Seq > since {
+			missed = append(missed, event)
+		}
+	}
+	return ch, missed, b.seq, true
+}
+
+// Seq returns the number of the last event published
+func (b *EventBus) Seq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+func (b *EventBus) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[ch] {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventBusSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	first := bus.Seq()
+	for i := 0; i < 3; i++ {
+		bus.publish("concept", eventCreated, strconv.Itoa(i), nil)
+	}
+	last := bus.Seq()
+
+	tests := []struct {
+		name    string
+		since   uint64
+		resumed bool
+		missed  []string // IDs of the events sent again
+	}{
+		{"fresh client", 0, false, nil},
+		{"resumes from the middle", first + 1, true, []string{"1", "2"}},
+		{"resumes from before the first", first, true, []string{"0", "1", "2"}},
+		{"up to date", last, true, nil},
+		{"from before a restart", first - 100, false, nil},
+		{"from another node", last + 100, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, missed, seq, resumed := bus.Subscribe(tt.since)
+			defer bus.Unsubscribe(ch)
+			if resumed != tt.resumed {
+				t.Errorf("resumed %v, want %v", resumed, tt.resumed)
+			}
+			if seq != last {
+				t.Errorf("seq %d, want %d", seq, last)
+			}
+			var ids []string
+			for _, event := range missed {
+				ids = append(ids, event.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.missed) {
+				t.Errorf("missed %v, want %v", ids, tt.missed)
+			}
+		})
+	}
+}
+
+func TestEventBusDropsSlowSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	ch, _, _, _ := bus.Subscribe(0)
+	for i := 0; i <= subscriberQueueSize; i++ {
+		bus.publish("concept", eventUpdated, "c", nil)
+	}
+	for range subscriberQueueSize {
+		<-ch
+	}
+	if _, ok := <-ch; ok {
+		t.Error("subscriber that fell behind is still subscribed")
+	}
+}
+
+func TestEventBusRingIsBounded(t *testing.T) {
+	bus := NewEventBus()
+	first := bus.Seq()
+	for i := 0; i < eventBufferSize+10; i++ {
+		bus.publish("concept", eventUpdated, "c", nil)
+	}
+	if _, _, _, resumed := bus.Subscribe(first + 5); resumed {
+		t.Error("resumed from an event no longer kept")
+	}
+	if _, missed, _, resumed := bus.Subscribe(first + 10); !resumed || len(missed) != eventBufferSize {
+		t.Errorf("resumed %v with %d events, want all %d kept", resumed, len(missed), eventBufferSize)
+	}
+}
+
+// sseMessage is one message read from an event stream
+type sseMessage struct {
+	id    uint64
+	event string
+	data  string
+}
+
+// readSSE connects to an event stream and returns its first n messages
+func readSSE(t *testing.T, url, lastEventID string, n int) []sseMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var messages []sseMessage
+	var m sseMessage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for len(messages) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			messages = append(messages, m)
+			m = sseMessage{}
+		case strings.HasPrefix(line, "id: "):
+			m.id, _ = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+		case strings.HasPrefix(line, "event: "):
+			m.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			m.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if len(messages) < n {
+		t.Fatalf("stream ended after %d of %d messages: %v", len(messages), n, scanner.Err())
+	}
+	return messages
+}
+
+func TestStreamEventsResume(t *testing.T) {
+	s, _ := newTestServer(t)
+	r := gin.New()
+	s.setupRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	start := s.events.Seq()
+	s.events.publish("concept", eventCreated, "a", &Concept{ID: "a", Name: "A"})
+	s.events.publish("relationship", eventCreated, "r", &Relationship{ID: "r"})
+	s.events.publish("concept", eventUpdated, "a", &Concept{ID: "a", Name: "A2"})
+	s.events.publish("relationship", eventDeleted, "r", nil)
+	s.events.publish("relationship", eventCreated, "o", &Relationship{ID: "o", Type: "opposes"})
+
+	tests := []struct {
+		name        string
+		query       string
+		lastEventID string
+		want        []uint64 // sequence numbers, 0 for a snapshot
+	}{
+		{"resume all", "?kinds=concept,relationship", strconv.FormatUint(start+1, 10), []uint64{start + 2, start + 3, start + 4}},
+		{"resume one kind", "?kinds=concept", strconv.FormatUint(start, 10), []uint64{start + 1, start + 3}},
+		{"resume from the query", "?kinds=relationship&lastEventId=" + strconv.FormatUint(start+2, 10), "", []uint64{start + 4}},
+		{"relationship type", "?kinds=relationship&relationshipType=opposes", strconv.FormatUint(start, 10), []uint64{start + 4, start + 5}},
+		{"too old for the buffer", "?kinds=concept", "1", []uint64{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := readSSE(t, server.URL+"/events"+tt.query, tt.lastEventID, len(tt.want))
+			for i, m := range messages {
+				if tt.want[i] == 0 {
+					if m.event != "snapshot" {
+						t.Errorf("message %d is %q, want a snapshot", i, m.event)
+					}
+					continue
+				}
+				if m.id != tt.want[i] || m.event != "" {
+					t.Errorf("message %d is %q %d, want event %d", i, m.event, m.id, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if w := serve(s, http.MethodGet, "/events?kinds=gadget", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown kind answered %d", w.Code)
+	}
+}
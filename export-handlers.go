@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) exportGraph_h(c *gin.Context) {
+	format := c.DefaultQuery("format", "cytoscape")
+	if _, ok := graphExporters[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown export format: " + format})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := s.exportGraph(&buf, format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export graph"})
+		return
+	}
+
+	c.Data(http.StatusOK, graphContentTypes[format], buf.Bytes())
+}
+
+func (s *Server) importGraph_h(c *gin.Context) {
+	format := c.DefaultQuery("format", "jsonld")
+	parse, ok := rdfParsers[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown import format: " + format})
+		return
+	}
+
+	triples, err := parse(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse %s: %v", format, err)})
+		return
+	}
+
+	report, err := s.importRDF(c.Request.Context(), triples, peerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	s.announce()
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GraphNode is a concept or seed as rendered by the graph exporters
+type GraphNode struct {
+	ID          string
+	Label       string
+	Kind        string // "Concept" or "Seed"
+	ConceptType string
+	Description string
+	Color       string
+}
+
+// GraphEdge is a typed relationship (or a seed's link to its concept) as rendered by the graph exporters
+type GraphEdge struct {
+	ID     string
+	Source string
+	Target string
+	Type   string
+	Label  string
+}
+
+// Graph is an exporter-neutral snapshot of concepts, seeds and relationships
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+const seedOfEdgeType = "Seed Of"
+
+var conceptTypeColors = map[string]string{
+	"ConceptType":          "#8e44ad",
+	"FundamentalConcept":   "#2980b9",
+	"BuildingBlockConcept": "#27ae60",
+	"SystemConcept":        "#e67e22",
+	"InteractionType":      "#16a085",
+	"RelationshipType":     "#7f8c8d",
+	"Seed":                 "#c0392b",
+}
+
+// colorForType returns the palette color for known concept types and a stable
+// hash-derived color for anything added at runtime
+func colorForType(conceptType string) string {
+	if color, ok := conceptTypeColors[conceptType]; ok {
+		return color
+	}
+	h := fnv.New32a()
+	h.Write([]byte(conceptType))
+	sum := h.Sum32()
+	return fmt.Sprintf("#%02x%02x%02x", 64+byte(sum)%160, 64+byte(sum>>8)%160, 64+byte(sum>>16)%160)
+}
+
+// buildGraph takes a consistent snapshot of the concept, seed and relationship maps
+func (s *Server) buildGraph() *Graph {
+	graph := &Graph{}
+	typeNames := make(map[ConceptGUID]string)
+
+	for id, concept := range s.concepts.Snapshot() {
+		typeNames[id] = concept.Name
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			ID:          string(id),
+			Label:       concept.Name,
+			Kind:        concept.GetEntityType(),
+			ConceptType: concept.ConceptType,
+			Description: concept.Description,
+			Color:       colorForType(concept.ConceptType),
+		})
+	}
+
+	for id, seed := range s.seeds.Snapshot() {
+		core := seed.GetCoreSeed()
+		label := core.Name
+		if label == "" {
+			label = typeNames[core.ConceptID]
+		}
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			ID:          string(id),
+			Label:       label,
+			Kind:        seed.GetEntityType(),
+			ConceptType: typeNames[core.ConceptID],
+			Description: core.Description,
+			Color:       colorForType("Seed"),
+		})
+		graph.Edges = append(graph.Edges, GraphEdge{
+			ID:     string(id) + "-" + string(core.ConceptID),
+			Source: string(id),
+			Target: string(core.ConceptID),
+			Type:   seedOfEdgeType,
+			Label:  seedOfEdgeType,
+		})
+	}
+
+	for id, rel := range s.relationships.Snapshot() {
+		label := typeNames[rel.Type]
+		if label == "" {
+			label = string(rel.Type)
+		}
+		graph.Edges = append(graph.Edges, GraphEdge{
+			ID:     string(id),
+			Source: string(rel.SourceID),
+			Target: string(rel.TargetID),
+			Type:   string(rel.Type),
+			Label:  label,
+		})
+	}
+
+	// Leave out edges to entities that are gone, e.g. a seed of a removed
+	// concept, so every edge's ends are nodes of the graph
+	nodes := make(map[string]bool, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = true
+	}
+	graph.Edges = slices.DeleteFunc(graph.Edges, func(e GraphEdge) bool {
+		return !nodes[e.Source] || !nodes[e.Target]
+	})
+
+	// Map iteration order is random; sort so exports can be diffed
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool { return graph.Edges[i].ID < graph.Edges[j].ID })
+	return graph
+}
+
+// conceptSnapshot is a consistent copy of the concepts and relationships for exporters
+type conceptSnapshot struct {
+	Concepts      []*Concept
+	Relationships []*Relationship
+}
+
+func (s *Server) snapshotConcepts() *conceptSnapshot {
+	ds := &conceptSnapshot{}
+
+	for _, concept := range s.concepts.Snapshot() {
+		ds.Concepts = append(ds.Concepts, concept)
+	}
+	ds.Relationships = s.relationships.List()
+
+	sort.Slice(ds.Concepts, func(i, j int) bool { return ds.Concepts[i].ID < ds.Concepts[j].ID })
+	sort.Slice(ds.Relationships, func(i, j int) bool {
+		a, b := ds.Relationships[i], ds.Relationships[j]
+		if a.SourceID != b.SourceID {
+			return a.SourceID < b.SourceID
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.TargetID < b.TargetID
+	})
+	return ds
+}
+
+type GraphExporter func(s *Server, w io.Writer) error
+
+func graphExporter(render func(w io.Writer, graph *Graph) error) GraphExporter {
+	return func(s *Server, w io.Writer) error { return render(w, s.buildGraph()) }
+}
+
+var graphExporters = map[string]GraphExporter{
+	"graphml":   graphExporter(exportGraphML),
+	"dot":       graphExporter(exportDOT),
+	"cytoscape": graphExporter(exportCytoscape),
+	"jsonld":    rdfExporter(exportJSONLD),
+	"turtle":    rdfExporter(exportTurtle),
+	"yaml":      (*Server).exportYAML,
+}
+
+var graphContentTypes = map[string]string{
+	"graphml":   "application/graphml+xml",
+	"dot":       "text/vnd.graphviz",
+	"cytoscape": "application/json",
+	"jsonld":    "application/ld+json",
+	"turtle":    "text/turtle",
+	"yaml":      "application/yaml",
+}
+
+func (s *Server) exportGraph(w io.Writer, format string) error {
+	exporter, ok := graphExporters[format]
+	if !ok {
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+	return exporter(s, w)
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func exportGraphML(w io.Writer, graph *Graph) error {
+	doc := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "conceptType", For: "node", AttrName: "conceptType", AttrType: "string"},
+			{ID: "description", For: "node", AttrName: "description", AttrType: "string"},
+			{ID: "color", For: "node", AttrName: "color", AttrType: "string"},
+			{ID: "type", For: "edge", AttrName: "type", AttrType: "string"},
+			{ID: "relationship", For: "edge", AttrName: "label", AttrType: "string"},
+		},
+	}
+	doc.Graph.ID = "ccn"
+	doc.Graph.EdgeDefault = "directed"
+
+	for _, n := range graph.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.ID,
+			Data: []graphMLData{
+				{Key: "label", Value: n.Label},
+				{Key: "kind", Value: n.Kind},
+				{Key: "conceptType", Value: n.ConceptType},
+				{Key: "description", Value: n.Description},
+				{Key: "color", Value: n.Color},
+			},
+		})
+	}
+	for _, e := range graph.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     e.ID,
+			Source: e.Source,
+			Target: e.Target,
+			Data: []graphMLData{
+				{Key: "type", Value: e.Type},
+				{Key: "relationship", Value: e.Label},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode GraphML: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func exportDOT(w io.Writer, graph *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph ccn {\n")
+	b.WriteString("  node [style=filled, fontcolor=white];\n")
+	for _, n := range graph.Nodes {
+		shape := "ellipse"
+		if n.Kind == "Seed" {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s, fillcolor=%s, tooltip=%s];\n",
+			dotQuote(n.ID), dotQuote(n.Label), shape, dotQuote(n.Color), dotQuote(n.ConceptType))
+	}
+	for _, e := range graph.Edges {
+		style := "solid"
+		if e.Type == seedOfEdgeType {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, style=%s];\n",
+			dotQuote(e.Source), dotQuote(e.Target), dotQuote(e.Label), style)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func exportCytoscape(w io.Writer, graph *Graph) error {
+	type element struct {
+		Data    map[string]string `json:"data"`
+		Classes string            `json:"classes,omitempty"`
+	}
+	var doc struct {
+		Elements struct {
+			Nodes []element `json:"nodes"`
+			Edges []element `json:"edges"`
+		} `json:"elements"`
+	}
+	doc.Elements.Nodes = []element{}
+	doc.Elements.Edges = []element{}
+
+	for _, n := range graph.Nodes {
+		doc.Elements.Nodes = append(doc.Elements.Nodes, element{
+			Data: map[string]string{
+				"id":          n.ID,
+				"label":       n.Label,
+				"kind":        n.Kind,
+				"conceptType": n.ConceptType,
+				"description": n.Description,
+				"color":       n.Color,
+			},
+			Classes: n.Kind,
+		})
+	}
+	for _, e := range graph.Edges {
+		doc.Elements.Edges = append(doc.Elements.Edges, element{
+			Data: map[string]string{
+				"id":     e.ID,
+				"source": e.Source,
+				"target": e.Target,
+				"type":   e.Type,
+				"label":  e.Label,
+			},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBuildGraph(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	alice := newTestSteward(t, s, "Alice")
+	technology := s.findConceptGUID("Technology")
+	influences := CreateRelationship(EntityGUID(alice.SeedID), EntityGUID(technology), s.findConceptGUID("Influences"), nil)
+	s.relationships.Put(ctx, influences)
+	dangling := CreateRelationship(EntityGUID(technology), "gone", s.findConceptGUID("Influences"), nil)
+	s.relationships.Put(ctx, dangling)
+
+	graph := s.buildGraph()
+	nodes := make(map[string]GraphNode)
+	for _, n := range graph.Nodes {
+		nodes[n.ID] = n
+	}
+	edges := make(map[string]GraphEdge)
+	for _, e := range graph.Edges {
+		edges[e.ID] = e
+		if _, ok := nodes[e.Source]; !ok {
+			t.Errorf("edge %s starts at %s, which is not a node", e.ID, e.Source)
+		}
+		if _, ok := nodes[e.Target]; !ok {
+			t.Errorf("edge %s ends at %s, which is not a node", e.ID, e.Target)
+		}
+	}
+
+	concept, _ := s.concepts.Get(technology)
+	if n := nodes[string(technology)]; n.Label != "Technology" || n.Color != colorForType(concept.ConceptType) || n.Kind != "Concept" {
+		t.Errorf("Technology rendered as %+v", n)
+	}
+	if n := nodes[string(alice.SeedID)]; n.Label != "Alice" || n.Color != conceptTypeColors["Seed"] || n.ConceptType != "Steward" {
+		t.Errorf("Alice rendered as %+v", n)
+	}
+	if e, ok := edges[string(alice.SeedID)+"-"+string(alice.ConceptID)]; !ok || e.Type != seedOfEdgeType {
+		t.Errorf("no %q edge from Alice to her concept", seedOfEdgeType)
+	}
+	if e := edges[string(influences.ID)]; e.Label != "Influences" {
+		t.Errorf("relationship labelled %q, want its type's name", e.Label)
+	}
+	if _, ok := edges[string(dangling.ID)]; ok {
+		t.Error("edge to a missing node exported")
+	}
+}
+
+func TestColorForType(t *testing.T) {
+	if got := colorForType("FundamentalConcept"); got != conceptTypeColors["FundamentalConcept"] {
+		t.Errorf("palette type colored %s", got)
+	}
+	runtime := colorForType("Gadget")
+	if runtime != colorForType("Gadget") || !strings.HasPrefix(runtime, "#") || len(runtime) != 7 {
+		t.Errorf("runtime type colored %q", runtime)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	s, _ := newTestServer(t)
+	newTestSteward(t, s, "Alice")
+	graph := s.buildGraph()
+
+	tests := []struct {
+		format      string
+		contentType string
+		count       func(t *testing.T, body []byte) (nodes, edges int)
+	}{
+		{"graphml", "application/graphml+xml", func(t *testing.T, body []byte) (int, int) {
+			var doc graphMLDocument
+			if err := xml.Unmarshal(body, &doc); err != nil {
+				t.Fatal(err)
+			}
+			return len(doc.Graph.Nodes), len(doc.Graph.Edges)
+		}},
+		{"dot", "text/vnd.graphviz", func(t *testing.T, body []byte) (int, int) {
+			text := string(body)
+			if !strings.HasPrefix(text, "digraph ccn {") || !strings.HasSuffix(text, "}\n") {
+				t.Fatalf("not a digraph: %.80s", text)
+			}
+			return strings.Count(text, "fillcolor="), strings.Count(text, " -> ")
+		}},
+		{"cytoscape", "application/json", func(t *testing.T, body []byte) (int, int) {
+			var doc struct {
+				Elements struct {
+					Nodes []map[string]any `json:"nodes"`
+					Edges []map[string]any `json:"edges"`
+				} `json:"elements"`
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatal(err)
+			}
+			return len(doc.Elements.Nodes), len(doc.Elements.Edges)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			w := serve(s, http.MethodGet, "/export?format="+tt.format, "", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("content type %s, want %s", got, tt.contentType)
+			}
+			nodes, edges := tt.count(t, w.Body.Bytes())
+			if nodes != len(graph.Nodes) || edges != len(graph.Edges) {
+				t.Errorf("%d nodes and %d edges, want %d and %d", nodes, edges, len(graph.Nodes), len(graph.Edges))
+			}
+		})
+	}
+
+	if w := serve(s, http.MethodGet, "/export?format=svg", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format answered %d", w.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const maxTraversalDepth = 10
+
+type traversalOptions struct {
+	Depth     int
+	Direction string // "out", "in" or "both"
+	Types     map[ConceptGUID]bool
+	Filters   []propertyFilter
+	Inferred  bool
+}
+
+type TraversalNode struct {
+	ID    EntityGUID
+	Name  string
+	Kind  string
+	Depth int
+}
+
+type Traversal struct {
+	Start         EntityGUID
+	Nodes         []TraversalNode
+	Relationships []*Relationship
+}
+
+func (s *Server) entityName(guid EntityGUID) (string, string, bool) {
+	if concept, ok := s.concepts.Get(ConceptGUID(guid)); ok {
+		return concept.Name, concept.ConceptType, true
+	}
+	if seed, ok := s.seeds.Get(SeedGUID(guid)); ok {
+		return seed.GetName(), seed.GetEntityType(), true
+	}
+	return "", "", false
+}
+
+// traverseGraph walks the graph breadth-first from start, following only the
+// relationships that match the options, and returns the entities reached with
+// their distance from start
+func (s *Server) traverseGraph(start EntityGUID, opts traversalOptions) (*Traversal, error) {
+	name, kind, ok := s.entityName(start)
+	if !ok {
+		return nil, fmt.Errorf("entity not found: %s", start)
+	}
+	if opts.Depth < 1 || opts.Depth > maxTraversalDepth {
+		return nil, fmt.Errorf("depth must be between 1 and %d", maxTraversalDepth)
+	}
+
+	rels := s.relationships.List()
+	if opts.Inferred {
+		rels = withInferredRelationships(rels)
+	}
+
+	adjacent := make(map[EntityGUID][]*Relationship)
+	for _, rel := range rels {
+		if len(opts.Types) > 0 && !opts.Types[rel.Type] {
+			continue
+		}
+		if !matchesPropertyFilters(rel, opts.Filters) {
+			continue
+		}
+		if opts.Direction != "in" {
+			adjacent[rel.SourceID] = append(adjacent[rel.SourceID], rel)
+		}
+		if opts.Direction != "out" && rel.TargetID != rel.SourceID {
+			adjacent[rel.TargetID] = append(adjacent[rel.TargetID], rel)
+		}
+	}
+	for _, edges := range adjacent {
+		sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+	}
+
+	result := &Traversal{Start: start, Nodes: []TraversalNode{{ID: start, Name: name, Kind: kind}}}
+	visited := map[EntityGUID]bool{start: true}
+	used := make(map[RelationshipGUID]bool)
+	frontier := []EntityGUID{start}
+	for depth := 1; depth <= opts.Depth && len(frontier) > 0; depth++ {
+		var next []EntityGUID
+		for _, id := range frontier {
+			for _, rel := range adjacent[id] {
+				other := rel.TargetID
+				if other == id {
+					other = rel.SourceID
+				}
+				if !used[rel.ID] {
+					used[rel.ID] = true
+					result.Relationships = append(result.Relationships, rel)
+				}
+				if visited[other] {
+					continue
+				}
+				visited[other] = true
+				name, kind, _ := s.entityName(other)
+				result.Nodes = append(result.Nodes, TraversalNode{ID: other, Name: name, Kind: kind, Depth: depth})
+				next = append(next, other)
+			}
+		}
+		frontier = next
+	}
+	return result, nil
+}
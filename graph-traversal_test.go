@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTraverseGraph(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	ids := newConcepts(t, s, "A", "B", "C", "D")
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+	influences := s.findConceptGUID("Influences")
+	utilizes := s.findConceptGUID("Utilizes")
+	for _, r := range []*Relationship{
+		CreateRelationship(a, b, influences, map[string]any{"weight": 0.9}),
+		CreateRelationship(b, c, influences, map[string]any{"weight": 0.2}),
+		CreateRelationship(a, d, utilizes, nil),
+	} {
+		if err := s.putRelationship(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	weighty, _ := parsePropertyFilters([]string{"weight>0.5"})
+
+	tests := []struct {
+		name  string
+		start EntityGUID
+		opts  traversalOptions
+		want  map[EntityGUID]int
+	}{
+		{"one hop out", a, traversalOptions{Depth: 1, Direction: "out"}, map[EntityGUID]int{a: 0, b: 1, d: 1}},
+		{"two hops out", a, traversalOptions{Depth: 2, Direction: "out"}, map[EntityGUID]int{a: 0, b: 1, d: 1, c: 2}},
+		{"only heavy edges", a, traversalOptions{Depth: 2, Direction: "out", Filters: weighty}, map[EntityGUID]int{a: 0, b: 1}},
+		{"one type", a, traversalOptions{Depth: 2, Direction: "out", Types: map[ConceptGUID]bool{utilizes: true}}, map[EntityGUID]int{a: 0, d: 1}},
+		{"inward", c, traversalOptions{Depth: 3, Direction: "in"}, map[EntityGUID]int{c: 0, b: 1, a: 2}},
+		{"outward from a leaf", c, traversalOptions{Depth: 3, Direction: "out"}, map[EntityGUID]int{c: 0}},
+		{"both ways", d, traversalOptions{Depth: 2, Direction: "both"}, map[EntityGUID]int{d: 0, a: 1, b: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traversal, err := s.traverseGraph(tt.start, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[EntityGUID]int)
+			for _, n := range traversal.Nodes {
+				got[n.ID] = n.Depth
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("reached %v, want %v", got, tt.want)
+			}
+			for id, depth := range tt.want {
+				if d, ok := got[id]; !ok || d != depth {
+					t.Errorf("%s at depth %d (reached %v), want %d", id, d, ok, depth)
+				}
+			}
+			for _, rel := range traversal.Relationships {
+				if _, ok := got[rel.SourceID]; !ok || !slices.ContainsFunc(traversal.Nodes, func(n TraversalNode) bool { return n.ID == rel.TargetID }) {
+					t.Errorf("relationship %s leaves the traversal", rel.ID)
+				}
+			}
+		})
+	}
+
+	if _, err := s.traverseGraph(a, traversalOptions{Depth: maxTraversalDepth + 1, Direction: "out"}); err == nil {
+		t.Error("traversed past the depth limit")
+	}
+	if w := serve(s, http.MethodGet, "/traverse/"+string(a)+"?property=weight", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid property filter answered %d", w.Code)
+	}
+
+	w := serve(s, http.MethodGet, "/relationship-type/"+string(influences)+"?inferred=false&property=weight%3E0.5", "", nil)
+	var heavy []*Relationship
+	if err := json.Unmarshal(w.Body.Bytes(), &heavy); err != nil {
+		t.Fatal(err)
+	}
+	if len(heavy) != 1 || heavy[0].SourceID != a || heavy[0].TargetID != b {
+		t.Errorf("relationships with weight>0.5: %s", w.Body)
+	}
+}
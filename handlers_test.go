@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TestConcurrentHandlers runs writers and readers of every kind against one
+// node at once; run it with -race. Afterwards the state must be consistent and
+// persisted as it is in memory.
+func TestConcurrentHandlers(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	r := gin.New()
+	s.setupRoutes(r)
+
+	alice := newTestSteward(t, s, "Alice")
+	_, adminToken, _ := s.auth.createToken(ctx, "admin", defaultSteward(), true)
+	_, aliceToken, _ := s.auth.createToken(ctx, "alice", alice.SeedID, false)
+
+	technology := s.findConceptGUID("Technology")
+	influences := s.findConceptGUID("Influences")
+	drumming := ConceptGUID(uuid.New().String())
+	if err := s.addNewConcept(ctx, &Concept{ID: drumming, Name: "Drumming", ConceptType: interactionTypeConceptType}, peerID); err != nil {
+		t.Fatal(err)
+	}
+	targets := []ConceptGUID{technology, s.findConceptGUID("Society"), s.findConceptGUID("Wisdom")}
+	technologyBefore, _ := s.concepts.Get(technology)
+
+	w := serveWith(r, http.MethodPost, "/relationship", aliceToken, relationshipRequest{
+		SourceID: EntityGUID(alice.SeedID), TargetID: EntityGUID(technology), TypeID: influences,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("creating a relationship: %d %s", w.Code, w.Body)
+	}
+	var interacted Relationship
+	json.Unmarshal(w.Body.Bytes(), &interacted)
+
+	const rounds = 8
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created []RelationshipGUID
+		failed  []string
+	)
+	expect := func(name string, got int, want ...int) bool {
+		if slices.Contains(want, got) {
+			return true
+		}
+		mu.Lock()
+		failed = append(failed, fmt.Sprintf("%s: status %d, want %v", name, got, want))
+		mu.Unlock()
+		return false
+	}
+	run := func(f func(i int)) {
+		for i := 0; i < rounds; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				f(i)
+			}(i)
+		}
+	}
+
+	run(func(i int) {
+		w := serveWith(r, http.MethodPut, "/concept/"+string(technology), adminToken, map[string]string{
+			"name": technologyBefore.Name, "description": fmt.Sprintf("Revision %d", i), "type": technologyBefore.ConceptType,
+		})
+		expect("update concept", w.Code, http.StatusOK)
+	})
+	run(func(i int) {
+		w := serveWith(r, http.MethodPost, "/relationship", aliceToken, relationshipRequest{
+			SourceID: EntityGUID(alice.SeedID), TargetID: EntityGUID(targets[i%len(targets)]), TypeID: influences,
+		})
+		if expect("create relationship", w.Code, http.StatusOK) {
+			var rel Relationship
+			json.Unmarshal(w.Body.Bytes(), &rel)
+			mu.Lock()
+			created = append(created, rel.ID)
+			mu.Unlock()
+		}
+	})
+	run(func(i int) {
+		w := serveWith(r, http.MethodPost, "/relationship/"+string(interacted.ID)+"/interact", aliceToken, map[string]any{
+			"interactionTypeGuid": drumming,
+		})
+		expect("interact", w.Code, http.StatusOK)
+	})
+	run(func(i int) {
+		ops := []BatchOperation{
+			batchOp("create", "concept", "", "c", map[string]any{"name": fmt.Sprintf("Batch %d", i), "type": "FundamentalConcept"}),
+			batchOp("create", "relationship", "", "", map[string]any{"sourceId": "$c", "targetId": technology, "typeId": influences}),
+		}
+		want := http.StatusOK
+		if i%2 == 1 {
+			ops = append(ops, batchOp("delete", "concept", "no-such-concept", "", nil))
+			want = http.StatusNotFound
+		}
+		w := serveWith(r, http.MethodPost, "/batch", adminToken, map[string]any{"operations": ops})
+		expect("batch", w.Code, want)
+	})
+	run(func(i int) {
+		for _, path := range []string{"/concepts", "/relationships", "/interactions", "/concept/" + string(technology), "/stewards"} {
+			expect("GET "+path, serveWith(r, http.MethodGet, path, "", nil).Code, http.StatusOK)
+		}
+	})
+	wg.Wait()
+
+	for _, f := range failed {
+		t.Error(f)
+	}
+
+	technologyAfter, _ := s.concepts.Get(technology)
+	if want := technologyBefore.Version + rounds; technologyAfter.Version != want {
+		t.Errorf("Technology at version %d, want %d", technologyAfter.Version, want)
+	}
+
+	aliceAfter, _ := s.seeds.Get(alice.SeedID)
+	links := aliceAfter.GetCoreSeed().Relationships
+	for _, id := range append(created, interacted.ID) {
+		if !slices.Contains(links, id) {
+			t.Errorf("Alice does not list relationship %s", id)
+		}
+	}
+
+	rel, _ := s.relationships.Get(interacted.ID)
+	if rel.Dynamics == nil || rel.Dynamics.Interactions != rounds {
+		t.Errorf("relationship has %v interactions, want %d", rel.Dynamics, rounds)
+	}
+	events := queryInteractions(InteractionQuery{RelationshipID: interacted.ID})
+	if len(events) != rounds {
+		t.Errorf("%d interactions logged, want %d", len(events), rounds)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].PreviousCID != events[i-1].CID {
+			t.Errorf("interaction %d follows %s, want %s", i, events[i].PreviousCID, events[i-1].CID)
+		}
+	}
+
+	if report := s.checkIntegrity(ctx, false); len(report.Issues) > 0 {
+		t.Errorf("integrity issues: %v", report.Issues)
+	}
+
+	// The store holds what is in memory
+	stored := make(RelationshipMap)
+	if err := loadData(ctx, relationshipsPath, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != s.relationships.Len() {
+		t.Errorf("%d relationships stored, %d in memory", len(stored), s.relationships.Len())
+	}
+	var logged []*InteractionEvent
+	if err := loadData(ctx, interactionLogPath, &logged); err != nil || len(logged) != rounds {
+		t.Errorf("%d interactions stored, want %d: %v", len(logged), rounds, err)
+	}
+	storedConcepts := make(ConceptMap)
+	loadData(ctx, conceptsPath, &storedConcepts)
+	if c := storedConcepts[technology]; c == nil || c.Version != technologyAfter.Version {
+		t.Errorf("stored Technology is %v, want version %d", c, technologyAfter.Version)
+	}
+}
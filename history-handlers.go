@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) currentConceptCID(guid ConceptGUID) (CID, bool) {
+	concept, ok := s.concepts.Get(guid)
+	if !ok {
+		return "", false
+	}
+	return concept.GetCID(), true
+}
+
+func (s *Server) currentSeedCID(guid SeedGUID) (CID, bool) {
+	seed, ok := s.seeds.Get(guid)
+	if !ok {
+		return "", false
+	}
+	return seed.GetCID(), true
+}
+
+func respondHistory(c *gin.Context, head CID) {
+	history, err := versionHistory(c.Request.Context(), head)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// respondDiff compares ?from= with ?to=, which defaults to the current version.
+// Both must belong to the entity's history.
+func respondDiff(c *gin.Context, head CID) {
+	from, to := CID(c.Query("from")), CID(c.DefaultQuery("to", string(head)))
+	if from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+	ctx := c.Request.Context()
+	for _, cid := range []CID{from, to} {
+		if !inHistory(ctx, head, cid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found: " + string(cid)})
+			return
+		}
+	}
+
+	changes, err := diffVersions(ctx, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "changes": changes})
+}
+
+// rollbackTarget reads the version named in the request body, checking that it
+// belongs to the entity's history
+func rollbackTarget(c *gin.Context, head CID) ([]byte, bool) {
+	var req struct {
+		CID CID `json:"cid"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.CID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cid is required"})
+		return nil, false
+	}
+	if !inHistory(c.Request.Context(), head, req.CID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found: " + string(req.CID)})
+		return nil, false
+	}
+
+	content, err := loadVersion(c.Request.Context(), req.CID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	data, _ := json.Marshal(content)
+	return data, true
+}
+
+func (s *Server) getConceptHistory_h(c *gin.Context) {
+	head, ok := s.currentConceptCID(ConceptGUID(c.Param("guid")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
+		return
+	}
+	respondHistory(c, head)
+}
+
+func (s *Server) diffConceptVersions_h(c *gin.Context) {
+	head, ok := s.currentConceptCID(ConceptGUID(c.Param("guid")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
+		return
+	}
+	respondDiff(c, head)
+}
+
+// rollbackConcept_h republishes an earlier version of a concept as its newest
+// version. The concept keeps its current relationships.
+func (s *Server) rollbackConcept_h(c *gin.Context) {
+	guid := ConceptGUID(c.Param("guid"))
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	current, ok := s.concepts.Get(guid)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Concept not found"})
+		return
+	}
+	if !ifMatch(c, current.GetCID()) {
+		preconditionFailed(c, current.GetCID(), current)
+		return
+	}
+
+	data, ok := rollbackTarget(c, current.GetCID())
+	if !ok {
+		return
+	}
+	var restored Concept
+	if err := json.Unmarshal(data, &restored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode version"})
+		return
+	}
+	restored.ID = guid
+	restored.CID = current.GetCID()
+	restored.Version = current.Version
+	restored.Relationships = current.Relationships
+
+	if err := s.addOrUpdateConcept(c.Request.Context(), &restored, peerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll back concept"})
+		return
+	}
+	c.Header("ETag", etag(restored.CID))
+	c.JSON(http.StatusOK, restored)
+}
+
+func (s *Server) getSeedHistory_h(c *gin.Context) {
+	head, ok := s.currentSeedCID(SeedGUID(c.Param("guid")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
+		return
+	}
+	respondHistory(c, head)
+}
+
+func (s *Server) diffSeedVersions_h(c *gin.Context) {
+	head, ok := s.currentSeedCID(SeedGUID(c.Param("guid")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
+		return
+	}
+	respondDiff(c, head)
+}
+
+// rollbackSeed_h republishes an earlier version of a seed as its newest version.
+// The seed keeps its current relationships.
+func (s *Server) rollbackSeed_h(c *gin.Context) {
+	guid := SeedGUID(c.Param("guid"))
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	current, ok := s.seeds.Get(guid)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
+		return
+	}
+	if !ifMatch(c, current.GetCID()) {
+		preconditionFailed(c, current.GetCID(), current)
+		return
+	}
+
+	data, ok := rollbackTarget(c, current.GetCID())
+	if !ok {
+		return
+	}
+	restored, err := UnmarshalJSON2Seed(data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode version"})
+		return
+	}
+	core := restored.GetCoreSeed()
+	core.SeedID = guid
+	core.CID = current.GetCID()
+	core.Version = current.GetCoreSeed().Version
+	core.Relationships = current.GetRelationships()
+	if err := s.authorizeSeed(c.Request.Context(), current, restored); err != nil {
+		abortAuth(c, err)
+		return
+	}
+
+	if err := s.addOrUpdateSeed(c.Request.Context(), restored, peerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll back seed"})
+		return
+	}
+	c.Header("ETag", etag(restored.GetCID()))
+	c.JSON(http.StatusOK, restored)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestConceptHistory(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	_, adminToken, _ := s.auth.createToken(ctx, "admin", defaultSteward(), true)
+	guid := ConceptGUID(newConcepts(t, s, "Versioned")[0])
+	path := "/concept/" + string(guid)
+	neighbour := newConcepts(t, s, "Neighbour")[0]
+	rel := CreateRelationship(EntityGUID(guid), neighbour, s.findConceptGUID("Influences"), nil)
+	s.putRelationship(ctx, rel)
+	s.linkRelationship(ctx, rel)
+	first, _ := s.concepts.Get(guid)
+
+	for _, description := range []string{"Second", "Third"} {
+		w := serve(s, http.MethodPut, path, adminToken, map[string]string{"name": "Versioned", "description": description, "type": "FundamentalConcept"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT status %d: %s", w.Code, w.Body)
+		}
+	}
+
+	history := func() []VersionInfo {
+		t.Helper()
+		var history []VersionInfo
+		w := serve(s, http.MethodGet, path+"/history", "", nil)
+		if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+			t.Fatalf("history: %d %s", w.Code, w.Body)
+		}
+		return history
+	}
+	versions := history()
+	// Linking a relationship does not make a version
+	if len(versions) != 3 {
+		t.Fatalf("%d versions, want 3", len(versions))
+	}
+	for i, v := range versions {
+		if v.Version != 3-i {
+			t.Errorf("version %d listed at %d", v.Version, i)
+		}
+		if i+1 < len(versions) && v.PreviousCID != versions[i+1].CID {
+			t.Errorf("version %d follows %s, want %s", v.Version, v.PreviousCID, versions[i+1].CID)
+		}
+	}
+	current, _ := s.concepts.Get(guid)
+	if versions[0].CID != current.GetCID() {
+		t.Error("history does not start at the current version")
+	}
+	if err := s.addOrUpdateConcept(ctx, current.clone(), peerID); err != nil {
+		t.Fatal(err)
+	}
+	if unchanged, _ := s.concepts.Get(guid); unchanged.GetCID() != current.GetCID() {
+		t.Error("storing an unchanged concept made a version")
+	}
+
+	var diff struct {
+		Changes []FieldChange `json:"changes"`
+	}
+	w := serve(s, http.MethodGet, path+"/diff?from="+string(first.GetCID()), "", nil)
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if w.Code != http.StatusOK || len(diff.Changes) == 0 {
+		t.Fatalf("diff: %d %s", w.Code, w.Body)
+	}
+	for _, change := range diff.Changes {
+		if change.Field == "Description" && (change.From != "" || change.To != "Third") {
+			t.Errorf("Description changed from %v to %v", change.From, change.To)
+		}
+	}
+	if w := serve(s, http.MethodGet, path+"/diff?from=unknown", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("diff from a foreign version answered %d", w.Code)
+	}
+
+	if w := serve(s, http.MethodPost, path+"/rollback", adminToken, map[string]CID{"cid": versions[1].CID}); w.Code != http.StatusOK {
+		t.Fatalf("rollback: %d %s", w.Code, w.Body)
+	}
+	restored, _ := s.concepts.Get(guid)
+	if restored.Description != "Second" || restored.Version != 4 || !hasRelationship(restored.Relationships, rel.ID) {
+		t.Errorf("rolled back to %q, version %d, links %v", restored.Description, restored.Version, restored.Relationships)
+	}
+	if versions := history(); len(versions) != 4 {
+		t.Errorf("%d versions after the rollback, want 4", len(versions))
+	}
+	if w := serve(s, http.MethodPost, path+"/rollback", adminToken, map[string]CID{"cid": "unknown"}); w.Code != http.StatusNotFound {
+		t.Errorf("rollback to a foreign version answered %d", w.Code)
+	}
+}
+
+func TestSeedRollback(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	alice := newTestSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+	_, aliceToken, _ := s.auth.createToken(ctx, "alice", alice.SeedID, false)
+	_, bobToken, _ := s.auth.createToken(ctx, "bob", bob.SeedID, false)
+	first, _ := s.seeds.Get(alice.SeedID)
+
+	changed := cloneOf(t, first.(*StewardSeed))
+	changed.Description = "Changed"
+	if err := s.addOrUpdateSeed(ctx, changed, peerID); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/seed/" + string(alice.SeedID)
+	var versions []VersionInfo
+	json.Unmarshal(serve(s, http.MethodGet, path+"/history", "", nil).Body.Bytes(), &versions)
+	if len(versions) != 2 || versions[1].CID != first.GetCID() {
+		t.Fatalf("seed history %+v", versions)
+	}
+
+	body := map[string]CID{"cid": first.GetCID()}
+	if w := serve(s, http.MethodPost, path+"/rollback", bobToken, body); w.Code != http.StatusForbidden {
+		t.Errorf("another steward's rollback answered %d", w.Code)
+	}
+	if w := serve(s, http.MethodPost, path+"/rollback", aliceToken, body); w.Code != http.StatusOK {
+		t.Fatalf("rollback: %d %s", w.Code, w.Body)
+	}
+	if restored, _ := s.seeds.Get(alice.SeedID); restored.GetCoreSeed().Description != "" || restored.GetCoreSeed().Version != 3 {
+		t.Errorf("rolled back to %+v", restored.GetCoreSeed())
+	}
+}
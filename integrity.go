@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+)
+
+const (
+	danglingRelationship = "dangling-relationship" // source, target or type no longer exists
+	staleLink            = "stale-link"            // entity lists a relationship it is not an endpoint of
+	missingLink          = "missing-link"          // entity does not list a relationship it is an endpoint of
+	orphanSeed           = "orphan-seed"           // seed's concept no longer exists
+	staleCID             = "stale-cid"             // CID map entry without a concept or seed
+)
+
+// IntegrityIssue is a broken link found between concepts, seeds and relationships
+type IntegrityIssue struct {
+	Kind     string
+	Entity   string
+	Detail   string
+	Repaired bool
+}
+
+func (i IntegrityIssue) String() string {
+	status := ""
+	if i.Repaired {
+		status = " (repaired)"
+	}
+	return fmt.Sprintf("%s %s: %s%s", i.Kind, i.Entity, i.Detail, status)
+}
+
+type IntegrityReport struct {
+	Relationships int
+	Concepts      int
+	Seeds         int
+	Issues        []IntegrityIssue
+	Repaired      int
+}
+
+func (r *IntegrityReport) add(kind, entity, detail string, repaired bool) {
+	r.Issues = append(r.Issues, IntegrityIssue{Kind: kind, Entity: entity, Detail: detail, Repaired: repaired})
+	if repaired {
+		r.Repaired++
+	}
+}
+
+// checkIntegrity verifies that every relationship points at existing entities and
+// that the Relationships lists of concepts and seeds match the relationship map.
+// With repair set, dangling relationships are deleted, links are corrected in a
+// new version of the concept or seed, and stale CID entries are dropped; orphan
+// seeds are only reported.
+func (s *Server) checkIntegrity(ctx context.Context, repair bool) *IntegrityReport {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	report := &IntegrityReport{}
+
+	concepts, seeds, relationships := s.concepts.Snapshot(), s.seeds.Snapshot(), s.relationships.Snapshot()
+	exists := func(guid EntityGUID) bool {
+		if _, ok := concepts[ConceptGUID(guid)]; ok {
+			return true
+		}
+		_, ok := seeds[SeedGUID(guid)]
+		return ok
+	}
+
+	var dangling []RelationshipGUID
+	reasons := make(map[RelationshipGUID]string)
+	report.Relationships = len(relationships)
+	report.Concepts = len(concepts)
+	report.Seeds = len(seeds)
+	for id, rel := range relationships {
+		switch {
+		case !exists(rel.SourceID):
+			reasons[id] = fmt.Sprintf("source %s not found", rel.SourceID)
+		case !exists(rel.TargetID):
+			reasons[id] = fmt.Sprintf("target %s not found", rel.TargetID)
+		case concepts[rel.Type] == nil:
+			reasons[id] = fmt.Sprintf("type %s not found", rel.Type)
+		default:
+			continue
+		}
+		dangling = append(dangling, id)
+	}
+
+	sort.Slice(dangling, func(i, j int) bool { return dangling[i] < dangling[j] })
+	for _, id := range dangling {
+		report.add(danglingRelationship, string(id), reasons[id], repair && s.removeRelationship(ctx, id))
+	}
+
+	// Relationships each entity should list, after any dangling ones were removed
+	concepts, seeds, relationships = s.concepts.Snapshot(), s.seeds.Snapshot(), s.relationships.Snapshot()
+	expected := make(map[EntityGUID]map[RelationshipGUID]bool)
+	known := make(map[RelationshipGUID]bool, len(relationships))
+	for id, rel := range relationships {
+		known[id] = true
+		for _, endpoint := range []EntityGUID{rel.SourceID, rel.TargetID} {
+			if expected[endpoint] == nil {
+				expected[endpoint] = make(map[RelationshipGUID]bool)
+			}
+			expected[endpoint][id] = true
+		}
+	}
+
+	checkLinks := func(guid EntityGUID, ids []RelationshipGUID) []RelationshipGUID {
+		kept := make([]RelationshipGUID, 0, len(ids))
+		seen := make(map[RelationshipGUID]bool, len(ids))
+		for _, id := range ids {
+			switch {
+			case seen[id]:
+				report.add(staleLink, string(guid), fmt.Sprintf("relationship %s listed twice", id), repair)
+			case !known[id]:
+				report.add(staleLink, string(guid), fmt.Sprintf("relationship %s does not exist", id), repair)
+			case !expected[guid][id]:
+				report.add(staleLink, string(guid), fmt.Sprintf("not an endpoint of relationship %s", id), repair)
+			default:
+				kept = append(kept, id)
+			}
+			seen[id] = true
+		}
+		var missing []RelationshipGUID
+		for id := range expected[guid] {
+			if !seen[id] {
+				missing = append(missing, id)
+			}
+		}
+		sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+		for _, id := range missing {
+			report.add(missingLink, string(guid), fmt.Sprintf("endpoint of relationship %s but does not list it", id), repair)
+			kept = append(kept, id)
+		}
+		if !repair {
+			return ids
+		}
+		return kept
+	}
+
+	conceptIDs := make([]ConceptGUID, 0, len(concepts))
+	for id := range concepts {
+		conceptIDs = append(conceptIDs, id)
+	}
+	sort.Slice(conceptIDs, func(i, j int) bool { return conceptIDs[i] < conceptIDs[j] })
+	for _, id := range conceptIDs {
+		links := checkLinks(EntityGUID(id), concepts[id].Relationships)
+		if !slices.Equal(links, concepts[id].Relationships) {
+			concept := concepts[id].clone()
+			concept.Relationships = links
+			if err := s.storeConceptLinks(ctx, concept, peerID); err != nil {
+				log.Printf("Failed to repair the relationships of concept %s: %v", id, err)
+			}
+		}
+	}
+	for _, id := range s.concepts.StaleCIDs(repair) {
+		report.add(staleCID, string(id), "concept CID entry without a concept", repair)
+	}
+
+	seedIDs := make([]SeedGUID, 0, len(seeds))
+	for id := range seeds {
+		seedIDs = append(seedIDs, id)
+	}
+	sort.Slice(seedIDs, func(i, j int) bool { return seedIDs[i] < seedIDs[j] })
+	for _, id := range seedIDs {
+		core := seeds[id].GetCoreSeed()
+		links := checkLinks(EntityGUID(id), core.Relationships)
+		if !slices.Equal(links, core.Relationships) {
+			seed, err := cloneSeed(seeds[id])
+			if err == nil {
+				seed.GetCoreSeed().Relationships = links
+				err = s.storeSeedLinks(ctx, seed, peerID)
+			}
+			if err != nil {
+				log.Printf("Failed to repair the relationships of seed %s: %v", id, err)
+			}
+		}
+		if _, ok := concepts[core.ConceptID]; !ok {
+			report.add(orphanSeed, string(id), fmt.Sprintf("concept %s not found", core.ConceptID), false)
+		}
+	}
+	for _, id := range s.seeds.StaleCIDs(repair) {
+		report.add(staleCID, string(id), "seed CID entry without a seed", repair)
+	}
+
+	if report.Repaired > 0 {
+		s.persist(ctx)
+		s.announce()
+	}
+	return report
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	if report := s.checkIntegrity(ctx, false); len(report.Issues) != 0 {
+		t.Fatalf("a fresh node has integrity issues: %v", report.Issues)
+	}
+
+	ids := newConcepts(t, s, "Left", "Right")
+	left, right := ids[0], ids[1]
+	influences := s.findConceptGUID("Influences")
+	linked := CreateRelationship(left, right, influences, nil)
+	s.putRelationship(ctx, linked)
+	dangling := CreateRelationship(left, "gone", influences, nil)
+	s.relationships.Put(ctx, dangling)
+
+	// Left lists a relationship that does not exist; Right misses its link. The
+	// dangling relationship is a known link until a repair removes it.
+	concept, _ := s.concepts.Get(ConceptGUID(left))
+	concept = concept.clone()
+	concept.Relationships = []RelationshipGUID{linked.ID, dangling.ID, "unknown"}
+	if err := s.storeConceptLinks(ctx, concept, peerID); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := func(report *IntegrityReport) []string {
+		var kinds []string
+		for _, issue := range report.Issues {
+			kinds = append(kinds, issue.Kind)
+		}
+		slices.Sort(kinds)
+		return kinds
+	}
+	want := []string{danglingRelationship, missingLink, staleLink}
+
+	report := s.checkIntegrity(ctx, false)
+	if got := kinds(report); !slices.Equal(got, want) {
+		t.Errorf("found %v, want %v", report.Issues, want)
+	}
+	if report.Repaired != 0 {
+		t.Errorf("a check repaired %d issues", report.Repaired)
+	}
+	if _, ok := s.relationships.Get(dangling.ID); !ok {
+		t.Error("a check removed the dangling relationship")
+	}
+
+	report = s.checkIntegrity(ctx, true)
+	if got := kinds(report); !slices.Equal(got, want) || report.Repaired != len(want) {
+		t.Errorf("repair found %v and repaired %d", report.Issues, report.Repaired)
+	}
+	if _, ok := s.relationships.Get(dangling.ID); ok {
+		t.Error("dangling relationship kept")
+	}
+	for _, id := range []EntityGUID{left, right} {
+		if c, _ := s.concepts.Get(ConceptGUID(id)); !slices.Equal(c.Relationships, []RelationshipGUID{linked.ID}) {
+			t.Errorf("%s lists %v after the repair", c.Name, c.Relationships)
+		}
+	}
+	if report := s.checkIntegrity(ctx, false); len(report.Issues) != 0 {
+		t.Errorf("issues left after the repair: %v", report.Issues)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const interactionLogPath = "/ccn/interaction-log.json"
+
+// interactionTypeConceptType is the ConceptType of the concepts naming a kind of interaction
+const interactionTypeConceptType = "InteractionType"
+
+const (
+	interactEvent = "interact"
+	deepenEvent   = "deepen"
+)
+
+// InteractionMetrics is the state of a relationship's dynamics after an event
+type InteractionMetrics struct {
+	EnergyFlow   float64
+	Amplitude    float64
+	Volume       float64
+	Depth        int
+	Interactions int
+}
+
+// InteractionEvent is an immutable record of one interaction with a relationship.
+// Each event is added to the network under its own CID and names the CID of the
+// event before it, so the log forms a chain.
+type InteractionEvent struct {
+	CID             CID `json:",omitempty"` // not part of the stored content
+	Kind            string
+	RelationshipID  RelationshipGUID
+	InteractionType ConceptGUID `json:",omitempty"`
+	InteractionName string      `json:",omitempty"`
+	StewardID       SeedGUID
+	PeerID          PeerID
+	Timestamp       time.Time
+	Metrics         InteractionMetrics
+	PreviousCID     CID `json:",omitempty"`
+}
+
+var (
+	interactionLog   []*InteractionEvent
+	interactionLogMu sync.RWMutex
+
+	errRelationshipNotFound   = errors.New("relationship not found")
+	errUnknownInteractionType = errors.New("interaction type not found")
+	errNotInteractionType     = errors.New("not an interaction type")
+)
+
+func loadInteractionLog(ctx context.Context) {
+	var events []*InteractionEvent
+	if err := loadData(ctx, interactionLogPath, &events); err != nil {
+		log.Printf("No interaction log loaded: %v\n", err)
+		events = nil
+	}
+	interactionLogMu.Lock()
+	interactionLog = events
+	interactionLogMu.Unlock()
+}
+
+func metricsOf(d *RelationshipDynamics) InteractionMetrics {
+	return InteractionMetrics{
+		EnergyFlow:   d.EnergyFlow,
+		Amplitude:    d.Amplitude,
+		Volume:       d.Volume,
+		Depth:        d.Depth,
+		Interactions: d.Interactions,
+	}
+}
+
+// recordInteraction adds an event to the network and appends it to the log,
+// writing only the new entry to the store
+func recordInteraction(ctx context.Context, event *InteractionEvent) error {
+	interactionLogMu.Lock()
+	defer interactionLogMu.Unlock()
+
+	event.CID = ""
+	n := len(interactionLog)
+	if n > 0 {
+		event.PreviousCID = interactionLog[n-1].CID
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	cid, err := network.Add(ctx, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to store interaction event: %v", err)
+	}
+	event.CID = cid
+
+	op, err := elementOp(interactionLogPath, n, event)
+	if err == nil {
+		err = stateStore.Apply([]StoreOp{op})
+	}
+	if err != nil {
+		network.Remove(ctx, cid)
+		return fmt.Errorf("failed to save interaction event: %v", err)
+	}
+	interactionLog = append(interactionLog, event)
+	return nil
+}
+
+// interactionTypeName returns the name of an interaction type concept
+func (s *Server) interactionTypeName(id ConceptGUID) (string, error) {
+	concept, ok := s.concepts.Get(id)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errUnknownInteractionType, id)
+	}
+	if concept.ConceptType != interactionTypeConceptType {
+		return "", fmt.Errorf("%w: %s is a %s", errNotInteractionType, concept.Name, concept.ConceptType)
+	}
+	return concept.Name, nil
+}
+
+// applyInteraction runs an interaction or deepen event against a copy of the
+// relationship, records it, and only then stores the copy. Only the steward
+// owning the relationship's source may change its dynamics.
+func (s *Server) applyInteraction(ctx context.Context, id RelationshipGUID, kind string, interactionType ConceptGUID, now time.Time) (*Relationship, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	var name string
+	if kind == interactEvent {
+		var err error
+		if name, err = s.interactionTypeName(interactionType); err != nil {
+			return nil, err
+		}
+	}
+
+	existing, ok := s.relationships.Get(id)
+	if !ok {
+		return nil, errRelationshipNotFound
+	}
+	if err := s.authorizeRelationship(ctx, existing.SourceID); err != nil {
+		return nil, err
+	}
+	relationship := existing.clone()
+	dynamics := relationship.dynamics()
+	if kind == interactEvent {
+		dynamicsEngine.Interact(dynamics, interactionType, name, now)
+	} else {
+		dynamicsEngine.Deepen(dynamics, now)
+	}
+
+	event := &InteractionEvent{
+		Kind:            kind,
+		RelationshipID:  id,
+		InteractionType: interactionType,
+		InteractionName: name,
+		StewardID:       actingSteward(ctx),
+		PeerID:          peerID,
+		Timestamp:       now,
+		Metrics:         metricsOf(dynamics),
+	}
+	if err := recordInteraction(ctx, event); err != nil {
+		return nil, err
+	}
+	s.relationships.Put(ctx, relationship)
+	return relationship, nil
+}
+
+// InteractionQuery selects events from the log; zero fields match everything
+type InteractionQuery struct {
+	RelationshipID RelationshipGUID
+	StewardID      SeedGUID
+	Kind           string
+	Since          time.Time
+	Until          time.Time
+	Limit          int
+}
+
+func queryInteractions(q InteractionQuery) []*InteractionEvent {
+	interactionLogMu.RLock()
+	defer interactionLogMu.RUnlock()
+
+	events := []*InteractionEvent{}
+	for _, event := range interactionLog {
+		if q.RelationshipID != "" && event.RelationshipID != q.RelationshipID {
+			continue
+		}
+		if q.StewardID != "" && event.StewardID != q.StewardID {
+			continue
+		}
+		if q.Kind != "" && event.Kind != q.Kind {
+			continue
+		}
+		if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && !event.Timestamp.Before(q.Until) {
+			continue
+		}
+		events = append(events, event)
+	}
+	// Most recent last; a limit keeps the newest events
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events
+}
+
+// ReplayReport describes the relationship dynamics rebuilt from the event log
+type ReplayReport struct {
+	DryRun        bool
+	Events        int
+	Relationships map[RelationshipGUID]*RelationshipDynamics
+	Changed       []RelationshipGUID // rebuilt metrics differ from the stored ones
+	Missing       []RelationshipGUID // events for relationships that no longer exist
+}
+
+// replayInteractions rebuilds relationship dynamics by running every logged event
+// through the dynamics engine in order. Unless dryRun is set, the rebuilt state
+// replaces the stored dynamics of the relationships in the log.
+func (s *Server) replayInteractions(ctx context.Context, dryRun bool) *ReplayReport {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	interactionLogMu.RLock()
+	events := append([]*InteractionEvent(nil), interactionLog...)
+	interactionLogMu.RUnlock()
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	report := &ReplayReport{DryRun: dryRun, Events: len(events), Relationships: make(map[RelationshipGUID]*RelationshipDynamics)}
+	for _, event := range events {
+		d, ok := report.Relationships[event.RelationshipID]
+		if !ok {
+			d = newRelationshipDynamics()
+			report.Relationships[event.RelationshipID] = d
+		}
+		if event.Kind == deepenEvent {
+			dynamicsEngine.Deepen(d, event.Timestamp)
+		} else {
+			dynamicsEngine.Interact(d, event.InteractionType, event.InteractionName, event.Timestamp)
+		}
+	}
+
+	for id, d := range report.Relationships {
+		relationship, ok := s.relationships.Get(id)
+		if !ok {
+			report.Missing = append(report.Missing, id)
+			continue
+		}
+		if relationship.Dynamics == nil || metricsOf(relationship.Dynamics) != metricsOf(d) {
+			report.Changed = append(report.Changed, id)
+		}
+		if !dryRun {
+			s.relationships.Update(ctx, id, func(relationship *Relationship) error {
+				relationship.Dynamics = d.clone()
+				return nil
+			})
+		}
+	}
+	sort.Slice(report.Changed, func(i, j int) bool { return report.Changed[i] < report.Changed[j] })
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i] < report.Missing[j] })
+
+	if !dryRun && len(report.Relationships) > 0 {
+		s.persist(ctx)
+	}
+	return report
+}
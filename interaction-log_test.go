@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestInteractionLog records interactions by two stewards, queries them, and
+// reads the log back after the store is reopened
+func TestInteractionLog(t *testing.T) {
+	s, mem := newTestServer(t)
+	ctx := context.Background()
+	alice := newTestSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+	drumming := ConceptGUID(uuid.New().String())
+	if err := s.addNewConcept(ctx, &Concept{ID: drumming, Name: "Drumming", ConceptType: interactionTypeConceptType}, peerID); err != nil {
+		t.Fatal(err)
+	}
+	technology := EntityGUID(s.findConceptGUID("Technology"))
+	influences := s.findConceptGUID("Influences")
+	aliceRel := CreateRelationship(EntityGUID(alice.SeedID), technology, influences, nil)
+	bobRel := CreateRelationship(EntityGUID(bob.SeedID), technology, influences, nil)
+	for _, rel := range []*Relationship{aliceRel, bobRel} {
+		if err := s.putRelationship(ctx, rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		steward SeedGUID
+		rel     RelationshipGUID
+		kind    string
+	}{
+		{alice.SeedID, aliceRel.ID, interactEvent},
+		{bob.SeedID, bobRel.ID, interactEvent},
+		{alice.SeedID, aliceRel.ID, deepenEvent},
+	}
+	for i, step := range steps {
+		interactionType := drumming
+		if step.kind == deepenEvent {
+			interactionType = ""
+		}
+		if _, err := s.applyInteraction(asSteward(step.steward, false), step.rel, step.kind, interactionType, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all := queryInteractions(InteractionQuery{})
+	if len(all) != len(steps) {
+		t.Fatalf("logged %d events, want %d", len(all), len(steps))
+	}
+	for i, event := range all {
+		if !mem.has(event.CID) {
+			t.Errorf("event %d not added to the network", i)
+		}
+		if i > 0 && event.PreviousCID != all[i-1].CID {
+			t.Errorf("event %d follows %s, want %s", i, event.PreviousCID, all[i-1].CID)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    InteractionQuery
+		want int
+	}{
+		{"by relationship", InteractionQuery{RelationshipID: aliceRel.ID}, 2},
+		{"by steward", InteractionQuery{StewardID: bob.SeedID}, 1},
+		{"by kind", InteractionQuery{Kind: deepenEvent}, 1},
+		{"since", InteractionQuery{Since: start.Add(time.Hour)}, 2},
+		{"until", InteractionQuery{Until: start.Add(time.Hour)}, 1},
+		{"newest only", InteractionQuery{Limit: 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryInteractions(tt.q); len(got) != tt.want {
+				t.Errorf("%d events, want %d", len(got), tt.want)
+			}
+		})
+	}
+	if newest := queryInteractions(InteractionQuery{Limit: 1}); newest[0].CID != all[2].CID {
+		t.Error("a limit did not keep the newest event")
+	}
+
+	w := serve(s, http.MethodGet, "/interactions?steward="+string(alice.SeedID)+"&since="+start.Add(time.Hour).Format(time.RFC3339), "", nil)
+	var served []*InteractionEvent
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil || len(served) != 1 || served[0].Kind != deepenEvent {
+		t.Errorf("GET /interactions answered %s", w.Body)
+	}
+	if w := serve(s, http.MethodGet, "/interactions?since=yesterday", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid timestamp answered %d", w.Code)
+	}
+
+	stateStore.Close()
+	if err := openStateStore(ctx, nodeConfig.StoreDir, false); err != nil {
+		t.Fatal(err)
+	}
+	loadInteractionLog(ctx)
+	reloaded := queryInteractions(InteractionQuery{})
+	if len(reloaded) != len(all) {
+		t.Fatalf("%d events after reopening the store, want %d", len(reloaded), len(all))
+	}
+	for i := range all {
+		if reloaded[i].CID != all[i].CID || reloaded[i].Metrics != all[i].Metrics {
+			t.Errorf("event %d reloaded as %+v, want %+v", i, reloaded[i], all[i])
+		}
+	}
+}
@@ -3,18 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
-	"sync"
-	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 const (
 	peerListPath      = "/ccn/peer-list.json"
 	stewardGUIDPath   = "/ccn/steward-guid.json"
 	relationshipsPath = "/ccn/relationships.json"
+	ontologyStatePath = "/ccn/ontology-state.json"
 
 	conceptsPath      = "/ccn/concepts.json"
 	conceptID2CIDPath = "/ccn/conceptID-CID.json"
@@ -23,160 +22,341 @@ const (
 	seedID2CIDPath = "/ccn/seedID-CID.json"
 )
 
+// maxStoreAttempts bounds how often a version is made again because the entity
+// changed while it was being added to the network
+const maxStoreAttempts = 5
+
+var errConcurrentChange = errors.New("changed concurrently while being stored")
+
+// Update stores a new version of the concept that points back at the current
+// one; an unchanged concept keeps its CID
 func (c *Concept) Update(ctx context.Context) error {
-	if c.CID != "" {
-		network.Remove(ctx, c.CID)
-		c.CID = ""
-	}
+	previous := c.CID
 	conceptJSON, _ := json.Marshal(c)
-	cid, err := network.Add(ctx, strings.NewReader(string(conceptJSON)))
+	data, version, changed, err := nextVersion(ctx, previous, conceptJSON)
+	if err != nil || !changed {
+		return err
+	}
+	cid, err := network.Add(ctx, strings.NewReader(string(data)))
 	if err != nil {
 		return err
 	}
 	c.CID = cid
+	c.PreviousCID = previous
+	c.Version = version
 	return nil
 }
 
-func addOrUpdateConcept(ctx context.Context, concept *Concept, pID PeerID) error {
-	conceptMu.Lock()
-	defer conceptMu.Unlock()
-
-	if err := concept.Update(ctx); err != nil {
-		log.Printf("Failed to update concept: %v", err)
+func (s *Server) addOrUpdateConcept(ctx context.Context, concept *Concept, pID PeerID) error {
+	if err := s.storeConcept(ctx, concept, pID); err != nil {
 		return err
 	}
-	conceptMap[concept.ID] = concept
-	conceptID2CID[concept.ID] = concept.GetCID()
-	log.Printf("Added/Updated concept: %s\n", concept)
 
-	if err := saveConcepts(ctx); err != nil {
-		log.Printf("Failed to save concept list: %v", err)
-		return err
-	}
+	return s.persist(ctx)
+}
 
-	peerMap[pID].AddConceptCID(concept.GetCID())
-	if err := savePeerList(ctx); err != nil {
-		log.Printf("Failed to save peer list: %v", err)
+// storeConcept adds a new version of the concept to the network and the concept
+// map without saving the map. The version is added without holding the map's
+// lock and only stored if the concept did not change meanwhile; otherwise it is
+// made again from the concept now stored.
+func (s *Server) storeConcept(ctx context.Context, concept *Concept, pID PeerID) error {
+	return s.storeConceptVersion(ctx, concept, pID, true)
+}
+
+// storeConceptLinks is storeConcept for a concept whose relationship list is
+// to be stored as it is, for repairing the list
+func (s *Server) storeConceptLinks(ctx context.Context, concept *Concept, pID PeerID) error {
+	return s.storeConceptVersion(ctx, concept, pID, false)
+}
+
+func (s *Server) storeConceptVersion(ctx context.Context, concept *Concept, pID PeerID, keepLinks bool) error {
+	baseCID, baseVersion := concept.CID, concept.Version
+	var oldCID CID
+	for attempt := 1; ; attempt++ {
+		// A replacement object continues the existing concept's version chain.
+		// The relationship list is kept by linkRelationship and unlinkRelationship,
+		// so a writer holding an older copy cannot drop links made since.
+		existing, _ := s.concepts.Get(concept.ID)
+		concept.CID, concept.Version = baseCID, baseVersion
+		if existing != nil {
+			if baseCID == "" {
+				concept.CID = existing.CID
+				concept.Version = existing.Version
+			}
+			if keepLinks {
+				concept.Relationships = existing.Relationships
+			}
+		}
+		oldCID = concept.CID
+		if err := concept.Update(ctx); err != nil {
+			log.Printf("Failed to update concept: %v", err)
+			return err
+		}
+		if s.concepts.Replace(ctx, concept, existing) {
+			if concept.CID != oldCID {
+				journalFrom(ctx).addVersion(concept.CID)
+			}
+			break
+		}
+		if attempt == maxStoreAttempts {
+			return fmt.Errorf("concept %s: %w", concept.ID, errConcurrentChange)
+		}
 	}
+	log.Printf("Added/Updated concept: %s\n", concept)
+
+	s.peers.Update(ctx, pID, func(peer *Peer) {
+		if oldCID != "" && oldCID != concept.GetCID() {
+			peer.RemoveConceptCID(oldCID)
+		}
+		peer.AddConceptCID(concept.GetCID())
+	})
 	return nil
 }
 
-func addNewConcept(ctx context.Context, concept *Concept, pID PeerID) {
-	addOrUpdateConcept(ctx, concept, pID)
+// removeRelationship deletes a relationship and unlinks it from its endpoints;
+// callers are responsible for saving the affected maps
+func (s *Server) removeRelationship(ctx context.Context, id RelationshipGUID) bool {
+	rel, ok := s.relationships.Delete(ctx, id)
+	if !ok {
+		return false
+	}
 
-	go publishPeerMessage(context.Background())
+	s.unlinkRelationship(ctx, rel)
+	return true
 }
 
-func periodicSend(conn *websocket.Conn, sendFunc func(*websocket.Conn)) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// linkRelationship records a relationship on the concepts or seeds at its endpoints
+func (s *Server) linkRelationship(ctx context.Context, rel *Relationship) {
+	for _, endpoint := range []EntityGUID{rel.SourceID, rel.TargetID} {
+		if concept, ok := s.concepts.Get(ConceptGUID(endpoint)); ok && !hasRelationship(concept.Relationships, rel.ID) {
+			s.concepts.Update(ctx, concept.ID, func(concept *Concept) error {
+				if !hasRelationship(concept.Relationships, rel.ID) {
+					concept.AddRelationship(rel.ID)
+				}
+				return nil
+			})
+		}
+		if seed, ok := s.seeds.Get(SeedGUID(endpoint)); ok && !hasRelationship(seed.GetRelationships(), rel.ID) {
+			s.seeds.Update(ctx, seed.GetSeedID(), func(seed Seed_i) error {
+				if !hasRelationship(seed.GetRelationships(), rel.ID) {
+					seed.AddRelationship(rel.ID)
+				}
+				return nil
+			})
+		}
+	}
+}
 
-	for {
-		<-ticker.C
-		sendFunc(conn)
+// unlinkRelationship removes a relationship from the concepts or seeds at its endpoints
+func (s *Server) unlinkRelationship(ctx context.Context, rel *Relationship) {
+	for _, endpoint := range []EntityGUID{rel.SourceID, rel.TargetID} {
+		if concept, ok := s.concepts.Get(ConceptGUID(endpoint)); ok && hasRelationship(concept.Relationships, rel.ID) {
+			s.concepts.Update(ctx, concept.ID, func(concept *Concept) error {
+				concept.Relationships = withoutRelationship(concept.Relationships, rel.ID)
+				return nil
+			})
+		}
+		if seed, ok := s.seeds.Get(SeedGUID(endpoint)); ok && hasRelationship(seed.GetRelationships(), rel.ID) {
+			s.seeds.Update(ctx, seed.GetSeedID(), func(seed Seed_i) error {
+				core := seed.GetCoreSeed()
+				core.Relationships = withoutRelationship(core.Relationships, rel.ID)
+				return nil
+			})
+		}
 	}
 }
 
-func keepAlive(conn *websocket.Conn) {
-	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
-			log.Printf("WebSocket read error: %v", err)
-			break
+func hasRelationship(ids []RelationshipGUID, id RelationshipGUID) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
 		}
 	}
+	return false
 }
 
-func sendConceptList(conn *websocket.Conn) {
-	sendJSONList(conn, conceptMap, &conceptMu, "concept map")
+func withoutRelationship(ids []RelationshipGUID, id RelationshipGUID) []RelationshipGUID {
+	ret := ids[:0]
+	for _, existing := range ids {
+		if existing != id {
+			ret = append(ret, existing)
+		}
+	}
+	return ret
+}
+
+// relationshipsOf returns the relationships that use guid as source, target or type
+func (s *Server) relationshipsOf(guid EntityGUID) []RelationshipGUID {
+	var ids []RelationshipGUID
+	for _, rel := range s.relationships.Select(func(rel *Relationship) bool {
+		return rel.SourceID == guid || rel.TargetID == guid || EntityGUID(rel.Type) == guid
+	}) {
+		ids = append(ids, rel.ID)
+	}
+	return ids
+}
+
+// removeConcept deletes a concept together with every relationship that references it
+func (s *Server) removeConcept(ctx context.Context, guid ConceptGUID) (int, error) {
+	concept, removed, err := s.detachConcept(ctx, guid)
+	if err != nil {
+		return 0, err
+	}
+	unpinHistory(ctx, concept.GetCID())
+	return removed, nil
 }
 
-func sendPeerList(conn *websocket.Conn) {
-	peerMapMu.RLock()
-	defer peerMapMu.RUnlock()
+// detachConcept removes a concept and its relationships from the maps but keeps
+// its versions pinned
+func (s *Server) detachConcept(ctx context.Context, guid ConceptGUID) (*Concept, int, error) {
+	if _, exists := s.concepts.Get(guid); !exists {
+		return nil, 0, fmt.Errorf("concept not found: %s", guid)
+	}
 
-	filteredPeerMap := make(map[PeerID]Peer_i)
-	for peerID, peer := range peerMap {
-		if peer.GetStewardID() != "" {
-			filteredPeerMap[peerID] = peer
+	removed := 0
+	for _, id := range s.relationshipsOf(EntityGUID(guid)) {
+		if s.removeRelationship(ctx, id) {
+			removed++
 		}
 	}
 
-	if err := conn.WriteJSON(filteredPeerMap); err != nil {
-		log.Printf("Failed to send peer list: %v", err)
-	} else {
-		log.Printf("Sent filtered peer list with %d peers", len(filteredPeerMap))
+	concept, exists := s.concepts.Delete(ctx, guid)
+	if !exists {
+		return nil, 0, fmt.Errorf("concept not found: %s", guid)
 	}
+	s.peers.Update(ctx, peerID, func(peer *Peer) {
+		peer.RemoveConceptCID(concept.GetCID())
+	})
+	return concept, removed, nil
 }
 
-func sendJSONList(conn *websocket.Conn, list any, mu sync.Locker, itemType string) {
-	mu.Lock()
-	defer mu.Unlock()
+// conceptDependents returns the relationships typed by a concept and the seeds
+// created from it; deleting the concept would orphan them
+func (s *Server) conceptDependents(guid ConceptGUID) ([]RelationshipGUID, []SeedGUID) {
+	var typed []RelationshipGUID
+	for _, rel := range s.relationships.Select(func(rel *Relationship) bool { return rel.Type == guid }) {
+		typed = append(typed, rel.ID)
+	}
 
-	if err := conn.WriteJSON(list); err != nil {
-		log.Printf("Failed to send %s: %v", itemType, err)
-	} else {
-		log.Printf("Sent %s", itemType)
+	var seeds []SeedGUID
+	for id, seed := range s.seeds.Snapshot() {
+		if seed.GetCoreSeed().ConceptID == guid {
+			seeds = append(seeds, id)
+		}
+	}
+	return typed, seeds
+}
+
+// removeSeed deletes a seed together with every relationship that references it
+func (s *Server) removeSeed(ctx context.Context, guid SeedGUID) (int, error) {
+	seed, removed, err := s.detachSeed(ctx, guid)
+	if err != nil {
+		return 0, err
+	}
+	unpinHistory(ctx, seed.GetCID())
+	return removed, nil
+}
+
+// detachSeed removes a seed and its relationships from the maps but keeps its
+// versions pinned
+func (s *Server) detachSeed(ctx context.Context, guid SeedGUID) (Seed_i, int, error) {
+	if _, exists := s.seeds.Get(guid); !exists {
+		return nil, 0, fmt.Errorf("seed not found: %s", guid)
+	}
+
+	removed := 0
+	for _, id := range s.relationshipsOf(EntityGUID(guid)) {
+		if s.removeRelationship(ctx, id) {
+			removed++
+		}
 	}
+
+	seed, exists := s.seeds.Delete(ctx, guid)
+	if !exists {
+		return nil, 0, fmt.Errorf("seed not found: %s", guid)
+	}
+	s.peers.Update(ctx, peerID, func(peer *Peer) {
+		peer.RemoveSeedCID(seed.GetCID())
+	})
+	return seed, removed, nil
+}
+
+// addNewConcept stores a concept made on this node and announces it. The name
+// must not be in use by another concept.
+func (s *Server) addNewConcept(ctx context.Context, concept *Concept, pID PeerID) error {
+	if err := s.checkConceptName(concept.ID, concept.Name); err != nil {
+		return err
+	}
+	if err := s.addOrUpdateConcept(ctx, concept, pID); err != nil {
+		return err
+	}
+
+	s.announce()
+	return nil
 }
 
-func handleReceivedMessage(data []byte) {
+// handleReceivedMessage takes in a peer's announcement. It is dropped when the
+// peer is not accepted, or when the network knows the sender and it is not the
+// peer the message claims to be from.
+func (s *Server) handleReceivedMessage(msg NetworkMessage) {
+	ctx := context.Background()
 	var message PeerMessage
-	if err := json.Unmarshal(data, &message); err != nil {
+	if err := json.Unmarshal(msg.Data, &message); err != nil {
 		log.Printf("Error unmarshaling received message: %v", err)
 		return
 	}
+	if msg.From != "" && msg.From != message.PeerID {
+		log.Printf("Dropped message from %s claiming to be from peer %s", msg.From, message.PeerID)
+		return
+	}
+	if !acceptPeer(message.PeerID) {
+		log.Printf("Dropped message from peer %s, which is not accepted", message.PeerID)
+		return
+	}
 
 	log.Printf("Received message from peer: %s", message.PeerID)
 
 	// Add or update the sender in the peer list
-	addOrUpdatePeer(context.Background(), message.PeerID, message.StewardID)
+	s.addOrUpdatePeer(ctx, message.PeerID, message.StewardClaims)
+
+	// Update the CIDs for this peer, first, so the received relationships can
+	// refer to the concepts and seeds it announced
+	s.updatePeerCIDs(message.PeerID, message.ConceptCIDs, message.SeedCIDs)
+
+	// Steward seeds that just arrived may prove more of the peer's claims
+	s.addOrUpdatePeer(ctx, message.PeerID, message.StewardClaims)
 
-	// Update local relationships with received ones
+	// Add the received relationships we do not have yet
+	s.updateMu.Lock()
 	for id, relationship := range message.Relationships {
-		relationshipMu.Lock()
-		if _, exists := relationshipMap[id]; !exists {
-			relationshipMap[id] = relationship
+		relationship.ID = id
+		if err := s.addPeerRelationship(ctx, message.PeerID, relationship); err != nil {
+			log.Printf("Rejected relationship %s from peer %s: %v", id, message.PeerID, err)
 		}
-		relationshipMu.Unlock()
 	}
-	saveRelationships(context.Background())
-
-	// Update the CIDs for this peer
-	updatePeerCIDs(message.PeerID, message.ConceptCIDs, message.SeedCIDs)
+	s.updateMu.Unlock()
+	s.persist(ctx)
 }
 
-// Modify the Interact method of Relationship
-func (r *Relationship) Interact(interactionType ConceptGUID) {
-	//	r.Interactions++
-	//	r.Depth = int(math.Log2(float64(r.Interactions))) + 1
-	//	r.LastInteraction = time.Now()
-
-	// Get the interaction type concept
-	conceptMu.RLock()
-	interactionConcept, ok := conceptMap[interactionType]
-	conceptMu.RUnlock()
-
-	if !ok {
-		log.Printf("Interaction type %s not found", interactionType)
-		return
+// addPeerRelationship adds a relationship a peer announced, unless we have it,
+// checking it like one made here and linking it to its endpoints. The caller
+// holds updateMu.
+func (s *Server) addPeerRelationship(ctx context.Context, from PeerID, rel *Relationship) error {
+	if _, exists := s.relationships.Get(rel.ID); exists {
+		return nil
 	}
-
-	log.Printf("Name=%s\n", interactionConcept.Name)
-	// Apply effects based on the interaction type
-	//	switch interactionConcept.Name {
-	//	case "Music":
-	//		r.FrequencySpec = append(r.FrequencySpec, 440.0) // Add A4 note
-	//		r.Amplitude *= 1.05
-	//	case "Meditation":
-	//		r.EnergyFlow *= 1.1
-	//		r.Volume *= 0.95
-	//	case "FlowState":
-	//		r.EnergyFlow *= 1.2
-	//		r.Amplitude *= 1.1
-	//		r.Volume *= 1.05
-	//	default:
-	//		r.EnergyFlow *= 1.05
-	//	}
-
-	r.Timestamp = time.Now()
+	if err := s.authorizePeerRelationship(from, rel); err != nil {
+		return err
+	}
+	if err := s.validateRelationship(rel.SourceID, rel.TargetID, rel.Type); err != nil {
+		return err
+	}
+	if err := validateRelationshipProperties(rel.Type, rel.Properties); err != nil {
+		return err
+	}
+	if err := s.putRelationship(ctx, rel); err != nil {
+		return err
+	}
+	s.linkRelationship(ctx, rel)
+	return nil
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReceivedMessageNeedsStewardClaims(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice, aliceKey := newKeyedSteward(t, s, "Alice")
+	influences := s.findConceptGUID("Influences")
+	technology := EntityGUID(s.findConceptGUID("Technology"))
+	fromConcept := CreateRelationship(technology, EntityGUID(s.findConceptGUID("Society")), influences, nil)
+	fromAlice := CreateRelationship(EntityGUID(alice.SeedID), technology, influences, nil)
+
+	receive := func(message PeerMessage) {
+		data, _ := json.Marshal(message)
+		s.handleReceivedMessage(NetworkMessage{From: message.PeerID, Data: data})
+	}
+	// Claiming to run the node's admin steward takes more than naming it
+	receive(PeerMessage{
+		PeerID:        "mallory-node",
+		StewardID:     defaultSteward(),
+		StewardIDs:    []SeedGUID{defaultSteward(), alice.SeedID},
+		Relationships: RelationshipMap{fromConcept.ID: fromConcept, fromAlice.ID: fromAlice},
+	})
+	if peer, _ := s.peers.Get("mallory-node"); peer == nil || len(peer.GetStewardIDs()) > 0 {
+		t.Errorf("peer runs %v without claims", peer)
+	}
+	if _, ok := s.relationships.Get(fromConcept.ID); ok {
+		t.Error("relationship between concepts added from a peer without an admin")
+	}
+	if _, ok := s.relationships.Get(fromAlice.ID); ok {
+		t.Error("relationship from Alice's seed added from a peer not running her")
+	}
+
+	receive(PeerMessage{
+		PeerID:        "alice-node",
+		StewardClaims: map[SeedGUID]string{alice.SeedID: claimOn("alice-node", alice, aliceKey)},
+		Relationships: RelationshipMap{fromAlice.ID: fromAlice},
+	})
+	if peer, _ := s.peers.Get("alice-node"); peer == nil || !peer.HasSteward(alice.SeedID) {
+		t.Error("peer with a valid claim does not run Alice")
+	}
+	if _, ok := s.relationships.Get(fromAlice.ID); !ok {
+		t.Error("relationship from Alice's seed not added from the peer running her")
+	}
+}
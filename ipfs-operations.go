@@ -3,77 +3,224 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 )
 
-func saveData(ctx context.Context, path string, data any) error {
-	if err := network.Save(ctx, path, data); err != nil {
-		log.Printf("Failed to save data at %s: %v", path, err)
-		return err
+// statePaths are the documents the node's state is saved as. They used to be
+// files in IPFS MFS; they are now buckets of the state store, one entry per
+// concept, seed, relationship or peer.
+var statePaths = []string{
+	peerListPath, stewardGUIDPath, relationshipsPath, ontologyStatePath,
+	conceptsPath, conceptID2CIDPath, seedsPath, seedID2CIDPath, interactionLogPath,
+}
+
+// openStateStore opens the state store in dir. A new store is filled from the
+// files the node previously kept in IPFS MFS. A read-only store can be opened
+// while a node runs on dir; writes to it fail.
+func openStateStore(ctx context.Context, dir string, readOnly bool) error {
+	if readOnly {
+		store, err := openFileStoreReadOnly(dir)
+		if err != nil {
+			return fmt.Errorf("failed to open state store %s: %v", dir, err)
+		}
+		stateStore = store
+		return nil
+	}
+	store, err := openFileStore(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open state store %s: %w", dir, err)
+	}
+	stateStore = store
+
+	for _, path := range statePaths {
+		if len(store.Keys(path)) > 0 {
+			return nil
+		}
+	}
+	migrated := 0
+	for _, path := range statePaths {
+		var data json.RawMessage
+		if err := network.Load(ctx, mfsPath(path), &data); err != nil {
+			continue
+		}
+		if err := saveData(ctx, path, data); err != nil {
+			return fmt.Errorf("failed to migrate %s: %v", path, err)
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("Migrated %d state files from IPFS MFS to %s", migrated, dir)
+		return store.Compact()
 	}
 	return nil
 }
 
-func saveRelationships(ctx context.Context) error {
-	relationshipMu.RLock()
-	defer relationshipMu.RUnlock()
-	return saveData(ctx, relationshipsPath, relationshipMap)
+func compactStateStore(ctx context.Context) {
+	if err := stateStore.Compact(); err != nil {
+		log.Printf("Failed to compact state store: %v", err)
+	}
 }
 
-func saveConcepts(ctx context.Context) error {
-	conceptMu.RLock()
-	defer conceptMu.RUnlock()
-	if err := saveData(ctx, conceptsPath, conceptMap); err != nil {
-		return err
+// saveData stores a document, writing only the entries that changed
+func saveData(ctx context.Context, path string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err == nil {
+		var ops []StoreOp
+		if ops, err = documentOps(stateStore, path, encoded); err == nil {
+			err = stateStore.Apply(ops)
+		}
 	}
-	if err := saveData(ctx, conceptID2CIDPath, conceptID2CID); err != nil {
+	if err != nil {
+		log.Printf("Failed to save data at %s: %v", path, err)
 		return err
 	}
 	return nil
 }
 
-func savePeerList(ctx context.Context) error {
-	return saveData(ctx, peerListPath, peerMap)
+func loadData(ctx context.Context, path string, target any) error {
+	data, ok := loadDocument(stateStore, path)
+	if !ok {
+		return fmt.Errorf("no data at %s", path)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("failed to decode data at %s: %v", path, err)
+	}
+	return nil
 }
 
-func saveSeeds(ctx context.Context) error {
-	if err := saveData(ctx, seedsPath, seedMap); err != nil {
+// persist writes the concepts, seeds, relationships and peers changed since
+// the last persist to the state store: each entity is put or deleted on its
+// own, and a concept or seed is written with its CID in the same operation
+func (s *Server) persist(ctx context.Context) error {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+
+	conceptIDs := s.concepts.TakeChanged()
+	seedIDs := s.seeds.TakeChanged()
+	relationshipIDs := s.relationships.TakeChanged()
+	peerIDs := s.peers.TakeChanged()
+
+	var ops []StoreOp
+	add := func(bucket, member string, value any) error {
+		op, err := memberOp(bucket, member, value)
+		if err == nil {
+			ops = append(ops, op)
+		}
 		return err
 	}
-	if err := saveData(ctx, seedID2CIDPath, seedID2CID); err != nil {
+	err := func() error {
+		for _, id := range conceptIDs {
+			var value, cid any
+			if concept, ok := s.concepts.Get(id); ok {
+				value, cid = concept, concept.GetCID()
+			}
+			if err := add(conceptsPath, string(id), value); err != nil {
+				return err
+			}
+			if err := add(conceptID2CIDPath, string(id), cid); err != nil {
+				return err
+			}
+		}
+		for _, id := range seedIDs {
+			var value, cid any
+			if seed, ok := s.seeds.Get(id); ok {
+				value, cid = seed, seed.GetCID()
+			}
+			if err := add(seedsPath, string(id), value); err != nil {
+				return err
+			}
+			if err := add(seedID2CIDPath, string(id), cid); err != nil {
+				return err
+			}
+		}
+		for _, id := range relationshipIDs {
+			var value any
+			if relationship, ok := s.relationships.Get(id); ok {
+				value = relationship
+			}
+			if err := add(relationshipsPath, string(id), value); err != nil {
+				return err
+			}
+		}
+		for _, id := range peerIDs {
+			var value any
+			if peer, ok := s.peers.Get(id); ok {
+				value = peer
+			}
+			if err := add(peerListPath, string(id), value); err != nil {
+				return err
+			}
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+		return stateStore.Apply(withMapMarkers(stateStore, ops))
+	}()
+	if err != nil {
+		s.concepts.MarkChanged(conceptIDs...)
+		s.seeds.MarkChanged(seedIDs...)
+		s.relationships.MarkChanged(relationshipIDs...)
+		s.peers.MarkChanged(peerIDs...)
+		log.Printf("Failed to persist state: %v", err)
 		return err
 	}
 	return nil
 }
 
-func publishPeerMessage(ctx context.Context) {
-	peerMapMu.RLock()
-	peer, exists := peerMap[peerID]
-	peerMapMu.RUnlock()
+// announce asks publishRoutine to send the node's state to its peers. Changes
+// made while an announcement is pending go out with it, so a burst of writes
+// publishes once.
+func (s *Server) announce() {
+	select {
+	case s.announceCh <- struct{}{}:
+	default:
+	}
+}
+
+// publishRoutine publishes the peer message every interval and when changes
+// are announced
+func (s *Server) publishRoutine(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.announceCh:
+		}
+		s.publishPeerMessage(ctx)
+	}
+}
 
+func (s *Server) publishPeerMessage(ctx context.Context) {
+	peer, exists := s.peers.Get(peerID)
 	if !exists {
 		log.Printf("Peer information not set for this peer")
 		return
 	}
 
-	conceptMu.RLock()
-	conceptCIDs := make([]CID, 0, len(conceptMap))
-	for _, concept := range conceptMap {
-		conceptCIDs = append(conceptCIDs, concept.GetCID())
+	conceptCIDs := make([]CID, 0, s.concepts.Len())
+	for _, cid := range s.concepts.CIDs() {
+		conceptCIDs = append(conceptCIDs, cid)
 	}
-	conceptMu.RUnlock()
 
-	seedCIDs := make([]CID, 0, len(seedMap))
-	for _, seed := range seedMap {
-		seedCIDs = append(seedCIDs, seed.GetCID())
+	seedCIDs := make([]CID, 0, s.seeds.Len())
+	for _, cid := range s.seeds.CIDs() {
+		seedCIDs = append(seedCIDs, cid)
 	}
 
 	message := PeerMessage{
 		PeerID:        peerID,
-		StewardID:     peer.GetStewardID(),
+		StewardID:     defaultSteward(),
+		StewardIDs:    peer.GetStewardIDs(),
+		StewardClaims: localStewardClaims(),
 		ConceptCIDs:   conceptCIDs,
 		SeedCIDs:      seedCIDs,
-		Relationships: relationshipMap,
+		Relationships: s.relationships.Snapshot(),
 	}
 
 	data, err := json.Marshal(message)
@@ -82,27 +229,27 @@ func publishPeerMessage(ctx context.Context) {
 		return
 	}
 
-	if err := network.Publish(ctx, pubsubTopic, data); err != nil {
+	if err := network.Publish(ctx, pubsubTopic(), data); err != nil {
 		log.Printf("Error publishing peer message: %v", err)
 	} else {
 		log.Printf("Published peer message with %d CIDs", len(conceptCIDs))
 	}
 }
 
-func subscribeRoutine(ctx context.Context) {
-	ch, err := network.Subscribe(ctx, pubsubTopic)
+func (s *Server) subscribeRoutine(ctx context.Context) {
+	ch, err := network.Subscribe(ctx, pubsubTopic())
 	if err != nil {
 		log.Fatalf("Error subscribing to topic: %v", err)
 	}
 
-	log.Printf("Subscribed to topic: %s", pubsubTopic)
+	log.Printf("Subscribed to topic: %s", pubsubTopic())
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case msg := <-ch:
-			handleReceivedMessage(msg)
+			s.handleReceivedMessage(msg)
 		}
 	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -51,13 +52,13 @@ func (i *IPFSShell) Publish(ctx context.Context, topic string, data []byte) erro
 	return i.sh.PubSubPublish(topic, string(data))
 }
 
-func (i *IPFSShell) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+func (i *IPFSShell) Subscribe(ctx context.Context, topic string) (<-chan NetworkMessage, error) {
 	sub, err := i.sh.PubSubSubscribe(topic)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan []byte)
+	ch := make(chan NetworkMessage)
 	go func() {
 		defer close(ch)
 		for {
@@ -69,7 +70,7 @@ func (i *IPFSShell) Subscribe(ctx context.Context, topic string) (<-chan []byte,
 				log.Printf("Error receiving message: %v", err)
 				continue
 			}
-			ch <- msg.Data
+			ch <- NetworkMessage{From: PeerID(msg.From.String()), Data: msg.Data}
 		}
 	}()
 
@@ -81,31 +82,43 @@ func (i *IPFSShell) Connect(ctx context.Context, peerID PeerID) error {
 }
 
 func (i *IPFSShell) ListPeers(ctx context.Context) ([]Peer_i, error) {
-	swarmPeers, err := i.sh.SwarmPeers(ctx)
-	if err != nil {
+	var swarmPeers shell.SwarmConnInfos
+	if err := i.sh.Request("swarm/peers").Option("latency", true).Exec(ctx, &swarmPeers); err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	peers := make([]Peer_i, len(swarmPeers.Peers))
 	for j, p := range swarmPeers.Peers {
+		latency, _ := time.ParseDuration(p.Latency)
 		peers[j] = &Peer{
 			ID:        PeerID(p.Peer),
-			Timestamp: time.Now(),
+			Timestamp: now,
+			LastSeen:  now,
+			Latency:   latency,
 		}
 	}
 
 	return peers, nil
 }
 
-func (i *IPFSShell) Bootstrap(ctx context.Context) error {
-	bootstrapNodes := []string{
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa",
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb",
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+func (i *IPFSShell) TopicPeers(ctx context.Context, topic string) ([]PeerID, error) {
+	var out struct{ Strings []string }
+	// the API takes topics multibase-encoded, as base64url with a "u" prefix
+	encoded := "u" + base64.RawURLEncoding.EncodeToString([]byte(topic))
+	if err := i.sh.Request("pubsub/peers", encoded).Exec(ctx, &out); err != nil {
+		return nil, err
 	}
 
-	for _, addr := range bootstrapNodes {
+	peers := make([]PeerID, len(out.Strings))
+	for j, p := range out.Strings {
+		peers[j] = PeerID(p)
+	}
+	return peers, nil
+}
+
+func (i *IPFSShell) Bootstrap(ctx context.Context, addrs []string) error {
+	for _, addr := range addrs {
 		if err := i.sh.SwarmConnect(ctx, addr); err != nil {
 			log.Printf("Failed to connect to bootstrap node %s: %v", addr, err)
 			// } else {
@@ -116,6 +129,18 @@ func (i *IPFSShell) Bootstrap(ctx context.Context) error {
 	return nil
 }
 
+// AddStaticPeer adds the peer to the daemon's peering set, which it keeps
+// connected to
+func (i *IPFSShell) AddStaticPeer(ctx context.Context, addr string) error {
+	_, err := i.sh.SwarmPeeringAdd(ctx, addr)
+	return err
+}
+
+func (i *IPFSShell) RemoveBootstrapNodes(ctx context.Context) error {
+	_, err := i.sh.BootstrapRmAll()
+	return err
+}
+
 func (i *IPFSShell) ID(ctx context.Context) (PeerID, error) {
 	info, err := i.sh.ID()
 	if err != nil {
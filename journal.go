@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// journal keeps the changes made with one context, so a batch can publish them
+// once it commits or undo them if it fails. Repositories record every change
+// into the journal of the context it is made with; changes made with other
+// contexts meanwhile are published as usual and are not touched by an undo.
+type journal struct {
+	mu       sync.Mutex
+	events   []func()
+	undos    []func()
+	versions []CID
+}
+
+type journalKey struct{}
+
+// withJournal returns a context whose changes are kept in a new journal
+func withJournal(ctx context.Context) (context.Context, *journal) {
+	j := &journal{}
+	return context.WithValue(ctx, journalKey{}, j), j
+}
+
+// journalFrom returns the journal of ctx, or nil if it has none
+func journalFrom(ctx context.Context) *journal {
+	j, _ := ctx.Value(journalKey{}).(*journal)
+	return j
+}
+
+// recordChange publishes a change a repository just stored or, if ctx has a
+// journal, keeps its event back with undo, which puts the previous value back.
+// Repositories call it while they hold their lock.
+func recordChange(ctx context.Context, events *EventBus, kind, op, id string, data any, undo func()) {
+	j := journalFrom(ctx)
+	if j == nil {
+		events.publish(kind, op, id, data)
+		return
+	}
+	j.add(func() { events.publish(kind, op, id, data) }, undo)
+}
+
+// add keeps back the publish of a change and records how to undo it
+func (j *journal) add(publish, undo func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, publish)
+	j.undos = append(j.undos, undo)
+}
+
+// addVersion records a version added to the network, removed again on rollback
+func (j *journal) addVersion(cid CID) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.versions = append(j.versions, cid)
+}
+
+// commit publishes the events kept back, in the order the changes were made
+func (j *journal) commit() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, publish := range j.events {
+		publish()
+	}
+	j.events, j.undos, j.versions = nil, nil, nil
+}
+
+// rollback undoes the changes, latest first, drops their events and removes
+// the versions they added
+func (j *journal) rollback(ctx context.Context) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(j.undos) - 1; i >= 0; i-- {
+		j.undos[i]()
+	}
+	for _, cid := range j.versions {
+		network.Remove(ctx, cid)
+	}
+	j.events, j.undos, j.versions = nil, nil, nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// patchOperation is one operation of an RFC 6902 JSON Patch. HasValue tells
+// a missing value from a null one.
+type patchOperation struct {
+	Op       string
+	Path     string
+	From     string
+	Value    json.RawMessage
+	HasValue bool
+}
+
+func (op *patchOperation) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for name, target := range map[string]*string{"op": &op.Op, "path": &op.Path, "from": &op.From} {
+		if raw, ok := members[name]; ok {
+			if err := json.Unmarshal(raw, target); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	op.Value, op.HasValue = members["value"]
+	return nil
+}
+
+// applyPatch applies a request body to a JSON document. The content type picks
+// the format; without one, an array is read as a JSON Patch and an object as a
+// merge patch.
+func applyPatch(doc map[string]any, contentType string, body []byte) (map[string]any, error) {
+	isJSONPatch := strings.HasPrefix(contentType, jsonPatchContentType)
+	if !isJSONPatch && !strings.HasPrefix(contentType, mergePatchContentType) {
+		isJSONPatch = strings.HasPrefix(strings.TrimSpace(string(body)), "[")
+	}
+
+	var result any
+	if isJSONPatch {
+		var ops []patchOperation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON Patch: %v", err)
+		}
+		var err error
+		if result, err = applyJSONPatch(doc, ops); err != nil {
+			return nil, err
+		}
+	} else {
+		var patch any
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, fmt.Errorf("invalid merge patch: %v", err)
+		}
+		result = mergePatch(doc, patch)
+	}
+
+	patched, ok := result.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("patch must leave an object")
+	}
+	return patched, nil
+}
+
+// mergePatch applies an RFC 7386 merge patch: objects are merged recursively,
+// null removes a member and anything else replaces the target
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+	merged := make(map[string]any, len(targetObj))
+	for k, v := range targetObj {
+		merged[k] = v
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = mergePatch(merged[k], v)
+		}
+	}
+	return merged
+}
+
+// applyJSONPatch applies RFC 6902 operations in order to a copy of doc. The
+// patch is atomic: on any error doc is left as it was.
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	doc = deepCopyJSON(doc)
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case "add", "replace", "test":
+			if !op.HasValue {
+				err = fmt.Errorf("missing value")
+				break
+			}
+			var value any
+			if err = json.Unmarshal(op.Value, &value); err != nil {
+				break
+			}
+			switch op.Op {
+			case "add":
+				doc, err = pointerAdd(doc, op.Path, value)
+			case "replace":
+				if op.Path == "" {
+					doc = value
+				} else if doc, _, err = pointerRemove(doc, op.Path); err == nil {
+					doc, err = pointerAdd(doc, op.Path, value)
+				}
+			case "test":
+				var current any
+				if current, err = pointerGet(doc, op.Path); err == nil && !reflect.DeepEqual(current, value) {
+					err = fmt.Errorf("test failed")
+				}
+			}
+		case "remove":
+			doc, _, err = pointerRemove(doc, op.Path)
+		case "move":
+			if op.From == op.Path {
+				_, err = pointerGet(doc, op.From)
+				break
+			}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				err = fmt.Errorf("cannot move a value into itself")
+				break
+			}
+			var value any
+			if doc, value, err = pointerRemove(doc, op.From); err == nil {
+				doc, err = pointerAdd(doc, op.Path, value)
+			}
+		case "copy":
+			var value any
+			if value, err = pointerGet(doc, op.From); err == nil {
+				doc, err = pointerAdd(doc, op.Path, deepCopyJSON(value))
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func deepCopyJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = deepCopyJSON(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = deepCopyJSON(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (!allowEnd && i == length) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc any, path string) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found")
+			}
+			current = value
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	}
+	return current, nil
+}
+
+// updateParent finds the container a pointer's last token refers into and
+// replaces it with the result of change, returning the new document. The
+// pointer must name a member, not the document itself.
+func updateParent(doc any, path string, change func(parent any, last string) (any, error)) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("path must not be the whole document")
+	}
+	var rebuild func(node any, rest []string) (any, error)
+	rebuild = func(node any, rest []string) (any, error) {
+		if len(rest) == 1 {
+			return change(node, rest[0])
+		}
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[rest[0]]
+			if !ok {
+				return nil, fmt.Errorf("path not found")
+			}
+			updated, err := rebuild(child, rest[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[rest[0]] = updated
+			return n, nil
+		case []any:
+			i, err := arrayIndex(rest[0], len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			updated, err := rebuild(n[i], rest[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[i] = updated
+			return n, nil
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	}
+	return rebuild(doc, tokens)
+}
+
+func pointerAdd(doc any, path string, value any) (any, error) {
+	if path == "" {
+		return value, nil
+	}
+	return updateParent(doc, path, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[last] = value
+			return p, nil
+		case []any:
+			i, err := arrayIndex(last, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	})
+}
+
+func pointerRemove(doc any, path string) (any, any, error) {
+	var removed any
+	updated, err := updateParent(doc, path, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			value, ok := p[last]
+			if !ok {
+				return nil, fmt.Errorf("path not found")
+			}
+			removed = value
+			delete(p, last)
+			return p, nil
+		case []any:
+			i, err := arrayIndex(last, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = p[i]
+			return append(p[:i], p[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	})
+	return updated, removed, err
+}
+
+// entityDocument is the JSON object form of a concept or seed that patches apply to
+func entityDocument(entity any) (map[string]any, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// checkUnchanged rejects a patch that touched any of the given fields
+func checkUnchanged(before, after map[string]any, fields ...string) error {
+	for _, field := range fields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			return fmt.Errorf("%s cannot be changed", field)
+		}
+	}
+	return nil
+}
+
+// decodeStrict decodes a patched document, rejecting members the target does
+// not have and values of the wrong type
+func decodeStrict(doc map[string]any, target any) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
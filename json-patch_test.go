@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	const doc = `{"Name":"seed","Tags":["a","b"],"Meta":{"x":1,"y":2}}`
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		want        string // empty when the patch fails
+	}{
+		// RFC 7386 merge patches
+		{"merge replaces", mergePatchContentType, `{"Name":"new"}`, `{"Name":"new","Tags":["a","b"],"Meta":{"x":1,"y":2}}`},
+		{"merge recurses", mergePatchContentType, `{"Meta":{"x":3,"z":4}}`, `{"Name":"seed","Tags":["a","b"],"Meta":{"x":3,"y":2,"z":4}}`},
+		{"merge null removes", mergePatchContentType, `{"Meta":{"y":null}}`, `{"Name":"seed","Tags":["a","b"],"Meta":{"x":1}}`},
+		{"merge replaces arrays", mergePatchContentType, `{"Tags":["c"]}`, `{"Name":"seed","Tags":["c"],"Meta":{"x":1,"y":2}}`},
+		{"merge must leave an object", mergePatchContentType, `"text"`, ``},
+
+		// RFC 6902 JSON Patches
+		{"add member", jsonPatchContentType, `[{"op":"add","path":"/Owner","value":"me"}]`, `{"Name":"seed","Owner":"me","Tags":["a","b"],"Meta":{"x":1,"y":2}}`},
+		{"add null", jsonPatchContentType, `[{"op":"add","path":"/Owner","value":null}]`, `{"Name":"seed","Owner":null,"Tags":["a","b"],"Meta":{"x":1,"y":2}}`},
+		{"add to end of array", jsonPatchContentType, `[{"op":"add","path":"/Tags/-","value":"c"}]`, `{"Name":"seed","Tags":["a","b","c"],"Meta":{"x":1,"y":2}}`},
+		{"insert into array", jsonPatchContentType, `[{"op":"add","path":"/Tags/0","value":"z"}]`, `{"Name":"seed","Tags":["z","a","b"],"Meta":{"x":1,"y":2}}`},
+		{"remove", jsonPatchContentType, `[{"op":"remove","path":"/Meta/x"}]`, `{"Name":"seed","Tags":["a","b"],"Meta":{"y":2}}`},
+		{"replace", jsonPatchContentType, `[{"op":"replace","path":"/Tags/1","value":"B"}]`, `{"Name":"seed","Tags":["a","B"],"Meta":{"x":1,"y":2}}`},
+		{"move", jsonPatchContentType, `[{"op":"move","from":"/Meta/x","path":"/X"}]`, `{"Name":"seed","X":1,"Tags":["a","b"],"Meta":{"y":2}}`},
+		{"copy", jsonPatchContentType, `[{"op":"copy","from":"/Meta","path":"/Copy"}]`, `{"Name":"seed","Copy":{"x":1,"y":2},"Tags":["a","b"],"Meta":{"x":1,"y":2}}`},
+		{"test passes", jsonPatchContentType, `[{"op":"test","path":"/Name","value":"seed"},{"op":"replace","path":"/Name","value":"ok"}]`, `{"Name":"ok","Tags":["a","b"],"Meta":{"x":1,"y":2}}`},
+		{"test fails", jsonPatchContentType, `[{"op":"test","path":"/Name","value":"other"}]`, ``},
+		{"escaped pointer", jsonPatchContentType, `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"Name":"seed","a/b~c":1,"Tags":["a","b"],"Meta":{"x":1,"y":2}}`},
+		{"replace missing member", jsonPatchContentType, `[{"op":"replace","path":"/Missing","value":1}]`, ``},
+		{"remove out of range", jsonPatchContentType, `[{"op":"remove","path":"/Tags/5"}]`, ``},
+		{"missing value", jsonPatchContentType, `[{"op":"add","path":"/Owner"}]`, ``},
+		{"unknown op", jsonPatchContentType, `[{"op":"frobnicate","path":"/Name"}]`, ``},
+		{"replace root with non-object", jsonPatchContentType, `[{"op":"replace","path":"","value":[1]}]`, ``},
+
+		// Without a content type the body decides
+		{"sniffed JSON Patch", "application/json", `[{"op":"remove","path":"/Tags"}]`, `{"Name":"seed","Meta":{"x":1,"y":2}}`},
+		{"sniffed merge patch", "", `{"Tags":null}`, `{"Name":"seed","Meta":{"x":1,"y":2}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var original map[string]any
+			json.Unmarshal([]byte(doc), &original)
+			patched, err := applyPatch(original, tt.contentType, []byte(tt.patch))
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("patch applied, want an error: %v", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(patched)
+			assertSameJSON(t, string(got), tt.want)
+		})
+	}
+}
+
+func TestApplyPatchLeavesDocumentAlone(t *testing.T) {
+	var doc map[string]any
+	json.Unmarshal([]byte(`{"Tags":["a"],"Meta":{"x":1}}`), &doc)
+	applyPatch(doc, jsonPatchContentType, []byte(`[{"op":"add","path":"/Tags/-","value":"b"},{"op":"remove","path":"/Meta/x"},{"op":"test","path":"/Tags/0","value":"nope"}]`))
+
+	got, _ := json.Marshal(doc)
+	assertSameJSON(t, string(got), `{"Tags":["a"],"Meta":{"x":1}}`)
+}
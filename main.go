@@ -3,81 +3,157 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-const (
-	pubsubTopic       = "concept-list"
-	publishInterval   = 1 * time.Minute
-	peerCheckInterval = 5 * time.Minute
-)
-
-var (
-	network Node_i
-)
+var network Node_i
 
 func main() {
-	network = NewIPFSShell("localhost:5001")
+	config, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	nodeConfig = config
+	if len(args) > 0 {
+		os.Exit(runCommand(args))
+	}
+
+	network = NewIPFSShell(nodeConfig.IPFSAPI)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	initializeLists(ctx)
+	if err := openStateStore(ctx, nodeConfig.StoreDir, false); err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer stateStore.Close()
+
+	s := NewServer()
+	s.initializeLists(ctx)
 
 	// Start IPFS routines
-	go runPeriodicTask(ctx, publishInterval, publishPeerMessage)
-	go runPeriodicTask(ctx, peerCheckInterval, discoverPeers)
-	go subscribeRoutine(ctx)
+	go s.publishRoutine(ctx, nodeConfig.PublishInterval)
+	go runPeriodicTask(ctx, nodeConfig.PeerCheckInterval, s.discoverPeers)
+	go runPeriodicTask(ctx, nodeConfig.CompactInterval, compactStateStore)
+	go s.subscribeRoutine(ctx)
+	go s.webhooks.Run(ctx)
 
 	// Set up Gin router
 	r := gin.Default()
-	setupRoutes(r)
+	s.setupRoutes(r)
 
 	// Start server
-	log.Fatal(r.Run(":9090"))
+	log.Fatal(r.Run(nodeConfig.Listen))
 }
 
-func setupRoutes(r *gin.Engine) {
+func (s *Server) setupRoutes(r *gin.Engine) {
 	r.Use(corsMiddleware())
-	r.POST("/concept", addConcept_h)
-	r.DELETE("/concept/:guid", deleteConcept_h)
-	r.PUT("/concept/:guid", updateConcept_h)
-	r.GET("/concept/:guid", getConcept_h)
-	r.GET("/concept/:guid/name", getConceptName_h)
-	r.GET("/concepts", queryConcepts_h)
-
-	r.PUT("/steward", updateSteward_h)
-	r.GET("/steward", getSteward_h)
-
-	r.POST("/seed", addSeed_h)
-	r.DELETE("/seed/:guid", deleteSeed_h)
-	r.PUT("/seed/:guid", updateSeed_h)
-	r.GET("/seed/:guid", getSeed_h)
-	r.GET("/seeds", querySeeds_h)
-
-	r.GET("/peers", listPeers_h)
-
-	r.GET("/ws", handleWebSocket_h)
-	r.GET("/ws/peers", handlePeerWebSocket_h)
-
-	r.POST("/relationship", addRelationship_h)
-	r.PUT("/relationship/:id/deepen", deepenRelationship_h)
-	r.GET("/relationships", getRelationships_h)
-	r.GET("/relationship/:id", getRelationship_h)
-	r.GET("/relationship-types", getRelationshipTypes_h)
-	r.GET("/relationship-type/:type", getRelationshipsByType_h)
-	r.GET("/interact/:id", interactWithRelationship_h)
+	r.Use(s.authMiddleware())
+	r.POST("/concept", s.addConcept_h)
+	r.DELETE("/concept/:guid", s.deleteConcept_h)
+	r.PUT("/concept/:guid", s.updateConcept_h)
+	r.PATCH("/concept/:guid", s.patchConcept_h)
+	r.GET("/concept/:guid", s.getConcept_h)
+	r.GET("/concept/:guid/name", s.getConceptName_h)
+	r.GET("/concept/:guid/relationships", s.getConceptRelationships_h)
+	r.GET("/concept/:guid/history", s.getConceptHistory_h)
+	r.GET("/concept/:guid/diff", s.diffConceptVersions_h)
+	r.POST("/concept/:guid/rollback", s.rollbackConcept_h)
+	r.GET("/concepts", s.queryConcepts_h)
+
+	r.PUT("/steward", s.updateSteward_h)
+	r.GET("/steward", s.getSteward_h)
+	r.PUT("/steward/claim", s.setStewardClaim_h)
+	r.GET("/stewards", s.listStewards_h)
+	r.POST("/stewards", s.createSteward_h)
+	r.PUT("/stewards/default", s.setDefaultSteward_h)
+	r.DELETE("/stewards/:guid", s.deleteSteward_h)
+
+	r.POST("/seed", s.addSeed_h)
+	r.DELETE("/seed/:guid", s.deleteSeed_h)
+	r.PUT("/seed/:guid", s.updateSeed_h)
+	r.PATCH("/seed/:guid", s.patchSeed_h)
+	r.GET("/seed/:guid", s.getSeed_h)
+	r.GET("/seed/:guid/history", s.getSeedHistory_h)
+	r.GET("/seed/:guid/diff", s.diffSeedVersions_h)
+	r.POST("/seed/:guid/rollback", s.rollbackSeed_h)
+	r.GET("/seeds", s.querySeeds_h)
+
+	r.GET("/peers", s.listPeers_h)
+
+	r.GET("/ws", s.handleWebSocket_h)
+	r.GET("/ws/peers", s.handlePeerWebSocket_h)
+	r.GET("/events", s.streamEvents_h)
+
+	r.GET("/auth/whoami", s.whoami_h)
+	r.POST("/auth/tokens", s.createToken_h)
+	r.GET("/auth/tokens", s.listTokens_h)
+	r.DELETE("/auth/tokens/:id", s.revokeToken_h)
+
+	r.POST("/webhooks", s.registerWebhook_h)
+	r.GET("/webhooks", s.listWebhooks_h)
+	r.GET("/webhooks/dead-letters", s.listDeadLetters_h)
+	r.POST("/webhooks/dead-letters/:id/retry", s.retryDeadLetter_h)
+	r.DELETE("/webhooks/dead-letters/:id", s.deleteDeadLetter_h)
+	r.GET("/webhooks/:id", s.getWebhook_h)
+	r.PUT("/webhooks/:id", s.updateWebhook_h)
+	r.DELETE("/webhooks/:id", s.deleteWebhook_h)
+	r.GET("/webhooks/:id/deliveries", s.getWebhookDeliveries_h)
+
+	r.POST("/relationship", s.addRelationship_h)
+	r.PUT("/relationship/:id", s.updateRelationship_h)
+	r.PATCH("/relationship/:id", s.patchRelationship_h)
+	r.DELETE("/relationship/:id", s.deleteRelationship_h)
+	r.PUT("/relationship/:id/deepen", s.deepenRelationship_h)
+	r.GET("/relationship/:id/dynamics", s.getRelationshipDynamics_h)
+	r.POST("/relationship/:id/interact", s.interactWithRelationship_h)
+	r.GET("/interactions", getInteractions_h)
+	r.POST("/interactions/replay", s.replayInteractions_h)
+	r.GET("/relationships", s.getRelationships_h)
+	r.GET("/relationship/:id", s.getRelationship_h)
+	r.GET("/relationship-types", s.getRelationshipTypes_h)
+	r.GET("/relationship-type-specs", getRelationshipTypeSpecs_h)
+	r.GET("/relationship-type/:type", s.getRelationshipsByType_h)
+	r.GET("/traverse/:id", s.traverse_h)
+	r.GET("/interact/:id", interactMoved_h)
+
+	r.POST("/batch", s.batch_h)
+
+	r.GET("/export", s.exportGraph_h)
+	r.POST("/import", s.importGraph_h)
+
+	r.GET("/ontology/migrations", getOntologyMigrations_h)
+	r.POST("/ontology/migrate", s.migrateOntology_h)
+	r.GET("/ontology/lint", lintOntology_h)
+	r.GET("/integrity", s.getIntegrity_h)
+	r.POST("/integrity/repair", s.repairIntegrity_h)
 }
 
+// corsMiddleware lets the pages of the configured CORS origins call the API;
+// "*" allows any origin. Without it only same-origin pages can.
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		if origin := c.GetHeader("Origin"); origin != "" && corsAllowed(origin) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-Match, Last-Event-ID")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
+		}
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -86,6 +162,20 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
+func corsAllowed(origin string) bool {
+	origins := nodeConfig.CORSOrigins
+	return slices.Contains(origins, "*") || slices.Contains(origins, origin)
+}
+
+// parseOrigins reads a comma-separated list of origins
+func parseOrigins(list string) []string {
+	origins := parseList(list)
+	for i, origin := range origins {
+		origins[i] = strings.TrimSuffix(origin, "/")
+	}
+	return origins
+}
+
 func runPeriodicTask(ctx context.Context, interval time.Duration, task func(context.Context)) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -100,15 +190,8 @@ func runPeriodicTask(ctx context.Context, interval time.Duration, task func(cont
 	}
 }
 
-func initializeLists(ctx context.Context) {
-	conceptMap = make(ConceptMap)
-	conceptID2CID = make(ConceptGUID2CIDMap)
-	peerMap = make(PeerMap)
-	relationshipMap = make(RelationshipMap)
-	seedMap = make(SeedMap)
-	seedID2CID = make(SeedGUID2CIDMap)
-
-	if err := network.Bootstrap(ctx); err != nil {
+func (s *Server) initializeLists(ctx context.Context) {
+	if err := joinNetwork(ctx); err != nil {
 		log.Fatalf("Failed to bootstrap IPFS: %v", err)
 	}
 
@@ -117,67 +200,86 @@ func initializeLists(ctx context.Context) {
 	if err != nil {
 		log.Fatalf("Failed to get peer ID: %v", err)
 	}
-	if err := network.Load(ctx, peerListPath, &peerMap); err != nil {
+	peers := make(PeerMap)
+	if err := loadData(ctx, peerListPath, &peers); err != nil {
 		log.Printf("Failed to load peer list: %v\n", err)
 	}
-	for id, peer := range peerMap {
-		if peer.GetStewardID() == "" {
-			delete(peerMap, id)
-		}
-	}
-	if _, ok := peerMap[peerID]; !ok {
-		peerMap[peerID] = &Peer{
-			ID:          peerID,
-			Timestamp:   time.Now(),
-			ConceptCIDs: make(map[CID]bool),
-			SeedCIDs:    make(map[CID]bool),
-		}
-	}
-
-	if err := network.Load(ctx, conceptID2CIDPath, &conceptID2CID); err != nil {
+	s.peers.Load(peers)
+	s.peers.PutIfAbsent(ctx, &Peer{
+		ID:          peerID,
+		Timestamp:   time.Now(),
+		LastSeen:    time.Now(),
+		ConceptCIDs: make(map[CID]bool),
+		SeedCIDs:    make(map[CID]bool),
+	})
+
+	conceptCIDs := make(ConceptGUID2CIDMap)
+	if err := loadData(ctx, conceptID2CIDPath, &conceptCIDs); err != nil {
 		log.Printf("Failed to load concept CID map: %v\n", err)
 	}
-	if err := network.Load(ctx, relationshipsPath, &relationshipMap); err != nil {
+	loadOntologyState(ctx)
+	relationships := make(RelationshipMap)
+	if err := loadData(ctx, relationshipsPath, &relationships); err != nil {
 		log.Printf("Failed to load relationships: %v\n", err)
-		InitializeSystem(ctx)
-		saveRelationships(ctx)
+		s.InitializeSystem(ctx)
+		s.persist(ctx)
 	} else {
-		if err := network.Load(ctx, conceptsPath, &conceptMap); err != nil {
+		s.relationships.Load(relationships)
+		concepts := make(ConceptMap)
+		if err := loadData(ctx, conceptsPath, &concepts); err != nil {
 			log.Fatalf("Failed to load concepts: %v", err)
 		}
-		for id, concept := range conceptMap {
-			guidMap[concept.Name] = GUID(id)
+		s.concepts.Load(concepts, conceptCIDs)
+		if report, err := s.migrateOntology(ctx, nodeConfig.OntologyFile, false); err != nil {
+			log.Printf("Failed to migrate ontology: %v\n", err)
+		} else {
+			for _, op := range report.Operations {
+				log.Printf("Ontology migration: %s\n", op)
+			}
 		}
 	}
-	StewardConcept = findConceptGUID("Steward")
-	AssetConcept = findConceptGUID("Asset")
-	CoinConcept = findConceptGUID("Coin")
-	SmartContractConcept = findConceptGUID("Smart Contract")
-	ContractEvaluatorConcept = findConceptGUID("Contract Evaluator")
-	ConceptInvestmentConcept = findConceptGUID("Concept Investment")
-	SeedInvestmentConcept = findConceptGUID("Seed Investment")
-	TransactionConcept = findConceptGUID("Transaction")
-	ReturnConcept = findConceptGUID("Return")
-	ProposalConcept = findConceptGUID("Proposal")
-	ProposalActionConcept = findConceptGUID("Proposal Action")
-	HarmonyGuidelineConcept = findConceptGUID("Harmony Guideline")
-	initSeedUnmarshal()
+	if err := s.refreshRelationshipTypeSpecs(nodeConfig.OntologyFile); err != nil {
+		log.Printf("Failed to load relationship type constraints: %v\n", err)
+	}
+	initDynamics()
+	loadInteractionLog(ctx)
+	s.resolveSystemConcepts()
 
-	if err := network.Load(ctx, seedID2CIDPath, &seedID2CID); err != nil {
+	seedCIDs := make(SeedGUID2CIDMap)
+	if err := loadData(ctx, seedID2CIDPath, &seedCIDs); err != nil {
 		log.Printf("Failed to load seed CID map: %v\n", err)
 	}
-	if err := network.Load(ctx, seedsPath, &seedMap); err != nil {
+	seeds := make(SeedMap)
+	if err := loadData(ctx, seedsPath, &seeds); err != nil {
 		log.Printf("Failed to load seeds: %v\n", err)
 	}
+	s.seeds.Load(seeds, seedCIDs)
 
-	loadOrCreateSteward(ctx)
-	peerMap[peerID].(*Peer).StewardID = stewardID
-	savePeerList(ctx)
+	// Peers only run the stewards their claims prove, now the seeds with the
+	// stewards' keys are loaded
+	for id, peer := range peers {
+		if id == peerID {
+			continue
+		}
+		verified := s.verifiedStewards(id, peer.GetStewardClaims())
+		if len(verified) == 0 || !acceptPeer(id) {
+			s.peers.Delete(ctx, id)
+			continue
+		}
+		s.peers.Update(ctx, id, func(p *Peer) { p.SetStewardIDs(verified) })
+	}
 
-	json, _ := json.Marshal(peerMap[peerID])
+	s.loadOrCreateSteward(ctx)
+	s.loadLocalStewards(ctx)
+	s.persist(ctx)
+	s.loadAuth(ctx)
+	s.webhooks.load(ctx)
+
+	self, _ := s.peers.Get(peerID)
+	json, _ := json.Marshal(self)
 	log.Printf("Peer[%s]: %s\n", peerID, string(json))
 
-	for _, cid := range peerMap[peerID].GetConceptCIDs() {
+	for _, cid := range self.GetConceptCIDs() {
 		c, err := cid.AsConcept(ctx)
 		if err != nil {
 			log.Fatalf("Unable to parse Concept: %s: %v", cid, err)
@@ -186,7 +288,7 @@ func initializeLists(ctx context.Context) {
 		}
 	}
 
-	for _, cid := range peerMap[peerID].GetSeedCIDs() {
+	for _, cid := range self.GetSeedCIDs() {
 		i, err := cid.AsSeed(ctx)
 		if err != nil {
 			log.Fatalf("Unable to parse seed: %s: %v", cid, err)
@@ -196,14 +298,30 @@ func initializeLists(ctx context.Context) {
 	}
 }
 
-func loadOrCreateSteward(ctx context.Context) {
+func (s *Server) resolveSystemConcepts() {
+	StewardConcept = s.findConceptGUID("Steward")
+	AssetConcept = s.findConceptGUID("Asset")
+	CoinConcept = s.findConceptGUID("Coin")
+	SmartContractConcept = s.findConceptGUID("Smart Contract")
+	ContractEvaluatorConcept = s.findConceptGUID("Contract Evaluator")
+	ConceptInvestmentConcept = s.findConceptGUID("Concept Investment")
+	SeedInvestmentConcept = s.findConceptGUID("Seed Investment")
+	TransactionConcept = s.findConceptGUID("Transaction")
+	ReturnConcept = s.findConceptGUID("Return")
+	ProposalConcept = s.findConceptGUID("Proposal")
+	ProposalActionConcept = s.findConceptGUID("Proposal Action")
+	HarmonyGuidelineConcept = s.findConceptGUID("Harmony Guideline")
+	initSeedUnmarshal()
+}
+
+func (s *Server) loadOrCreateSteward(ctx context.Context) {
 	var guid SeedGUID
-	err := network.Load(ctx, stewardGUIDPath, &guid)
+	err := loadData(ctx, stewardGUIDPath, &guid)
 	if err != nil {
 		log.Printf("Failed to load Steward ID from IPFS: %v", err)
 		log.Println("Generating new Steward ID...")
 		guid = SeedGUID(uuid.New().String())
-		if err := network.Save(ctx, stewardGUIDPath, guid); err != nil {
+		if err := saveData(ctx, stewardGUIDPath, guid); err != nil {
 			log.Fatalf("Failed to save new Steward ID: %v", err)
 		}
 	}
@@ -212,26 +330,17 @@ func loadOrCreateSteward(ctx context.Context) {
 	stewardID = guid
 	stewardMu.Unlock()
 
-	log.Printf("Steward ID: %s", stewardID)
-	_, ok := seedID2CID[stewardID]
-	if !ok {
-		steward := NewStewardSeed("Urs Muff", "Creator of this network")
-		steward.SeedID = stewardID
-		addOrUpdateSeed(ctx, steward, peerID)
-
-		// if err := network.Load(ctx, seedsPath, &seedMap); err != nil {
-		// 	log.Printf("Failed to load seeds: %v\n", err)
-		// }
-
-		// peerJson, _ := json.Marshal(peerMap[peerID])
-		// fmt.Printf("Peer: %s\n", string(peerJson))
-
-		// cid := seedID2CID[stewardID]
-		//
-		// if seed, err := cid.AsSeed(ctx); err != nil {
-		// 	log.Fatalf("Unable to parse Concept: %s: %v", cid, err)
-		// } else {
-		// 	log.Printf("Seed: %s\n", seed)
-		// }
+	log.Printf("Steward ID: %s", guid)
+	if _, ok := s.seeds.Get(guid); ok {
+		return
+	}
+	if nodeConfig.StewardName == "" {
+		log.Println("No steward seed created: set steward_name, or add a steward with POST /stewards")
+		return
+	}
+	steward := NewStewardSeed(nodeConfig.StewardName, nodeConfig.StewardDescription)
+	steward.SeedID = guid
+	if err := s.addOrUpdateSeed(ctx, steward, peerID); err != nil {
+		log.Printf("Failed to create the steward seed: %v", err)
 	}
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// memNetwork keeps content in memory instead of IPFS, addressed by its hash
+type memNetwork struct {
+	mu      sync.Mutex
+	content map[CID][]byte
+	present []PeerID // subscribed to the topic
+
+	bootstrapped     []string
+	staticPeers      []string
+	clearedBootstrap bool
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{content: make(map[CID][]byte)}
+}
+
+func (n *memNetwork) Add(ctx context.Context, content io.Reader) (CID, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	cid := CID("mem" + hex.EncodeToString(sum[:16]))
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.content[cid] = data
+	return cid, nil
+}
+
+func (n *memNetwork) Get(ctx context.Context, cid CID) (io.ReadCloser, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	data, ok := n.content[cid]
+	if !ok {
+		return nil, fmt.Errorf("no content for %s", cid)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (n *memNetwork) Remove(ctx context.Context, cid CID) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.content, cid)
+	return nil
+}
+
+func (n *memNetwork) List(ctx context.Context) ([]CID, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	cids := make([]CID, 0, len(n.content))
+	for cid := range n.content {
+		cids = append(cids, cid)
+	}
+	return cids, nil
+}
+
+func (n *memNetwork) has(cid CID) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.content[cid]
+	return ok
+}
+
+func (n *memNetwork) Load(ctx context.Context, path string, target any) error {
+	return fmt.Errorf("no data at %s", path)
+}
+func (n *memNetwork) Save(ctx context.Context, path string, data any) error { return nil }
+func (n *memNetwork) Publish(ctx context.Context, topic string, data []byte) error {
+	return nil
+}
+func (n *memNetwork) Subscribe(ctx context.Context, topic string) (<-chan NetworkMessage, error) {
+	return make(chan NetworkMessage), nil
+}
+func (n *memNetwork) Connect(ctx context.Context, peerID PeerID) error { return nil }
+func (n *memNetwork) ListPeers(ctx context.Context) ([]Peer_i, error)  { return nil, nil }
+func (n *memNetwork) Bootstrap(ctx context.Context, addrs []string) error {
+	n.bootstrapped = append(n.bootstrapped, addrs...)
+	return nil
+}
+func (n *memNetwork) AddStaticPeer(ctx context.Context, addr string) error {
+	n.staticPeers = append(n.staticPeers, addr)
+	return nil
+}
+func (n *memNetwork) RemoveBootstrapNodes(ctx context.Context) error {
+	n.clearedBootstrap = true
+	return nil
+}
+func (n *memNetwork) ID(ctx context.Context) (PeerID, error) { return "test-peer", nil }
+func (n *memNetwork) TopicPeers(ctx context.Context, topic string) ([]PeerID, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]PeerID(nil), n.present...), nil
+}
+
+// newTestServer starts a node on an empty store in a temporary directory,
+// bootstrapped from the ontology in data/
+func newTestServer(t *testing.T) (*Server, *memNetwork) {
+	t.Helper()
+	mem := newMemNetwork()
+	network = mem
+
+	config := defaultConfig()
+	config.StoreDir = t.TempDir()
+	config.Bootstrap = []string{}
+	config.StewardName = "Test Steward"
+	nodeConfig = config
+
+	if err := openStateStore(context.Background(), config.StoreDir, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stateStore.Close() })
+
+	s := NewServer()
+	s.initializeLists(context.Background())
+	return s, mem
+}
+
+// asSteward returns a context acting for steward, with admin rights if admin is set
+func asSteward(steward SeedGUID, admin bool) context.Context {
+	return withPrincipal(context.Background(), &Principal{StewardID: steward, Admin: admin})
+}
+
+// newTestSteward adds a steward seed to s and returns it
+func newTestSteward(t *testing.T, s *Server, name string) *StewardSeed {
+	t.Helper()
+	steward := NewStewardSeed(name, "")
+	if err := s.addOrUpdateSeed(context.Background(), steward, peerID); err != nil {
+		t.Fatal(err)
+	}
+	return steward
+}
+
+// newKeyedSteward adds a steward seed with a new key pair to s
+func newKeyedSteward(t *testing.T, s *Server, name string) (*StewardSeed, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steward := NewStewardSeed(name, "")
+	steward.PublicKey = base64.StdEncoding.EncodeToString(public)
+	if s != nil {
+		if err := s.addOrUpdateSeed(context.Background(), steward, peerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return steward, private
+}
+
+// claimOn signs a steward's claim to run on peer
+func claimOn(peer PeerID, steward *StewardSeed, private ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(private, stewardClaimMessage(peer, steward.PublicKey)))
+}
+
+// cloneOf copies a seed, so a test can change the copy without changing the
+// stored seed
+func cloneOf[T Seed_i](t *testing.T, seed T) T {
+	t.Helper()
+	clone, err := cloneSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clone.(T)
+}
+
+// serve runs a request through the server's routes, authenticated with token
+// unless it is empty
+func serve(s *Server, method, path, token string, body any) *httptest.ResponseRecorder {
+	r := gin.New()
+	s.setupRoutes(r)
+	return serveWith(r, method, path, token, body)
+}
+
+func serveWith(r *gin.Engine, method, path, token string, body any) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
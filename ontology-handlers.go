@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getOntologyMigrations_h(c *gin.Context) {
+	ontologyMu.Lock()
+	defer ontologyMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"version": ontologyState.Version,
+		"hash":    ontologyState.Hash,
+		"applied": ontologyState.Applied,
+	})
+}
+
+func (s *Server) migrateOntology_h(c *gin.Context) {
+	dryRun := c.Query("dryRun") == "true"
+
+	report, err := s.migrateOntology(c.Request.Context(), nodeConfig.OntologyFile, dryRun)
+	if err != nil && report == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	if !dryRun && len(report.Operations) > 0 {
+		s.announce()
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) getIntegrity_h(c *gin.Context) {
+	c.JSON(http.StatusOK, s.checkIntegrity(c.Request.Context(), false))
+}
+
+func (s *Server) repairIntegrity_h(c *gin.Context) {
+	report := s.checkIntegrity(c.Request.Context(), true)
+	if report.Repaired > 0 {
+		s.announce()
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func lintOntology_h(c *gin.Context) {
+	issues, err := lintOntologyFile(nodeConfig.OntologyFile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file":   nodeConfig.OntologyFile,
+		"valid":  !hasLintErrors(issues),
+		"issues": issues,
+	})
+}
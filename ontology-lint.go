@@ -0,0 +1,430 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// knownConceptTypes are the values accepted in a concept's `type` field
+var knownConceptTypes = map[string]bool{
+	"ConceptType":          true,
+	"FundamentalConcept":   true,
+	"BuildingBlockConcept": true,
+	"SystemConcept":        true,
+	"InteractionType":      true,
+}
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// LintIssue is a problem found in an ontology file
+type LintIssue struct {
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%d: %s: %s", i.Line, i.Severity, i.Message)
+}
+
+type lintConcept struct {
+	name     string
+	typ      string
+	line     int
+	typeLine int
+	parent   string
+	edges    []lintEdge
+	children int
+}
+
+type lintEdge struct {
+	typ    string
+	target string
+	line   int
+}
+
+type lintRelType struct {
+	line        int
+	domain      []string
+	rangeTypes  []string
+	constraints int
+	maxOut      int
+	maxIn       int
+	inverse     string
+	inverseLine int
+	symmetric   bool
+}
+
+type ontologyLinter struct {
+	issues   []LintIssue
+	concepts []*lintConcept
+	byName   map[string]*lintConcept
+	relTypes map[string]*lintRelType
+}
+
+func (l *ontologyLinter) report(line int, severity string, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarValue(node *yamlv3.Node, key string) (string, int) {
+	value := mappingValue(node, key)
+	if value == nil || value.Kind != yamlv3.ScalarNode {
+		return "", node.Line
+	}
+	return value.Value, value.Line
+}
+
+func sequenceItems(node *yamlv3.Node) []*yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+func scalarList(node *yamlv3.Node, key string) ([]string, int) {
+	value := mappingValue(node, key)
+	if value == nil {
+		return nil, node.Line
+	}
+	var list []string
+	for _, item := range sequenceItems(value) {
+		list = append(list, item.Value)
+	}
+	return list, value.Line
+}
+
+func intValue(node *yamlv3.Node, key string) int {
+	value, _ := scalarValue(node, key)
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// lintOntology checks an ontology document before it is bootstrapped or migrated
+func lintOntology(data []byte) ([]LintIssue, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML: %v", err)
+	}
+	if len(doc.Content) == 0 {
+		return []LintIssue{{Line: 1, Severity: lintError, Message: "empty ontology"}}, nil
+	}
+	root := doc.Content[0]
+
+	l := &ontologyLinter{byName: make(map[string]*lintConcept), relTypes: make(map[string]*lintRelType)}
+
+	for _, item := range sequenceItems(mappingValue(root, "relationships")) {
+		name, line := scalarValue(item, "name")
+		if name == "" {
+			l.report(item.Line, lintError, "relationship type without a name")
+			continue
+		}
+		if first, dup := l.relTypes[name]; dup {
+			l.report(line, lintError, "duplicate relationship type %q (first defined on line %d)", name, first.line)
+			continue
+		}
+		rt := &lintRelType{line: line, maxOut: intValue(item, "max_out"), maxIn: intValue(item, "max_in")}
+		rt.domain, rt.constraints = scalarList(item, "domain")
+		rt.rangeTypes, _ = scalarList(item, "range")
+		rt.inverse, rt.inverseLine = scalarValue(item, "inverse")
+		symmetric, _ := scalarValue(item, "symmetric")
+		rt.symmetric = symmetric == "true"
+		l.relTypes[name] = rt
+		l.checkPropertySchemas(name, mappingValue(item, "properties"))
+	}
+
+	for _, item := range sequenceItems(mappingValue(root, "concepts")) {
+		l.collect(item, "")
+	}
+
+	l.checkReferences()
+	l.checkRelationshipTypes()
+	l.checkComponentCycles()
+	l.checkOrphans()
+
+	sort.SliceStable(l.issues, func(i, j int) bool { return l.issues[i].Line < l.issues[j].Line })
+	return l.issues, nil
+}
+
+func (l *ontologyLinter) collect(node *yamlv3.Node, parent string) {
+	name, line := scalarValue(node, "name")
+	if name == "" {
+		l.report(node.Line, lintError, "concept without a name")
+		return
+	}
+	typ, typeLine := scalarValue(node, "type")
+	c := &lintConcept{name: name, typ: typ, line: line, typeLine: typeLine, parent: parent}
+
+	if first, dup := l.byName[name]; dup {
+		l.report(line, lintError, "duplicate concept %q (first defined on line %d)", name, first.line)
+	} else {
+		l.byName[name] = c
+	}
+	if _, clash := l.relTypes[name]; clash {
+		l.report(line, lintWarning, "concept %q has the same name as a relationship type", name)
+	}
+	l.concepts = append(l.concepts, c)
+
+	for _, rel := range sequenceItems(mappingValue(node, "relationships")) {
+		typ, typLine := scalarValue(rel, "type")
+		target, _ := scalarValue(rel, "target")
+		c.edges = append(c.edges, lintEdge{typ: typ, target: target, line: typLine})
+	}
+	for _, child := range sequenceItems(mappingValue(node, "children")) {
+		c.children++
+		l.collect(child, name)
+	}
+}
+
+func (l *ontologyLinter) checkReferences() {
+	for _, c := range l.concepts {
+		switch {
+		case c.typ == "":
+			l.report(c.line, lintError, "concept %q has no type", c.name)
+		case !knownConceptTypes[c.typ]:
+			l.report(c.typeLine, lintError, "concept %q has unknown type %q", c.name, c.typ)
+		}
+		for _, e := range c.edges {
+			if _, ok := l.relTypes[e.typ]; !ok {
+				l.report(e.line, lintError, "concept %q uses unknown relationship type %q", c.name, e.typ)
+			}
+			if _, ok := l.byName[e.target]; !ok {
+				l.report(e.line, lintError, "concept %q has relationship %q to unknown target %q", c.name, e.typ, e.target)
+			}
+		}
+	}
+	if len(l.concepts) > 0 {
+		if _, ok := l.relTypes[componentOfRelationship]; !ok && l.hasChildren() {
+			l.report(1, lintError, "children require the %q relationship type", componentOfRelationship)
+		}
+	}
+}
+
+// checkRelationshipTypes verifies inverses, and that the file's own edges respect
+// each type's domain, range and cardinality
+func (l *ontologyLinter) checkRelationshipTypes() {
+	names := make([]string, 0, len(l.relTypes))
+	for name := range l.relTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rt := l.relTypes[name]
+		if rt.inverse != "" {
+			inverse, ok := l.relTypes[rt.inverse]
+			switch {
+			case !ok:
+				l.report(rt.inverseLine, lintError, "relationship type %q has unknown inverse %q", name, rt.inverse)
+			case inverse.inverse != name:
+				l.report(rt.inverseLine, lintWarning, "relationship type %q names %q as its inverse, but not the other way round", name, rt.inverse)
+			}
+		}
+		for _, allowed := range append(append([]string{}, rt.domain...), rt.rangeTypes...) {
+			if _, ok := l.byName[allowed]; !ok && !knownConceptTypes[allowed] && allowed != "Seed" {
+				l.report(rt.constraints, lintWarning, "relationship type %q constrains to unknown type or concept %q", name, allowed)
+			}
+		}
+	}
+
+	// Cardinality counts the edges that inverse and symmetric types imply as
+	// well; an edge written both ways, or twice, counts once
+	type edge struct{ typ, from, to string }
+	seen := make(map[edge]bool)
+	out := make(map[string]int)
+	in := make(map[string]int)
+	count := func(e edge, line int) {
+		rt, ok := l.relTypes[e.typ]
+		if !ok || seen[e] {
+			return
+		}
+		seen[e] = true
+		out[e.typ+"|"+e.from]++
+		in[e.typ+"|"+e.to]++
+		if rt.maxOut > 0 && out[e.typ+"|"+e.from] == rt.maxOut+1 {
+			l.report(line, lintError, "%q has more than %d %q relationship(s)", e.from, rt.maxOut, e.typ)
+		}
+		if rt.maxIn > 0 && in[e.typ+"|"+e.to] == rt.maxIn+1 {
+			l.report(line, lintError, "%q is the target of more than %d %q relationship(s)", e.to, rt.maxIn, e.typ)
+		}
+	}
+	for _, c := range l.concepts {
+		edges := c.edges
+		if c.parent != "" {
+			edges = append([]lintEdge{{typ: componentOfRelationship, target: c.parent, line: c.line}}, edges...)
+		}
+		for _, e := range edges {
+			rt, ok := l.relTypes[e.typ]
+			target, known := l.byName[e.target]
+			if !ok || !known {
+				continue
+			}
+			if !matchesAny([]string{c.typ, c.name}, rt.domain) {
+				l.report(e.line, lintError, "%q does not allow source %q (allowed: %v)", e.typ, c.name, rt.domain)
+			}
+			if !matchesAny([]string{target.typ, target.name}, rt.rangeTypes) {
+				l.report(e.line, lintError, "%q does not allow target %q (allowed: %v)", e.typ, e.target, rt.rangeTypes)
+			}
+			count(edge{e.typ, c.name, e.target}, e.line)
+			if c.name == e.target {
+				continue
+			}
+			if rt.inverse != "" {
+				count(edge{rt.inverse, e.target, c.name}, e.line)
+			}
+			if rt.symmetric {
+				count(edge{e.typ, e.target, c.name}, e.line)
+			}
+		}
+	}
+}
+
+func (l *ontologyLinter) checkPropertySchemas(relType string, properties *yamlv3.Node) {
+	if properties == nil {
+		return
+	}
+	if properties.Kind != yamlv3.MappingNode {
+		l.report(properties.Line, lintError, "properties of %q must be a mapping", relType)
+		return
+	}
+	for i := 0; i+1 < len(properties.Content); i += 2 {
+		name, schema := properties.Content[i].Value, properties.Content[i+1]
+		typ, line := scalarValue(schema, "type")
+		if !propertyTypes[typ] {
+			l.report(line, lintError, "property %q of %q has unknown type %q", name, relType, typ)
+			continue
+		}
+		min, minLine := scalarValue(schema, "min")
+		max, maxLine := scalarValue(schema, "max")
+		if (min != "" || max != "") && typ != propertyFloat && typ != propertyInt {
+			l.report(line, lintWarning, "property %q of %q has min/max but is not numeric", name, relType)
+		}
+		lo, errMin := strconv.ParseFloat(min, 64)
+		hi, errMax := strconv.ParseFloat(max, 64)
+		if min != "" && errMin != nil {
+			l.report(minLine, lintError, "min of property %q is not a number", name)
+		}
+		if max != "" && errMax != nil {
+			l.report(maxLine, lintError, "max of property %q is not a number", name)
+		}
+		if min != "" && max != "" && errMin == nil && errMax == nil && lo > hi {
+			l.report(line, lintError, "property %q of %q has min greater than max", name, relType)
+		}
+		if mappingValue(schema, "enum") != nil && typ != propertyString {
+			l.report(line, lintWarning, "property %q of %q has enum but is not a string", name, relType)
+		}
+	}
+}
+
+func (l *ontologyLinter) hasChildren() bool {
+	for _, c := range l.concepts {
+		if c.children > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ontologyLinter) checkComponentCycles() {
+	parents := make(map[string][]string)
+	for _, c := range l.concepts {
+		if c.parent != "" {
+			parents[c.name] = append(parents[c.name], c.parent)
+		}
+		for _, e := range c.edges {
+			if e.typ == componentOfRelationship {
+				parents[c.name] = append(parents[c.name], e.target)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case done:
+			return
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+				}
+			}
+			line := 0
+			if c, ok := l.byName[name]; ok {
+				line = c.line
+			}
+			l.report(line, lintError, "%q cycle: %v", componentOfRelationship, append(path[start:], name))
+			return
+		}
+		state[name] = visiting
+		for _, parent := range parents[name] {
+			visit(parent, append(path, name))
+		}
+		state[name] = done
+	}
+
+	names := make([]string, 0, len(parents))
+	for name := range parents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name, nil)
+	}
+}
+
+func (l *ontologyLinter) checkOrphans() {
+	referenced := make(map[string]bool)
+	for _, c := range l.concepts {
+		for _, e := range c.edges {
+			referenced[e.target] = true
+		}
+	}
+	for _, c := range l.concepts {
+		if c.parent == "" && c.children == 0 && len(c.edges) == 0 && !referenced[c.name] {
+			l.report(c.line, lintWarning, "concept %q is an orphan: it has no relationships and nothing refers to it", c.name)
+		}
+	}
+}
+
+func hasLintErrors(issues []LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == lintError {
+			return true
+		}
+	}
+	return false
+}
+
+func lintOntologyFile(filename string) ([]LintIssue, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return lintOntology(data)
+}
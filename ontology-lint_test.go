@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// lintBase is a valid ontology the cases add to
+const lintBase = `
+relationships:
+  - name: Component Of
+    max_out: 1
+    inverse: Composed Of
+  - name: Composed Of
+    inverse: Component Of
+  - name: Influences
+    properties:
+      weight: {type: float, min: 0, max: 1}
+  - name: Governs
+    domain: [SystemConcept]
+    range: [FundamentalConcept]
+    max_in: 1
+
+concepts:
+  - name: Whole
+    type: FundamentalConcept
+    children:
+      - name: Part
+        type: FundamentalConcept
+  - name: Rule
+    type: SystemConcept
+    relationships:
+      - type: Governs
+        target: Whole
+      - type: Influences
+        target: Part
+`
+
+func TestLintOntology(t *testing.T) {
+	tests := []struct {
+		name     string
+		add      string // appended to lintBase
+		severity string // of the issue expected, or "" for none
+		message  string // part of its message
+	}{
+		{"valid", "", "", ""},
+		{"duplicate concept", `
+  - name: Whole
+    type: FundamentalConcept
+`, lintError, `duplicate concept "Whole"`},
+		{"duplicate relationship type", `
+relationships:
+  - name: Influences
+`, lintError, `duplicate relationship type "Influences"`},
+		{"unknown concept type", `
+  - name: Odd
+    type: Gadget
+    relationships:
+      - type: Influences
+        target: Whole
+`, lintError, `unknown type "Gadget"`},
+		{"missing concept type", `
+  - name: Untyped
+    relationships:
+      - type: Influences
+        target: Whole
+`, lintError, `"Untyped" has no type`},
+		{"unknown relationship type", `
+  - name: Stray
+    type: FundamentalConcept
+    relationships:
+      - type: Loves
+        target: Whole
+`, lintError, `unknown relationship type "Loves"`},
+		{"unknown target", `
+  - name: Stray
+    type: FundamentalConcept
+    relationships:
+      - type: Influences
+        target: Nowhere
+`, lintError, `unknown target "Nowhere"`},
+		{"domain", `
+  - name: Rogue
+    type: FundamentalConcept
+    relationships:
+      - type: Governs
+        target: Part
+`, lintError, `does not allow source "Rogue"`},
+		{"range", `
+  - name: Law
+    type: SystemConcept
+    relationships:
+      - type: Governs
+        target: Rule
+`, lintError, `does not allow target "Rule"`},
+		{"max_in", `
+  - name: Law
+    type: SystemConcept
+    relationships:
+      - type: Governs
+        target: Whole
+`, lintError, `"Whole" is the target of more than 1 "Governs"`},
+		{"max_out across children and edges", `
+  - name: Other Whole
+    type: FundamentalConcept
+    children:
+      - name: Shared
+        type: FundamentalConcept
+        relationships:
+          - type: Component Of
+            target: Whole
+`, lintError, `"Shared" has more than 1 "Component Of"`},
+		{"max_out through an inverse", `
+  - name: Other Whole
+    type: FundamentalConcept
+    relationships:
+      - type: Composed Of
+        target: Part
+`, lintError, `"Part" has more than 1 "Component Of"`},
+		{"edge written both ways", `
+  - name: Assembly
+    type: FundamentalConcept
+    children:
+      - name: Gear
+        type: FundamentalConcept
+    relationships:
+      - type: Composed Of
+        target: Gear
+`, "", ""},
+		{"component cycle", `
+  - name: Egg
+    type: FundamentalConcept
+    children:
+      - name: Chicken
+        type: FundamentalConcept
+    relationships:
+      - type: Component Of
+        target: Chicken
+`, lintError, `"Component Of" cycle`},
+		{"orphan", `
+  - name: Alone
+    type: FundamentalConcept
+`, lintWarning, `"Alone" is an orphan`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := lintBase + tt.add
+			if strings.HasPrefix(strings.TrimSpace(tt.add), "relationships:") {
+				// a second top-level key would be invalid YAML; extend the first list instead
+				doc = strings.Replace(lintBase, "relationships:\n", strings.TrimSpace(tt.add)+"\n", 1)
+			}
+			issues, err := lintOntology([]byte(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.severity == "" {
+				if len(issues) > 0 {
+					t.Errorf("issues in a valid ontology: %v", issues)
+				}
+				return
+			}
+			for _, issue := range issues {
+				if issue.Severity == tt.severity && strings.Contains(issue.Message, tt.message) {
+					if issue.Line == 0 {
+						t.Errorf("issue %q has no line", issue.Message)
+					}
+					return
+				}
+			}
+			t.Errorf("no %s containing %q in %v", tt.severity, tt.message, issues)
+		})
+	}
+}
+
+func TestShippedOntologyLints(t *testing.T) {
+	issues, err := lintOntologyFile(conceptStructurePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		if issue.Severity == lintError {
+			t.Errorf("%s: %s", conceptStructurePath, issue)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MigrationOp is a single change needed to bring the live graph in line with the ontology file
+type MigrationOp struct {
+	Action string // "add", "update", "rename" or "remove"
+	Kind   string // "relationship-type", "concept" or "relationship"
+	Name   string
+	From   string `json:",omitempty"`
+	Detail string `json:",omitempty"`
+}
+
+func (op MigrationOp) String() string {
+	if op.From != "" {
+		return fmt.Sprintf("%s %s %s -> %s", op.Action, op.Kind, op.From, op.Name)
+	}
+	return fmt.Sprintf("%s %s %s", op.Action, op.Kind, op.Name)
+}
+
+// AppliedMigration records one migration run against this node's graph
+type AppliedMigration struct {
+	Version    int
+	Hash       string
+	AppliedAt  time.Time
+	Operations []MigrationOp
+}
+
+// OntologyState tracks which ontology version was applied and which concepts,
+// relationship types and edges are owned by the ontology file. Only owned items
+// are ever removed by a migration; anything created at runtime is left alone.
+type OntologyState struct {
+	Version           int
+	Hash              string
+	Concepts          []string
+	RelationshipTypes []string
+	Relationships     []string
+	Applied           []AppliedMigration
+}
+
+// MigrationReport describes a planned or applied migration
+type MigrationReport struct {
+	FromVersion int
+	ToVersion   int
+	Hash        string
+	DryRun      bool
+	Issues      []LintIssue
+	Operations  []MigrationOp
+}
+
+var (
+	ontologyState OntologyState
+	ontologyMu    sync.Mutex
+)
+
+type ontologyConcept struct {
+	Name        string
+	Description string
+	Type        string
+	RenamedFrom []string
+}
+
+type ontologyEdge struct {
+	Source string
+	Type   string
+	Target string
+}
+
+func (e ontologyEdge) key() string { return e.Source + "|" + e.Type + "|" + e.Target }
+
+// ontology is the flattened form of a ConceptStructure
+type ontology struct {
+	types    []ontologyConcept
+	concepts []ontologyConcept
+	edges    []ontologyEdge
+}
+
+func flattenStructure(structure *ConceptStructure) *ontology {
+	o := &ontology{}
+	for _, rel := range structure.Relationships {
+		o.types = append(o.types, ontologyConcept{Name: rel.Name, Description: rel.Description, Type: relationshipTypeConceptType, RenamedFrom: rel.RenamedFrom})
+	}
+
+	// Concept names are unique here: the bootstrap and migrateOntology refuse a
+	// file the linter finds a duplicate in. Edges can still be given twice, as a
+	// child and as a "Component Of" relationship, and are kept once.
+	seenEdges := make(map[string]bool)
+	addEdge := func(e ontologyEdge) {
+		if !seenEdges[e.key()] {
+			seenEdges[e.key()] = true
+			o.edges = append(o.edges, e)
+		}
+	}
+	var walk func(node ConceptNode, parent string)
+	walk = func(node ConceptNode, parent string) {
+		o.concepts = append(o.concepts, ontologyConcept{Name: node.Name, Description: node.Description, Type: node.Type, RenamedFrom: node.RenamedFrom})
+		if parent != "" {
+			addEdge(ontologyEdge{node.Name, componentOfRelationship, parent})
+		}
+		for _, child := range node.Children {
+			walk(child, node.Name)
+		}
+		for _, rel := range node.Relationships {
+			addEdge(ontologyEdge{node.Name, rel.Type, rel.Target})
+		}
+	}
+	for _, node := range structure.Concepts {
+		walk(node, "")
+	}
+	return o
+}
+
+func (o *ontology) names() (types []string, concepts []string, edges []string) {
+	for _, t := range o.types {
+		types = append(types, t.Name)
+	}
+	for _, c := range o.concepts {
+		concepts = append(concepts, c.Name)
+	}
+	for _, e := range o.edges {
+		edges = append(edges, e.key())
+	}
+	return
+}
+
+func (s *Server) liveConceptsByName() map[string]*Concept {
+	concepts := s.concepts.Snapshot()
+	byName := make(map[string]*Concept, len(concepts))
+	for _, concept := range concepts {
+		byName[concept.Name] = concept
+	}
+	return byName
+}
+
+func (s *Server) liveEdgeKeys(renames map[string]string) map[string]*Relationship {
+	concepts := s.concepts.Snapshot()
+	name := func(id ConceptGUID) string {
+		if c, ok := concepts[id]; ok {
+			if renamed, ok := renames[c.Name]; ok {
+				return renamed
+			}
+			return c.Name
+		}
+		return ""
+	}
+	relationships := s.relationships.List()
+	edges := make(map[string]*Relationship, len(relationships))
+	for _, rel := range relationships {
+		e := ontologyEdge{name(ConceptGUID(rel.SourceID)), name(rel.Type), name(ConceptGUID(rel.TargetID))}
+		if e.Source != "" && e.Type != "" && e.Target != "" {
+			edges[e.key()] = rel
+		}
+	}
+	return edges
+}
+
+// planMigration diffs the ontology against the live graph
+func (s *Server) planMigration(o *ontology, state *OntologyState) []MigrationOp {
+	live := s.liveConceptsByName()
+	renames := make(map[string]string)
+	var ops []MigrationOp
+
+	diffConcepts := func(kind string, wanted []ontologyConcept) {
+		for _, want := range wanted {
+			existing, exists := live[want.Name]
+			if !exists {
+				for _, old := range want.RenamedFrom {
+					if c, ok := live[old]; ok {
+						if _, taken := renames[old]; !taken {
+							renames[old] = want.Name
+							ops = append(ops, MigrationOp{Action: "rename", Kind: kind, Name: want.Name, From: old})
+							existing, exists = c, true
+							break
+						}
+					}
+				}
+			}
+			if !exists {
+				ops = append(ops, MigrationOp{Action: "add", Kind: kind, Name: want.Name})
+				continue
+			}
+			if existing.Description != want.Description || existing.ConceptType != want.Type {
+				ops = append(ops, MigrationOp{Action: "update", Kind: kind, Name: want.Name, Detail: "description/type changed"})
+			}
+		}
+	}
+	diffConcepts("relationship-type", o.types)
+	diffConcepts("concept", o.concepts)
+
+	wantedTypes, wantedConcepts, wantedEdges := o.names()
+	wanted := make(map[string]bool)
+	for _, name := range append(append(wantedTypes, wantedConcepts...), wantedEdges...) {
+		wanted[name] = true
+	}
+	renamed := func(name string) string {
+		if n, ok := renames[name]; ok {
+			return n
+		}
+		return name
+	}
+
+	edges := s.liveEdgeKeys(renames)
+	for _, key := range state.Relationships {
+		e := splitEdgeKey(key)
+		e = ontologyEdge{renamed(e.Source), renamed(e.Type), renamed(e.Target)}
+		if _, exists := edges[e.key()]; exists && !wanted[e.key()] {
+			ops = append(ops, MigrationOp{Action: "remove", Kind: "relationship", Name: e.key()})
+		}
+	}
+	for _, e := range o.edges {
+		if _, exists := edges[e.key()]; !exists {
+			ops = append(ops, MigrationOp{Action: "add", Kind: "relationship", Name: e.key()})
+		}
+	}
+
+	removeOwned := func(kind string, owned []string) {
+		for _, name := range owned {
+			if _, isRenamed := renames[name]; isRenamed || wanted[name] {
+				continue
+			}
+			if _, exists := live[name]; exists {
+				ops = append(ops, MigrationOp{Action: "remove", Kind: kind, Name: name})
+			}
+		}
+	}
+	removeOwned("concept", state.Concepts)
+	removeOwned("relationship-type", state.RelationshipTypes)
+	return ops
+}
+
+func splitEdgeKey(key string) ontologyEdge {
+	parts := strings.SplitN(key, "|", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return ontologyEdge{parts[0], parts[1], parts[2]}
+}
+
+// applyMigration executes planned operations; each step re-checks the live graph so
+// re-running a partially applied migration is safe
+func (s *Server) applyMigration(ctx context.Context, o *ontology, ops []MigrationOp) error {
+	wanted := make(map[string]ontologyConcept)
+	for _, c := range append(append([]ontologyConcept{}, o.types...), o.concepts...) {
+		wanted[c.Name] = c
+	}
+
+	for _, op := range ops {
+		live := s.liveConceptsByName()
+		switch {
+		case op.Action == "rename":
+			concept, ok := live[op.From]
+			if !ok {
+				continue
+			}
+			concept = concept.clone()
+			want := wanted[op.Name]
+			concept.Name = want.Name
+			concept.Description = want.Description
+			concept.ConceptType = want.Type
+			concept.Timestamp = time.Now()
+			if err := s.addOrUpdateConcept(ctx, concept, peerID); err != nil {
+				return fmt.Errorf("failed to %s: %v", op, err)
+			}
+
+		case op.Action == "add" && op.Kind != "relationship":
+			if _, ok := live[op.Name]; ok {
+				continue
+			}
+			want := wanted[op.Name]
+			concept := &Concept{
+				ID:            ConceptGUID(s.generateGUID(ctx, want.Name)),
+				Name:          want.Name,
+				Description:   want.Description,
+				ConceptType:   want.Type,
+				Relationships: []RelationshipGUID{},
+				Timestamp:     time.Now(),
+			}
+			if err := s.addOrUpdateConcept(ctx, concept, peerID); err != nil {
+				return fmt.Errorf("failed to %s: %v", op, err)
+			}
+
+		case op.Action == "update":
+			concept, ok := live[op.Name]
+			if !ok {
+				continue
+			}
+			concept = concept.clone()
+			want := wanted[op.Name]
+			concept.Description = want.Description
+			concept.ConceptType = want.Type
+			concept.Timestamp = time.Now()
+			if err := s.addOrUpdateConcept(ctx, concept, peerID); err != nil {
+				return fmt.Errorf("failed to %s: %v", op, err)
+			}
+
+		case op.Action == "add" && op.Kind == "relationship":
+			e := splitEdgeKey(op.Name)
+			source, ok1 := live[e.Source]
+			relType, ok2 := live[e.Type]
+			target, ok3 := live[e.Target]
+			if !ok1 || !ok2 || !ok3 {
+				return fmt.Errorf("failed to %s: unknown concept or relationship type", op)
+			}
+			if s.findRelationship(EntityGUID(source.ID), relType.ID, EntityGUID(target.ID)) != nil {
+				continue
+			}
+			if err := s.createCoreRelationship(ctx, EntityGUID(source.ID), relType.ID, EntityGUID(target.ID)); err != nil {
+				return fmt.Errorf("failed to %s: %v", op, err)
+			}
+
+		case op.Action == "remove" && op.Kind == "relationship":
+			e := splitEdgeKey(op.Name)
+			source, ok1 := live[e.Source]
+			relType, ok2 := live[e.Type]
+			target, ok3 := live[e.Target]
+			if !ok1 || !ok2 || !ok3 {
+				continue
+			}
+			if rel := s.findRelationship(EntityGUID(source.ID), relType.ID, EntityGUID(target.ID)); rel != nil {
+				s.removeRelationship(ctx, rel.ID)
+			}
+
+		case op.Action == "remove":
+			concept, ok := live[op.Name]
+			if !ok {
+				continue
+			}
+			if _, err := s.removeConcept(ctx, concept.ID); err != nil {
+				return fmt.Errorf("failed to %s: %v", op, err)
+			}
+		}
+	}
+
+	return s.persist(ctx)
+}
+
+func readOntology(filename string) (*ConceptStructure, string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file: %v", err)
+	}
+	var structure ConceptStructure
+	if err := yaml.Unmarshal(data, &structure); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal YAML: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return &structure, hex.EncodeToString(sum[:]), nil
+}
+
+func loadOntologyState(ctx context.Context) {
+	ontologyMu.Lock()
+	defer ontologyMu.Unlock()
+
+	ontologyState = OntologyState{}
+	if err := loadData(ctx, ontologyStatePath, &ontologyState); err != nil {
+		log.Printf("Failed to load ontology state: %v\n", err)
+	}
+}
+
+// recordOntology marks the ontology as applied and takes ownership of its items
+func recordOntology(ctx context.Context, structure *ConceptStructure, hash string, ops []MigrationOp) error {
+	types, concepts, edges := flattenStructure(structure).names()
+	sort.Strings(types)
+	sort.Strings(concepts)
+	sort.Strings(edges)
+
+	ontologyState.Version = structure.Version
+	ontologyState.Hash = hash
+	ontologyState.RelationshipTypes = types
+	ontologyState.Concepts = concepts
+	ontologyState.Relationships = edges
+	ontologyState.Applied = append(ontologyState.Applied, AppliedMigration{
+		Version:    structure.Version,
+		Hash:       hash,
+		AppliedAt:  time.Now(),
+		Operations: ops,
+	})
+	return saveData(ctx, ontologyStatePath, ontologyState)
+}
+
+// migrateOntology brings the live graph in line with the ontology file. With dryRun
+// set it only reports the operations that would be applied.
+func (s *Server) migrateOntology(ctx context.Context, filename string, dryRun bool) (*MigrationReport, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	ontologyMu.Lock()
+	defer ontologyMu.Unlock()
+
+	structure, hash, err := readOntology(filename)
+	if err != nil {
+		return nil, err
+	}
+	report := &MigrationReport{
+		FromVersion: ontologyState.Version,
+		ToVersion:   structure.Version,
+		Hash:        hash,
+		DryRun:      dryRun,
+	}
+	if report.Issues, err = lintOntologyFile(filename); err != nil {
+		return nil, err
+	}
+	if hasLintErrors(report.Issues) {
+		return report, fmt.Errorf("ontology %s has errors", filename)
+	}
+	if structure.Version < ontologyState.Version {
+		return report, fmt.Errorf("ontology version %d is older than applied version %d", structure.Version, ontologyState.Version)
+	}
+
+	o := flattenStructure(structure)
+	report.Operations = s.planMigration(o, &ontologyState)
+	if dryRun {
+		return report, nil
+	}
+	if len(report.Operations) == 0 && hash == ontologyState.Hash {
+		return report, nil
+	}
+
+	if err := s.applyMigration(ctx, o, report.Operations); err != nil {
+		return report, err
+	}
+	if err := recordOntology(ctx, structure, hash, report.Operations); err != nil {
+		return report, err
+	}
+	if err := s.refreshRelationshipTypeSpecs(filename); err != nil {
+		log.Printf("Failed to load relationship type constraints: %v\n", err)
+	}
+	log.Printf("Applied ontology version %d with %d operations", structure.Version, len(report.Operations))
+	return report, nil
+}
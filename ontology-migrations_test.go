@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestMigrateOntology adds, renames and removes concepts by migrating to
+// edited copies of the shipped ontology
+func TestMigrateOntology(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	runtime := newConcepts(t, s, "Runtime")[0]
+
+	shipped, _, err := readOntology(conceptStructurePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := shipped.Concepts
+	writeVersion := func(version int, extra ...ConceptNode) string {
+		structure := *shipped
+		structure.Version = version
+		structure.Concepts = append(slices.Clip(base), extra...)
+		data, err := yaml.Marshal(&structure)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(t.TempDir(), "concepts_structure.yaml")
+		if err := os.WriteFile(filename, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	actions := func(report *MigrationReport) []string {
+		var ops []string
+		for _, op := range report.Operations {
+			ops = append(ops, op.String())
+		}
+		slices.Sort(ops)
+		return ops
+	}
+	lookup := func(name string) (ConceptGUID, bool) {
+		guid, ok := s.concepts.LookupName(name)
+		return ConceptGUID(guid), ok
+	}
+
+	v3 := writeVersion(3, ConceptNode{Name: "Weather", Description: "What the sky does", Type: "FundamentalConcept",
+		Children: []ConceptNode{{Name: "Rain", Description: "Water falling", Type: "FundamentalConcept"}}})
+	report, err := s.migrateOntology(ctx, v3, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"add concept Rain", "add concept Weather", "add relationship Rain|Component Of|Weather"}
+	if got := actions(report); !slices.Equal(got, want) {
+		t.Errorf("planned %v, want %v", got, want)
+	}
+	if _, ok := lookup("Weather"); ok || ontologyState.Version != shipped.Version {
+		t.Error("a dry run changed the graph")
+	}
+
+	if _, err := s.migrateOntology(ctx, v3, false); err != nil {
+		t.Fatal(err)
+	}
+	weather, ok1 := lookup("Weather")
+	rain, ok2 := lookup("Rain")
+	if !ok1 || !ok2 || s.findRelationship(EntityGUID(rain), s.findConceptGUID(componentOfRelationship), EntityGUID(weather)) == nil {
+		t.Fatal("migration did not add Weather, Rain and their edge")
+	}
+	if report, err := s.migrateOntology(ctx, v3, false); err != nil || len(report.Operations) != 0 {
+		t.Errorf("migrating again planned %v (%v)", report.Operations, err)
+	}
+
+	v4 := writeVersion(4, ConceptNode{Name: "Climate", Description: "What the sky does", Type: "FundamentalConcept", RenamedFrom: []string{"Weather"}})
+	report, err = s.migrateOntology(ctx, v4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"remove concept Rain", "remove relationship Rain|Component Of|Climate", "rename concept Weather -> Climate"}
+	if got := actions(report); !slices.Equal(got, want) {
+		t.Errorf("applied %v, want %v", got, want)
+	}
+	if climate, _ := lookup("Climate"); climate != weather {
+		t.Errorf("renamed concept has GUID %s, want %s", climate, weather)
+	}
+	if _, ok := s.concepts.Get(rain); ok {
+		t.Error("concept dropped from the ontology was kept")
+	}
+	if _, ok := s.concepts.Get(ConceptGUID(runtime)); !ok {
+		t.Error("concept created at runtime was removed")
+	}
+
+	if _, err := s.migrateOntology(ctx, v3, false); err == nil {
+		t.Error("migrated back to an older version")
+	}
+}
+
+// TestShippedInteractionTypes checks that a node bootstrapped from version 1 of
+// the ontology, which had no InteractionType concepts, gets every interaction
+// type data/dynamics.yaml configures when it migrates to the shipped file
+func TestShippedInteractionTypes(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+
+	// Put the graph back the way version 1 left it
+	for _, name := range []string{"Music", "Meditation"} {
+		if _, err := s.removeConcept(ctx, s.findConceptGUID(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flow, _ := s.concepts.Get(s.findConceptGUID("Flow State"))
+	flow = flow.clone()
+	flow.ConceptType = "FundamentalConcept"
+	if err := s.addOrUpdateConcept(ctx, flow, peerID); err != nil {
+		t.Fatal(err)
+	}
+	ontologyMu.Lock()
+	ontologyState.Version, ontologyState.Hash = 1, ""
+	ontologyMu.Unlock()
+
+	report, err := s.migrateOntology(ctx, conceptStructurePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ToVersion != 2 {
+		t.Errorf("migrated to version %d, want 2", report.ToVersion)
+	}
+
+	config, err := loadDynamicsConfig(dynamicsConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range config.Interactions {
+		guid, ok := s.concepts.LookupName(name)
+		if !ok {
+			t.Errorf("interaction type %s not in the graph after %v", name, report.Operations)
+			continue
+		}
+		if _, err := s.interactionTypeName(ConceptGUID(guid)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -2,100 +2,124 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func listPeers_h(c *gin.Context) {
-	peerMapMu.RLock()
-	defer peerMapMu.RUnlock()
+// peerView is a peer as /peers lists it
+type peerView struct {
+	ID           PeerID
+	StewardIDs   []SeedGUID
+	Status       string
+	Timestamp    time.Time
+	LastSeen     time.Time
+	Latency      time.Duration
+	ConceptCount int
+	SeedCount    int
+	ConceptCIDs  []CID
+	SeedCIDs     []CID
+}
+
+// listPeers_h lists the peers with a steward and how recently they were heard
+// from, optionally only those with the ?status= given
+func (s *Server) listPeers_h(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != peerOnline && status != peerStale && status != peerOffline {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be online, stale or offline"})
+		return
+	}
 
-	filteredPeerMap := make(map[PeerID]Peer_i)
-	for peerID, peer := range peerMap {
-		if peer.GetStewardID() != "" {
-			filteredPeerMap[peerID] = peer
+	now := time.Now()
+	views := make(map[PeerID]peerView)
+	for peerID, peer := range s.peers.Snapshot() {
+		view := peerView{
+			ID:          peerID,
+			StewardIDs:  peer.GetStewardIDs(),
+			Status:      peerStatus(peer, now),
+			Timestamp:   peer.GetTimestamp(),
+			LastSeen:    peerLastSeen(peer),
+			Latency:     peer.GetLatency(),
+			ConceptCIDs: peer.GetConceptCIDs(),
+			SeedCIDs:    peer.GetSeedCIDs(),
+		}
+		view.ConceptCount, view.SeedCount = len(view.ConceptCIDs), len(view.SeedCIDs)
+		if len(view.StewardIDs) > 0 && (status == "" || view.Status == status) {
+			views[peerID] = view
 		}
 	}
 
-	c.JSON(http.StatusOK, filteredPeerMap)
+	c.JSON(http.StatusOK, views)
 }
 
-func addOrUpdatePeer(ctx context.Context, peerID PeerID, stewardID SeedGUID) {
-	peerMapMu.Lock()
-	defer peerMapMu.Unlock()
-
-	if _, ok := peerMap[peerID]; !ok {
-		peerMap[peerID] = &Peer{
-			ID:        peerID,
-			StewardID: stewardID,
-			Timestamp: time.Now(),
-		}
+// addOrUpdatePeer adds a peer we heard from, or records that we heard from it.
+// It is taken to run the stewards whose claims check out.
+func (s *Server) addOrUpdatePeer(ctx context.Context, peerID PeerID, claims map[SeedGUID]string) {
+	now := time.Now()
+	peer := &Peer{ID: peerID, Timestamp: now, LastSeen: now, StewardClaims: claims}
+	peer.SetStewardIDs(s.verifiedStewards(peerID, claims))
+	changed := s.peers.PutIfAbsent(ctx, peer)
+	if changed {
 		log.Printf("Added peer: %s", peerID)
-		if err := savePeerList(ctx); err != nil {
-			log.Printf("Failed to save peerMap: %v", err)
-		}
+	} else {
+		s.peers.Update(ctx, peerID, func(p *Peer) {
+			p.LastSeen = now
+			if !slices.Equal(p.GetStewardIDs(), peer.GetStewardIDs()) || !maps.Equal(p.StewardClaims, claims) {
+				p.SetStewardIDs(peer.GetStewardIDs())
+				p.StewardClaims = claims
+				changed = true
+			}
+		})
+	}
+	if changed {
+		s.persist(ctx)
 	}
 }
 
-func updatePeerCIDs(peerID PeerID, conceptCIDs []CID, seedCIDs []CID) {
-	conceptMu.Lock()
-	defer conceptMu.Unlock()
+// updatePeerCIDs merges the concept and seed versions a peer announced that we
+// do not hold yet. A version only replaces ours when it was built on it.
+func (s *Server) updatePeerCIDs(peerID PeerID, conceptCIDs []CID, seedCIDs []CID) {
+	ctx := context.Background()
 
-	for _, cid := range conceptCIDs {
-		found := false
-		for _, concept := range conceptMap {
-			if concept.GetCID() == cid {
-				found = true
-				break
-			}
-		}
-		if !found {
-			// If the concept is not in our list, we might want to fetch it
-			// This is left as an exercise, as it depends on how you want to handle this case
-			log.Printf("Found new Concept CID from peer %s: %s", peerID, cid)
-		}
+	known := make(map[CID]bool)
+	for _, cid := range s.concepts.CIDs() {
+		known[cid] = true
+	}
+	for _, cid := range s.seeds.CIDs() {
+		known[cid] = true
 	}
 
-	for _, cid := range seedCIDs {
-		found := false
-		for _, seed := range seedMap {
-			if seed.GetCID() == cid {
-				found = true
-				break
-			}
+	merged := false
+	merge := func(kind string, cid CID, mergeFunc func(context.Context, PeerID, CID) error) {
+		if known[cid] {
+			return
 		}
-		if !found {
-			// If the concept is not in our list, we might want to fetch it
-			// This is left as an exercise, as it depends on how you want to handle this case
-			log.Printf("Found new Seed CID from peer %s: %s", peerID, cid)
+		err := mergeFunc(ctx, peerID, cid)
+		switch {
+		case err == nil:
+			merged = true
+		case errors.Is(err, errStaleVersion):
+		case errors.Is(err, errPreconditionFailed):
+			log.Printf("Conflicting %s version from peer %s kept out: %v", kind, peerID, err)
+		case errors.Is(err, errForbidden):
+			log.Printf("Rejected %s %s from peer %s: %v", kind, cid, peerID, err)
+		default:
+			log.Printf("Failed to merge %s %s from peer %s: %v", kind, cid, peerID, err)
 		}
 	}
-}
+	for _, cid := range conceptCIDs {
+		merge("concept", cid, s.mergePeerConcept)
+	}
+	for _, cid := range seedCIDs {
+		merge("seed", cid, s.mergePeerSeed)
+	}
 
-func discoverPeers(ctx context.Context) {
-	//	peers, err := network.ListPeers(ctx)
-	//	if err != nil {
-	//		log.Printf("Error discovering peers: %v", err)
-	//		return
-	//	}
-	//
-	//	peerMapMu.Lock()
-	//	defer peerMapMu.Unlock()
-	//
-	//	for _, peer := range peers {
-	//		peerID := peer.GetID()
-	//		if _, exists := peerMap[peerID]; !exists {
-	//			peerMap[peerID] = peer
-	//			log.Printf("Discovered new peer: %s", peerID)
-	//		}
-	//	}
-	//
-	//	log.Printf("Discovered %d peers", len(peerMap))
-	//
-	//	if err := network.Save(context.Background(), savePeerList(ctx), peerMap); err != nil {
-	//		log.Printf("Failed to save peerMap: %v", err)
-	//	}
+	if merged {
+		s.persist(ctx)
+	}
 }
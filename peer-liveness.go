@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	peerOnline  = "online"
+	peerStale   = "stale"
+	peerOffline = "offline"
+)
+
+// peerLastSeen is when the node last heard from or saw a peer; peers saved
+// before this was tracked fall back to when they were first heard of
+func peerLastSeen(peer Peer_i) time.Time {
+	if seen := peer.GetLastSeen(); !seen.IsZero() {
+		return seen
+	}
+	return peer.GetTimestamp()
+}
+
+// peerStatus tells how recently a peer was heard from. The node itself is
+// always online.
+func peerStatus(peer Peer_i, now time.Time) string {
+	silence := now.Sub(peerLastSeen(peer))
+	switch {
+	case peer.GetID() == peerID || silence < nodeConfig.PeerStaleAfter:
+		return peerOnline
+	case silence < nodeConfig.PeerOfflineAfter:
+		return peerStale
+	default:
+		return peerOffline
+	}
+}
+
+// discoverPeers refreshes who is around. Peers subscribed to the topic are
+// present, so they count as seen. One the node does not know yet is added once
+// it announces itself with its claims; when it first shows up it is sent an
+// announcement so it answers without waiting for its own. Connected peers get
+// their latency. Peers silent for longer than peer_evict_after are forgotten.
+// Only forgetting peers is saved right away; the rest goes with the next save.
+func (s *Server) discoverPeers(ctx context.Context) {
+	now := time.Now()
+
+	latencies := make(map[PeerID]time.Duration)
+	if connected, err := network.ListPeers(ctx); err != nil {
+		log.Printf("Error listing connected peers: %v", err)
+	} else {
+		for _, peer := range connected {
+			latencies[peer.GetID()] = peer.GetLatency()
+		}
+	}
+
+	discovered := false
+	if present, err := network.TopicPeers(ctx, pubsubTopic()); err != nil {
+		log.Printf("Error listing peers on %s: %v", pubsubTopic(), err)
+	} else {
+		strangers := make(map[PeerID]bool)
+		for _, id := range present {
+			if !acceptPeer(id) || s.peers.Update(ctx, id, func(p *Peer) { p.LastSeen = now }) {
+				continue
+			}
+			strangers[id] = true
+			if !s.strangers[id] {
+				log.Printf("Discovered peer %s on %s", id, pubsubTopic())
+				discovered = true
+			}
+		}
+		s.strangers = strangers
+	}
+
+	s.peers.Update(ctx, peerID, func(p *Peer) { p.LastSeen = now })
+	evicted := 0
+	for id, peer := range s.peers.Snapshot() {
+		if id == peerID {
+			continue
+		}
+		if now.Sub(peerLastSeen(peer)) > nodeConfig.PeerEvictAfter {
+			s.peers.Delete(ctx, id)
+			log.Printf("Evicted peer %s, last seen %s", id, peerLastSeen(peer).Format(time.RFC3339))
+			evicted++
+			continue
+		}
+		if latency := latencies[id]; latency != peer.GetLatency() {
+			s.peers.Update(ctx, id, func(p *Peer) { p.Latency = latency })
+		}
+	}
+
+	if evicted > 0 {
+		s.persist(ctx)
+	}
+	if discovered {
+		s.announce()
+	}
+}
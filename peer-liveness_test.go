@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPeerStatus(t *testing.T) {
+	newTestServer(t)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		id     PeerID
+		silent time.Duration
+		want   string
+	}{
+		{"just heard from", "other", time.Second, peerOnline},
+		{"past stale", "other", nodeConfig.PeerStaleAfter + time.Second, peerStale},
+		{"past offline", "other", nodeConfig.PeerOfflineAfter + time.Second, peerOffline},
+		{"the node itself", peerID, nodeConfig.PeerOfflineAfter + time.Second, peerOnline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := &Peer{ID: tt.id, LastSeen: now.Add(-tt.silent)}
+			if got := peerStatus(peer, now); got != tt.want {
+				t.Errorf("status %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverPeers(t *testing.T) {
+	s, mem := newTestServer(t)
+	ctx := context.Background()
+	store := stateStore.(*fileStore)
+	walSize := func() int64 {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		return store.walSize
+	}
+	announced := func() bool {
+		select {
+		case <-s.announceCh:
+			return true
+		default:
+			return false
+		}
+	}
+	announced()
+
+	s.addOrUpdatePeer(ctx, "known", nil)
+	s.addOrUpdatePeer(ctx, "gone", nil)
+	s.peers.Update(ctx, "known", func(p *Peer) { p.LastSeen = time.Now().Add(-time.Hour) })
+	s.peers.Update(ctx, "gone", func(p *Peer) { p.LastSeen = time.Now().Add(-nodeConfig.PeerEvictAfter - time.Hour) })
+	s.persist(ctx)
+	mem.present = []PeerID{"known", "stranger"}
+
+	before := walSize()
+	s.discoverPeers(ctx)
+	if _, ok := s.peers.Get("gone"); ok {
+		t.Error("silent peer not evicted")
+	}
+	if walSize() == before {
+		t.Error("evicting a peer was not saved")
+	}
+	if known, _ := s.peers.Get("known"); time.Since(known.GetLastSeen()) > time.Minute {
+		t.Error("peer on the topic not marked as seen")
+	}
+	if _, ok := s.peers.Get("stranger"); ok {
+		t.Error("peer added before it announced itself")
+	}
+	if !announced() {
+		t.Error("no announcement for a newly discovered peer")
+	}
+
+	before = walSize()
+	s.discoverPeers(ctx)
+	if walSize() != before {
+		t.Error("a tick that changed no peers was saved")
+	}
+	if announced() {
+		t.Error("the same stranger was announced to again")
+	}
+
+	mem.present = nil
+	s.discoverPeers(ctx)
+	mem.present = []PeerID{"stranger"}
+	s.discoverPeers(ctx)
+	if !announced() {
+		t.Error("no announcement for a peer that came back")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errPreconditionFailed = errors.New("precondition failed")
+	errStaleVersion       = errors.New("version already known")
+)
+
+func etag(cid CID) string {
+	return `"` + string(cid) + `"`
+}
+
+// ifMatch reports whether the request's If-Match header, if any, names the
+// current CID
+func ifMatch(c *gin.Context, current CID) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag(current) {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed answers a stale write with the entity's current version
+func preconditionFailed(c *gin.Context, current CID, entity any) {
+	c.Header("ETag", etag(current))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "Version mismatch: the entity was changed since it was read",
+		"current": entity,
+	})
+}
+
+// checkFastForward decides whether a version received from a peer can replace ours
+func checkFastForward(ctx context.Context, local, remote, remotePrevious CID) error {
+	switch {
+	case local == "" || remotePrevious == local:
+		return nil // new to us, or built on our current version: fast-forward
+	case remote == local || inHistory(ctx, local, remote):
+		return errStaleVersion
+	default:
+		return fmt.Errorf("%w: local %s, remote %s based on %s", errPreconditionFailed, local, remote, remotePrevious)
+	}
+}
+
+// mergePeerConcept applies a concept version published by a peer. Like If-Match
+// on a PUT, it only replaces our version when the peer's one was based on it,
+// and like a PUT it needs an admin.
+func (s *Server) mergePeerConcept(ctx context.Context, from PeerID, cid CID) error {
+	content, err := loadVersion(ctx, cid)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(content)
+	var remote Concept
+	if err := json.Unmarshal(data, &remote); err != nil || remote.ID == "" {
+		return fmt.Errorf("invalid concept %s", cid)
+	}
+	remote.CID = cid
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	local, exists := s.concepts.Get(remote.ID)
+	var localCID CID
+	if exists {
+		localCID = local.GetCID()
+	}
+	if err := checkFastForward(ctx, localCID, cid, remote.PreviousCID); err != nil {
+		return err
+	}
+	if err := s.authorizePeerConcept(from); err != nil {
+		return err
+	}
+
+	if err := s.addOrUpdateConcept(ctx, &remote, peerID); err != nil {
+		return err
+	}
+	log.Printf("Merged concept %s version %d from peer %s", remote.ID, remote.Version, from)
+	return nil
+}
+
+// mergePeerSeed applies a seed version published by a peer, with the same
+// precondition as mergePeerConcept, if the peer runs the seed's steward
+func (s *Server) mergePeerSeed(ctx context.Context, from PeerID, cid CID) error {
+	content, err := loadVersion(ctx, cid)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(content)
+	remote, err := UnmarshalJSON2Seed(data)
+	if err != nil {
+		return err
+	}
+	remote.SetCID(cid)
+	core := remote.GetCoreSeed()
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	var localCID CID
+	local, exists := s.seeds.Get(core.SeedID)
+	if exists {
+		localCID = local.GetCID()
+	}
+	if err := checkFastForward(ctx, localCID, cid, core.PreviousCID); err != nil {
+		return err
+	}
+	if err := s.authorizePeerSeed(from, local, remote); err != nil {
+		return err
+	}
+
+	if err := s.addOrUpdateSeed(ctx, remote, peerID); err != nil {
+		return err
+	}
+	log.Printf("Merged seed %s version %d from peer %s", core.SeedID, core.Version, from)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatch(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	_, adminToken, _ := s.auth.createToken(ctx, "admin", defaultSteward(), true)
+	alice := newTestSteward(t, s, "Alice")
+	_, aliceToken, _ := s.auth.createToken(ctx, "alice", alice.SeedID, false)
+	guid := newConcepts(t, s, "Edited")[0]
+	r := gin.New()
+	s.setupRoutes(r)
+
+	send := func(method, path, token, contentType, ifMatch string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	put := func(ifMatch, description string) *httptest.ResponseRecorder {
+		return send(http.MethodPut, "/concept/"+string(guid), adminToken, "application/json", ifMatch,
+			map[string]string{"name": "Edited", "description": description, "type": "FundamentalConcept"})
+	}
+
+	read := serveWith(r, http.MethodGet, "/concept/"+string(guid), "", nil)
+	tag := read.Header().Get("ETag")
+	if concept, _ := s.concepts.Get(ConceptGUID(guid)); tag != etag(concept.GetCID()) {
+		t.Fatalf("GET ETag %s, want %s", tag, etag(concept.GetCID()))
+	}
+
+	w := put(tag, "First edit")
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT with the current ETag: %d %s", w.Code, w.Body)
+	}
+	current := w.Header().Get("ETag")
+	if current == tag || current == "" {
+		t.Errorf("PUT answered ETag %q after a change", current)
+	}
+
+	w = put(tag, "Lost edit")
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != current {
+		t.Fatalf("PUT with a stale ETag: %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+	var conflict struct {
+		Current Concept `json:"current"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if conflict.Current.Description != "First edit" {
+		t.Errorf("412 carried %+v, want the current version", conflict.Current)
+	}
+	if concept, _ := s.concepts.Get(ConceptGUID(guid)); concept.Description != "First edit" {
+		t.Error("a stale PUT was applied")
+	}
+
+	for _, ifMatch := range []func(string) string{
+		func(string) string { return "*" },
+		func(tag string) string { return "W/" + tag },
+		func(tag string) string { return `"other", ` + tag },
+	} {
+		header := ifMatch(current)
+		w := put(header, "Edit for "+header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("If-Match %s answered %d", header, w.Code)
+		}
+		current = w.Header().Get("ETag")
+	}
+	if w := put("", "Blind edit"); w.Code != http.StatusOK {
+		t.Errorf("PUT without If-Match answered %d", w.Code)
+	}
+
+	seedPath := "/seed/" + string(alice.SeedID)
+	seedTag := serveWith(r, http.MethodGet, seedPath, "", nil).Header().Get("ETag")
+	patch := map[string]string{"Description": "Patched"}
+	if w := send(http.MethodPatch, seedPath, aliceToken, mergePatchContentType, seedTag, patch); w.Code != http.StatusOK {
+		t.Fatalf("PATCH with the current ETag: %d %s", w.Code, w.Body)
+	}
+	if w := send(http.MethodPatch, seedPath, aliceToken, mergePatchContentType, seedTag, patch); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with a stale ETag answered %d", w.Code)
+	}
+}
+
+func TestCheckFastForward(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	guid := ConceptGUID(newConcepts(t, s, "Shared")[0])
+	concept, _ := s.concepts.Get(guid)
+	v1 := concept.GetCID()
+	concept = concept.clone()
+	concept.Description = "Second"
+	if err := s.addOrUpdateConcept(ctx, concept, peerID); err != nil {
+		t.Fatal(err)
+	}
+	v2 := concept.GetCID()
+
+	tests := []struct {
+		name                    string
+		local, remote, previous CID
+		want                    error
+	}{
+		{"new to us", "", v1, "", nil},
+		{"built on our version", v2, "v3", v2, nil},
+		{"our version", v2, v2, v1, errStaleVersion},
+		{"older than ours", v2, v1, "", errStaleVersion},
+		{"diverged", v2, "other", v1, errPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFastForward(ctx, tt.local, tt.remote, tt.previous)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,839 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Concepts and relationship types share one IRI scheme derived from their ConceptGUID,
+// so a relationship type's concept IRI doubles as the RDF property for its edges.
+const (
+	rdfNS        = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	rdfsNS       = "http://www.w3.org/2000/01/rdf-schema#"
+	xsdNS        = "http://www.w3.org/2001/XMLSchema#"
+	ccnNS        = "urn:ccn:vocab#"
+	conceptIRINS = "urn:ccn:concept:"
+
+	rdfType                     = rdfNS + "type"
+	rdfProperty                 = rdfNS + "Property"
+	rdfsLabel                   = rdfsNS + "label"
+	rdfsComment                 = rdfsNS + "comment"
+	xsdDateTime                 = xsdNS + "dateTime"
+	ccnConcept                  = ccnNS + "Concept"
+	ccnConceptType              = ccnNS + "conceptType"
+	ccnTimestamp                = ccnNS + "timestamp"
+	relationshipTypeConceptType = "RelationshipType"
+)
+
+func conceptIRI(id ConceptGUID) string { return conceptIRINS + string(id) }
+
+func conceptGUIDFromIRI(iri string) (ConceptGUID, bool) {
+	if !strings.HasPrefix(iri, conceptIRINS) {
+		return "", false
+	}
+	return ConceptGUID(strings.TrimPrefix(iri, conceptIRINS)), true
+}
+
+// rdfTerm is an IRI or a literal in the object position of a triple
+type rdfTerm struct {
+	Value    string
+	Literal  bool
+	Datatype string
+	Lang     string
+}
+
+type rdfTriple struct {
+	Subject   string
+	Predicate string
+	Object    rdfTerm
+}
+
+func iriTerm(iri string) rdfTerm { return rdfTerm{Value: iri} }
+func literalTerm(value string) rdfTerm {
+	return rdfTerm{Value: value, Literal: true}
+}
+
+func rdfExporter(render func(w io.Writer, ds *conceptSnapshot) error) GraphExporter {
+	return func(s *Server, w io.Writer) error { return render(w, s.snapshotConcepts()) }
+}
+
+// Triples returns the RDF description of a concept
+func (c *Concept) Triples() []rdfTriple {
+	s := conceptIRI(c.ID)
+	triples := []rdfTriple{{s, rdfType, iriTerm(ccnConcept)}}
+	if c.ConceptType == relationshipTypeConceptType {
+		triples = append(triples, rdfTriple{s, rdfType, iriTerm(rdfProperty)})
+	}
+	triples = append(triples,
+		rdfTriple{s, rdfsLabel, literalTerm(c.Name)},
+		rdfTriple{s, ccnConceptType, literalTerm(c.ConceptType)},
+	)
+	if c.Description != "" {
+		triples = append(triples, rdfTriple{s, rdfsComment, literalTerm(c.Description)})
+	}
+	if !c.Timestamp.IsZero() {
+		triples = append(triples, rdfTriple{s, ccnTimestamp, rdfTerm{Value: c.Timestamp.UTC().Format(time.RFC3339Nano), Literal: true, Datatype: xsdDateTime}})
+	}
+	return triples
+}
+
+// Triple returns the RDF statement for a relationship, using its type as the property
+func (r *Relationship) Triple() rdfTriple {
+	return rdfTriple{conceptIRI(ConceptGUID(r.SourceID)), conceptIRI(r.Type), iriTerm(conceptIRI(ConceptGUID(r.TargetID)))}
+}
+
+func (ds *conceptSnapshot) triples() []rdfTriple {
+	var triples []rdfTriple
+	for _, c := range ds.Concepts {
+		triples = append(triples, c.Triples()...)
+	}
+	for _, r := range ds.Relationships {
+		triples = append(triples, r.Triple())
+	}
+	return triples
+}
+
+var turtlePrefixes = []struct{ prefix, ns string }{
+	{"rdf", rdfNS},
+	{"rdfs", rdfsNS},
+	{"xsd", xsdNS},
+	{"ccn", ccnNS},
+}
+
+func turtleIRI(iri string) string {
+	if iri == rdfType {
+		return "a"
+	}
+	for _, p := range turtlePrefixes {
+		if local, ok := strings.CutPrefix(iri, p.ns); ok && local != "" && isTurtleLocalName(local) {
+			return p.prefix + ":" + local
+		}
+	}
+	return "<" + iri + ">"
+}
+
+func isTurtleLocalName(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func turtleLiteral(t rdfTerm) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	lit := `"` + r.Replace(t.Value) + `"`
+	if t.Lang != "" {
+		return lit + "@" + t.Lang
+	}
+	if t.Datatype != "" {
+		return lit + "^^" + turtleIRI(t.Datatype)
+	}
+	return lit
+}
+
+func exportTurtle(w io.Writer, ds *conceptSnapshot) error {
+	var b strings.Builder
+	for _, p := range turtlePrefixes {
+		fmt.Fprintf(&b, "@prefix %s: <%s> .\n", p.prefix, p.ns)
+	}
+
+	// Group statements by subject so each concept is written as one block
+	bySubject := make(map[string][]rdfTriple)
+	var subjects []string
+	for _, t := range ds.triples() {
+		if _, ok := bySubject[t.Subject]; !ok {
+			subjects = append(subjects, t.Subject)
+		}
+		bySubject[t.Subject] = append(bySubject[t.Subject], t)
+	}
+	sort.Strings(subjects)
+
+	for _, s := range subjects {
+		fmt.Fprintf(&b, "\n%s", turtleIRI(s))
+		for i, t := range bySubject[s] {
+			if i > 0 {
+				b.WriteString(" ;")
+			}
+			obj := turtleIRI(t.Object.Value)
+			if t.Object.Literal {
+				obj = turtleLiteral(t.Object)
+			}
+			fmt.Fprintf(&b, "\n    %s %s", turtleIRI(t.Predicate), obj)
+		}
+		b.WriteString(" .\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func exportJSONLD(w io.Writer, ds *conceptSnapshot) error {
+	context := map[string]any{
+		"rdf":         rdfNS,
+		"rdfs":        rdfsNS,
+		"xsd":         xsdNS,
+		"ccn":         ccnNS,
+		"name":        "rdfs:label",
+		"description": "rdfs:comment",
+		"conceptType": "ccn:conceptType",
+		"timestamp":   map[string]string{"@id": "ccn:timestamp", "@type": "xsd:dateTime"},
+	}
+
+	// Relationship types become context terms named after the type, e.g. "Influences"
+	terms := make(map[ConceptGUID]string)
+	for _, c := range ds.Concepts {
+		if c.ConceptType != relationshipTypeConceptType {
+			continue
+		}
+		term := c.Name
+		if _, taken := context[term]; taken || term == "" || strings.HasPrefix(term, "@") {
+			term = conceptIRI(c.ID)
+		} else {
+			context[term] = map[string]string{"@id": conceptIRI(c.ID), "@type": "@id"}
+		}
+		terms[c.ID] = term
+	}
+
+	nodes := make(map[string]map[string]any)
+	var order []string
+	for _, c := range ds.Concepts {
+		types := []string{"ccn:Concept"}
+		if c.ConceptType == relationshipTypeConceptType {
+			types = append(types, "rdf:Property")
+		}
+		node := map[string]any{
+			"@id":         conceptIRI(c.ID),
+			"@type":       types,
+			"name":        c.Name,
+			"conceptType": c.ConceptType,
+		}
+		if c.Description != "" {
+			node["description"] = c.Description
+		}
+		if !c.Timestamp.IsZero() {
+			node["timestamp"] = c.Timestamp.UTC().Format(time.RFC3339Nano)
+		}
+		nodes[conceptIRI(c.ID)] = node
+		order = append(order, conceptIRI(c.ID))
+	}
+	for _, r := range ds.Relationships {
+		s := conceptIRI(ConceptGUID(r.SourceID))
+		node, ok := nodes[s]
+		if !ok {
+			node = map[string]any{"@id": s}
+			nodes[s] = node
+			order = append(order, s)
+		}
+		term, ok := terms[r.Type]
+		if !ok {
+			term = conceptIRI(r.Type)
+		}
+		target := conceptIRI(ConceptGUID(r.TargetID))
+		if term == conceptIRI(r.Type) {
+			node[term] = append(asSlice(node[term]), map[string]string{"@id": target})
+		} else {
+			node[term] = append(asSlice(node[term]), target)
+		}
+	}
+
+	graph := make([]any, 0, len(order))
+	for _, id := range order {
+		graph = append(graph, nodes[id])
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"@context": context, "@graph": graph})
+}
+
+func asSlice(v any) []any {
+	if s, ok := v.([]any); ok {
+		return s
+	}
+	return []any{}
+}
+
+// parseTurtle reads the subset of Turtle produced by exportTurtle: @prefix/PREFIX
+// directives, IRIs, prefixed names, "a", string literals with language tags or
+// datatypes, and ';' / ',' lists. Blank nodes and collections are not supported.
+func parseTurtle(r io.Reader) ([]rdfTriple, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &turtleParser{src: []rune(string(data)), prefixes: make(map[string]string)}
+	return p.parse()
+}
+
+type turtleParser struct {
+	src      []rune
+	pos      int
+	prefixes map[string]string
+}
+
+func (p *turtleParser) errorf(format string, args ...any) error {
+	line := 1 + strings.Count(string(p.src[:p.pos]), "\n")
+	return fmt.Errorf("turtle line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *turtleParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch r := p.src[p.pos]; {
+		case unicode.IsSpace(r):
+			p.pos++
+		case r == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *turtleParser) peek() rune {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *turtleParser) expect(r rune) error {
+	p.skipSpace()
+	if p.peek() != r {
+		return p.errorf("expected '%c'", r)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *turtleParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		if unicode.IsSpace(r) || strings.ContainsRune("<>\";,", r) {
+			break
+		}
+		// A '.' only ends the word when it terminates the statement
+		if r == '.' && (p.pos+1 >= len(p.src) || unicode.IsSpace(p.src[p.pos+1])) {
+			break
+		}
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *turtleParser) parse() ([]rdfTriple, error) {
+	var triples []rdfTriple
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return triples, nil
+		}
+		if p.peek() == '@' || strings.HasPrefix(strings.ToUpper(string(p.src[p.pos:min(p.pos+6, len(p.src))])), "PREFIX") {
+			if err := p.parsePrefix(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		subject, err := p.parseIRI()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			p.skipSpace()
+			predicate, err := p.parseIRI()
+			if err != nil {
+				return nil, err
+			}
+			for {
+				object, err := p.parseObject()
+				if err != nil {
+					return nil, err
+				}
+				triples = append(triples, rdfTriple{subject, predicate, object})
+				p.skipSpace()
+				if p.peek() != ',' {
+					break
+				}
+				p.pos++
+			}
+			p.skipSpace()
+			if p.peek() != ';' {
+				break
+			}
+			p.pos++
+			p.skipSpace()
+			if p.peek() == '.' {
+				break
+			}
+		}
+		if err := p.expect('.'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *turtleParser) parsePrefix() error {
+	sparql := p.peek() != '@'
+	if !sparql {
+		p.pos++
+	}
+	if kw := p.word(); !strings.EqualFold(kw, "prefix") {
+		return p.errorf("unsupported directive: %s", kw)
+	}
+	p.skipSpace()
+	name := p.word()
+	if !strings.HasSuffix(name, ":") {
+		return p.errorf("invalid prefix name: %s", name)
+	}
+	p.skipSpace()
+	ns, err := p.parseIRIRef()
+	if err != nil {
+		return err
+	}
+	p.prefixes[strings.TrimSuffix(name, ":")] = ns
+	if !sparql {
+		return p.expect('.')
+	}
+	return nil
+}
+
+func (p *turtleParser) parseIRIRef() (string, error) {
+	if p.peek() != '<' {
+		return "", p.errorf("expected IRI")
+	}
+	end := p.pos + 1
+	for end < len(p.src) && p.src[end] != '>' {
+		end++
+	}
+	if end >= len(p.src) {
+		return "", p.errorf("unterminated IRI")
+	}
+	iri := string(p.src[p.pos+1 : end])
+	p.pos = end + 1
+	return iri, nil
+}
+
+func (p *turtleParser) parseIRI() (string, error) {
+	p.skipSpace()
+	if p.peek() == '<' {
+		return p.parseIRIRef()
+	}
+	name := p.word()
+	if name == "a" {
+		return rdfType, nil
+	}
+	prefix, local, ok := strings.Cut(name, ":")
+	if !ok {
+		return "", p.errorf("expected IRI or prefixed name, got %q", name)
+	}
+	ns, ok := p.prefixes[prefix]
+	if !ok {
+		return "", p.errorf("undefined prefix: %s", prefix)
+	}
+	return ns + local, nil
+}
+
+func (p *turtleParser) parseObject() (rdfTerm, error) {
+	p.skipSpace()
+	if p.peek() != '"' {
+		iri, err := p.parseIRI()
+		return iriTerm(iri), err
+	}
+
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return rdfTerm{}, p.errorf("unterminated string literal")
+		}
+		r := p.src[p.pos]
+		p.pos++
+		if r == '"' {
+			break
+		}
+		if r != '\\' {
+			b.WriteRune(r)
+			continue
+		}
+		if p.pos >= len(p.src) {
+			return rdfTerm{}, p.errorf("unterminated escape")
+		}
+		esc := p.src[p.pos]
+		p.pos++
+		switch esc {
+		case 'n':
+			b.WriteRune('\n')
+		case 'r':
+			b.WriteRune('\r')
+		case 't':
+			b.WriteRune('\t')
+		case '"', '\\', '\'':
+			b.WriteRune(esc)
+		default:
+			return rdfTerm{}, p.errorf("unsupported escape: \\%c", esc)
+		}
+	}
+
+	term := literalTerm(b.String())
+	switch {
+	case p.peek() == '@':
+		p.pos++
+		term.Lang = p.word()
+	case strings.HasPrefix(string(p.src[p.pos:min(p.pos+2, len(p.src))]), "^^"):
+		p.pos += 2
+		datatype, err := p.parseIRI()
+		if err != nil {
+			return rdfTerm{}, err
+		}
+		term.Datatype = datatype
+	}
+	return term, nil
+}
+
+// parseJSONLD reads JSON-LD documents shaped like exportJSONLD output: a top-level
+// @context of prefixes and terms and either a @graph array or a single node object.
+func parseJSONLD(r io.Reader) ([]rdfTriple, error) {
+	var doc map[string]any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON-LD: %v", err)
+	}
+
+	ctx := jsonLDContext{prefixes: make(map[string]string), terms: make(map[string]jsonLDTerm)}
+	if raw, ok := doc["@context"].(map[string]any); ok {
+		ctx.load(raw)
+	}
+
+	var nodes []any
+	if graph, ok := doc["@graph"].([]any); ok {
+		nodes = graph
+	} else {
+		nodes = []any{doc}
+	}
+
+	var triples []rdfTriple
+	for _, n := range nodes {
+		node, ok := n.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid JSON-LD node: %v", n)
+		}
+		id, _ := node["@id"].(string)
+		if id == "" {
+			return nil, fmt.Errorf("JSON-LD node without @id is not supported")
+		}
+		subject := ctx.expand(id)
+
+		for key, value := range node {
+			switch key {
+			case "@id", "@context":
+				continue
+			case "@type":
+				for _, t := range jsonLDValues(value) {
+					if s, ok := t.(string); ok {
+						triples = append(triples, rdfTriple{subject, rdfType, iriTerm(ctx.expand(s))})
+					}
+				}
+				continue
+			}
+
+			predicate, term := ctx.property(key)
+			for _, v := range jsonLDValues(value) {
+				object, err := ctx.object(v, term)
+				if err != nil {
+					return nil, fmt.Errorf("node %s, property %s: %v", id, key, err)
+				}
+				triples = append(triples, rdfTriple{subject, predicate, object})
+			}
+		}
+	}
+	return triples, nil
+}
+
+type jsonLDTerm struct {
+	id      string
+	typ     string
+	isIDRef bool
+}
+
+type jsonLDContext struct {
+	prefixes map[string]string
+	terms    map[string]jsonLDTerm
+}
+
+func (c *jsonLDContext) load(raw map[string]any) {
+	// Prefixes first, so terms can use compact IRIs in any order
+	for key, value := range raw {
+		if s, ok := value.(string); ok && (strings.HasSuffix(s, "#") || strings.HasSuffix(s, "/") || strings.HasSuffix(s, ":")) {
+			c.prefixes[key] = s
+		}
+	}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			if _, isPrefix := c.prefixes[key]; !isPrefix {
+				c.terms[key] = jsonLDTerm{id: c.expand(v)}
+			}
+		case map[string]any:
+			id, _ := v["@id"].(string)
+			typ, _ := v["@type"].(string)
+			term := jsonLDTerm{id: c.expand(id), isIDRef: typ == "@id"}
+			if !term.isIDRef && typ != "" {
+				term.typ = c.expand(typ)
+			}
+			c.terms[key] = term
+		}
+	}
+}
+
+func (c *jsonLDContext) expand(s string) string {
+	if term, ok := c.terms[s]; ok {
+		return term.id
+	}
+	if prefix, local, ok := strings.Cut(s, ":"); ok {
+		if ns, ok := c.prefixes[prefix]; ok {
+			return ns + local
+		}
+	}
+	return s
+}
+
+func (c *jsonLDContext) property(key string) (string, jsonLDTerm) {
+	if term, ok := c.terms[key]; ok {
+		return term.id, term
+	}
+	return c.expand(key), jsonLDTerm{}
+}
+
+func (c *jsonLDContext) object(v any, term jsonLDTerm) (rdfTerm, error) {
+	switch val := v.(type) {
+	case string:
+		if term.isIDRef {
+			return iriTerm(c.expand(val)), nil
+		}
+		return rdfTerm{Value: val, Literal: true, Datatype: term.typ}, nil
+	case map[string]any:
+		if id, ok := val["@id"].(string); ok {
+			return iriTerm(c.expand(id)), nil
+		}
+		if value, ok := val["@value"]; ok {
+			lit := rdfTerm{Value: fmt.Sprint(value), Literal: true}
+			if t, ok := val["@type"].(string); ok {
+				lit.Datatype = c.expand(t)
+			}
+			if lang, ok := val["@language"].(string); ok {
+				lit.Lang = lang
+			}
+			return lit, nil
+		}
+		return rdfTerm{}, fmt.Errorf("nested node objects are not supported")
+	case float64, bool:
+		return literalTerm(fmt.Sprint(val)), nil
+	}
+	return rdfTerm{}, fmt.Errorf("unsupported value: %v", v)
+}
+
+func jsonLDValues(v any) []any {
+	if list, ok := v.([]any); ok {
+		return list
+	}
+	return []any{v}
+}
+
+var rdfParsers = map[string]func(io.Reader) ([]rdfTriple, error){
+	"jsonld": parseJSONLD,
+	"turtle": parseTurtle,
+}
+
+// ImportReport summarizes what an RDF import changed
+type ImportReport struct {
+	Concepts      int
+	Relationships int
+	Skipped       []string
+}
+
+// importRDF merges concepts and relationships described by the triples into the live graph
+func (s *Server) importRDF(ctx context.Context, triples []rdfTriple, pID PeerID) (*ImportReport, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	report := &ImportReport{Skipped: []string{}}
+
+	// Collect concept descriptions per subject
+	type description struct {
+		concept    *Concept
+		isConcept  bool
+		isProperty bool
+	}
+	described := make(map[string]*description)
+	var order []string
+	describe := func(subject string) *description {
+		d, ok := described[subject]
+		if !ok {
+			d = &description{concept: &Concept{}}
+			described[subject] = d
+			order = append(order, subject)
+		}
+		return d
+	}
+	var edges []rdfTriple
+	for _, t := range triples {
+		switch t.Predicate {
+		case rdfType:
+			d := describe(t.Subject)
+			switch t.Object.Value {
+			case ccnConcept:
+				d.isConcept = true
+			case rdfProperty:
+				d.isProperty = true
+			}
+		case rdfsLabel:
+			describe(t.Subject).concept.Name = t.Object.Value
+		case rdfsComment:
+			describe(t.Subject).concept.Description = t.Object.Value
+		case ccnConceptType:
+			describe(t.Subject).concept.ConceptType = t.Object.Value
+		case ccnTimestamp:
+			if ts, err := time.Parse(time.RFC3339Nano, t.Object.Value); err == nil {
+				describe(t.Subject).concept.Timestamp = ts
+			}
+		default:
+			edges = append(edges, t)
+		}
+	}
+
+	// Foreign IRIs take the GUID of the concept with their name, or a fresh one;
+	// ours keep the GUID they were exported with
+	guids := make(map[string]ConceptGUID)
+	resolve := func(iri string) (ConceptGUID, bool) {
+		if guid, ok := guids[iri]; ok {
+			return guid, true
+		}
+		if guid, ok := conceptGUIDFromIRI(iri); ok {
+			return guid, true
+		}
+		return "", false
+	}
+
+	for _, iri := range order {
+		d := described[iri]
+		if !d.isConcept && !d.isProperty && d.concept.Name == "" {
+			continue
+		}
+		incoming := d.concept
+		if d.isProperty && incoming.ConceptType == "" {
+			incoming.ConceptType = relationshipTypeConceptType
+		}
+
+		guid, ok := conceptGUIDFromIRI(iri)
+		if !ok {
+			guid = ConceptGUID(uuid.New().String())
+			if other, named := s.concepts.LookupName(incoming.Name); named {
+				if _, isConcept := s.concepts.Get(ConceptGUID(other)); isConcept {
+					guid = ConceptGUID(other)
+				}
+			}
+		}
+		if err := s.checkConceptName(guid, incoming.Name); err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("concept %s: %v", iri, err))
+			continue
+		}
+		guids[iri] = guid
+
+		existing, exists := s.concepts.Get(guid)
+
+		var concept *Concept
+		if exists {
+			if existing.Name == incoming.Name && existing.Description == incoming.Description && existing.ConceptType == incoming.ConceptType {
+				continue
+			}
+			concept = existing.clone()
+			concept.Name = incoming.Name
+			concept.Description = incoming.Description
+			concept.ConceptType = incoming.ConceptType
+			concept.Timestamp = time.Now()
+		} else {
+			concept = &Concept{
+				ID:            guid,
+				Name:          incoming.Name,
+				Description:   incoming.Description,
+				ConceptType:   incoming.ConceptType,
+				Relationships: []RelationshipGUID{},
+				Timestamp:     incoming.Timestamp,
+			}
+			if concept.Timestamp.IsZero() {
+				concept.Timestamp = time.Now()
+			}
+		}
+		if err := s.addOrUpdateConcept(ctx, concept, pID); err != nil {
+			return report, fmt.Errorf("failed to import concept %s: %v", iri, err)
+		}
+		report.Concepts++
+	}
+
+	for _, t := range edges {
+		if t.Object.Literal {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("unsupported literal property %s on %s", t.Predicate, t.Subject))
+			continue
+		}
+		typeID, ok1 := resolve(t.Predicate)
+		sourceID, ok2 := resolve(t.Subject)
+		targetID, ok3 := resolve(t.Object.Value)
+		if !ok1 || !ok2 || !ok3 {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("unresolvable statement %s %s %s", t.Subject, t.Predicate, t.Object.Value))
+			continue
+		}
+
+		relType, typeOK := s.concepts.Get(typeID)
+		_, sourceOK := s.concepts.Get(sourceID)
+		_, targetOK := s.concepts.Get(targetID)
+		if !typeOK || relType.ConceptType != relationshipTypeConceptType || !sourceOK || !targetOK {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("unknown relationship type or endpoint in %s %s %s", t.Subject, t.Predicate, t.Object.Value))
+			continue
+		}
+
+		if s.findRelationship(EntityGUID(sourceID), typeID, EntityGUID(targetID)) != nil {
+			continue
+		}
+		if err := s.validateRelationship(EntityGUID(sourceID), EntityGUID(targetID), typeID); err != nil {
+			report.Skipped = append(report.Skipped, err.Error())
+			continue
+		}
+
+		relationship := CreateRelationship(EntityGUID(sourceID), EntityGUID(targetID), typeID, map[string]any{})
+		if err := s.putRelationship(ctx, relationship); err != nil {
+			report.Skipped = append(report.Skipped, err.Error())
+			continue
+		}
+		s.linkRelationship(ctx, relationship)
+		report.Relationships++
+	}
+
+	if report.Relationships > 0 {
+		s.persist(ctx)
+	}
+	log.Printf("Imported %d concepts and %d relationships (%d statements skipped)", report.Concepts, report.Relationships, len(report.Skipped))
+	return report, nil
+}
+
+func (s *Server) findRelationship(sourceID EntityGUID, typeID ConceptGUID, targetID EntityGUID) *Relationship {
+	matches := s.relationships.Select(func(rel *Relationship) bool {
+		return rel.SourceID == sourceID && rel.Type == typeID && rel.TargetID == targetID
+	})
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0]
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRDFRoundTrip reads back what each RDF exporter writes
+func TestRDFRoundTrip(t *testing.T) {
+	s, _ := newTestServer(t)
+	concept := &Concept{
+		ID:            ConceptGUID("quoted"),
+		Name:          `Say "hi"`,
+		Description:   "two\nlines\twith a \\ backslash",
+		ConceptType:   "FundamentalConcept",
+		Relationships: []RelationshipGUID{},
+		Timestamp:     time.Now(),
+	}
+	if err := s.addNewConcept(context.Background(), concept, peerID); err != nil {
+		t.Fatal(err)
+	}
+	ds := s.snapshotConcepts()
+	want := make(map[rdfTriple]bool)
+	for _, triple := range ds.triples() {
+		want[triple] = true
+	}
+
+	tests := []struct {
+		format string
+		export func(w io.Writer, ds *conceptSnapshot) error
+	}{
+		{"turtle", exportTurtle},
+		{"jsonld", exportJSONLD},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.export(&buf, ds); err != nil {
+				t.Fatal(err)
+			}
+			triples, err := rdfParsers[tt.format](&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[rdfTriple]bool)
+			for _, triple := range triples {
+				got[triple] = true
+				if !want[triple] {
+					t.Errorf("read back %+v, which was not exported", triple)
+				}
+			}
+			for triple := range want {
+				if !got[triple] {
+					t.Errorf("exported %+v, which was not read back", triple)
+				}
+			}
+
+			report, err := s.importRDF(context.Background(), triples, peerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Concepts != 0 || report.Relationships != 0 {
+				t.Errorf("importing the node's own export changed %d concepts and %d relationships", report.Concepts, report.Relationships)
+			}
+		})
+	}
+}
+
+func TestImportRDF(t *testing.T) {
+	s, _ := newTestServer(t)
+	influences := s.findConceptGUID("Influences")
+	technology := s.findConceptGUID("Technology")
+	doc := fmt.Sprintf(`@prefix ex: <http://example.org/> .
+@prefix rdfs: <http://www.w3.org/2000/01/rdf-schema#> .
+@prefix ccn: <urn:ccn:vocab#> .
+
+ex:rain a ccn:Concept ;
+    rdfs:label "Rain" ;
+    ccn:conceptType "FundamentalConcept" ;
+    ex:wetness "high" ;
+    <%s> ex:growth , <%s> .
+ex:growth rdfs:label "Growth" ;
+    ccn:conceptType "FundamentalConcept" .
+<%s> rdfs:comment "Renamed elsewhere" ;
+    rdfs:label "Technology" ;
+    ccn:conceptType "FundamentalConcept" .
+<%s> rdfs:label "Rain" .
+`, conceptIRI(influences), conceptIRI(technology), conceptIRI(technology), conceptIRI("taken"))
+
+	triples, err := parseTurtle(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.importRDF(context.Background(), triples, peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Concepts != 3 || report.Relationships != 2 || len(report.Skipped) != 2 {
+		t.Fatalf("report %+v, want 3 concepts, 2 relationships, the literal and the taken name skipped", report)
+	}
+
+	rain, growth := s.findConceptGUID("Rain"), s.findConceptGUID("Growth")
+	if rain == "" || growth == "" {
+		t.Fatal("foreign concepts not imported")
+	}
+	if s.findRelationship(EntityGUID(rain), influences, EntityGUID(growth)) == nil ||
+		s.findRelationship(EntityGUID(rain), influences, EntityGUID(technology)) == nil {
+		t.Error("edges not imported")
+	}
+	if c, _ := s.concepts.Get(technology); c.Description != "Renamed elsewhere" {
+		t.Errorf("existing concept kept its description %q", c.Description)
+	}
+
+	again, err := s.importRDF(context.Background(), triples, peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Concepts != 0 || again.Relationships != 0 {
+		t.Errorf("importing again changed %d concepts and %d relationships", again.Concepts, again.Relationships)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const dynamicsConfigPath = "data/dynamics.yaml"
+
+// RelationshipDynamics is the state a relationship builds up through interactions
+type RelationshipDynamics struct {
+	EnergyFlow        float64
+	Amplitude         float64
+	Volume            float64
+	FrequencySpec     []float64
+	Depth             int
+	Interactions      int
+	InteractionCounts map[ConceptGUID]int
+	LastInteraction   time.Time
+	History           []InteractionRecord
+}
+
+// InteractionRecord is one entry of a relationship's interaction history, with
+// the state the interaction left behind
+type InteractionRecord struct {
+	Type       ConceptGUID `json:",omitempty"` // empty for Deepen
+	Name       string
+	At         time.Time
+	EnergyFlow float64
+	Amplitude  float64
+	Volume     float64
+	Depth      int
+}
+
+func newRelationshipDynamics() *RelationshipDynamics {
+	return &RelationshipDynamics{
+		EnergyFlow:        1,
+		Amplitude:         1,
+		Volume:            1,
+		Depth:             1,
+		InteractionCounts: make(map[ConceptGUID]int),
+	}
+}
+
+func (d *RelationshipDynamics) clone() *RelationshipDynamics {
+	c := *d
+	c.FrequencySpec = append([]float64(nil), d.FrequencySpec...)
+	c.History = append([]InteractionRecord(nil), d.History...)
+	c.InteractionCounts = make(map[ConceptGUID]int, len(d.InteractionCounts))
+	for k, v := range d.InteractionCounts {
+		c.InteractionCounts[k] = v
+	}
+	return &c
+}
+
+// DynamicsEngine_i decides how interactions, deepening and the passage of time
+// change a relationship. The current time is passed in so replays and tests are
+// deterministic.
+type DynamicsEngine_i interface {
+	Interact(d *RelationshipDynamics, interactionType ConceptGUID, name string, now time.Time)
+	Deepen(d *RelationshipDynamics, now time.Time)
+	Decay(d *RelationshipDynamics, now time.Time)
+}
+
+// DynamicsEffect scales a relationship's energy flow, amplitude and volume and
+// optionally adds a frequency; zero factors leave the value unchanged
+type DynamicsEffect struct {
+	EnergyFlow   float64 `yaml:"energy_flow,omitempty"`
+	Amplitude    float64 `yaml:"amplitude,omitempty"`
+	Volume       float64 `yaml:"volume,omitempty"`
+	AddFrequency float64 `yaml:"add_frequency,omitempty"`
+}
+
+// DynamicsConfig holds the rules of the rule-based dynamics engine
+type DynamicsConfig struct {
+	HistoryLimit int                       `yaml:"history_limit"`
+	HalfLife     time.Duration             `yaml:"half_life"` // time for energy flow and amplitude to decay halfway back to 1
+	Deepen       DynamicsEffect            `yaml:"deepen"`
+	Default      DynamicsEffect            `yaml:"default"` // interaction types without a rule
+	Interactions map[string]DynamicsEffect `yaml:"interactions"`
+}
+
+var defaultDynamicsConfig = DynamicsConfig{
+	HistoryLimit: 50,
+	HalfLife:     30 * 24 * time.Hour,
+	Deepen:       DynamicsEffect{EnergyFlow: 1.1, Amplitude: 1.05, Volume: 1.05},
+	Default:      DynamicsEffect{EnergyFlow: 1.05},
+	Interactions: map[string]DynamicsEffect{},
+}
+
+var dynamicsEngine DynamicsEngine_i = &ruleDynamics{config: defaultDynamicsConfig}
+
+// loadDynamicsConfig reads the dynamics rules; a missing file keeps the defaults
+func loadDynamicsConfig(filename string) (*DynamicsConfig, error) {
+	config := defaultDynamicsConfig
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML: %v", err)
+	}
+	if config.HistoryLimit < 0 || config.HalfLife < 0 {
+		return nil, fmt.Errorf("history_limit and half_life must not be negative")
+	}
+	return &config, nil
+}
+
+func initDynamics() {
+	config, err := loadDynamicsConfig(nodeConfig.DynamicsFile)
+	if err != nil {
+		log.Printf("Failed to load dynamics rules, using defaults: %v\n", err)
+		return
+	}
+	dynamicsEngine = &ruleDynamics{config: *config}
+}
+
+// ruleDynamics applies the effects configured per interaction type name
+type ruleDynamics struct {
+	config DynamicsConfig
+}
+
+func scale(value, factor float64) float64 {
+	if factor == 0 {
+		return value
+	}
+	return value * factor
+}
+
+func (e *ruleDynamics) apply(d *RelationshipDynamics, effect DynamicsEffect, interactionType ConceptGUID, name string, now time.Time) {
+	e.Decay(d, now)
+	d.LastInteraction = now
+	d.EnergyFlow = scale(d.EnergyFlow, effect.EnergyFlow)
+	d.Amplitude = scale(d.Amplitude, effect.Amplitude)
+	d.Volume = scale(d.Volume, effect.Volume)
+	if effect.AddFrequency != 0 {
+		d.FrequencySpec = append(d.FrequencySpec, effect.AddFrequency)
+	}
+
+	d.History = append(d.History, InteractionRecord{
+		Type:       interactionType,
+		Name:       name,
+		At:         now,
+		EnergyFlow: d.EnergyFlow,
+		Amplitude:  d.Amplitude,
+		Volume:     d.Volume,
+		Depth:      d.Depth,
+	})
+	if limit := e.config.HistoryLimit; limit > 0 && len(d.History) > limit {
+		d.History = append([]InteractionRecord(nil), d.History[len(d.History)-limit:]...)
+	}
+}
+
+func (e *ruleDynamics) Interact(d *RelationshipDynamics, interactionType ConceptGUID, name string, now time.Time) {
+	d.Interactions++
+	if d.InteractionCounts == nil {
+		d.InteractionCounts = make(map[ConceptGUID]int)
+	}
+	d.InteractionCounts[interactionType]++
+	d.Depth = max(d.Depth, int(math.Log2(float64(d.Interactions)))+1)
+
+	effect, ok := e.config.Interactions[name]
+	if !ok {
+		effect = e.config.Default
+	}
+	e.apply(d, effect, interactionType, name, now)
+}
+
+func (e *ruleDynamics) Deepen(d *RelationshipDynamics, now time.Time) {
+	d.Depth++
+	effect := e.config.Deepen
+	if effect.AddFrequency == 0 {
+		effect.AddFrequency = float64(len(d.FrequencySpec) + 1)
+	}
+	e.apply(d, effect, "", "Deepen", now)
+}
+
+// Decay moves energy flow and amplitude back towards 1 with the configured half-life
+func (e *ruleDynamics) Decay(d *RelationshipDynamics, now time.Time) {
+	if e.config.HalfLife == 0 || d.LastInteraction.IsZero() || !now.After(d.LastInteraction) {
+		return
+	}
+	remaining := math.Pow(0.5, float64(now.Sub(d.LastInteraction))/float64(e.config.HalfLife))
+	d.EnergyFlow = 1 + (d.EnergyFlow-1)*remaining
+	d.Amplitude = 1 + (d.Amplitude-1)*remaining
+}
+
+// dynamics returns the relationship's dynamics, creating them on first use
+func (r *Relationship) dynamics() *RelationshipDynamics {
+	if r.Dynamics == nil {
+		r.Dynamics = newRelationshipDynamics()
+	}
+	return r.Dynamics
+}
+
+// DynamicsAt returns a copy of the relationship's dynamics decayed to the given
+// time, without changing the stored state
+func (r *Relationship) DynamicsAt(now time.Time) *RelationshipDynamics {
+	if r.Dynamics == nil {
+		return newRelationshipDynamics()
+	}
+	d := *r.Dynamics
+	dynamicsEngine.Decay(&d, now)
+	return &d
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRuleDynamics(t *testing.T) {
+	e := &ruleDynamics{config: DynamicsConfig{
+		HistoryLimit: 2,
+		HalfLife:     time.Hour,
+		Deepen:       DynamicsEffect{EnergyFlow: 2},
+		Default:      DynamicsEffect{EnergyFlow: 1.5},
+		Interactions: map[string]DynamicsEffect{"Music": {Amplitude: 2, AddFrequency: 440}},
+	}}
+	d := newRelationshipDynamics()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e.Interact(d, "music", "Music", start)
+	if d.Amplitude != 2 || d.EnergyFlow != 1 || !slices.Equal(d.FrequencySpec, []float64{440}) || d.Depth != 1 {
+		t.Errorf("after a configured interaction: %+v", d)
+	}
+	e.Interact(d, "chat", "Chat", start)
+	if d.EnergyFlow != 1.5 || d.Depth != 2 || d.Interactions != 2 || d.InteractionCounts["music"] != 1 || d.InteractionCounts["chat"] != 1 {
+		t.Errorf("after an interaction without a rule: %+v", d)
+	}
+	e.Deepen(d, start)
+	if d.Depth != 3 || d.EnergyFlow != 3 || !slices.Equal(d.FrequencySpec, []float64{440, 2}) || d.Interactions != 2 {
+		t.Errorf("after deepening: %+v", d)
+	}
+	if len(d.History) != 2 || d.History[0].Name != "Chat" || d.History[1].Name != "Deepen" || d.History[1].EnergyFlow != 3 {
+		t.Errorf("history %+v, want the last two events", d.History)
+	}
+
+	decayed := d.clone()
+	e.Decay(decayed, start.Add(time.Hour))
+	if math.Abs(decayed.EnergyFlow-2) > 1e-9 || math.Abs(decayed.Amplitude-1.5) > 1e-9 || decayed.Volume != d.Volume {
+		t.Errorf("after one half-life: energy flow %v, amplitude %v, volume %v", decayed.EnergyFlow, decayed.Amplitude, decayed.Volume)
+	}
+	e.Decay(decayed, start)
+	if math.Abs(decayed.EnergyFlow-2) > 1e-9 {
+		t.Error("decay ran backwards in time")
+	}
+}
+
+func TestLoadDynamicsConfig(t *testing.T) {
+	shipped, err := loadDynamicsConfig(dynamicsConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shipped.HalfLife != 720*time.Hour || shipped.Interactions["Music"].AddFrequency != 440 {
+		t.Errorf("shipped rules read as %+v", shipped)
+	}
+
+	dir := t.TempDir()
+	if config, err := loadDynamicsConfig(filepath.Join(dir, "missing.yaml")); err != nil || config.HalfLife != defaultDynamicsConfig.HalfLife {
+		t.Errorf("missing file gave %+v, %v", config, err)
+	}
+	negative := filepath.Join(dir, "negative.yaml")
+	os.WriteFile(negative, []byte("half_life: -1h\n"), 0o644)
+	if _, err := loadDynamicsConfig(negative); err == nil {
+		t.Error("negative half-life accepted")
+	}
+}
+
+func TestApplyInteraction(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	alice := newTestSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+	drumming := ConceptGUID(uuid.New().String())
+	if err := s.addNewConcept(ctx, &Concept{ID: drumming, Name: "Drumming", ConceptType: interactionTypeConceptType}, peerID); err != nil {
+		t.Fatal(err)
+	}
+	rel := CreateRelationship(EntityGUID(alice.SeedID), EntityGUID(s.findConceptGUID("Technology")), s.findConceptGUID("Influences"), nil)
+	if err := s.putRelationship(ctx, rel); err != nil {
+		t.Fatal(err)
+	}
+	asAlice := asSteward(alice.SeedID, false)
+	now := time.Now()
+
+	if _, err := s.applyInteraction(asSteward(bob.SeedID, false), rel.ID, interactEvent, drumming, now); !errors.Is(err, errForbidden) {
+		t.Errorf("another steward's interaction: %v", err)
+	}
+	if _, err := s.applyInteraction(asAlice, rel.ID, interactEvent, s.findConceptGUID("Technology"), now); !errors.Is(err, errNotInteractionType) {
+		t.Errorf("interaction of a concept that is no interaction type: %v", err)
+	}
+	if _, err := s.applyInteraction(asAlice, "missing", deepenEvent, "", now); !errors.Is(err, errRelationshipNotFound) {
+		t.Errorf("interaction with a missing relationship: %v", err)
+	}
+	if events := queryInteractions(InteractionQuery{RelationshipID: rel.ID}); len(events) != 0 {
+		t.Fatalf("rejected interactions logged: %+v", events)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.applyInteraction(asAlice, rel.ID, interactEvent, drumming, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.applyInteraction(asAlice, rel.ID, deepenEvent, "", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := s.relationships.Get(rel.ID)
+	if d := stored.Dynamics; d == nil || d.Interactions != 3 || d.InteractionCounts[drumming] != 3 || d.Depth != 3 || len(d.History) != 4 {
+		t.Fatalf("stored dynamics %+v", stored.Dynamics)
+	}
+	events := queryInteractions(InteractionQuery{RelationshipID: rel.ID})
+	if len(events) != 4 || events[0].StewardID != alice.SeedID || events[0].InteractionName != "Drumming" || events[3].Kind != deepenEvent {
+		t.Fatalf("logged %+v", events)
+	}
+	if events[3].Metrics != metricsOf(stored.Dynamics) {
+		t.Errorf("last event metrics %+v, stored %+v", events[3].Metrics, metricsOf(stored.Dynamics))
+	}
+
+	// Replaying the log rebuilds the same state
+	s.relationships.Update(ctx, rel.ID, func(r *Relationship) error {
+		r.Dynamics = nil
+		return nil
+	})
+	report := s.replayInteractions(ctx, false)
+	if !slices.Contains(report.Changed, rel.ID) {
+		t.Errorf("replay did not notice the lost dynamics: %+v", report)
+	}
+	if replayed, _ := s.relationships.Get(rel.ID); replayed.Dynamics == nil || metricsOf(replayed.Dynamics) != events[3].Metrics {
+		t.Errorf("replayed dynamics %+v, want %+v", replayed.Dynamics, events[3].Metrics)
+	}
+}
@@ -1,86 +1,247 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func addRelationship_h(c *gin.Context) {
-	var req struct {
-		SourceID EntityGUID  `json:"sourceId"`
-		TargetID EntityGUID  `json:"targetId"`
-		TypeID   ConceptGUID `json:"typeId"`
+type relationshipRequest struct {
+	SourceID   EntityGUID     `json:"sourceId"`
+	TargetID   EntityGUID     `json:"targetId"`
+	TypeID     ConceptGUID    `json:"typeId"`
+	Properties map[string]any `json:"properties"`
+}
+
+func (s *Server) addRelationship_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	var req relationshipRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := s.validateRelationship(req.SourceID, req.TargetID, req.TypeID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateRelationshipProperties(req.TypeID, req.Properties); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.authorizeRelationship(c.Request.Context(), req.SourceID); err != nil {
+		abortAuth(c, err)
+		return
+	}
+	if req.Properties == nil {
+		req.Properties = map[string]any{}
+	}
+
+	relationship := CreateRelationship(req.SourceID, req.TargetID, req.TypeID, req.Properties)
+	if err := s.putRelationship(c.Request.Context(), relationship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+
+	// Update the endpoints
+	s.linkRelationship(c.Request.Context(), relationship)
+
+	// Save updated data
+	s.persist(c.Request.Context())
+
+	c.JSON(http.StatusOK, relationship)
+}
+
+// updateRelationship_h replaces a relationship's endpoints, type and properties
+func (s *Server) updateRelationship_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	id := RelationshipGUID(c.Param("id"))
+	var req relationshipRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.SourceID == "" || req.TargetID == "" || req.TypeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sourceId, targetId and typeId are required"})
+		return
+	}
+	if req.Properties == nil {
+		req.Properties = map[string]any{}
+	}
+	s.replaceRelationship(c, id, req)
+}
+
+// patchRelationship_h changes only the fields present in the request. Properties
+// are merged into the existing ones; a property set to null is removed.
+func (s *Server) patchRelationship_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	id := RelationshipGUID(c.Param("id"))
+	var req relationshipRequest
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	relationship := CreateRelationship(req.SourceID, req.TargetID, req.TypeID, map[string]any{})
-	relationshipMu.Lock()
-	relationshipMap[relationship.ID] = relationship
-	relationshipMu.Unlock()
+	existing, ok := s.relationships.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+
+	s.replaceRelationship(c, id, mergeRelationshipRequest(existing, req))
+}
 
-	// Update the concepts
-	conceptMu.Lock()
-	if concept, ok := conceptMap[ConceptGUID(req.SourceID)]; ok {
-		concept.Relationships = append(concept.Relationships, relationship.ID)
+// mergeRelationshipRequest fills the fields a partial request leaves out from the
+// existing relationship
+func mergeRelationshipRequest(existing *Relationship, req relationshipRequest) relationshipRequest {
+	if req.SourceID == "" {
+		req.SourceID = existing.SourceID
+	}
+	if req.TargetID == "" {
+		req.TargetID = existing.TargetID
 	}
-	if concept, ok := conceptMap[ConceptGUID(req.TargetID)]; ok {
-		concept.Relationships = append(concept.Relationships, relationship.ID)
+	if req.TypeID == "" {
+		req.TypeID = existing.Type
 	}
-	conceptMu.Unlock()
+	properties := make(map[string]any, len(existing.Properties)+len(req.Properties))
+	for k, v := range existing.Properties {
+		properties[k] = v
+	}
+	for k, v := range req.Properties {
+		if v == nil {
+			delete(properties, k)
+		} else {
+			properties[k] = v
+		}
+	}
+	req.Properties = properties
+	return req
+}
 
-	// Save updated data
-	saveRelationships(c.Request.Context())
-	saveConcepts(c.Request.Context())
+func (s *Server) replaceRelationship(c *gin.Context, id RelationshipGUID, req relationshipRequest) {
+	existing, ok := s.relationships.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+	if err := s.authorizeRelationship(c.Request.Context(), existing.SourceID, req.SourceID); err != nil {
+		abortAuth(c, err)
+		return
+	}
+	changed, err := s.changeRelationship(c.Request.Context(), existing, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, relationship)
+	s.persist(c.Request.Context())
+
+	c.JSON(http.StatusOK, changed)
 }
 
-func deepenRelationship_h(c *gin.Context) {
+// changeRelationship validates a relationship's new endpoints, type and
+// properties and moves it to them; callers save the affected maps
+func (s *Server) changeRelationship(ctx context.Context, existing *Relationship, req relationshipRequest) (*Relationship, error) {
+	if err := s.validateRelationship(req.SourceID, req.TargetID, req.TypeID); err != nil {
+		return nil, err
+	}
+	if err := validateRelationshipProperties(req.TypeID, req.Properties); err != nil {
+		return nil, err
+	}
+
+	changed := existing.clone()
+	changed.SourceID = req.SourceID
+	changed.TargetID = req.TargetID
+	changed.Type = req.TypeID
+	changed.Properties = req.Properties
+
+	if err := s.putRelationship(ctx, changed); err != nil {
+		return nil, err
+	}
+	s.unlinkRelationship(ctx, existing)
+	s.linkRelationship(ctx, changed)
+	return changed, nil
+}
+
+func (s *Server) deleteRelationship_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
 	id := RelationshipGUID(c.Param("id"))
-	if relationship, ok := relationshipMap[id]; ok {
-		// relationship.Deepen()
-		relationshipMu.Lock()
-		relationshipMap[id] = relationship
-		relationshipMu.Unlock()
-		saveRelationships(c.Request.Context())
-		c.JSON(http.StatusOK, relationship)
-	} else {
+	if existing, ok := s.relationships.Get(id); ok {
+		if err := s.authorizeRelationship(c.Request.Context(), existing.SourceID); err != nil {
+			abortAuth(c, err)
+			return
+		}
+	}
+	if !s.removeRelationship(c.Request.Context(), id) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
 	}
+
+	s.persist(c.Request.Context())
+
+	c.Status(http.StatusNoContent)
 }
 
-func getRelationships_h(c *gin.Context) {
+func (s *Server) deepenRelationship_h(c *gin.Context) {
+	id := RelationshipGUID(c.Param("id"))
+	relationship, err := s.applyInteraction(c.Request.Context(), id, deepenEvent, "", time.Now())
+	s.respondInteraction(c, relationship, err)
+}
+
+// getRelationshipDynamics_h returns a relationship's dynamics decayed to now, or
+// to the RFC 3339 time given in ?at=
+func (s *Server) getRelationshipDynamics_h(c *gin.Context) {
+	id := RelationshipGUID(c.Param("id"))
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timestamp format"})
+			return
+		}
+		at = t
+	}
+
+	relationship, ok := s.relationships.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+	c.JSON(http.StatusOK, relationship.DynamicsAt(at))
+}
+
+func (s *Server) getRelationships_h(c *gin.Context) {
 	relationships := []Relationship{}
-	relationshipMu.RLock()
-	defer relationshipMu.RUnlock()
-	for _, relationship := range relationshipMap {
+	for _, relationship := range s.relationships.Snapshot() {
 		relationships = append(relationships, *relationship)
 	}
 
 	c.JSON(http.StatusOK, relationships)
 }
 
-func getRelationship_h(c *gin.Context) {
+func (s *Server) getRelationship_h(c *gin.Context) {
 	id := RelationshipGUID(c.Param("id"))
-	relationshipMu.RLock()
-	defer relationshipMu.RUnlock()
-	if relationship, ok := relationshipMap[id]; ok {
+	if relationship, ok := s.relationships.Get(id); ok {
 		c.JSON(http.StatusOK, relationship)
 	} else {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
 	}
 }
 
-func getRelationshipTypes_h(c *gin.Context) {
-	conceptMu.RLock()
-	defer conceptMu.RUnlock()
-
+func (s *Server) getRelationshipTypes_h(c *gin.Context) {
 	var relationshipTypes []Concept
-	for _, concept := range conceptMap {
+	for _, concept := range s.concepts.Snapshot() {
 		if concept.ConceptType == "RelationshipType" {
 			relationshipTypes = append(relationshipTypes, *concept)
 		}
@@ -89,18 +250,106 @@ func getRelationshipTypes_h(c *gin.Context) {
 	c.JSON(http.StatusOK, relationshipTypes)
 }
 
-func getRelationshipsByType_h(c *gin.Context) {
-	typeGUID := ConceptGUID(c.Query("type"))
-	var filteredRelationships []*Relationship
-	for _, rel := range relationshipMap {
-		if rel.Type == typeGUID {
+func (s *Server) getRelationshipsByType_h(c *gin.Context) {
+	typeGUID := ConceptGUID(c.Param("type"))
+	if typeGUID == "" {
+		typeGUID = ConceptGUID(c.Query("type"))
+	}
+	filters, err := parsePropertyFilters(c.QueryArray("property"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	all := s.relationships.List()
+	if c.Query("inferred") != "false" {
+		all = withInferredRelationships(all)
+	}
+
+	filteredRelationships := []*Relationship{}
+	for _, rel := range all {
+		if rel.Type == typeGUID && matchesPropertyFilters(rel, filters) {
 			filteredRelationships = append(filteredRelationships, rel)
 		}
 	}
 	c.JSON(http.StatusOK, filteredRelationships)
 }
 
-func interactWithRelationship_h(c *gin.Context) {
+func (s *Server) getConceptRelationships_h(c *gin.Context) {
+	guid := EntityGUID(c.Param("guid"))
+	filters, err := parsePropertyFilters(c.QueryArray("property"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	all := s.relationships.Select(func(rel *Relationship) bool {
+		return rel.SourceID == guid || rel.TargetID == guid
+	})
+	if c.Query("inferred") != "false" {
+		all = withInferredRelationships(all)
+	}
+
+	typeGUID := ConceptGUID(c.Query("type"))
+	relationships := []*Relationship{}
+	for _, rel := range all {
+		if (typeGUID == "" || rel.Type == typeGUID) && matchesPropertyFilters(rel, filters) {
+			relationships = append(relationships, rel)
+		}
+	}
+	c.JSON(http.StatusOK, relationships)
+}
+
+// traverse_h walks the graph from an entity up to ?depth= hops in ?direction=
+// out, in or both, following only edges of the given ?type= values that match
+// every ?property= condition
+func (s *Server) traverse_h(c *gin.Context) {
+	opts := traversalOptions{Depth: 1, Direction: c.DefaultQuery("direction", "both"), Inferred: c.Query("inferred") != "false"}
+	if depth := c.Query("depth"); depth != "" {
+		n, err := strconv.Atoi(depth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid depth"})
+			return
+		}
+		opts.Depth = n
+	}
+	if opts.Direction != "out" && opts.Direction != "in" && opts.Direction != "both" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction must be out, in or both"})
+		return
+	}
+	if types := c.QueryArray("type"); len(types) > 0 {
+		opts.Types = make(map[ConceptGUID]bool)
+		for _, t := range types {
+			opts.Types[ConceptGUID(t)] = true
+		}
+	}
+	filters, err := parsePropertyFilters(c.QueryArray("property"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts.Filters = filters
+
+	traversal, err := s.traverseGraph(EntityGUID(c.Param("id")), opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, traversal)
+}
+
+func getRelationshipTypeSpecs_h(c *gin.Context) {
+	relationshipTypeSpecsMu.RLock()
+	defer relationshipTypeSpecsMu.RUnlock()
+
+	specs := make([]*RelationshipTypeSpec, 0, len(relationshipTypeSpecs))
+	for _, spec := range relationshipTypeSpecs {
+		specs = append(specs, spec)
+	}
+	c.JSON(http.StatusOK, specs)
+}
+
+func (s *Server) interactWithRelationship_h(c *gin.Context) {
 	id := RelationshipGUID(c.Param("id"))
 	var req struct {
 		InteractionTypeGUID ConceptGUID `json:"interactionTypeGuid"`
@@ -110,11 +359,60 @@ func interactWithRelationship_h(c *gin.Context) {
 		return
 	}
 
-	if relationship, ok := relationshipMap[id]; ok {
-		relationship.Interact(req.InteractionTypeGUID)
-		saveRelationships(c.Request.Context())
-		c.JSON(http.StatusOK, relationship)
-	} else {
+	relationship, err := s.applyInteraction(c.Request.Context(), id, interactEvent, req.InteractionTypeGUID, time.Now())
+	s.respondInteraction(c, relationship, err)
+}
+
+// interactMoved_h answers the older GET /interact/:id, which changed state on a read
+func interactMoved_h(c *gin.Context) {
+	c.Header("Allow", http.MethodPost)
+	c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Use POST /relationship/" + c.Param("id") + "/interact"})
+}
+
+func (s *Server) respondInteraction(c *gin.Context, relationship *Relationship, err error) {
+	switch {
+	case errors.Is(err, errRelationshipNotFound):
 		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+	case errors.Is(err, errUnauthenticated), errors.Is(err, errForbidden):
+		abortAuth(c, err)
+	case errors.Is(err, errUnknownInteractionType), errors.Is(err, errNotInteractionType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		s.persist(c.Request.Context())
+		c.JSON(http.StatusOK, relationship)
 	}
 }
+
+func getInteractions_h(c *gin.Context) {
+	q := InteractionQuery{
+		RelationshipID: RelationshipGUID(c.Query("relationship")),
+		StewardID:      SeedGUID(c.Query("steward")),
+		Kind:           c.Query("kind"),
+	}
+	for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if s := c.Query(param); s != "" {
+			parsed, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timestamp format"})
+				return
+			}
+			*t = parsed
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		q.Limit = n
+	}
+	c.JSON(http.StatusOK, queryInteractions(q))
+}
+
+func (s *Server) replayInteractions_h(c *gin.Context) {
+	report := s.replayInteractions(c.Request.Context(), c.Query("dryRun") == "true")
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRelationshipCRUD(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	_, adminToken, _ := s.auth.createToken(ctx, "admin", defaultSteward(), true)
+	alice := newTestSteward(t, s, "Alice")
+	_, aliceToken, _ := s.auth.createToken(ctx, "alice", alice.SeedID, false)
+	ids := newConcepts(t, s, "Source", "First Target", "Second Target")
+	source, first, second := ids[0], ids[1], ids[2]
+	influences := s.findConceptGUID("Influences")
+
+	lists := func(entity EntityGUID, id RelationshipGUID) bool {
+		concept, _ := s.concepts.Get(ConceptGUID(entity))
+		return hasRelationship(concept.Relationships, id)
+	}
+
+	body := relationshipRequest{SourceID: source, TargetID: first, TypeID: influences, Properties: map[string]any{"weight": 0.5}}
+	if w := serve(s, http.MethodPost, "/relationship", aliceToken, body); w.Code != http.StatusForbidden {
+		t.Errorf("steward linking concepts answered %d", w.Code)
+	}
+	w := serve(s, http.MethodPost, "/relationship", adminToken, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST status %d: %s", w.Code, w.Body)
+	}
+	var rel Relationship
+	json.Unmarshal(w.Body.Bytes(), &rel)
+	path := "/relationship/" + string(rel.ID)
+	if !lists(source, rel.ID) || !lists(first, rel.ID) {
+		t.Error("endpoints do not list the new relationship")
+	}
+
+	if w := serve(s, http.MethodPatch, path, adminToken, map[string]any{"properties": map[string]any{"weight": 2}}); w.Code != http.StatusBadRequest {
+		t.Errorf("PATCH with a weight out of range answered %d", w.Code)
+	}
+	if w := serve(s, http.MethodPatch, path, adminToken, map[string]any{"targetId": second}); w.Code != http.StatusOK {
+		t.Fatalf("PATCH status %d: %s", w.Code, w.Body)
+	}
+	patched, _ := s.relationships.Get(rel.ID)
+	if patched.SourceID != source || patched.TargetID != second || patched.Type != influences || patched.Properties["weight"] != 0.5 {
+		t.Errorf("PATCH left %+v", patched)
+	}
+	if lists(first, rel.ID) || !lists(second, rel.ID) {
+		t.Error("moving the target did not move the link")
+	}
+	if w := serve(s, http.MethodPatch, path, adminToken, map[string]any{"properties": map[string]any{"weight": nil}}); w.Code != http.StatusOK {
+		t.Fatalf("PATCH status %d: %s", w.Code, w.Body)
+	}
+	if patched, _ := s.relationships.Get(rel.ID); len(patched.Properties) != 0 {
+		t.Errorf("property set to null kept: %v", patched.Properties)
+	}
+
+	if w := serve(s, http.MethodPut, path, adminToken, map[string]any{"sourceId": source, "targetId": first}); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT without a type answered %d", w.Code)
+	}
+	if w := serve(s, http.MethodPut, path, adminToken, relationshipRequest{SourceID: source, TargetID: first, TypeID: influences}); w.Code != http.StatusOK {
+		t.Fatalf("PUT status %d: %s", w.Code, w.Body)
+	}
+	if replaced, _ := s.relationships.Get(rel.ID); replaced.TargetID != first || len(replaced.Properties) != 0 {
+		t.Errorf("PUT left %+v", replaced)
+	}
+
+	if w := serve(s, http.MethodDelete, path, adminToken, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status %d: %s", w.Code, w.Body)
+	}
+	if _, ok := s.relationships.Get(rel.ID); ok || lists(source, rel.ID) || lists(first, rel.ID) {
+		t.Error("deleted relationship is still linked")
+	}
+	for _, method := range []string{http.MethodDelete, http.MethodPatch} {
+		if w := serve(s, method, path, adminToken, map[string]any{}); w.Code != http.StatusNotFound {
+			t.Errorf("%s of a deleted relationship answered %d", method, w.Code)
+		}
+	}
+}
+
+func TestDeleteConceptCascade(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	_, adminToken, _ := s.auth.createToken(ctx, "admin", defaultSteward(), true)
+	ids := newConcepts(t, s, "Doomed", "Neighbour")
+	doomed, neighbour := ids[0], ids[1]
+	rel := CreateRelationship(neighbour, doomed, s.findConceptGUID("Influences"), nil)
+	if err := s.putRelationship(ctx, rel); err != nil {
+		t.Fatal(err)
+	}
+	s.linkRelationship(ctx, rel)
+	seed := NewStewardSeed("Doomed Seed", "")
+	seed.ConceptID = ConceptGUID(doomed)
+	if err := s.addOrUpdateSeed(ctx, seed, peerID); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/concept/" + string(doomed)
+	if w := serve(s, http.MethodDelete, path, adminToken, nil); w.Code != http.StatusConflict {
+		t.Fatalf("deleting a concept in use answered %d", w.Code)
+	}
+	if w := serve(s, http.MethodDelete, path+"?cascade=true", adminToken, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("cascading delete answered %d: %s", w.Code, w.Body)
+	}
+	if _, ok := s.seeds.Get(seed.SeedID); ok {
+		t.Error("seed of the deleted concept kept")
+	}
+	if _, ok := s.relationships.Get(rel.ID); ok {
+		t.Error("relationship to the deleted concept kept")
+	}
+	if c, _ := s.concepts.Get(ConceptGUID(neighbour)); hasRelationship(c.Relationships, rel.ID) {
+		t.Error("neighbour still lists the removed relationship")
+	}
+	if report := s.checkIntegrity(ctx, false); len(report.Issues) != 0 {
+		t.Errorf("integrity issues after the delete: %v", report.Issues)
+	}
+}
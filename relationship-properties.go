@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Property types a relationship type's schema can declare
+const (
+	propertyString = "string"
+	propertyFloat  = "float"
+	propertyInt    = "int"
+	propertyBool   = "bool"
+	propertyDate   = "date"
+)
+
+var propertyTypes = map[string]bool{
+	propertyString: true,
+	propertyFloat:  true,
+	propertyInt:    true,
+	propertyBool:   true,
+	propertyDate:   true,
+}
+
+// PropertySchema describes one property of a relationship type
+type PropertySchema struct {
+	Type     string   `yaml:"type"`
+	Min      *float64 `yaml:"min,omitempty" json:",omitempty"`
+	Max      *float64 `yaml:"max,omitempty" json:",omitempty"`
+	Enum     []string `yaml:"enum,omitempty" json:",omitempty"`
+	Required bool     `yaml:"required,omitempty"`
+}
+
+// parseDate accepts RFC 3339 timestamps and plain dates
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+func (s PropertySchema) check(name string, value any) error {
+	switch s.Type {
+	case propertyString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("property %s must be a string", name)
+		}
+		if len(s.Enum) > 0 && !matchesAny([]string{str}, s.Enum) {
+			return fmt.Errorf("property %s must be one of %v", name, s.Enum)
+		}
+		return nil
+	case propertyBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("property %s must be a boolean", name)
+		}
+		return nil
+	case propertyDate:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("property %s must be a date string", name)
+		}
+		if _, err := parseDate(str); err != nil {
+			return fmt.Errorf("property %s must be a date (YYYY-MM-DD or RFC 3339)", name)
+		}
+		return nil
+	}
+
+	n, ok := toFloat(value)
+	if !ok {
+		return fmt.Errorf("property %s must be a number", name)
+	}
+	if s.Type == propertyInt && n != math.Trunc(n) {
+		return fmt.Errorf("property %s must be an integer", name)
+	}
+	if s.Min != nil && n < *s.Min {
+		return fmt.Errorf("property %s must be at least %v", name, *s.Min)
+	}
+	if s.Max != nil && n > *s.Max {
+		return fmt.Errorf("property %s must be at most %v", name, *s.Max)
+	}
+	return nil
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// validateRelationshipProperties checks properties against the schema declared by
+// the relationship type. Types without a schema accept any properties.
+func validateRelationshipProperties(typeID ConceptGUID, properties map[string]any) error {
+	spec := relationshipTypeSpec(typeID)
+	if spec == nil || len(spec.Properties) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema, ok := spec.Properties[name]
+		if !ok {
+			return fmt.Errorf("%s has no property %s", spec.Name, name)
+		}
+		if err := schema.check(name, properties[name]); err != nil {
+			return err
+		}
+	}
+	for name, schema := range spec.Properties {
+		if _, ok := properties[name]; schema.Required && !ok {
+			return fmt.Errorf("property %s is required for %s", name, spec.Name)
+		}
+	}
+	return nil
+}
+
+// propertyFilter is a condition on a relationship property, written key<op>value,
+// e.g. weight>0.5 or since>=2024-01-01
+type propertyFilter struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+var propertyOperators = []string{">=", "<=", "!=", ">", "<", "="}
+
+func parsePropertyFilter(s string) (propertyFilter, error) {
+	for i := range s {
+		for _, op := range propertyOperators {
+			if strings.HasPrefix(s[i:], op) {
+				key, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(op):])
+				if key == "" {
+					return propertyFilter{}, fmt.Errorf("invalid property filter %q", s)
+				}
+				return propertyFilter{Key: key, Op: op, Value: value}, nil
+			}
+		}
+	}
+	return propertyFilter{}, fmt.Errorf("invalid property filter %q: expected key<op>value", s)
+}
+
+func parsePropertyFilters(exprs []string) ([]propertyFilter, error) {
+	filters := make([]propertyFilter, 0, len(exprs))
+	for _, expr := range exprs {
+		f, err := parsePropertyFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// compare orders a property value against the filter value: numerically, then as
+// dates, then as strings
+func (f propertyFilter) compare(value any) int {
+	if n, ok := toFloat(value); ok {
+		if want, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			switch {
+			case n < want:
+				return -1
+			case n > want:
+				return 1
+			}
+			return 0
+		}
+	}
+	str := fmt.Sprint(value)
+	if t, err := parseDate(str); err == nil {
+		if want, err := parseDate(f.Value); err == nil {
+			return t.Compare(want)
+		}
+	}
+	return strings.Compare(str, f.Value)
+}
+
+func (f propertyFilter) matches(properties map[string]any) bool {
+	value, ok := properties[f.Key]
+	if !ok {
+		return f.Op == "!="
+	}
+	cmp := f.compare(value)
+	switch f.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+func matchesPropertyFilters(rel *Relationship, filters []propertyFilter) bool {
+	for _, f := range filters {
+		if !f.matches(rel.Properties) {
+			return false
+		}
+	}
+	return true
+}
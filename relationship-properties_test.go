@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateRelationshipProperties(t *testing.T) {
+	newTestServer(t)
+	zero, one := 0.0, 1.0
+	typeID := ConceptGUID("weighted")
+	withSpec(t, &RelationshipTypeSpec{TypeID: typeID, Name: "Weighted", Properties: map[string]PropertySchema{
+		"weight": {Type: propertyFloat, Min: &zero, Max: &one, Required: true},
+		"count":  {Type: propertyInt},
+		"since":  {Type: propertyDate},
+		"mood":   {Type: propertyString, Enum: []string{"calm", "wild"}},
+		"shared": {Type: propertyBool},
+	}})
+
+	tests := []struct {
+		name       string
+		properties map[string]any
+		valid      bool
+	}{
+		{"every property", map[string]any{"weight": 0.5, "count": float64(3), "since": "2024-01-31", "mood": "calm", "shared": true}, true},
+		{"RFC 3339 date", map[string]any{"weight": 1.0, "since": "2024-01-31T12:00:00Z"}, true},
+		{"required property missing", map[string]any{"count": float64(1)}, false},
+		{"undeclared property", map[string]any{"weight": 0.5, "color": "red"}, false},
+		{"below the minimum", map[string]any{"weight": -0.1}, false},
+		{"above the maximum", map[string]any{"weight": 1.5}, false},
+		{"number as a string", map[string]any{"weight": "0.5"}, false},
+		{"fractional int", map[string]any{"weight": 0.5, "count": 1.5}, false},
+		{"not a date", map[string]any{"weight": 0.5, "since": "yesterday"}, false},
+		{"not in the enum", map[string]any{"weight": 0.5, "mood": "bored"}, false},
+		{"not a boolean", map[string]any{"weight": 0.5, "shared": "yes"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRelationshipProperties(typeID, tt.properties)
+			if (err == nil) != tt.valid {
+				t.Errorf("valid %v, got error %v", tt.valid, err)
+			}
+		})
+	}
+
+	if err := validateRelationshipProperties("no schema", map[string]any{"anything": 1}); err != nil {
+		t.Errorf("type without a schema rejected properties: %v", err)
+	}
+}
+
+func TestPropertyFilter(t *testing.T) {
+	properties := map[string]any{"weight": 0.75, "since": "2024-03-01", "note": "beta"}
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"weight>0.5", true},
+		{"weight>=0.75", true},
+		{"weight<0.5", false},
+		{"weight=0.75", true},
+		{"weight!=0.75", false},
+		{"since>=2024-01-01", true},
+		{"since<2024-01-01T00:00:00Z", false},
+		{"note=beta", true},
+		{"note>alpha", true},
+		{"missing=1", false},
+		{"missing!=1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := parsePropertyFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.matches(properties); got != tt.match {
+				t.Errorf("matches %v, want %v", got, tt.match)
+			}
+		})
+	}
+
+	for _, expr := range []string{"weight", ">0.5"} {
+		if _, err := parsePropertyFilter(expr); err == nil {
+			t.Errorf("parsed invalid filter %q", expr)
+		}
+	}
+}
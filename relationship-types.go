@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// RelationshipTypeSpec holds the constraints a relationship type declares in the ontology
+type RelationshipTypeSpec struct {
+	TypeID      ConceptGUID
+	Name        string
+	Domain      []string
+	Range       []string
+	MaxOut      int
+	MaxIn       int
+	Symmetric   bool
+	Inverse     ConceptGUID `json:",omitempty"`
+	InverseName string      `json:",omitempty"`
+
+	Properties map[string]PropertySchema `json:",omitempty"`
+}
+
+var (
+	relationshipTypeSpecs   = make(map[ConceptGUID]*RelationshipTypeSpec)
+	relationshipTypeSpecsMu sync.RWMutex
+)
+
+// refreshRelationshipTypeSpecs resolves the constraints in the ontology file against the live graph
+func (s *Server) refreshRelationshipTypeSpecs(filename string) error {
+	structure, err := parseConceptStructure(filename)
+	if err != nil {
+		return err
+	}
+
+	live := s.liveConceptsByName()
+	specs := make(map[ConceptGUID]*RelationshipTypeSpec)
+	for _, node := range structure.Relationships {
+		relType, ok := live[node.Name]
+		if !ok || relType.ConceptType != relationshipTypeConceptType {
+			log.Printf("Relationship type %s is not in the graph; ignoring its constraints\n", node.Name)
+			continue
+		}
+		spec := &RelationshipTypeSpec{
+			TypeID:     relType.ID,
+			Name:       node.Name,
+			Domain:     node.Domain,
+			Range:      node.Range,
+			MaxOut:     node.MaxOut,
+			MaxIn:      node.MaxIn,
+			Symmetric:  node.Symmetric,
+			Properties: node.Properties,
+		}
+		if node.Inverse != "" {
+			if inverse, ok := live[node.Inverse]; ok {
+				spec.Inverse = inverse.ID
+				spec.InverseName = node.Inverse
+			} else {
+				log.Printf("Inverse %s of relationship type %s is not in the graph\n", node.Inverse, node.Name)
+			}
+		}
+		specs[relType.ID] = spec
+	}
+
+	relationshipTypeSpecsMu.Lock()
+	relationshipTypeSpecs = specs
+	relationshipTypeSpecsMu.Unlock()
+	return nil
+}
+
+func relationshipTypeSpec(typeID ConceptGUID) *RelationshipTypeSpec {
+	relationshipTypeSpecsMu.RLock()
+	defer relationshipTypeSpecsMu.RUnlock()
+	return relationshipTypeSpecs[typeID]
+}
+
+// entityTypes returns the names a domain or range entry can match for an entity:
+// a concept's ConceptType and name, or "Seed" and the name of the seed's concept
+func (s *Server) entityTypes(guid EntityGUID) ([]string, bool) {
+	if concept, ok := s.concepts.Get(ConceptGUID(guid)); ok {
+		return []string{concept.ConceptType, concept.Name}, true
+	}
+	if seed, ok := s.seeds.Get(SeedGUID(guid)); ok {
+		types := []string{seed.GetEntityType()}
+		if concept, ok := s.concepts.Get(seed.GetCoreSeed().ConceptID); ok {
+			types = append(types, concept.Name)
+		}
+		return types, true
+	}
+	return nil, false
+}
+
+func matchesAny(types []string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, t := range types {
+		for _, a := range allowed {
+			if t == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateRelationship checks a new or changed relationship against its type's
+// domain and range. Its cardinality limits are checked as it is stored, by
+// putRelationship.
+func (s *Server) validateRelationship(sourceID, targetID EntityGUID, typeID ConceptGUID) error {
+	relType, ok := s.concepts.Get(typeID)
+	if !ok || relType.ConceptType != relationshipTypeConceptType {
+		return fmt.Errorf("%s is not a relationship type", typeID)
+	}
+
+	sourceTypes, ok := s.entityTypes(sourceID)
+	if !ok {
+		return fmt.Errorf("source %s not found", sourceID)
+	}
+	targetTypes, ok := s.entityTypes(targetID)
+	if !ok {
+		return fmt.Errorf("target %s not found", targetID)
+	}
+
+	spec := relationshipTypeSpec(typeID)
+	if spec == nil {
+		return nil
+	}
+	if !matchesAny(sourceTypes, spec.Domain) {
+		return fmt.Errorf("%s does not allow source %s (allowed: %v)", spec.Name, sourceID, spec.Domain)
+	}
+	if !matchesAny(targetTypes, spec.Range) {
+		return fmt.Errorf("%s does not allow target %s (allowed: %v)", spec.Name, targetID, spec.Range)
+	}
+	return nil
+}
+
+// relationshipEdge is one direction of a relationship: the relationship as
+// stored, or the edge its type's inverse or symmetry implies
+type relationshipEdge struct {
+	typeID   ConceptGUID
+	from, to EntityGUID
+}
+
+// impliedEdges returns the edges a relationship stands for. The caller holds
+// relationshipTypeSpecsMu.
+func impliedEdges(rel *Relationship) []relationshipEdge {
+	edges := []relationshipEdge{{rel.Type, rel.SourceID, rel.TargetID}}
+	spec, ok := relationshipTypeSpecs[rel.Type]
+	if !ok || rel.SourceID == rel.TargetID {
+		return edges
+	}
+	if spec.Inverse != "" {
+		edges = append(edges, relationshipEdge{spec.Inverse, rel.TargetID, rel.SourceID})
+	}
+	if spec.Symmetric {
+		edges = append(edges, relationshipEdge{rel.Type, rel.TargetID, rel.SourceID})
+	}
+	return edges
+}
+
+// putRelationship stores a new or changed relationship unless that would take
+// an entity past a type's cardinality limits. The limits count the edges each
+// relationship implies as well, so "Y Composed Of X" counts as the "Component
+// Of" edge from X it stands for. A relationship stored both ways, or twice, is one edge.
+func (s *Server) putRelationship(ctx context.Context, rel *Relationship) error {
+	return s.relationships.PutWithin(ctx, rel, func(others []*Relationship) error {
+		relationshipTypeSpecsMu.RLock()
+		defer relationshipTypeSpecsMu.RUnlock()
+
+		edges := impliedEdges(rel)
+		limited := false
+		for _, e := range edges {
+			if spec, ok := relationshipTypeSpecs[e.typeID]; ok && (spec.MaxOut > 0 || spec.MaxIn > 0) {
+				limited = true
+			}
+		}
+		if !limited {
+			return nil
+		}
+
+		stored := make(map[relationshipEdge]bool)
+		for _, other := range others {
+			for _, e := range impliedEdges(other) {
+				stored[e] = true
+			}
+		}
+		for _, e := range edges {
+			spec, ok := relationshipTypeSpecs[e.typeID]
+			if !ok || stored[e] {
+				continue
+			}
+			out, in := 0, 0
+			for other := range stored {
+				if other.typeID != e.typeID {
+					continue
+				}
+				if other.from == e.from {
+					out++
+				}
+				if other.to == e.to {
+					in++
+				}
+			}
+			if spec.MaxOut > 0 && out >= spec.MaxOut {
+				return fmt.Errorf("%s already has %d %s relationship(s); at most %d allowed", e.from, out, spec.Name, spec.MaxOut)
+			}
+			if spec.MaxIn > 0 && in >= spec.MaxIn {
+				return fmt.Errorf("%s is already the target of %d %s relationship(s); at most %d allowed", e.to, in, spec.Name, spec.MaxIn)
+			}
+			stored[e] = true
+		}
+		return nil
+	})
+}
+
+// withInferredRelationships adds the edges implied by inverse and symmetric
+// relationship types, e.g. "Composed Of" answered from "Component Of". Inferred
+// edges carry the ID of the relationship they were derived from in InferredFrom.
+func withInferredRelationships(rels []*Relationship) []*Relationship {
+	relationshipTypeSpecsMu.RLock()
+	defer relationshipTypeSpecsMu.RUnlock()
+
+	exists := make(map[string]bool, len(rels))
+	key := func(source, target EntityGUID, typeID ConceptGUID) string {
+		return string(source) + "|" + string(typeID) + "|" + string(target)
+	}
+	for _, rel := range rels {
+		exists[key(rel.SourceID, rel.TargetID, rel.Type)] = true
+	}
+
+	result := append([]*Relationship{}, rels...)
+	infer := func(rel *Relationship, typeID ConceptGUID, suffix string) {
+		k := key(rel.TargetID, rel.SourceID, typeID)
+		if exists[k] {
+			return
+		}
+		exists[k] = true
+		result = append(result, &Relationship{
+			ID:           rel.ID + RelationshipGUID(suffix),
+			SourceID:     rel.TargetID,
+			TargetID:     rel.SourceID,
+			Type:         typeID,
+			Properties:   rel.Properties,
+			Timestamp:    rel.Timestamp,
+			InferredFrom: rel.ID,
+		})
+	}
+	for _, rel := range rels {
+		spec, ok := relationshipTypeSpecs[rel.Type]
+		if !ok || rel.InferredFrom != "" {
+			continue
+		}
+		if spec.Inverse != "" {
+			infer(rel, spec.Inverse, "~inverse")
+		}
+		if spec.Symmetric {
+			infer(rel, rel.Type, "~symmetric")
+		}
+	}
+	return result
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// withSpec replaces the constraints of a relationship type for one test
+func withSpec(t *testing.T, spec *RelationshipTypeSpec) {
+	t.Helper()
+	relationshipTypeSpecsMu.Lock()
+	previous := relationshipTypeSpecs[spec.TypeID]
+	relationshipTypeSpecs[spec.TypeID] = spec
+	relationshipTypeSpecsMu.Unlock()
+	t.Cleanup(func() {
+		relationshipTypeSpecsMu.Lock()
+		relationshipTypeSpecs[spec.TypeID] = previous
+		relationshipTypeSpecsMu.Unlock()
+	})
+}
+
+// newConcepts stores concepts with no relationships, for tests that must not
+// trip over the shipped ontology's edges
+func newConcepts(t *testing.T, s *Server, names ...string) []EntityGUID {
+	t.Helper()
+	ids := make([]EntityGUID, len(names))
+	for i, name := range names {
+		concept := &Concept{ID: ConceptGUID(uuid.New().String()), Name: name, ConceptType: "FundamentalConcept", Relationships: []RelationshipGUID{}}
+		if err := s.addNewConcept(context.Background(), concept, peerID); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = EntityGUID(concept.ID)
+	}
+	return ids
+}
+
+func TestValidateRelationship(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := newTestSteward(t, s, "Alice")
+	influences := s.findConceptGUID("Influences")
+	withSpec(t, &RelationshipTypeSpec{
+		TypeID: influences,
+		Name:   "Influences",
+		Domain: []string{"Seed", "Technology"},
+		Range:  []string{"FundamentalConcept"},
+	})
+	concept := func(name string) EntityGUID { return EntityGUID(s.findConceptGUID(name)) }
+
+	tests := []struct {
+		name    string
+		source  EntityGUID
+		target  EntityGUID
+		typeID  ConceptGUID
+		wantErr string
+	}{
+		{"allowed by concept name", concept("Technology"), concept("Society"), influences, ""},
+		{"allowed seed source", EntityGUID(alice.SeedID), concept("Society"), influences, ""},
+		{"source not in domain", concept("Self"), concept("Society"), influences, "does not allow source"},
+		{"target not in range", concept("Technology"), EntityGUID(alice.SeedID), influences, "does not allow target"},
+		{"missing source", "nobody", concept("Society"), influences, "source nobody not found"},
+		{"missing target", concept("Technology"), "nothing", influences, "target nothing not found"},
+		{"not a relationship type", concept("Technology"), concept("Society"), s.findConceptGUID("Society"), "is not a relationship type"},
+		{"unconstrained type", concept("Self"), EntityGUID(alice.SeedID), s.findConceptGUID("Manifests As"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateRelationship(tt.source, tt.target, tt.typeID)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("rejected: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPutRelationshipCardinality(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	typeID := s.findConceptGUID("Opposes")
+	a, b, c := EntityGUID(s.findConceptGUID("Self")), EntityGUID(s.findConceptGUID("Ego")), EntityGUID(s.findConceptGUID("Wisdom"))
+
+	tests := []struct {
+		name     string
+		maxOut   int
+		maxIn    int
+		existing [][2]EntityGUID // source and target of relationships already stored
+		put      [2]EntityGUID
+		wantErr  string
+	}{
+		{"unlimited", 0, 0, [][2]EntityGUID{{a, b}, {a, c}}, [2]EntityGUID{a, b}, ""},
+		{"max_out reached", 1, 0, [][2]EntityGUID{{a, b}}, [2]EntityGUID{a, c}, "at most 1 allowed"},
+		{"max_out other source", 1, 0, [][2]EntityGUID{{a, b}}, [2]EntityGUID{c, b}, ""},
+		{"max_in reached", 0, 2, [][2]EntityGUID{{a, b}, {c, b}}, [2]EntityGUID{b, b}, "already the target of 2"},
+		{"max_in other target", 0, 1, [][2]EntityGUID{{a, b}}, [2]EntityGUID{a, c}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSpec(t, &RelationshipTypeSpec{TypeID: typeID, Name: "Opposes", MaxOut: tt.maxOut, MaxIn: tt.maxIn})
+			var stored []RelationshipGUID
+			t.Cleanup(func() {
+				for _, id := range stored {
+					s.relationships.Delete(ctx, id)
+				}
+			})
+			for _, e := range tt.existing {
+				rel := CreateRelationship(e[0], e[1], typeID, nil)
+				if err := s.putRelationship(ctx, rel); err != nil {
+					t.Fatalf("storing %v: %v", e, err)
+				}
+				stored = append(stored, rel.ID)
+			}
+
+			rel := CreateRelationship(tt.put[0], tt.put[1], typeID, nil)
+			err := s.putRelationship(ctx, rel)
+			if err == nil {
+				stored = append(stored, rel.ID)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("rejected: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestPutRelationshipCountsImpliedEdges checks that a limit also holds for the
+// edges inverse and symmetric types imply
+func TestPutRelationshipCountsImpliedEdges(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	componentOf, composedOf, opposes := s.findConceptGUID("Component Of"), s.findConceptGUID("Composed Of"), s.findConceptGUID("Opposes")
+	withSpec(t, &RelationshipTypeSpec{TypeID: componentOf, Name: "Component Of", MaxOut: 1, Inverse: composedOf})
+	withSpec(t, &RelationshipTypeSpec{TypeID: composedOf, Name: "Composed Of", Inverse: componentOf})
+	withSpec(t, &RelationshipTypeSpec{TypeID: opposes, Name: "Opposes", MaxOut: 1, Symmetric: true})
+	parts := newConcepts(t, s, "A", "B", "C")
+	a, b, c := parts[0], parts[1], parts[2]
+
+	type edge struct {
+		typeID   ConceptGUID
+		from, to EntityGUID
+	}
+	tests := []struct {
+		name     string
+		existing []edge
+		put      edge
+		wantErr  string
+	}{
+		{"inverse past max_out", []edge{{componentOf, a, b}}, edge{composedOf, c, a}, "at most 1 allowed"},
+		{"max_out past a stored inverse", []edge{{composedOf, b, a}}, edge{componentOf, a, c}, "at most 1 allowed"},
+		{"inverse of the stored edge", []edge{{componentOf, a, b}}, edge{composedOf, b, a}, ""},
+		{"inverse from another part", []edge{{componentOf, a, b}}, edge{composedOf, b, c}, ""},
+		{"symmetric past max_out", []edge{{opposes, a, b}}, edge{opposes, c, a}, "at most 1 allowed"},
+		{"symmetric stored both ways", []edge{{opposes, a, b}}, edge{opposes, b, a}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored []RelationshipGUID
+			t.Cleanup(func() {
+				for _, id := range stored {
+					s.relationships.Delete(ctx, id)
+				}
+			})
+			for _, e := range tt.existing {
+				rel := CreateRelationship(e.from, e.to, e.typeID, nil)
+				if err := s.putRelationship(ctx, rel); err != nil {
+					t.Fatalf("storing %v: %v", e, err)
+				}
+				stored = append(stored, rel.ID)
+			}
+
+			rel := CreateRelationship(tt.put.from, tt.put.to, tt.put.typeID, nil)
+			err := s.putRelationship(ctx, rel)
+			if err == nil {
+				stored = append(stored, rel.ID)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("rejected: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPutRelationshipReplacesItself(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	componentOf := s.findConceptGUID("Component Of")
+	withSpec(t, &RelationshipTypeSpec{TypeID: componentOf, Name: "Component Of", MaxOut: 1})
+	part := newConcepts(t, s, "Part")[0]
+
+	rel := CreateRelationship(part, EntityGUID(s.findConceptGUID("Self")), componentOf, nil)
+	if err := s.putRelationship(ctx, rel); err != nil {
+		t.Fatal(err)
+	}
+	moved := rel.clone()
+	moved.TargetID = EntityGUID(s.findConceptGUID("Wisdom"))
+	if err := s.putRelationship(ctx, moved); err != nil {
+		t.Errorf("changing the only %q of %s rejected: %v", "Component Of", part, err)
+	}
+}
+
+func TestPutRelationshipConcurrent(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	componentOf := s.findConceptGUID("Component Of")
+	withSpec(t, &RelationshipTypeSpec{TypeID: componentOf, Name: "Component Of", MaxOut: 1})
+	part := newConcepts(t, s, "Part")[0]
+	targets := []string{"Self", "Wisdom", "Knowledge", "Technology", "Mathematics", "Experience"}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stored := 0
+	for _, name := range targets {
+		wg.Add(1)
+		go func(target EntityGUID) {
+			defer wg.Done()
+			if err := s.putRelationship(ctx, CreateRelationship(part, target, componentOf, nil)); err == nil {
+				mu.Lock()
+				stored++
+				mu.Unlock()
+			}
+		}(EntityGUID(s.findConceptGUID(name)))
+	}
+	wg.Wait()
+	if stored != 1 {
+		t.Errorf("%d concurrent %q relationships stored from one source, want 1", stored, "Component Of")
+	}
+}
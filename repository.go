@@ -0,0 +1,785 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// The repositories own the node's state and its locking. Stored entities are
+// never changed in place: Get and Snapshot hand out values that stay valid
+// however the repository changes afterwards, and every change stores a new
+// value, so readers never see a half-made update. Every change is recorded as
+// it is stored, see recordChange, and the entity is marked for the next
+// persist.
+
+// changeSet collects the IDs of the entities changed since they were last
+// written to the state store
+type changeSet[K comparable] struct {
+	mu  sync.Mutex
+	ids map[K]bool
+}
+
+func (c *changeSet[K]) mark(ids ...K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids == nil {
+		c.ids = make(map[K]bool)
+	}
+	for _, id := range ids {
+		c.ids[id] = true
+	}
+}
+
+// take returns the changed IDs and forgets them
+func (c *changeSet[K]) take() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]K, 0, len(c.ids))
+	for id := range c.ids {
+		ids = append(ids, id)
+	}
+	c.ids = nil
+	return ids
+}
+
+// ConceptRepo holds the concepts, the CIDs of their current versions and the
+// index of names to GUIDs
+type ConceptRepo struct {
+	mu       sync.RWMutex
+	concepts ConceptMap
+	cids     ConceptGUID2CIDMap
+	names    map[string]GUID
+	events   *EventBus
+	changed  changeSet[ConceptGUID]
+}
+
+func NewConceptRepo(events *EventBus) *ConceptRepo {
+	return &ConceptRepo{
+		events:   events,
+		concepts: make(ConceptMap),
+		cids:     make(ConceptGUID2CIDMap),
+		names:    make(map[string]GUID),
+	}
+}
+
+func (r *ConceptRepo) Get(id ConceptGUID) (*Concept, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	concept, ok := r.concepts[id]
+	return concept, ok
+}
+
+func (r *ConceptRepo) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.concepts)
+}
+
+// Snapshot returns the concepts as they are now
+func (r *ConceptRepo) Snapshot() ConceptMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.concepts)
+}
+
+// CIDs returns the CID of every concept's current version
+func (r *ConceptRepo) CIDs() ConceptGUID2CIDMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.cids)
+}
+
+// Put stores a concept, its CID and its name together. The concept must not be
+// changed afterwards.
+func (r *ConceptRepo) Put(ctx context.Context, concept *Concept) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.concepts[concept.ID]
+	r.set(concept.ID, existing, concept)
+	r.record(ctx, changeOp(existing != nil), concept.ID, existing, concept)
+}
+
+// Replace stores concept in place of expected, the version it was made from or
+// nil for a new concept. It stores nothing and returns false if the stored
+// concept is no longer expected.
+func (r *ConceptRepo) Replace(ctx context.Context, concept *Concept, expected *Concept) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.concepts[concept.ID]
+	if existing != expected {
+		return false
+	}
+	r.set(concept.ID, existing, concept)
+	r.record(ctx, changeOp(existing != nil), concept.ID, existing, concept)
+	return true
+}
+
+// Update changes a concept atomically: change gets a copy of the stored concept
+// and, unless it fails, the copy replaces it
+func (r *ConceptRepo) Update(ctx context.Context, id ConceptGUID, change func(concept *Concept) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.concepts[id]
+	if !ok {
+		return fmt.Errorf("concept %w: %s", errEntityNotFound, id)
+	}
+	concept := existing.clone()
+	if err := change(concept); err != nil {
+		return err
+	}
+	r.set(id, existing, concept)
+	r.record(ctx, eventUpdated, id, existing, concept)
+	return nil
+}
+
+// Delete removes a concept, its CID and its name
+func (r *ConceptRepo) Delete(ctx context.Context, id ConceptGUID) (*Concept, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	concept, ok := r.concepts[id]
+	if !ok {
+		return nil, false
+	}
+	r.set(id, concept, nil)
+	r.record(ctx, eventDeleted, id, concept, nil)
+	return concept, true
+}
+
+// set stores concept, or removes the one stored if it is nil, in place of
+// existing, keeping the CIDs and the name index in step
+func (r *ConceptRepo) set(id ConceptGUID, existing, concept *Concept) {
+	if existing != nil && r.names[existing.Name] == GUID(id) {
+		delete(r.names, existing.Name)
+	}
+	if concept == nil {
+		delete(r.concepts, id)
+		delete(r.cids, id)
+	} else {
+		r.concepts[id] = concept
+		r.cids[id] = concept.GetCID()
+		r.names[concept.Name] = GUID(id)
+	}
+	r.changed.mark(id)
+}
+
+// record records the change from existing to concept; undoing it puts existing
+// back unless the concept has changed again since
+func (r *ConceptRepo) record(ctx context.Context, op string, id ConceptGUID, existing, concept *Concept) {
+	var data any
+	if concept != nil {
+		data = concept
+	}
+	recordChange(ctx, r.events, "concept", op, string(id), data, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.concepts[id] == concept {
+			r.set(id, concept, existing)
+		}
+	})
+}
+
+// Load replaces the concepts, setting each one's CID from cids and indexing its name
+func (r *ConceptRepo) Load(concepts ConceptMap, cids ConceptGUID2CIDMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.concepts = make(ConceptMap, len(concepts))
+	r.cids = make(ConceptGUID2CIDMap, len(cids))
+	maps.Copy(r.cids, cids)
+	for id, concept := range concepts {
+		concept.CID = cids[id]
+		r.concepts[id] = concept
+		r.names[concept.Name] = GUID(id)
+	}
+}
+
+// TakeChanged returns the IDs changed since it was last called
+func (r *ConceptRepo) TakeChanged() []ConceptGUID {
+	return r.changed.take()
+}
+
+// MarkChanged marks IDs to be taken again, after they failed to be saved
+func (r *ConceptRepo) MarkChanged(ids ...ConceptGUID) {
+	r.changed.mark(ids...)
+}
+
+// StaleCIDs returns the CID entries that have no concept, sorted, and removes
+// them if drop is set
+func (r *ConceptRepo) StaleCIDs(drop bool) []ConceptGUID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stale []ConceptGUID
+	for id := range r.cids {
+		if _, ok := r.concepts[id]; !ok {
+			stale = append(stale, id)
+			if drop {
+				delete(r.cids, id)
+				r.changed.mark(id)
+			}
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// LookupName returns the GUID recorded for a name
+func (r *ConceptRepo) LookupName(name string) (GUID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	guid, ok := r.names[name]
+	return guid, ok
+}
+
+// SetName records the GUID for a name. Names are also given to relationship
+// keys, which are not concepts.
+func (r *ConceptRepo) SetName(name string, guid GUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names[name] = guid
+}
+
+// NameOf returns a name recorded for guid, or "" if there is none
+func (r *ConceptRepo) NameOf(guid GUID) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, nameGUID := range r.names {
+		if nameGUID == guid {
+			return name
+		}
+	}
+	return ""
+}
+
+// SeedRepo holds the seeds and the CIDs of their current versions
+type SeedRepo struct {
+	mu      sync.RWMutex
+	seeds   SeedMap
+	cids    SeedGUID2CIDMap
+	events  *EventBus
+	changed changeSet[SeedGUID]
+}
+
+func NewSeedRepo(events *EventBus) *SeedRepo {
+	return &SeedRepo{events: events, seeds: make(SeedMap), cids: make(SeedGUID2CIDMap)}
+}
+
+func (r *SeedRepo) Get(id SeedGUID) (Seed_i, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seed, ok := r.seeds[id]
+	return seed, ok
+}
+
+func (r *SeedRepo) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.seeds)
+}
+
+// Snapshot returns the seeds as they are now
+func (r *SeedRepo) Snapshot() SeedMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.seeds)
+}
+
+// CIDs returns the CID of every seed's current version
+func (r *SeedRepo) CIDs() SeedGUID2CIDMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.cids)
+}
+
+// Put stores a seed and its CID together. The seed must not be changed afterwards.
+func (r *SeedRepo) Put(ctx context.Context, seed Seed_i) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.seeds[seed.GetSeedID()]
+	r.set(seed.GetSeedID(), seed)
+	r.record(ctx, changeOp(existing != nil), seed.GetSeedID(), existing, seed)
+}
+
+// Replace stores seed in place of expected, the version it was made from or nil
+// for a new seed. It stores nothing and returns false if the stored seed is no
+// longer expected.
+func (r *SeedRepo) Replace(ctx context.Context, seed Seed_i, expected Seed_i) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.seeds[seed.GetSeedID()]
+	if existing != expected {
+		return false
+	}
+	r.set(seed.GetSeedID(), seed)
+	r.record(ctx, changeOp(existing != nil), seed.GetSeedID(), existing, seed)
+	return true
+}
+
+// Update changes a seed atomically: change gets a copy of the stored seed and,
+// unless it fails, the copy replaces it
+func (r *SeedRepo) Update(ctx context.Context, id SeedGUID, change func(seed Seed_i) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.seeds[id]
+	if !ok {
+		return fmt.Errorf("seed %w: %s", errEntityNotFound, id)
+	}
+	seed, err := cloneSeed(existing)
+	if err != nil {
+		return err
+	}
+	if err := change(seed); err != nil {
+		return err
+	}
+	r.set(id, seed)
+	r.record(ctx, eventUpdated, id, existing, seed)
+	return nil
+}
+
+// Delete removes a seed and its CID
+func (r *SeedRepo) Delete(ctx context.Context, id SeedGUID) (Seed_i, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seed, ok := r.seeds[id]
+	if ok {
+		r.set(id, nil)
+		r.record(ctx, eventDeleted, id, seed, nil)
+	}
+	return seed, ok
+}
+
+// set stores seed and its CID, or removes the stored seed if it is nil
+func (r *SeedRepo) set(id SeedGUID, seed Seed_i) {
+	if seed == nil {
+		delete(r.seeds, id)
+		delete(r.cids, id)
+	} else {
+		r.seeds[id] = seed
+		r.cids[id] = seed.GetCID()
+	}
+	r.changed.mark(id)
+}
+
+// record records the change from existing to seed; undoing it puts existing
+// back unless the seed has changed again since
+func (r *SeedRepo) record(ctx context.Context, op string, id SeedGUID, existing, seed Seed_i) {
+	var data any
+	if seed != nil {
+		data = seed
+	}
+	recordChange(ctx, r.events, "seed", op, string(id), data, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.seeds[id] == seed {
+			r.set(id, existing)
+		}
+	})
+}
+
+// Load replaces the seeds, setting each one's CID from cids
+func (r *SeedRepo) Load(seeds SeedMap, cids SeedGUID2CIDMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seeds = make(SeedMap, len(seeds))
+	r.cids = make(SeedGUID2CIDMap, len(cids))
+	maps.Copy(r.cids, cids)
+	for id, seed := range seeds {
+		if cid, ok := cids[id]; ok {
+			seed.SetCID(cid)
+		}
+		r.seeds[id] = seed
+	}
+}
+
+// TakeChanged returns the IDs changed since it was last called
+func (r *SeedRepo) TakeChanged() []SeedGUID {
+	return r.changed.take()
+}
+
+// MarkChanged marks IDs to be taken again, after they failed to be saved
+func (r *SeedRepo) MarkChanged(ids ...SeedGUID) {
+	r.changed.mark(ids...)
+}
+
+// StaleCIDs returns the CID entries that have no seed, sorted, and removes them
+// if drop is set
+func (r *SeedRepo) StaleCIDs(drop bool) []SeedGUID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stale []SeedGUID
+	for id := range r.cids {
+		if _, ok := r.seeds[id]; !ok {
+			stale = append(stale, id)
+			if drop {
+				delete(r.cids, id)
+				r.changed.mark(id)
+			}
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// RelationshipRepo holds the relationships
+type RelationshipRepo struct {
+	mu            sync.RWMutex
+	relationships RelationshipMap
+	events        *EventBus
+	changed       changeSet[RelationshipGUID]
+}
+
+func NewRelationshipRepo(events *EventBus) *RelationshipRepo {
+	return &RelationshipRepo{events: events, relationships: make(RelationshipMap)}
+}
+
+func (r *RelationshipRepo) Get(id RelationshipGUID) (*Relationship, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	relationship, ok := r.relationships[id]
+	return relationship, ok
+}
+
+func (r *RelationshipRepo) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.relationships)
+}
+
+// Snapshot returns the relationships as they are now
+func (r *RelationshipRepo) Snapshot() RelationshipMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.relationships)
+}
+
+// List returns every relationship
+func (r *RelationshipRepo) List() []*Relationship {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*Relationship, 0, len(r.relationships))
+	for _, relationship := range r.relationships {
+		list = append(list, relationship)
+	}
+	return list
+}
+
+// Select returns the relationships match accepts
+func (r *RelationshipRepo) Select(match func(relationship *Relationship) bool) []*Relationship {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var selected []*Relationship
+	for _, relationship := range r.relationships {
+		if match(relationship) {
+			selected = append(selected, relationship)
+		}
+	}
+	return selected
+}
+
+// Put stores a relationship. It must not be changed afterwards.
+func (r *RelationshipRepo) Put(ctx context.Context, relationship *Relationship) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.relationships[relationship.ID]
+	r.set(relationship.ID, relationship)
+	r.record(ctx, changeOp(existing != nil), relationship.ID, existing, relationship)
+}
+
+// PutWithin stores a new or changed relationship if fits accepts it alongside
+// the other stored relationships. The check and the store happen under one
+// lock, so no other writer can slip a relationship in between them; fits must
+// not keep the slice.
+func (r *RelationshipRepo) PutWithin(ctx context.Context, relationship *Relationship, fits func(others []*Relationship) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	others := make([]*Relationship, 0, len(r.relationships))
+	for _, rel := range r.relationships {
+		if rel.ID != relationship.ID {
+			others = append(others, rel)
+		}
+	}
+	if err := fits(others); err != nil {
+		return err
+	}
+	existing := r.relationships[relationship.ID]
+	r.set(relationship.ID, relationship)
+	r.record(ctx, changeOp(existing != nil), relationship.ID, existing, relationship)
+	return nil
+}
+
+// Update changes a relationship atomically: change gets a copy of the stored
+// relationship and, unless it fails, the copy replaces it
+func (r *RelationshipRepo) Update(ctx context.Context, id RelationshipGUID, change func(relationship *Relationship) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.relationships[id]
+	if !ok {
+		return fmt.Errorf("relationship %w: %s", errEntityNotFound, id)
+	}
+	relationship := existing.clone()
+	if err := change(relationship); err != nil {
+		return err
+	}
+	r.set(id, relationship)
+	r.record(ctx, eventUpdated, id, existing, relationship)
+	return nil
+}
+
+func (r *RelationshipRepo) Delete(ctx context.Context, id RelationshipGUID) (*Relationship, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	relationship, ok := r.relationships[id]
+	if ok {
+		r.set(id, nil)
+		r.record(ctx, eventDeleted, id, relationship, nil)
+	}
+	return relationship, ok
+}
+
+// set stores relationship, or removes the stored one if it is nil
+func (r *RelationshipRepo) set(id RelationshipGUID, relationship *Relationship) {
+	if relationship == nil {
+		delete(r.relationships, id)
+	} else {
+		r.relationships[id] = relationship
+	}
+	r.changed.mark(id)
+}
+
+// record records the change from existing to relationship; undoing it puts
+// existing back unless the relationship has changed again since
+func (r *RelationshipRepo) record(ctx context.Context, op string, id RelationshipGUID, existing, relationship *Relationship) {
+	var data any
+	if relationship != nil {
+		data = relationship
+	}
+	recordChange(ctx, r.events, "relationship", op, string(id), data, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.relationships[id] == relationship {
+			r.set(id, existing)
+		}
+	})
+}
+
+// Load replaces the relationships
+func (r *RelationshipRepo) Load(relationships RelationshipMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.relationships = maps.Clone(relationships)
+	if r.relationships == nil {
+		r.relationships = make(RelationshipMap)
+	}
+}
+
+// TakeChanged returns the IDs changed since it was last called
+func (r *RelationshipRepo) TakeChanged() []RelationshipGUID {
+	return r.changed.take()
+}
+
+// MarkChanged marks IDs to be taken again, after they failed to be saved
+func (r *RelationshipRepo) MarkChanged(ids ...RelationshipGUID) {
+	r.changed.mark(ids...)
+}
+
+// PeerRepo holds the peers this node knows, itself included
+type PeerRepo struct {
+	mu      sync.RWMutex
+	peers   PeerMap
+	events  *EventBus
+	changed changeSet[PeerID]
+}
+
+func NewPeerRepo(events *EventBus) *PeerRepo {
+	return &PeerRepo{events: events, peers: make(PeerMap)}
+}
+
+func (r *PeerRepo) Get(id PeerID) (Peer_i, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	peer, ok := r.peers[id]
+	return peer, ok
+}
+
+// Snapshot returns the peers as they are now
+func (r *PeerRepo) Snapshot() PeerMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.peers)
+}
+
+// Put stores a peer. It must not be changed afterwards.
+func (r *PeerRepo) Put(ctx context.Context, peer Peer_i) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.peers[peer.GetID()]
+	r.peers[peer.GetID()] = peer
+	r.record(ctx, changeOp(existing != nil), peer.GetID(), existing, peer)
+}
+
+// PutIfAbsent stores a peer unless one with its ID exists
+func (r *PeerRepo) PutIfAbsent(ctx context.Context, peer Peer_i) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.peers[peer.GetID()]; exists {
+		return false
+	}
+	r.peers[peer.GetID()] = peer
+	r.record(ctx, eventCreated, peer.GetID(), nil, peer)
+	return true
+}
+
+// Update changes a peer atomically; it does nothing for an unknown peer
+func (r *PeerRepo) Update(ctx context.Context, id PeerID, change func(peer *Peer)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.peers[id]
+	if !ok {
+		return false
+	}
+	peer := clonePeer(existing)
+	change(peer)
+	r.peers[id] = peer
+	r.record(ctx, eventUpdated, id, existing, peer)
+	return true
+}
+
+func (r *PeerRepo) Delete(ctx context.Context, id PeerID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.peers[id]; ok {
+		delete(r.peers, id)
+		r.record(ctx, eventDeleted, id, existing, nil)
+	}
+}
+
+// record publishes the change from existing to peer. Peers also change outside
+// the update lock, so a journaled change publishes the peer as it is when the
+// batch commits rather than as it was stored, and undoing it puts existing back
+// or, if the peer has changed again since, only the concept and seed CIDs it
+// had; only then was the change seen, and the undo is published.
+func (r *PeerRepo) record(ctx context.Context, op string, id PeerID, existing, peer Peer_i) {
+	r.changed.mark(id)
+	j := journalFrom(ctx)
+	if j == nil {
+		var data any
+		if peer != nil {
+			data = peer
+		}
+		r.events.publish("peer", op, string(id), data)
+		return
+	}
+	j.add(func() {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		if current, ok := r.peers[id]; ok {
+			r.events.publish("peer", op, string(id), current)
+		} else {
+			r.events.publish("peer", eventDeleted, string(id), nil)
+		}
+	}, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		current := r.peers[id]
+		r.changed.mark(id)
+		if current == peer {
+			r.setSilently(id, existing)
+			return
+		}
+		if current == nil || existing == nil {
+			return
+		}
+		kept, before := clonePeer(current), clonePeer(existing)
+		kept.ConceptCIDs, kept.SeedCIDs = before.ConceptCIDs, before.SeedCIDs
+		r.peers[id] = kept
+		r.events.publish("peer", eventUpdated, string(id), kept)
+	})
+}
+
+// setSilently stores or removes a peer without publishing the change
+func (r *PeerRepo) setSilently(id PeerID, peer Peer_i) {
+	if peer == nil {
+		delete(r.peers, id)
+		return
+	}
+	r.peers[id] = peer
+}
+
+// Load replaces the peers
+func (r *PeerRepo) Load(peers PeerMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers = maps.Clone(peers)
+	if r.peers == nil {
+		r.peers = make(PeerMap)
+	}
+}
+
+// TakeChanged returns the IDs changed since it was last called
+func (r *PeerRepo) TakeChanged() []PeerID {
+	return r.changed.take()
+}
+
+// MarkChanged marks IDs to be taken again, after they failed to be saved
+func (r *PeerRepo) MarkChanged(ids ...PeerID) {
+	r.changed.mark(ids...)
+}
+
+// changeOp names the event for storing an entity that did or did not exist yet
+func changeOp(exists bool) string {
+	if exists {
+		return eventUpdated
+	}
+	return eventCreated
+}
+
+func (c *Concept) clone() *Concept {
+	clone := *c
+	clone.Relationships = append([]RelationshipGUID(nil), c.Relationships...)
+	return &clone
+}
+
+func (r *Relationship) clone() *Relationship {
+	clone := *r
+	clone.Properties = maps.Clone(r.Properties)
+	if r.Dynamics != nil {
+		clone.Dynamics = r.Dynamics.clone()
+	}
+	return &clone
+}
+
+// cloneSeed copies a seed through its JSON form, the one thing every seed type has
+func cloneSeed(seed Seed_i) (Seed_i, error) {
+	data, err := json.Marshal(seed)
+	if err != nil {
+		return nil, err
+	}
+	clone, err := UnmarshalJSON2Seed(data)
+	if err != nil {
+		return nil, err
+	}
+	clone.SetCID(seed.GetCID())
+	return clone, nil
+}
+
+func clonePeer(peer Peer_i) *Peer {
+	clone := &Peer{
+		ID:          peer.GetID(),
+		ConceptCIDs: make(map[CID]bool),
+		SeedCIDs:    make(map[CID]bool),
+		Timestamp:   peer.GetTimestamp(),
+		LastSeen:    peer.GetLastSeen(),
+		Latency:     peer.GetLatency(),
+	}
+	clone.SetStewardIDs(peer.GetStewardIDs())
+	clone.StewardClaims = peer.GetStewardClaims()
+	for _, cid := range peer.GetConceptCIDs() {
+		clone.ConceptCIDs[cid] = true
+	}
+	for _, cid := range peer.GetSeedCIDs() {
+		clone.SeedCIDs[cid] = true
+	}
+	return clone
+}
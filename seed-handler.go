@@ -1,28 +1,44 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func getSeed_h(c *gin.Context) {
+// errSeedIDMismatch rejects a seed body that names another seed than the one
+// being changed
+var errSeedIDMismatch = errors.New("SeedID does not match the seed being changed")
+
+// checkSeedDocID rejects a changed seed document that names another seed
+func checkSeedDocID(guid SeedGUID, doc map[string]any) error {
+	if id, _ := doc["SeedID"].(string); SeedGUID(id) != guid {
+		return fmt.Errorf("%w: %s", errSeedIDMismatch, guid)
+	}
+	return nil
+}
+
+func (s *Server) getSeed_h(c *gin.Context) {
 	guid := SeedGUID(c.Param("guid"))
 
-	seed, exists := seedMap[guid]
+	seed, exists := s.seeds.Get(guid)
 
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
 		return
 	}
+	c.Header("ETag", etag(seed.GetCID()))
 	c.JSON(http.StatusOK, seed)
 }
 
-func addSeed_h(c *gin.Context) {
+func (s *Server) addSeed_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
 	var seedData map[string]any
 
 	if err := c.BindJSON(&seedData); err != nil {
@@ -36,14 +52,18 @@ func addSeed_h(c *gin.Context) {
 		return
 	}
 
-	generator := &SeedNursery{}
+	generator := s.nursery()
 	seed, err := generator.CreateSeed(ConceptGUID(conceptID), seedData)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to create seed: %v", err)})
 		return
 	}
+	if err := s.authorizeSeed(c.Request.Context(), nil, seed); err != nil {
+		abortAuth(c, err)
+		return
+	}
 
-	if err := addOrUpdateSeed(c.Request.Context(), seed, peerID); err != nil {
+	if err := s.addOrUpdateSeed(c.Request.Context(), seed, peerID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add seed"})
 		return
 	}
@@ -54,7 +74,7 @@ func addSeed_h(c *gin.Context) {
 	})
 }
 
-func updateSeed_h(c *gin.Context) {
+func (s *Server) updateSeed_h(c *gin.Context) {
 	seedID := SeedGUID(c.Param("guid"))
 
 	body, err := io.ReadAll(c.Request.Body)
@@ -67,48 +87,126 @@ func updateSeed_h(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
 		return
 	}
+	if updatedSeed.GetSeedID() != seedID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSeedIDMismatch.Error()})
+		return
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
 
-	existingSeed, exists := seedMap[seedID]
+	existingSeed, exists := s.seeds.Get(seedID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
 		return
 	}
+	if err := s.authorizeSeed(c.Request.Context(), existingSeed, updatedSeed); err != nil {
+		abortAuth(c, err)
+		return
+	}
+	if !ifMatch(c, existingSeed.GetCID()) {
+		preconditionFailed(c, existingSeed.GetCID(), existingSeed)
+		return
+	}
 
 	updatedSeed.SetCID(existingSeed.GetCID())
+	updatedSeed.GetCoreSeed().Version = existingSeed.GetCoreSeed().Version
 	updatedSeed.GetCoreSeed().Timestamp = time.Now()
-	if err := addOrUpdateSeed(c.Request.Context(), updatedSeed, peerID); err != nil {
+	if err := s.addOrUpdateSeed(c.Request.Context(), updatedSeed, peerID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update seed"})
 		return
 	}
 
+	c.Header("ETag", etag(updatedSeed.GetCID()))
 	c.JSON(http.StatusOK, gin.H{
 		"guid": seedID,
 		"cid":  string(updatedSeed.GetCID()),
 	})
 }
 
-func deleteSeed_h(c *gin.Context) {
-	guid := SeedGUID(c.Param("guid"))
+// patchSeed_h changes a seed with a JSON Merge Patch (RFC 7386) or a JSON Patch
+// (RFC 6902). The patched seed must still match the schema of its type.
+func (s *Server) patchSeed_h(c *gin.Context) {
+	seedID := SeedGUID(c.Param("guid"))
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
 
-	seed, exists := seedMap[guid]
+	existingSeed, exists := s.seeds.Get(seedID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
 		return
 	}
+	if !ifMatch(c, existingSeed.GetCID()) {
+		preconditionFailed(c, existingSeed.GetCID(), existingSeed)
+		return
+	}
 
-	if err := network.Remove(c.Request.Context(), seed.GetCID()); err != nil {
-		log.Printf("Failed to remove seed: %v", err)
+	doc, err := entityDocument(existingSeed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode seed"})
+		return
 	}
-	delete(seedMap, guid)
-	delete(seedID2CID, guid)
-	if err := saveSeeds(c.Request.Context()); err != nil {
-		log.Printf("Failed to save seed map: %v", err)
+	doc, err = applyPatch(doc, c.ContentType(), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	if err := checkSeedDocID(seedID, doc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	generator := s.nursery()
+	patchedSeed, err := generator.ValidateSeed(existingSeed, doc)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Invalid seed: %v", err)})
+		return
+	}
+	if err := s.authorizeSeed(c.Request.Context(), existingSeed, patchedSeed); err != nil {
+		abortAuth(c, err)
+		return
+	}
+
+	patchedSeed.SetCID(existingSeed.GetCID())
+	patchedSeed.GetCoreSeed().Timestamp = time.Now()
+	if err := s.addOrUpdateSeed(c.Request.Context(), patchedSeed, peerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update seed"})
+		return
+	}
+
+	c.Header("ETag", etag(patchedSeed.GetCID()))
+	c.JSON(http.StatusOK, patchedSeed)
+}
+
+func (s *Server) deleteSeed_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	guid := SeedGUID(c.Param("guid"))
+
+	if seed, ok := s.seeds.Get(guid); ok {
+		if err := s.authorizeSeed(c.Request.Context(), seed, nil); err != nil {
+			abortAuth(c, err)
+			return
+		}
+	}
+	if _, err := s.removeSeed(c.Request.Context(), guid); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found"})
+		return
+	}
+
+	s.persist(c.Request.Context())
 
 	c.Status(http.StatusNoContent)
 }
 
-func querySeeds_h(c *gin.Context) {
+func (s *Server) querySeeds_h(c *gin.Context) {
 	//	filter := SeedFilter{
 	//		CID:         CID(c.Query("cid")),
 	//		GUID:        SeedGUID(c.Query("guid")),
@@ -128,14 +226,15 @@ func querySeeds_h(c *gin.Context) {
 	//
 	//	seeds := filterSeeds(filter)
 	seeds := []Seed_i{}
-	for _, seed := range seedMap {
+	for _, seed := range s.seeds.Snapshot() {
 		seeds = append(seeds, seed)
 	}
 	c.JSON(http.StatusOK, seeds)
 }
 
-func getSteward_h(c *gin.Context) {
-	stewardSeed, exists := seedMap[stewardID]
+// getSteward_h returns the steward the request acts for
+func (s *Server) getSteward_h(c *gin.Context) {
+	stewardSeed, exists := s.seeds.Get(actingSteward(c.Request.Context()))
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Steward not found"})
 		return
@@ -143,14 +242,33 @@ func getSteward_h(c *gin.Context) {
 	c.JSON(http.StatusOK, stewardSeed)
 }
 
-func updateSteward_h(c *gin.Context) {
+// updateSteward_h replaces the seed of the steward the request acts for. Its
+// energy balance is kept, and so is its public key unless a new one is given.
+func (s *Server) updateSteward_h(c *gin.Context) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
 	var stewardSeed StewardSeed
 	if err := c.BindJSON(&stewardSeed); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid steward data"})
 		return
 	}
+	if stewardSeed.CoreSeed == nil {
+		stewardSeed.CoreSeed = &CoreSeed{}
+	}
+	if stewardSeed.PublicKey != "" {
+		if _, err := parsePublicKey(stewardSeed.PublicKey); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	existingSteward, exists := seedMap[stewardID]
+	guid := actingSteward(c.Request.Context())
+	if stewardSeed.SeedID != "" && stewardSeed.SeedID != guid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSeedIDMismatch.Error()})
+		return
+	}
+	existingSteward, exists := s.seeds.Get(guid)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Steward not found"})
 		return
@@ -158,11 +276,21 @@ func updateSteward_h(c *gin.Context) {
 
 	stewardSeed.CID = existingSteward.GetCID()
 	stewardSeed.ConceptID = StewardConcept
-	stewardSeed.SeedID = stewardID
-	// stewardSeed.EnergyBalance = existingSteward.GetSeedID().AsStewardSeed().EnergyBalance
+	stewardSeed.SeedID = guid
+	stewardSeed.Version = existingSteward.GetCoreSeed().Version
+	if existing, ok := existingSteward.(*StewardSeed); ok {
+		stewardSeed.EnergyBalance = existing.EnergyBalance
+		if stewardSeed.PublicKey == "" {
+			stewardSeed.PublicKey = existing.PublicKey
+		}
+	}
 	stewardSeed.Timestamp = time.Now()
+	if err := s.authorizeSeed(c.Request.Context(), existingSteward, &stewardSeed); err != nil {
+		abortAuth(c, err)
+		return
+	}
 
-	addOrUpdateSeed(c.Request.Context(), &stewardSeed, peerID)
+	s.addOrUpdateSeed(c.Request.Context(), &stewardSeed, peerID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Steward updated successfully", "guid": stewardSeed.SeedID})
 }
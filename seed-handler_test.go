@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestSeedUpdatesKeepTheirSeedID(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	alice := newTestSteward(t, s, "Alice")
+	bob := newTestSteward(t, s, "Bob")
+	_, bobToken, _ := s.auth.createToken(ctx, "bob", bob.SeedID, false)
+
+	aliceBike := NewAssetSeed("Bike", "", alice.SeedID)
+	bobCar := NewAssetSeed("Car", "", bob.SeedID)
+	for _, seed := range []Seed_i{aliceBike, bobCar} {
+		if err := s.addOrUpdateSeed(ctx, seed, peerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	taken := cloneOf(t, aliceBike)
+	taken.StewardID = bob.SeedID
+	impostor := cloneOf(t, alice)
+	impostor.Name = "Bob"
+	repainted := cloneOf(t, bobCar)
+	repainted.Description = "Red"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"PUT of the seed itself", http.MethodPut, "/seed/" + string(bobCar.SeedID), repainted, http.StatusOK},
+		{"PUT with another seed's ID", http.MethodPut, "/seed/" + string(bobCar.SeedID), taken, http.StatusBadRequest},
+		{"PATCH changing the ID", http.MethodPatch, "/seed/" + string(bobCar.SeedID), map[string]any{"SeedID": aliceBike.SeedID}, http.StatusBadRequest},
+		{"PUT /steward with another steward's ID", http.MethodPut, "/steward", impostor, http.StatusBadRequest},
+		{"batch update changing the ID", http.MethodPost, "/batch", map[string]any{"operations": []BatchOperation{
+			batchOp("update", "seed", string(bobCar.SeedID), "", map[string]any{"SeedID": aliceBike.SeedID}),
+		}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, tt.method, tt.path, bobToken, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if seed, _ := s.seeds.Get(aliceBike.SeedID); seed.(*AssetSeed).StewardID != alice.SeedID {
+				t.Error("Bob took Alice's bike")
+			}
+			if seed, _ := s.seeds.Get(alice.SeedID); seed.GetCoreSeed().Name != "Alice" {
+				t.Error("Bob renamed Alice")
+			}
+		})
+	}
+}
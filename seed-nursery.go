@@ -3,9 +3,14 @@ package main
 import (
 	"fmt"
 	"log"
+	"reflect"
 )
 
+// SeedNursery creates and validates seeds; references to other seeds and
+// concepts are checked against its repositories
 type SeedNursery struct {
+	concepts *ConceptRepo
+	seeds    *SeedRepo
 }
 
 // CreateSeed creates a new Seed based on the provided concept type
@@ -49,6 +54,12 @@ func (sf *SeedNursery) createStewardSeed(base *CoreSeed, data map[string]any) (*
 	if energyBalance, ok := data["EnergyBalance"].(float64); ok {
 		seed.EnergyBalance = energyBalance
 	}
+	if publicKey, ok := data["PublicKey"].(string); ok {
+		if _, err := parsePublicKey(publicKey); err != nil {
+			return nil, err
+		}
+		seed.PublicKey = publicKey
+	}
 	return seed, nil
 }
 
@@ -56,7 +67,7 @@ func (sf *SeedNursery) createAssetSeed(base *CoreSeed, data map[string]any) (*As
 	seed := &AssetSeed{CoreSeed: base}
 	if stewardID, ok := data["StewardID"].(string); ok {
 		seed.StewardID = SeedGUID(stewardID)
-		_, exists := seedMap[seed.StewardID]
+		_, exists := sf.seeds.Get(seed.StewardID)
 		if !exists {
 			return nil, fmt.Errorf("asset StewardID invalid: %s", stewardID)
 		}
@@ -108,14 +119,14 @@ func (sf *SeedNursery) createConceptInvestmentSeed(base *CoreSeed, data map[stri
 	seed := &ConceptInvestmentSeed{CoreSeed: base}
 	if investorID, ok := data["InvestorID"].(string); ok {
 		seed.InvestorID = SeedGUID(investorID)
-		_, exists := seedMap[seed.InvestorID]
+		_, exists := sf.seeds.Get(seed.InvestorID)
 		if !exists {
 			return nil, fmt.Errorf("asset InvestorID invalid: %s", investorID)
 		}
 	}
 	if targetID, ok := data["TargetID"].(string); ok {
 		seed.TargetID = ConceptGUID(targetID)
-		_, exists := conceptMap[seed.TargetID]
+		_, exists := sf.concepts.Get(seed.TargetID)
 		if !exists {
 			return nil, fmt.Errorf("asset TargetID invalid: %s", targetID)
 		}
@@ -130,14 +141,14 @@ func (sf *SeedNursery) createSeedInvestmentSeed(base *CoreSeed, data map[string]
 	seed := &SeedInvestmentSeed{CoreSeed: base}
 	if investorID, ok := data["InvestorID"].(string); ok {
 		seed.InvestorID = SeedGUID(investorID)
-		_, exists := seedMap[seed.InvestorID]
+		_, exists := sf.seeds.Get(seed.InvestorID)
 		if !exists {
 			return nil, fmt.Errorf("asset InvestorID invalid: %s", investorID)
 		}
 	}
 	if targetID, ok := data["TargetID"].(string); ok {
 		seed.TargetID = SeedGUID(targetID)
-		_, exists := seedMap[seed.TargetID]
+		_, exists := sf.seeds.Get(seed.TargetID)
 		if !exists {
 			return nil, fmt.Errorf("asset TargetID invalid: %s", targetID)
 		}
@@ -180,7 +191,7 @@ func (sf *SeedNursery) createProposalActionSeed(base *CoreSeed, data map[string]
 	seed := &ProposalAction{CoreSeed: base}
 	if targetID, ok := data["TargetID"].(string); ok {
 		seed.TargetID = ConceptGUID(targetID)
-		_, ok := conceptMap[seed.TargetID]
+		_, ok := sf.concepts.Get(seed.TargetID)
 		if !ok {
 			return nil, fmt.Errorf("TargetID invalid: %s", stewardID)
 		}
@@ -198,14 +209,14 @@ func (sf *SeedNursery) createProposalSeed(base *CoreSeed, data map[string]any) (
 	seed := &Proposal{CoreSeed: base}
 	if stewardID, ok := data["StewardID"].(string); ok {
 		seed.StewardID = SeedGUID(stewardID)
-		_, ok := seedMap[seed.StewardID]
+		_, ok := sf.seeds.Get(seed.StewardID)
 		if !ok {
 			return nil, fmt.Errorf("StewardID invalid: %s", stewardID)
 		}
 	}
 	if actionSeedID, ok := data["ActionSeedID"].(string); ok {
 		seed.ActionSeedID = SeedGUID(actionSeedID)
-		_, ok := seedMap[seed.ActionSeedID]
+		_, ok := sf.seeds.Get(seed.ActionSeedID)
 		if !ok {
 			return nil, fmt.Errorf("ActionSeedID invalid: %s", actionSeedID)
 		}
@@ -221,3 +232,57 @@ func (sf *SeedNursery) createProposalSeed(base *CoreSeed, data map[string]any) (
 	}
 	return seed, nil
 }
+
+// Seed fields that only the server changes: its identity, version chain and the
+// relationship list kept by the relationship endpoints
+var immutableSeedFields = []string{"SeedID", "ConceptID", "Relationships", "PreviousCID", "Version"}
+
+// ValidateSeed checks a changed seed document against the schema of the
+// existing seed's type and returns the seed it describes. Members the type does
+// not have, values of the wrong type and references to unknown seeds or
+// concepts are rejected, as when the seed was created.
+func (sf *SeedNursery) ValidateSeed(existing Seed_i, doc map[string]any) (Seed_i, error) {
+	original, err := entityDocument(existing)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUnchanged(original, doc, immutableSeedFields...); err != nil {
+		return nil, err
+	}
+	if name, _ := doc["Name"].(string); name == "" {
+		return nil, fmt.Errorf("Name is required")
+	}
+
+	value := reflect.New(reflect.TypeOf(existing).Elem())
+	if err := decodeStrict(doc, value.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid %T: %v", existing, err)
+	}
+	seed, ok := value.Interface().(Seed_i)
+	if !ok {
+		return nil, fmt.Errorf("invalid seed type %T", existing)
+	}
+
+	fields := value.Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Type().Field(i)
+		if field.Anonymous {
+			continue
+		}
+		switch ref := fields.Field(i).Interface().(type) {
+		case SeedGUID:
+			if _, exists := sf.seeds.Get(ref); ref != "" && !exists {
+				return nil, fmt.Errorf("%s invalid: %s", field.Name, ref)
+			}
+		case ConceptGUID:
+			if _, exists := sf.concepts.Get(ref); ref != "" && !exists {
+				return nil, fmt.Errorf("%s invalid: %s", field.Name, ref)
+			}
+		}
+	}
+	if steward, ok := seed.(*StewardSeed); ok && steward.PublicKey != "" {
+		if _, err := parsePublicKey(steward.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	return seed, nil
+}
@@ -55,6 +55,8 @@ type CoreSeed struct {
 	Description   string
 	Relationships []RelationshipGUID
 	Timestamp     time.Time
+	PreviousCID   CID `json:",omitempty"` // the version this one replaced
+	Version       int `json:",omitempty"`
 }
 
 func (s *CoreSeed) GetID() EntityGUID     { return EntityGUID(s.SeedID) }
@@ -129,6 +131,7 @@ type RenderAs_i interface {
 type StewardSeed struct {
 	*CoreSeed
 	EnergyBalance float64
+	PublicKey     string `json:",omitempty"` // base64 ed25519 key the steward signs requests with
 }
 
 // Asset represents a valuable item or resource within the network
@@ -221,22 +224,21 @@ func (ci *CoreSeed) GetCoreSeed() *CoreSeed {
 	return ci
 }
 
+// DefaultUpdate stores a new version of the seed that points back at the current
+// one; an unchanged seed keeps its CID
 func (ci *CoreSeed) DefaultUpdate(ctx context.Context, json json.RawMessage) error {
-	// DEBUG: oldCID := ci.CID
-	if ci.CID != "" {
-		network.Remove(ctx, ci.CID)
-		delete(seedMap, ci.SeedID)
-		ci.CID = ""
+	previous := ci.CID
+	data, version, changed, err := nextVersion(ctx, previous, json)
+	if err != nil || !changed {
+		return err
 	}
-	cid, err := network.Add(ctx, strings.NewReader(string(json)))
-	// DEBUG: fmt.Printf("Seed Update: JSON=%s => %s\n", string(json), cid)
+	cid, err := network.Add(ctx, strings.NewReader(string(data)))
 	if err != nil {
 		return err
 	}
 	ci.CID = cid
-	// DEBUG:  if oldCID != "" && ci.CID != oldCID {
-	// DEBUG:    fmt.Printf("Seed [%s] CID %s => %s\n", ci, oldCID, ci.CID)
-	// DEBUG:  }
+	ci.PreviousCID = previous
+	ci.Version = version
 	return nil
 }
 
@@ -244,42 +246,67 @@ func (ci CoreSeed) URI() string {
 	return "ipfs://" + string(ci.CID)
 }
 
-func (id SeedGUID) AsSeed() Seed_i {
-	seed, ok := seedMap[id]
-	if ok {
-		return seed
-	}
-	return nil
-}
-
-func (id SeedGUID) AsStewardSeed() *StewardSeed {
-	seed := id.AsSeed()
-	steward, ok := seed.(*StewardSeed)
-	if ok {
-		return steward
-	}
-	return nil
-}
-
-func addOrUpdateSeed(ctx context.Context, seed Seed_i, pID PeerID) error {
-	if seed.GetCID() != "" {
-		peerMap[pID].RemoveSeedCID(seed.GetCID())
-	}
-
-	if err := seed.Update(ctx); err != nil {
-		log.Printf("Failed to update seed: %v", err)
+func (s *Server) addOrUpdateSeed(ctx context.Context, seed Seed_i, pID PeerID) error {
+	if err := s.storeSeed(ctx, seed, pID); err != nil {
 		return err
 	}
-	seedMap[seed.GetSeedID()] = seed
-	seedID2CID[seed.GetSeedID()] = seed.GetCID()
-	log.Printf("Added/Updated seed: %s\n", seed)
-
-	if err := saveSeeds(ctx); err != nil {
-		log.Printf("Failed to save seed list: %v", err)
-		return err
+	return s.persist(ctx)
+}
+
+// storeSeed adds a new version of the seed to the network and the seed map
+// without saving the map. Like storeConcept, it makes the version again if the
+// seed changed while it was being added.
+func (s *Server) storeSeed(ctx context.Context, seed Seed_i, pID PeerID) error {
+	return s.storeSeedVersion(ctx, seed, pID, true)
+}
+
+// storeSeedLinks is storeSeed for a seed whose relationship list is to be
+// stored as it is, for repairing the list
+func (s *Server) storeSeedLinks(ctx context.Context, seed Seed_i, pID PeerID) error {
+	return s.storeSeedVersion(ctx, seed, pID, false)
+}
+
+func (s *Server) storeSeedVersion(ctx context.Context, seed Seed_i, pID PeerID, keepLinks bool) error {
+	baseCID, baseVersion := seed.GetCID(), seed.GetCoreSeed().Version
+	var oldCID CID
+	for attempt := 1; ; attempt++ {
+		// A replacement object continues the existing seed's version chain and
+		// keeps its relationship list, which only linking and unlinking change
+		existing, _ := s.seeds.Get(seed.GetSeedID())
+		seed.SetCID(baseCID)
+		seed.GetCoreSeed().Version = baseVersion
+		if existing != nil {
+			if baseCID == "" {
+				seed.SetCID(existing.GetCID())
+				seed.GetCoreSeed().Version = existing.GetCoreSeed().Version
+			}
+			if keepLinks {
+				seed.GetCoreSeed().Relationships = existing.GetCoreSeed().Relationships
+			}
+		}
+		oldCID = seed.GetCID()
+		if err := seed.Update(ctx); err != nil {
+			log.Printf("Failed to update seed: %v", err)
+			return err
+		}
+		if s.seeds.Replace(ctx, seed, existing) {
+			if seed.GetCID() != oldCID {
+				journalFrom(ctx).addVersion(seed.GetCID())
+			}
+			break
+		}
+		if attempt == maxStoreAttempts {
+			return fmt.Errorf("seed %s: %w", seed.GetSeedID(), errConcurrentChange)
+		}
 	}
+	log.Printf("Added/Updated seed: %s\n", seed)
 
-	peerMap[pID].AddSeedCID(seed.GetCID())
+	s.peers.Update(ctx, pID, func(peer *Peer) {
+		if oldCID != "" {
+			peer.RemoveSeedCID(oldCID)
+		}
+		peer.AddSeedCID(seed.GetCID())
+	})
 	return nil
 }
 
@@ -298,7 +325,7 @@ func (ci *CoreSeed) AsString() string {
 }
 
 func (ci *CoreSeed) DefaultString() string {
-	return fmt.Sprintf("CID=%s, ID=%s, Concept=%s, [%s]", ci.CID, ci.SeedID, ci.ConceptID.AsConcept().Name, ci.AsString())
+	return fmt.Sprintf("CID=%s, ID=%s, Concept=%s, [%s]", ci.CID, ci.SeedID, ci.ConceptID, ci.AsString())
 }
 
 func (ci *CoreSeed) String() string { return ci.DefaultString() }
@@ -331,7 +358,7 @@ func NewAssetSeed(name string, desc string, steward SeedGUID) *AssetSeed {
 }
 
 func (ci *AssetSeed) String() string {
-	return fmt.Sprintf("%s, Steward=[%s]", ci.DefaultString(), ci.StewardID.AsStewardSeed().AsString())
+	return fmt.Sprintf("%s, Steward=[%s]", ci.DefaultString(), ci.StewardID)
 }
 
 func (i *AssetSeed) Update(ctx context.Context) error {
@@ -379,8 +406,8 @@ func (i *ContractEvaluatorSeed) Update(ctx context.Context) error {
 func (i *ConceptInvestmentSeed) String() string {
 	return fmt.Sprintf("%s, Investor=[%s], Target=[%s], Amount=%f",
 		i.DefaultString(),
-		i.InvestorID.AsStewardSeed().AsString(),
-		i.TargetID.AsConcept(),
+		i.InvestorID,
+		i.TargetID,
 		i.Amount,
 	)
 }
@@ -393,8 +420,8 @@ func (i *ConceptInvestmentSeed) Update(ctx context.Context) error {
 func (i *SeedInvestmentSeed) String() string {
 	return fmt.Sprintf("%s, Investor=[%s], Target=[%s], Amount=%f",
 		i.DefaultString(),
-		i.InvestorID.AsStewardSeed().AsString(),
-		i.TargetID.AsSeed(),
+		i.InvestorID,
+		i.TargetID,
 		i.Amount,
 	)
 }
@@ -435,7 +462,7 @@ func (i *ReturnSeed) Update(ctx context.Context) error {
 func (i *ProposalAction) String() string {
 	return fmt.Sprintf("%s, Target=[%s], Action=[%s], Data=[%s]",
 		i.DefaultString(),
-		i.TargetID.AsConcept().String(),
+		i.TargetID,
 		i.ActionType,
 		i.ActionData,
 	)
@@ -449,8 +476,8 @@ func (i *ProposalAction) Update(ctx context.Context) error {
 func (i *Proposal) String() string {
 	return fmt.Sprintf("%s, Steward=[%s], Action=[%s], For=[%d], Against=[%d], Status=[%s]",
 		i.DefaultString(),
-		i.StewardID.AsStewardSeed().String(),
-		i.ActionSeedID.AsSeed(),
+		i.StewardID,
+		i.ActionSeedID,
 		i.VotesFor,
 		i.VotesAgainst,
 		i.Status,
@@ -545,10 +572,6 @@ func (cim *SeedMap) UnmarshalJSON(data []byte) error {
 			return err
 		}
 		(*cim)[id] = seed
-		cid, ok := seedID2CID[id]
-		if ok {
-			seed.SetCID(cid)
-		}
 	}
 	return nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import "sync"
+
+// Server is a node's state and everything that works on it: the HTTP handlers,
+// the pubsub routine and the CLI commands all go through one
+type Server struct {
+	concepts      *ConceptRepo
+	seeds         *SeedRepo
+	relationships *RelationshipRepo
+	peers         *PeerRepo
+	events        *EventBus
+	webhooks      *WebhookDispatcher
+	auth          *Authenticator
+
+	// updateMu serializes every change to concepts, seeds and relationships:
+	// a writer takes it for the whole of its check and change, so the version
+	// it checked is still current when its change is stored, and a batch's
+	// undo never meets changes made since. Peers are changed without it.
+	updateMu sync.Mutex
+	// persistMu keeps the changes taken by one persist from being written
+	// after those of a later one
+	persistMu sync.Mutex
+
+	// announceCh holds a pending request to publish the peer message
+	announceCh chan struct{}
+	// strangers are the peers on the topic the node has not heard from yet,
+	// as of the last discoverPeers, which alone uses them
+	strangers map[PeerID]bool
+}
+
+func NewServer() *Server {
+	events := NewEventBus()
+	s := &Server{
+		concepts:      NewConceptRepo(events),
+		seeds:         NewSeedRepo(events),
+		relationships: NewRelationshipRepo(events),
+		peers:         NewPeerRepo(events),
+		events:        events,
+		auth:          NewAuthenticator(),
+		announceCh:    make(chan struct{}, 1),
+	}
+	s.webhooks = NewWebhookDispatcher(s)
+	return s
+}
+
+// nursery returns a seed nursery that checks references against this server's state
+func (s *Server) nursery() *SeedNursery {
+	return &SeedNursery{concepts: s.concepts, seeds: s.seeds}
+}
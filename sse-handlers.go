@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+var eventKinds = []string{"concept", "seed", "relationship", "peer"}
+
+// streamEvents_h serves the change events as Server-Sent Events. Each event's
+// id is its sequence number, so a reconnecting EventSource resumes where it
+// stopped through Last-Event-ID.
+func (s *Server) streamEvents_h(c *gin.Context) {
+	topic, err := eventsQueryTopic(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	var since uint64
+	if lastEventID != "" {
+		if since, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Last-Event-ID must be a sequence number"})
+			return
+		}
+	}
+
+	events, missed, seq, resumed := s.events.Subscribe(since)
+	defer s.events.Unsubscribe(events)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	w := c.Writer
+
+	// A client whose events are gone gets the current state instead
+	sub := newStreamSubscription()
+	switch {
+	case resumed:
+		sub.add(topic, since, nil)
+	case since != 0 || c.Query("snapshot") == "true":
+		state := topic.state(s)
+		sub.add(topic, seq, state)
+		if err := writeSSE(w, seq, "snapshot", StreamMessage{Type: "snapshot", Seq: seq, State: state}); err != nil {
+			return
+		}
+	default:
+		sub.add(topic, seq, nil)
+	}
+	for _, event := range missed {
+		if err := sendSSEEvent(w, sub, event); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				log.Printf("Event stream client fell behind")
+				return
+			}
+			if err := sendSSEEvent(w, sub, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// eventsQueryTopic builds the stream's filter from the query: kinds picks the
+// kinds of entity, the parameters of GET /concepts filter concept events, and
+// relationshipType and property filter relationship events, like type and
+// property on the relationship queries.
+// Deletes carry no entity to filter on and are always sent.
+func eventsQueryTopic(c *gin.Context) (*streamTopic, error) {
+	kinds := eventKinds
+	if q := c.Query("kinds"); q != "" {
+		kinds = strings.Split(q, ",")
+		for _, kind := range kinds {
+			if !slices.Contains(eventKinds, kind) {
+				return nil, fmt.Errorf("unknown kind %q; use %s", kind, strings.Join(eventKinds, ", "))
+			}
+		}
+	}
+	conceptFilter, err := conceptFilterQuery(c)
+	if err != nil {
+		return nil, err
+	}
+	relType := ConceptGUID(c.Query("relationshipType"))
+	propertyFilters, err := parsePropertyFilters(c.QueryArray("property"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamTopic{
+		name:  "events",
+		kinds: kinds,
+		match: func(kind string, data any) bool {
+			if !slices.Contains(kinds, kind) {
+				return false
+			}
+			switch entity := data.(type) {
+			case *Concept:
+				return matchesConcept(*entity, conceptFilter)
+			case *Relationship:
+				return (relType == "" || entity.Type == relType) && matchesPropertyFilters(entity, propertyFilters)
+			case Peer_i:
+				return streamedPeer(entity)
+			}
+			return true
+		},
+	}, nil
+}
+
+func sendSSEEvent(w gin.ResponseWriter, sub *streamSubscription, event Event) error {
+	if !sub.wants(event) {
+		return nil
+	}
+	return writeSSE(w, event.Seq, "", event)
+}
+
+// writeSSE writes one event; without a name it is a plain message
+func writeSSE(w gin.ResponseWriter, id uint64, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\n", id)
+	if name != "" {
+		fmt.Fprintf(&b, "event: %s\n", name)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", payload)
+	if _, err := w.WriteString(b.String()); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type localStewardRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	PublicKey   string `json:"publicKey"`
+	Claim       string `json:"claim"` // with a public key: its signature over the claim to run on this node
+}
+
+// listStewards_h lists the stewards this node runs, marking the default one
+func (s *Server) listStewards_h(c *gin.Context) {
+	current := defaultSteward()
+	stewardMu.RLock()
+	locals := append([]LocalSteward(nil), localStewards...)
+	stewardMu.RUnlock()
+
+	stewards := make([]gin.H, 0, len(locals))
+	for _, l := range locals {
+		seed, _ := s.seeds.Get(l.ID)
+		stewards = append(stewards, gin.H{
+			"id":        l.ID,
+			"createdAt": l.CreatedAt,
+			"default":   l.ID == current,
+			"seed":      seed,
+		})
+	}
+	c.JSON(http.StatusOK, stewards)
+}
+
+// createSteward_h adds a steward to the node with an API token of its own,
+// and with a new key pair unless it brings a public key. The token and the
+// private key are in this response only.
+func (s *Server) createSteward_h(c *gin.Context) {
+	var req localStewardRequest
+	if err := c.BindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	steward, privateKey, token, err := s.createLocalSteward(c.Request.Context(), req.Name, req.Description, req.PublicKey, req.Claim)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"steward": steward, "token": token}
+	if privateKey != "" {
+		response["privateKey"] = privateKey
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// setDefaultSteward_h switches the steward the node acts for when a request is
+// not authenticated as one, and with it the steward that has admin rights
+// without being listed in admin_stewards
+func (s *Server) setDefaultSteward_h(c *gin.Context) {
+	var req struct {
+		StewardID SeedGUID `json:"stewardId"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+	err := s.setDefaultSteward(c.Request.Context(), req.StewardID)
+	switch {
+	case errors.Is(err, errForbidden):
+		abortAuth(c, err)
+		return
+	case err != nil:
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Default steward changed", "guid": req.StewardID})
+}
+
+func (s *Server) deleteSteward_h(c *gin.Context) {
+	err := s.removeLocalSteward(c.Request.Context(), SeedGUID(c.Param("guid")))
+	switch {
+	case errors.Is(err, errDefaultSteward):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// setStewardClaim_h stores the claim of the steward the request acts for to
+// run on this node, signed with its key; see stewardClaimMessage
+func (s *Server) setStewardClaim_h(c *gin.Context) {
+	var req struct {
+		Claim string `json:"claim"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+	err := s.setStewardClaim(c.Request.Context(), actingSteward(c.Request.Context()), req.Claim)
+	switch {
+	case errors.Is(err, errInvalidClaim):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Claim stored", "peerId": peerID})
+	}
+}
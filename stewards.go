@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+const localStewardsPath = "/ccn/local-stewards.json"
+
+// LocalSteward is a steward this node runs, one per person using it. Claim
+// proves to other peers that the steward runs here: it is signed with the
+// steward's key over stewardClaimMessage.
+type LocalSteward struct {
+	ID        SeedGUID  `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Claim     string    `json:"claim,omitempty"`
+}
+
+var (
+	// localStewards is guarded by stewardMu, like the default stewardID
+	localStewards []LocalSteward
+
+	errDefaultSteward = errors.New("the default steward cannot be removed")
+	errInvalidClaim   = errors.New("claim is not signed with the steward's key over its claim to run on this node")
+)
+
+// stewardClaimMessage is what a steward signs to claim it runs on a peer. It
+// names the key rather than the steward, so a steward bringing its own key can
+// sign it before the steward exists.
+func stewardClaimMessage(peer PeerID, publicKey string) []byte {
+	return []byte("ccn-steward-claim\n" + string(peer) + "\n" + publicKey)
+}
+
+func signStewardClaim(privateKey ed25519.PrivateKey, publicKey string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, stewardClaimMessage(peerID, publicKey)))
+}
+
+// loadLocalStewards reads the node's stewards; the default steward is always one
+func (s *Server) loadLocalStewards(ctx context.Context) {
+	var stewards []LocalSteward
+	if err := loadData(ctx, localStewardsPath, &stewards); err != nil {
+		log.Printf("No local stewards loaded: %v\n", err)
+	}
+
+	stewardMu.Lock()
+	localStewards = stewards
+	if !slices.ContainsFunc(localStewards, func(l LocalSteward) bool { return l.ID == stewardID }) {
+		localStewards = append(localStewards, LocalSteward{ID: stewardID, CreatedAt: time.Now()})
+	}
+	err := saveData(ctx, localStewardsPath, localStewards)
+	stewardMu.Unlock()
+	if err != nil {
+		log.Printf("Failed to save local stewards: %v", err)
+	}
+	s.claimLocalStewards(ctx)
+	s.syncPeerStewards(ctx)
+}
+
+// claimLocalStewards makes sure each local steward can prove it runs here. A
+// steward without a key gets one, used only to sign the claim; one with a key
+// and no valid claim has to send one to PUT /steward/claim.
+func (s *Server) claimLocalStewards(ctx context.Context) {
+	stewardMu.RLock()
+	locals := slices.Clone(localStewards)
+	stewardMu.RUnlock()
+
+	for _, l := range locals {
+		seed, ok := s.seeds.Get(l.ID)
+		if !ok || verifyStewardClaim(peerID, seed, l.Claim) {
+			continue
+		}
+		steward, _ := seed.(*StewardSeed)
+		if steward == nil || steward.PublicKey != "" {
+			log.Printf("Steward %s has no valid claim to run on this node; peers ignore its changes until one is sent to PUT /steward/claim", l.ID)
+			continue
+		}
+
+		public, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			log.Printf("Failed to generate a key for steward %s: %v", l.ID, err)
+			continue
+		}
+		clone, err := cloneSeed(steward)
+		if err != nil {
+			log.Printf("Failed to give steward %s a key: %v", l.ID, err)
+			continue
+		}
+		keyed := clone.(*StewardSeed)
+		keyed.PublicKey = base64.StdEncoding.EncodeToString(public)
+		keyed.Timestamp = time.Now()
+		if err := s.addOrUpdateSeed(ctx, keyed, peerID); err != nil {
+			log.Printf("Failed to give steward %s a key: %v", l.ID, err)
+			continue
+		}
+		if err := s.storeStewardClaim(ctx, l.ID, signStewardClaim(private, keyed.PublicKey)); err != nil {
+			log.Printf("Failed to save the claim of steward %s: %v", l.ID, err)
+		}
+	}
+}
+
+// localStewardClaims returns the claims the node announces for its stewards
+func localStewardClaims() map[SeedGUID]string {
+	stewardMu.RLock()
+	defer stewardMu.RUnlock()
+	claims := make(map[SeedGUID]string, len(localStewards))
+	for _, l := range localStewards {
+		if l.Claim != "" {
+			claims[l.ID] = l.Claim
+		}
+	}
+	return claims
+}
+
+// setStewardClaim stores a local steward's claim to run on this node and
+// announces it
+func (s *Server) setStewardClaim(ctx context.Context, id SeedGUID, claim string) error {
+	if err := s.storeStewardClaim(ctx, id, claim); err != nil {
+		return err
+	}
+	s.announce()
+	return nil
+}
+
+// storeStewardClaim stores a local steward's claim after checking it against
+// the key in the steward's seed
+func (s *Server) storeStewardClaim(ctx context.Context, id SeedGUID, claim string) error {
+	seed, ok := s.seeds.Get(id)
+	if !ok {
+		return fmt.Errorf("steward %w: %s", errEntityNotFound, id)
+	}
+	if !verifyStewardClaim(peerID, seed, claim) {
+		return errInvalidClaim
+	}
+
+	stewardMu.Lock()
+	i := slices.IndexFunc(localStewards, func(l LocalSteward) bool { return l.ID == id })
+	if i < 0 {
+		stewardMu.Unlock()
+		return fmt.Errorf("local steward %w: %s", errEntityNotFound, id)
+	}
+	previous := localStewards[i].Claim
+	localStewards[i].Claim = claim
+	err := saveData(ctx, localStewardsPath, localStewards)
+	if err != nil {
+		localStewards[i].Claim = previous
+	}
+	stewardMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.announce()
+	return nil
+}
+
+func localStewardIDs() []SeedGUID {
+	stewardMu.RLock()
+	defer stewardMu.RUnlock()
+	ids := make([]SeedGUID, 0, len(localStewards))
+	for _, l := range localStewards {
+		ids = append(ids, l.ID)
+	}
+	return ids
+}
+
+func defaultSteward() SeedGUID {
+	stewardMu.RLock()
+	defer stewardMu.RUnlock()
+	return stewardID
+}
+
+// actingSteward is the steward a request acts for: the one it is
+// authenticated as, or else the node's default steward
+func actingSteward(ctx context.Context) SeedGUID {
+	if p, ok := principalFrom(ctx); ok && p.authenticated() {
+		return p.StewardID
+	}
+	return defaultSteward()
+}
+
+// syncPeerStewards announces the node's stewards in its own peer entry
+func (s *Server) syncPeerStewards(ctx context.Context) {
+	ids := localStewardIDs()
+	s.peers.Update(ctx, peerID, func(peer *Peer) { peer.SetStewardIDs(ids) })
+}
+
+// createLocalSteward adds a steward to the node along with an API token for
+// it. Without a public key a key pair is generated, the node signs the
+// steward's claim to run here with it, and the private key, which the node
+// does not keep, is returned. A steward bringing its key may bring its claim
+// too. The token is issued first, so a steward is only added once it can be
+// used, and revoked again if adding it fails.
+func (s *Server) createLocalSteward(ctx context.Context, name, description, publicKey, claim string) (steward *StewardSeed, privateKey, token string, err error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	if publicKey == "" {
+		public, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, "", "", err
+		}
+		publicKey = base64.StdEncoding.EncodeToString(public)
+		privateKey = base64.StdEncoding.EncodeToString(private)
+		claim = signStewardClaim(private, publicKey)
+	} else if _, err := parsePublicKey(publicKey); err != nil {
+		return nil, "", "", err
+	}
+
+	steward = NewStewardSeed(name, description)
+	steward.PublicKey = publicKey
+	if claim != "" && !verifyStewardClaim(peerID, steward, claim) {
+		return nil, "", "", errInvalidClaim
+	}
+	issued, token, err := s.auth.createToken(ctx, name, steward.SeedID, false)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to issue a token: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if revokeErr := s.auth.revokeToken(ctx, issued.ID); revokeErr != nil {
+			log.Printf("Failed to revoke token %s: %v", issued.ID, revokeErr)
+		}
+	}()
+
+	if err := s.addOrUpdateSeed(ctx, steward, peerID); err != nil {
+		return nil, "", "", err
+	}
+
+	stewardMu.Lock()
+	localStewards = append(localStewards, LocalSteward{ID: steward.SeedID, CreatedAt: time.Now(), Claim: claim})
+	if err = saveData(ctx, localStewardsPath, localStewards); err != nil {
+		localStewards = localStewards[:len(localStewards)-1]
+	}
+	stewardMu.Unlock()
+	if err != nil {
+		return nil, "", "", err
+	}
+	s.syncPeerStewards(ctx)
+	s.persist(ctx)
+	s.announce()
+	return steward, privateKey, token, nil
+}
+
+// setDefaultSteward switches the steward the node acts for by default. The
+// default steward is an admin for signed requests, so this hands admin rights
+// from the previous default to the new one; only an admin may do it.
+func (s *Server) setDefaultSteward(ctx context.Context, id SeedGUID) error {
+	if err := authorizeAdmin(ctx); err != nil {
+		return err
+	}
+	if !slices.Contains(localStewardIDs(), id) {
+		return fmt.Errorf("local steward %w: %s", errEntityNotFound, id)
+	}
+	if err := saveData(ctx, stewardGUIDPath, id); err != nil {
+		return err
+	}
+	stewardMu.Lock()
+	previous := stewardID
+	stewardID = id
+	stewardMu.Unlock()
+	log.Printf("Default steward changed from %s to %s by %s; admin rights moved with it", previous, id, actingSteward(ctx))
+	s.announce()
+	return nil
+}
+
+// removeLocalSteward stops the node running a steward and revokes its tokens.
+// Its seed stays, as the ledger refers to it.
+func (s *Server) removeLocalSteward(ctx context.Context, id SeedGUID) error {
+	stewardMu.Lock()
+	i := slices.IndexFunc(localStewards, func(l LocalSteward) bool { return l.ID == id })
+	switch {
+	case i < 0:
+		stewardMu.Unlock()
+		return fmt.Errorf("local steward %w: %s", errEntityNotFound, id)
+	case id == stewardID:
+		stewardMu.Unlock()
+		return errDefaultSteward
+	}
+	localStewards = slices.Delete(localStewards, i, i+1)
+	err := saveData(ctx, localStewardsPath, localStewards)
+	stewardMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, token := range s.auth.listTokens(id) {
+		if err := s.auth.revokeToken(ctx, token.ID); err != nil {
+			log.Printf("Failed to revoke token %s: %v", token.ID, err)
+		}
+	}
+	s.syncPeerStewards(ctx)
+	s.persist(ctx)
+	s.announce()
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestLocalStewardClaims(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+
+	verified := func(id SeedGUID) bool {
+		seed, _ := s.seeds.Get(id)
+		return verifyStewardClaim(peerID, seed, localStewardClaims()[id])
+	}
+	if !verified(defaultSteward()) {
+		t.Error("the default steward has no valid claim to run on the node")
+	}
+
+	generated, _, _, err := s.createLocalSteward(ctx, "Alice", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified(generated.SeedID) {
+		t.Error("a steward with a generated key has no valid claim")
+	}
+
+	own, ownKey := newKeyedSteward(t, nil, "Bob")
+	if _, _, _, err := s.createLocalSteward(ctx, "Bob", "", own.PublicKey, claimOn("elsewhere", own, ownKey)); !errors.Is(err, errInvalidClaim) {
+		t.Errorf("a claim for another peer was accepted: %v", err)
+	}
+	brought, _, _, err := s.createLocalSteward(ctx, "Bob", "", own.PublicKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified(brought.SeedID) {
+		t.Error("a steward bringing its key has a claim it did not sign")
+	}
+	if err := s.setStewardClaim(ctx, brought.SeedID, claimOn(peerID, brought, ownKey)); err != nil {
+		t.Fatal(err)
+	}
+	if !verified(brought.SeedID) {
+		t.Error("the claim the steward signed was not kept")
+	}
+}
+
+func TestSetDefaultSteward(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+	previous := defaultSteward()
+	alice, _, _, err := s.createLocalSteward(ctx, "Alice", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, aliceToken, _ := s.auth.createToken(ctx, "alice", alice.SeedID, false)
+	_, adminToken, _ := s.auth.createToken(ctx, "admin", previous, true)
+	body := map[string]any{"stewardId": alice.SeedID}
+
+	if w := serve(s, http.MethodPut, "/stewards/default", aliceToken, body); w.Code != http.StatusForbidden {
+		t.Errorf("a steward made itself the default: %d %s", w.Code, w.Body)
+	}
+	if err := s.setDefaultSteward(asSteward(alice.SeedID, false), alice.SeedID); !errors.Is(err, errForbidden) {
+		t.Errorf("setDefaultSteward without admin rights: %v", err)
+	}
+	if defaultSteward() != previous {
+		t.Fatal("the default steward changed")
+	}
+
+	if w := serve(s, http.MethodPut, "/stewards/default", adminToken, body); w.Code != http.StatusOK {
+		t.Fatalf("switching the default: %d %s", w.Code, w.Body)
+	}
+	if defaultSteward() != alice.SeedID {
+		t.Errorf("default steward is %s, want %s", defaultSteward(), alice.SeedID)
+	}
+	if !s.auth.isAdmin(alice.SeedID) || s.auth.isAdmin(previous) {
+		t.Error("admin rights did not move to the new default steward")
+	}
+}
+
+func TestBootstrapTokenNeedsStewardSeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		steward   string
+		wantToken bool
+	}{
+		{"default name", defaultConfig().StewardName, true},
+		{"no name", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestServer(t)
+			ctx := context.Background()
+			stateStore.Close()
+			if err := openStateStore(ctx, t.TempDir(), false); err != nil {
+				t.Fatal(err)
+			}
+			nodeConfig.StewardName = tt.steward
+
+			s := NewServer()
+			s.initializeLists(ctx)
+			if _, ok := s.seeds.Get(defaultSteward()); ok != tt.wantToken {
+				t.Errorf("default steward has a seed: %t, want %t", ok, tt.wantToken)
+			}
+			if got := s.auth.hasTokens(); got != tt.wantToken {
+				t.Errorf("bootstrap token issued: %t, want %t", got, tt.wantToken)
+			}
+		})
+	}
+}
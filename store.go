@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultStoreDir = "ccn-store"
+	storeWALFile    = "wal.log"
+	storeSnapFile   = "snapshot.json"
+	storeLockFile   = "LOCK"
+	maxWALSize      = 4 << 20 // compact once the log grows past this
+)
+
+// Store_i persists the node's state as keyed entries grouped in buckets. Apply
+// is atomic: after a crash either all of its operations are visible or none.
+type Store_i interface {
+	Get(bucket, key string) ([]byte, bool)
+	Keys(bucket string) []string
+	Apply(ops []StoreOp) error
+	Compact() error
+	Close() error
+}
+
+// StoreOp puts Value at Bucket/Key, or removes the key when Delete is set
+type StoreOp struct {
+	Bucket string
+	Key    string
+	Value  []byte `json:",omitempty"`
+	Delete bool   `json:",omitempty"`
+}
+
+var stateStore Store_i
+
+var (
+	errStoreLocked   = errors.New("store is in use by another process")
+	errStoreReadOnly = errors.New("store is open read-only")
+)
+
+// fileStore is an embedded key-value store. The state is kept in memory; every
+// Apply is appended to a write-ahead log and fsynced before it is acknowledged,
+// and Compact folds the log into a snapshot file. A writable store holds an
+// exclusive lock on the directory until it is closed.
+type fileStore struct {
+	mu       sync.RWMutex
+	dir      string
+	buckets  map[string]map[string][]byte
+	wal      *os.File
+	walSize  int64
+	lock     *os.File
+	readOnly bool
+}
+
+// openFileStore loads the snapshot in dir and replays the write-ahead log on top
+// of it. A record torn by a crash is cut off the end of the log. It fails with
+// errStoreLocked while another process has the store open for writing.
+func openFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := lockStore(filepath.Join(dir, storeLockFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &fileStore{dir: dir, buckets: make(map[string]map[string][]byte), lock: lock}
+	if err := s.load(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	s.wal, err = os.OpenFile(filepath.Join(dir, storeWALFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	valid, records, err := s.replay(s.wal)
+	if err != nil {
+		s.wal.Close()
+		lock.Close()
+		return nil, err
+	}
+	if info, err := s.wal.Stat(); err == nil && info.Size() > valid {
+		log.Printf("Store: discarding %d bytes of incomplete log after %d records", info.Size()-valid, records)
+		if err := s.wal.Truncate(valid); err != nil {
+			s.wal.Close()
+			lock.Close()
+			return nil, err
+		}
+	}
+	if _, err := s.wal.Seek(valid, io.SeekStart); err != nil {
+		s.wal.Close()
+		lock.Close()
+		return nil, err
+	}
+	s.walSize = valid
+	return s, nil
+}
+
+// openFileStoreReadOnly loads the store in dir without locking it, so it can be
+// read while a node runs on it. It leaves the files as they are: a record the
+// node is still writing is skipped, and nothing is compacted on Close.
+func openFileStoreReadOnly(dir string) (*fileStore, error) {
+	s := &fileStore{dir: dir, buckets: make(map[string]map[string][]byte), readOnly: true}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	wal, err := os.Open(filepath.Join(dir, storeWALFile))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer wal.Close()
+	if _, _, err := s.replay(wal); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the snapshot, if there is one
+func (s *fileStore) load() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, storeSnapFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.buckets); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+	return nil
+}
+
+// Each log record is one line: the CRC-32 of the JSON payload in hex, a space
+// and the JSON list of operations
+func encodeRecord(ops []StoreOp) ([]byte, error) {
+	payload, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)), nil
+}
+
+func decodeRecord(line []byte) ([]StoreOp, bool) {
+	if len(line) < 10 || line[8] != ' ' || line[len(line)-1] != '\n' {
+		return nil, false
+	}
+	payload := line[9 : len(line)-1]
+	var sum uint32
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &sum); err != nil || sum != crc32.ChecksumIEEE(payload) {
+		return nil, false
+	}
+	var ops []StoreOp
+	if err := json.Unmarshal(payload, &ops); err != nil {
+		return nil, false
+	}
+	return ops, true
+}
+
+// replay applies the log's records and returns the length of its valid prefix
+func (s *fileStore) replay(r io.Reader) (int64, int, error) {
+	reader := bufio.NewReader(r)
+	var valid int64
+	records := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			ops, ok := decodeRecord(line)
+			if !ok {
+				return valid, records, nil
+			}
+			s.apply(ops)
+			valid += int64(len(line))
+			records++
+		}
+		if err == io.EOF {
+			return valid, records, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read log: %v", err)
+		}
+	}
+}
+
+func (s *fileStore) apply(ops []StoreOp) {
+	for _, op := range ops {
+		bucket := s.buckets[op.Bucket]
+		if op.Delete {
+			delete(bucket, op.Key)
+			continue
+		}
+		if bucket == nil {
+			bucket = make(map[string][]byte)
+			s.buckets[op.Bucket] = bucket
+		}
+		bucket[op.Key] = op.Value
+	}
+}
+
+func (s *fileStore) Get(bucket, key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.buckets[bucket][key]
+	return value, ok
+}
+
+func (s *fileStore) Keys(bucket string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *fileStore) Apply(ops []StoreOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	record, err := encodeRecord(ops)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return errStoreReadOnly
+	}
+	if s.wal == nil {
+		return errors.New("store is closed")
+	}
+	if _, err := s.wal.Write(record); err != nil {
+		return fmt.Errorf("failed to append to log: %v", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync log: %v", err)
+	}
+	s.walSize += int64(len(record))
+	s.apply(ops)
+
+	if s.walSize > maxWALSize {
+		if err := s.compact(); err != nil {
+			log.Printf("Failed to compact store: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return errStoreReadOnly
+	}
+	if s.wal == nil {
+		return errors.New("store is closed")
+	}
+	return s.compact()
+}
+
+// compact writes the state to a new snapshot and empties the log. Records are
+// absolute puts and deletes, so if a crash leaves the log in place after the
+// snapshot was renamed, replaying it again is harmless.
+func (s *fileStore) compact() error {
+	data, err := json.Marshal(s.buckets)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, storeSnapFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, storeSnapFile)); err != nil {
+		return err
+	}
+	if dir, err := os.Open(s.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.walSize = 0
+	return s.wal.Sync()
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return nil
+	}
+	err := s.compact()
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	s.wal = nil
+	s.lock.Close()
+	return err
+}
+
+// storeDocument splits a JSON document into the entries it is stored as: the
+// members of an object under "."+name, the elements of an array under "[" and
+// their zero-padded index, or the whole value under the empty key
+func storeDocument(data []byte) (map[string][]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	entries := make(map[string][]byte)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &members); err != nil {
+			return nil, err
+		}
+		for k, v := range members {
+			entries["."+k] = v
+		}
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var elements []json.RawMessage
+		if err := json.Unmarshal(trimmed, &elements); err != nil {
+			return nil, err
+		}
+		for i, v := range elements {
+			entries[fmt.Sprintf("[%08d", i)] = v
+		}
+	}
+	if len(entries) == 0 {
+		entries[""] = trimmed // a scalar, or an empty object or array
+	}
+	return entries, nil
+}
+
+// loadDocument puts a bucket's entries back together into the document
+func loadDocument(store Store_i, bucket string) ([]byte, bool) {
+	keys := store.Keys(bucket)
+	if len(keys) == 0 {
+		return nil, false
+	}
+	if keys[0] == "" {
+		if len(keys) == 1 {
+			value, _ := store.Get(bucket, "")
+			return value, true
+		}
+		keys = keys[1:] // the empty map a member was since added to
+	}
+
+	var buf bytes.Buffer
+	isArray := keys[0][0] == '['
+	if isArray {
+		buf.WriteByte('[')
+	} else {
+		buf.WriteByte('{')
+	}
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, _ := store.Get(bucket, key)
+		if !isArray {
+			name, _ := json.Marshal(key[1:])
+			buf.Write(name)
+			buf.WriteByte(':')
+		}
+		buf.Write(value)
+	}
+	if isArray {
+		buf.WriteByte(']')
+	} else {
+		buf.WriteByte('}')
+	}
+	return buf.Bytes(), true
+}
+
+// documentOps returns the operations that turn the bucket's entries into data,
+// leaving entries that did not change alone
+func documentOps(store Store_i, bucket string, data []byte) ([]StoreOp, error) {
+	entries, err := storeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	var ops []StoreOp
+	for _, key := range store.Keys(bucket) {
+		if _, ok := entries[key]; !ok {
+			ops = append(ops, StoreOp{Bucket: bucket, Key: key, Delete: true})
+		}
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if old, ok := store.Get(bucket, key); !ok || !bytes.Equal(old, entries[key]) {
+			ops = append(ops, StoreOp{Bucket: bucket, Key: key, Value: entries[key]})
+		}
+	}
+	return ops, nil
+}
+
+// memberOp returns the operation that stores value as one member of the map
+// document in bucket, or removes the member if value is nil
+func memberOp(bucket, member string, value any) (StoreOp, error) {
+	if value == nil {
+		return StoreOp{Bucket: bucket, Key: "." + member, Delete: true}, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return StoreOp{}, err
+	}
+	return StoreOp{Bucket: bucket, Key: "." + member, Value: data}, nil
+}
+
+// elementOp returns the operation that stores value as element index of the
+// array document in bucket
+func elementOp(bucket string, index int, value any) (StoreOp, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return StoreOp{}, err
+	}
+	return StoreOp{Bucket: bucket, Key: fmt.Sprintf("[%08d", index), Value: data}, nil
+}
+
+// withMapMarkers adds the empty form of each map document ops writes members of
+// under the empty key, where it is missing, so the map still loads once its
+// last member is removed
+func withMapMarkers(store Store_i, ops []StoreOp) []StoreOp {
+	var markers []StoreOp
+	marked := make(map[string]bool)
+	for _, op := range ops {
+		if marked[op.Bucket] {
+			continue
+		}
+		marked[op.Bucket] = true
+		if _, ok := store.Get(op.Bucket, ""); !ok {
+			markers = append(markers, StoreOp{Bucket: op.Bucket, Key: "", Value: []byte("{}")})
+		}
+	}
+	return append(markers, ops...)
+}
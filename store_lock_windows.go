@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const errorSharingViolation = syscall.Errno(32)
+
+// lockStore opens the store's lock file without sharing it, which keeps other
+// processes from opening it until the returned file is closed or the process
+// exits
+func lockStore(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, errStoreLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func put(bucket, key, value string) StoreOp {
+	return StoreOp{Bucket: bucket, Key: key, Value: []byte(value)}
+}
+
+func del(bucket, key string) StoreOp {
+	return StoreOp{Bucket: bucket, Key: key, Delete: true}
+}
+
+// contents returns every entry of a store as bucket/key -> value
+func contents(s *fileStore) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make(map[string]string)
+	for bucket, entries := range s.buckets {
+		for key, value := range entries {
+			all[bucket+"/"+key] = string(value)
+		}
+	}
+	return all
+}
+
+// crash lets go of a store without compacting it
+func crash(s *fileStore) {
+	s.wal.Close()
+	s.lock.Close()
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]StoreOp
+		torn    string // appended to the log as if a write was cut short
+		want    map[string]string
+	}{
+		{
+			name:    "puts",
+			records: [][]StoreOp{{put("a", ".x", "1")}, {put("a", ".y", "2"), put("b", "", "3")}},
+			want:    map[string]string{"a/.x": "1", "a/.y": "2", "b/": "3"},
+		},
+		{
+			name:    "later records win",
+			records: [][]StoreOp{{put("a", ".x", "1")}, {put("a", ".x", "2")}},
+			want:    map[string]string{"a/.x": "2"},
+		},
+		{
+			name:    "deletes",
+			records: [][]StoreOp{{put("a", ".x", "1"), put("a", ".y", "2")}, {del("a", ".x")}},
+			want:    map[string]string{"a/.y": "2"},
+		},
+		{
+			name:    "torn record dropped",
+			records: [][]StoreOp{{put("a", ".x", "1")}},
+			torn:    `0badc0de [{"Bucket":"a","Key":".y","Val`,
+			want:    map[string]string{"a/.x": "1"},
+		},
+		{
+			name:    "corrupt record dropped",
+			records: [][]StoreOp{{put("a", ".x", "1")}},
+			torn:    "00000000 [{\"Bucket\":\"a\",\"Key\":\".y\",\"Value\":\"Mg==\"}]\n",
+			want:    map[string]string{"a/.x": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := openFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, ops := range tt.records {
+				if err := s.Apply(ops); err != nil {
+					t.Fatal(err)
+				}
+			}
+			crash(s)
+			walPath := filepath.Join(dir, storeWALFile)
+			info, _ := os.Stat(walPath)
+			if tt.torn != "" {
+				f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString(tt.torn)
+				f.Close()
+			}
+
+			reopened, err := openFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			if got := contents(reopened); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+			if after, _ := os.Stat(walPath); after.Size() != info.Size() {
+				t.Errorf("log is %d bytes after replay, want the %d valid ones", after.Size(), info.Size())
+			}
+		})
+	}
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Apply([]StoreOp{put("a", ".x", "1"), put("a", ".y", "2")})
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if s.walSize != 0 {
+		t.Errorf("log is %d bytes after compaction, want 0", s.walSize)
+	}
+	s.Apply([]StoreOp{del("a", ".x")})
+	crash(s)
+
+	reopened, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	want := map[string]string{"a/.y": "2"}
+	if got := contents(reopened); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened %v, want %v", got, want)
+	}
+}
+
+func TestDocumentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		keys []string
+	}{
+		{"object", `{"a":1,"b":{"c":[1,2]}}`, []string{".a", ".b"}},
+		{"array", `[{"x":1},"y",3]`, []string{"[00000000", "[00000001", "[00000002"}},
+		{"scalar", `"guid"`, []string{""}},
+		{"empty object", `{}`, []string{""}},
+		{"empty array", `[]`, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := openFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			ops, err := documentOps(s, "doc", []byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Apply(ops)
+			if got := s.Keys("doc"); !reflect.DeepEqual(got, tt.keys) {
+				t.Errorf("keys %v, want %v", got, tt.keys)
+			}
+			data, ok := loadDocument(s, "doc")
+			if !ok {
+				t.Fatal("document not found")
+			}
+			assertSameJSON(t, string(data), tt.doc)
+		})
+	}
+}
+
+func TestDocumentOpsOnlyWritesChanges(t *testing.T) {
+	s, err := openFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ops, _ := documentOps(s, "doc", []byte(`{"a":1,"b":2}`))
+	s.Apply(ops)
+
+	ops, _ = documentOps(s, "doc", []byte(`{"a":1,"c":3}`))
+	want := []StoreOp{del("doc", ".b"), put("doc", ".c", "3")}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops %+v, want %+v", ops, want)
+	}
+}
+
+func TestMemberOps(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(s Store_i) []StoreOp
+		want string
+	}{
+		{
+			name: "first member gets a marker",
+			ops: func(s Store_i) []StoreOp {
+				op, _ := memberOp("map", "a", 1)
+				return withMapMarkers(s, []StoreOp{op})
+			},
+			want: `{"a":1}`,
+		},
+		{
+			name: "removing the last member leaves an empty map",
+			ops: func(s Store_i) []StoreOp {
+				op, _ := memberOp("map", "a", 1)
+				s.Apply(withMapMarkers(s, []StoreOp{op}))
+				op, _ = memberOp("map", "a", nil)
+				return withMapMarkers(s, []StoreOp{op})
+			},
+			want: `{}`,
+		},
+		{
+			name: "elements append to an empty array",
+			ops: func(s Store_i) []StoreOp {
+				ops, _ := documentOps(s, "map", []byte(`[]`))
+				s.Apply(ops)
+				first, _ := elementOp("map", 0, "x")
+				second, _ := elementOp("map", 1, "y")
+				return []StoreOp{first, second}
+			},
+			want: `["x","y"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := openFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := s.Apply(tt.ops(s)); err != nil {
+				t.Fatal(err)
+			}
+			data, ok := loadDocument(s, "map")
+			if !ok {
+				t.Fatal("document not found")
+			}
+			assertSameJSON(t, string(data), tt.want)
+		})
+	}
+}
+
+func assertSameJSON(t *testing.T, got, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	json.Unmarshal([]byte(want), &w)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir := t.TempDir()
+	node, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Apply([]StoreOp{put("a", ".x", "1")})
+
+	if _, err := openFileStore(dir); !errors.Is(err, errStoreLocked) {
+		t.Fatalf("second writer opened the store: %v", err)
+	}
+
+	reader, err := openFileStoreReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := contents(reader), map[string]string{"a/.x": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reader sees %v, want %v", got, want)
+	}
+	if err := reader.Apply([]StoreOp{put("a", ".z", "3")}); !errors.Is(err, errStoreReadOnly) {
+		t.Errorf("reader wrote to the store: %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader closing must leave the node's log alone
+	if err := node.Apply([]StoreOp{put("a", ".y", "2")}); err != nil {
+		t.Fatal(err)
+	}
+	node.Close()
+	reopened, err := openFileStore(dir)
+	if err != nil {
+		t.Fatalf("store still locked after the node closed it: %v", err)
+	}
+	defer reopened.Close()
+	if got, want := contents(reopened), map[string]string{"a/.x": "1", "a/.y": "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened %v, want %v", got, want)
+	}
+}
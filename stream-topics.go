@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// streamTopic selects the entities a stream client subscribed to. match gets
+// an event's kind and the entity after the change, or nil for a delete.
+type streamTopic struct {
+	name  string
+	kinds []string // the kinds of entity the topic can select
+	match func(kind string, data any) bool
+}
+
+// parseTopic reads a topic name:
+//
+//	concepts, seeds, relationships, peers  every entity of the kind
+//	concept-type:<type>                    concepts of a ConceptType
+//	seed:<guid>                            a seed and its relationships
+//	transactions:<steward guid>            transactions from or to a steward
+//	relationship-type:<type guid>          relationships of a type
+func parseTopic(name string) (*streamTopic, error) {
+	topic := &streamTopic{name: name}
+	prefix, arg, hasArg := strings.Cut(name, ":")
+	if hasArg && arg == "" {
+		return nil, fmt.Errorf("topic %q needs a value after the colon", name)
+	}
+
+	switch {
+	case !hasArg && (prefix == "concepts" || prefix == "seeds" || prefix == "relationships" || prefix == "peers"):
+		kind := strings.TrimSuffix(prefix, "s")
+		topic.kinds = []string{kind}
+		topic.match = func(k string, data any) bool {
+			if peer, ok := data.(Peer_i); ok && !streamedPeer(peer) {
+				return false
+			}
+			return k == kind
+		}
+
+	case prefix == "concept-type":
+		topic.kinds = []string{"concept"}
+		topic.match = func(kind string, data any) bool {
+			concept, ok := data.(*Concept)
+			return ok && concept.ConceptType == arg
+		}
+
+	case prefix == "seed":
+		id := EntityGUID(arg)
+		topic.kinds = []string{"seed", "relationship"}
+		topic.match = func(kind string, data any) bool {
+			switch entity := data.(type) {
+			case Seed_i:
+				return entity.GetID() == id
+			case *Relationship:
+				return entity.SourceID == id || entity.TargetID == id
+			}
+			return false
+		}
+
+	case prefix == "transactions":
+		steward := SeedGUID(arg)
+		topic.kinds = []string{"seed"}
+		topic.match = func(kind string, data any) bool {
+			transaction, ok := data.(*TransactionSeed)
+			return ok && (transaction.FromSteward == steward || transaction.ToSteward == steward)
+		}
+
+	case prefix == "relationship-type":
+		relType := ConceptGUID(arg)
+		topic.kinds = []string{"relationship"}
+		topic.match = func(kind string, data any) bool {
+			relationship, ok := data.(*Relationship)
+			return ok && relationship.Type == relType
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown topic %q", name)
+	}
+	return topic, nil
+}
+
+// streamedPeer leaves out peers without a steward, as the peer list always has
+func streamedPeer(peer Peer_i) bool {
+	return len(peer.GetStewardIDs()) > 0
+}
+
+// state returns the entities the topic selects now, by kind, in the form of a
+// snapshot message's state
+func (t *streamTopic) state(s *Server) map[string]any {
+	state := make(map[string]any)
+	for _, kind := range t.kinds {
+		switch kind {
+		case "concept":
+			concepts := make(ConceptMap)
+			for id, concept := range s.concepts.Snapshot() {
+				if t.match(kind, concept) {
+					concepts[id] = concept
+				}
+			}
+			state["concepts"] = concepts
+		case "seed":
+			seeds := make(SeedMap)
+			for id, seed := range s.seeds.Snapshot() {
+				if t.match(kind, seed) {
+					seeds[id] = seed
+				}
+			}
+			state["seeds"] = seeds
+		case "relationship":
+			relationships := make(RelationshipMap)
+			for _, relationship := range s.relationships.Select(func(r *Relationship) bool { return t.match(kind, r) }) {
+				relationships[relationship.ID] = relationship
+			}
+			state["relationships"] = relationships
+		case "peer":
+			peers := make(PeerMap)
+			for id, peer := range s.peers.Snapshot() {
+				if t.match(kind, peer) {
+					peers[id] = peer
+				}
+			}
+			state["peers"] = peers
+		}
+	}
+	return state
+}
+
+// streamSubscription is the set of topics one client follows
+type streamSubscription struct {
+	topics map[string]*streamTopic
+	// since holds, per topic, the last event its snapshot already includes
+	since map[string]uint64
+	// sent holds the entities the client was sent, as kind/id, so it also hears
+	// when one of them is deleted or no longer matches
+	sent map[string]bool
+}
+
+func newStreamSubscription() *streamSubscription {
+	return &streamSubscription{
+		topics: make(map[string]*streamTopic),
+		since:  make(map[string]uint64),
+		sent:   make(map[string]bool),
+	}
+}
+
+// add subscribes to a topic whose snapshot reflects every event up to seq
+func (sub *streamSubscription) add(topic *streamTopic, seq uint64, state map[string]any) {
+	sub.topics[topic.name] = topic
+	sub.since[topic.name] = seq
+	for plural, entities := range state {
+		kind := strings.TrimSuffix(plural, "s")
+		switch entities := entities.(type) {
+		case ConceptMap:
+			for id := range entities {
+				sub.sent[kind+"/"+string(id)] = true
+			}
+		case SeedMap:
+			for id := range entities {
+				sub.sent[kind+"/"+string(id)] = true
+			}
+		case RelationshipMap:
+			for id := range entities {
+				sub.sent[kind+"/"+string(id)] = true
+			}
+		case PeerMap:
+			for id := range entities {
+				sub.sent[kind+"/"+string(id)] = true
+			}
+		}
+	}
+}
+
+func (sub *streamSubscription) remove(name string) bool {
+	if _, ok := sub.topics[name]; !ok {
+		return false
+	}
+	delete(sub.topics, name)
+	delete(sub.since, name)
+	return true
+}
+
+// wants reports whether the client should be sent an event
+func (sub *streamSubscription) wants(event Event) bool {
+	key := event.Kind + "/" + event.ID
+	matched, covered := false, false
+	for name, topic := range sub.topics {
+		if !topic.match(event.Kind, event.Data) {
+			continue
+		}
+		if event.Seq > sub.since[name] {
+			matched = true
+			break
+		}
+		covered = true
+	}
+
+	switch {
+	case matched:
+		if event.Op == eventDeleted {
+			delete(sub.sent, key)
+		} else {
+			sub.sent[key] = true
+		}
+		return true
+	case covered:
+		return false // the topic's snapshot already has this change or a later one
+	case sub.sent[key]:
+		// Deleted, or changed so that no topic selects it any more
+		delete(sub.sent, key)
+		return true
+	}
+	return false
+}
+
+// mergeState adds the entities of one topic's state to another
+func mergeState(into, from map[string]any) {
+	for plural, entities := range from {
+		existing, ok := into[plural]
+		if !ok {
+			into[plural] = entities
+			continue
+		}
+		switch existing := existing.(type) {
+		case ConceptMap:
+			for id, e := range entities.(ConceptMap) {
+				existing[id] = e
+			}
+		case SeedMap:
+			for id, e := range entities.(SeedMap) {
+				existing[id] = e
+			}
+		case RelationshipMap:
+			for id, e := range entities.(RelationshipMap) {
+				existing[id] = e
+			}
+		case PeerMap:
+			for id, e := range entities.(PeerMap) {
+				existing[id] = e
+			}
+		}
+	}
+}
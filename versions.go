@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Fields that chain the versions of a concept or seed; they are left out when
+// deciding whether an update changed anything
+var versionFields = []string{"PreviousCID", "Version"}
+
+// VersionInfo describes one version in an entity's history
+type VersionInfo struct {
+	CID         CID
+	Version     int
+	PreviousCID CID `json:",omitempty"`
+	Timestamp   time.Time
+}
+
+// FieldChange is one difference between two versions; Field is a dotted path
+type FieldChange struct {
+	Field string
+	From  any `json:",omitempty"`
+	To    any `json:",omitempty"`
+}
+
+func loadVersion(ctx context.Context, cid CID) (map[string]any, error) {
+	r, err := network.Get(ctx, cid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %s: %v", cid, err)
+	}
+	defer r.Close()
+
+	var content map[string]any
+	if err := json.NewDecoder(r).Decode(&content); err != nil {
+		return nil, fmt.Errorf("failed to decode version %s: %v", cid, err)
+	}
+	return content, nil
+}
+
+func versionInfo(cid CID, content map[string]any) VersionInfo {
+	info := VersionInfo{CID: cid}
+	if v, ok := content["Version"].(float64); ok {
+		info.Version = int(v)
+	}
+	if prev, ok := content["PreviousCID"].(string); ok {
+		info.PreviousCID = CID(prev)
+	}
+	if ts, ok := content["Timestamp"].(string); ok {
+		info.Timestamp, _ = time.Parse(time.RFC3339Nano, ts)
+	}
+	return info
+}
+
+func withoutVersionFields(content map[string]any) map[string]any {
+	stripped := make(map[string]any, len(content))
+	for k, v := range content {
+		stripped[k] = v
+	}
+	for _, field := range versionFields {
+		delete(stripped, field)
+	}
+	return stripped
+}
+
+// nextVersion compares an entity's new content with the version stored at
+// previous, its current CID. It reports whether anything changed and, if so,
+// returns the content with the version fields pointing back at previous.
+func nextVersion(ctx context.Context, previous CID, data []byte) ([]byte, int, bool, error) {
+	var content map[string]any
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, 0, false, err
+	}
+
+	version := 1
+	if previous != "" {
+		if old, err := loadVersion(ctx, previous); err == nil &&
+			reflect.DeepEqual(withoutVersionFields(old), withoutVersionFields(content)) {
+			return data, 0, false, nil
+		}
+		if current, ok := content["Version"].(float64); ok {
+			version = int(current) + 1
+		}
+		content["PreviousCID"] = previous
+	}
+	content["Version"] = version
+
+	versioned, err := json.Marshal(content)
+	return versioned, version, true, err
+}
+
+// versionHistory follows the PreviousCID chain from cid, newest version first
+func versionHistory(ctx context.Context, cid CID) ([]VersionInfo, error) {
+	var history []VersionInfo
+	seen := make(map[CID]bool)
+	for cid != "" && !seen[cid] {
+		seen[cid] = true
+		content, err := loadVersion(ctx, cid)
+		if err != nil {
+			if len(history) == 0 {
+				return nil, err
+			}
+			// Older versions may not be available on this node
+			break
+		}
+		info := versionInfo(cid, content)
+		history = append(history, info)
+		cid = info.PreviousCID
+	}
+	return history, nil
+}
+
+// inHistory reports whether cid is one of the versions reachable from head
+func inHistory(ctx context.Context, head, cid CID) bool {
+	history, err := versionHistory(ctx, head)
+	if err != nil {
+		return false
+	}
+	for _, info := range history {
+		if info.CID == cid {
+			return true
+		}
+	}
+	return false
+}
+
+// diffVersions lists the fields that differ between two versions
+func diffVersions(ctx context.Context, from, to CID) ([]FieldChange, error) {
+	a, err := loadVersion(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := loadVersion(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	changes := []FieldChange{}
+	diffValues("", withoutVersionFields(a), withoutVersionFields(b), &changes)
+	return changes, nil
+}
+
+func diffValues(path string, a, b any, changes *[]FieldChange) {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if !aok || !bok {
+		if !reflect.DeepEqual(a, b) {
+			*changes = append(*changes, FieldChange{Field: path, From: a, To: b})
+		}
+		return
+	}
+
+	keys := make(map[string]bool)
+	for k := range am {
+		keys[k] = true
+	}
+	for k := range bm {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		field := k
+		if path != "" {
+			field = path + "." + k
+		}
+		diffValues(field, am[k], bm[k], changes)
+	}
+}
+
+// unpinHistory unpins every version of an entity that is being deleted
+func unpinHistory(ctx context.Context, cid CID) {
+	history, err := versionHistory(ctx, cid)
+	if err != nil {
+		history = []VersionInfo{{CID: cid}}
+	}
+	for _, info := range history {
+		network.Remove(ctx, info.CID)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookRequest is the body of POST /webhooks and PUT /webhooks/:id. Active
+// defaults to true.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Filter string   `json:"filter"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
+
+func (req webhookRequest) webhook() Webhook {
+	return Webhook{
+		URL:    req.URL,
+		Events: req.Events,
+		Filter: req.Filter,
+		Secret: req.Secret,
+		Active: req.Active == nil || *req.Active,
+	}
+}
+
+// entityErrorStatus reports an error of a lookup by ID: 404 if nothing has it
+func entityErrorStatus(err error) int {
+	if errors.Is(err, errEntityNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// registerWebhook_h adds a webhook. The response is the only one that shows
+// the secret deliveries are signed with.
+func (s *Server) registerWebhook_h(c *gin.Context) {
+	var req webhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+	hook := req.webhook()
+	if _, err := hook.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	registered, err := s.webhooks.register(c.Request.Context(), hook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, registered)
+}
+
+func (s *Server) listWebhooks_h(c *gin.Context) {
+	c.JSON(http.StatusOK, s.webhooks.list())
+}
+
+func (s *Server) getWebhook_h(c *gin.Context) {
+	hook, ok := s.webhooks.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, hook.public())
+}
+
+// updateWebhook_h replaces a webhook's registration; without a secret the
+// current one is kept
+func (s *Server) updateWebhook_h(c *gin.Context) {
+	var req webhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return
+	}
+	hook := req.webhook()
+	if _, err := hook.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	replaced, err := s.webhooks.replace(c.Request.Context(), c.Param("id"), hook)
+	if err != nil {
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, replaced.public())
+}
+
+func (s *Server) deleteWebhook_h(c *gin.Context) {
+	if err := s.webhooks.remove(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getWebhookDeliveries_h returns the latest delivery attempts of a webhook
+func (s *Server) getWebhookDeliveries_h(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := s.webhooks.get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, s.webhooks.deliveriesOf(id))
+}
+
+func (s *Server) listDeadLetters_h(c *gin.Context) {
+	c.JSON(http.StatusOK, s.webhooks.listDeadLetters())
+}
+
+// retryDeadLetter_h delivers a dead letter again, with a new round of attempts
+func (s *Server) retryDeadLetter_h(c *gin.Context) {
+	err := s.webhooks.retryDeadLetter(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, errWebhookQueueFull) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
+
+func (s *Server) deleteDeadLetter_h(c *gin.Context) {
+	if err := s.webhooks.removeDeadLetter(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(entityErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
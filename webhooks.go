@@ -0,0 +1,672 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webhooksPath           = "/ccn/webhooks.json"
+	webhookDeadLettersPath = "/ccn/webhook-dead-letters.json"
+
+	webhookWorkers         = 4
+	webhookQueueSize       = 1024
+	webhookTimeout         = 10 * time.Second
+	webhookMaxAttempts     = 8
+	webhookInitialDelay    = 2 * time.Second
+	webhookMaxDelay        = 10 * time.Minute
+	webhookDeliveryLog     = 500 // attempts kept for GET /webhooks/:id/deliveries
+	webhookDeadLetterLimit = 1000
+	webhookDeadLetterAge   = 7 * 24 * time.Hour // dead letters older than this are dropped
+	webhookSignatureHeader = "X-CCN-Signature"
+	webhookTimestampHeader = "X-CCN-Timestamp"
+)
+
+var errWebhookQueueFull = errors.New("the webhook delivery queue is full")
+
+// webhookEventTypes are the events a webhook can ask for. Transactions are seeds
+// of the Transaction concept; proposal.status fires when a proposal's Status
+// changes, including when one is created with a status.
+var webhookEventTypes = []string{
+	"concept.created", "concept.updated", "concept.deleted",
+	"seed.created", "seed.updated", "seed.deleted",
+	"relationship.created", "relationship.updated", "relationship.deleted",
+	"transaction.created", "transaction.updated", "transaction.deleted",
+	"proposal.status",
+}
+
+// Webhook is a registration for HMAC-signed deliveries of events. Events holds
+// event types, or patterns like "seed.*"; empty means all. Filter is a stream
+// topic (see the WebSocket protocol) the changed entity has to match.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"`
+	Filter    string    `json:"filter,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookPayload is the JSON body of a delivery
+type WebhookPayload struct {
+	ID             string    `json:"id"` // the same on every attempt
+	Type           string    `json:"type"`
+	WebhookID      string    `json:"webhookId"`
+	Timestamp      time.Time `json:"timestamp"`
+	Event          Event     `json:"event"`
+	PreviousStatus string    `json:"previousStatus,omitempty"` // for proposal.status
+}
+
+// WebhookDelivery records one attempt to deliver a payload
+type WebhookDelivery struct {
+	DeliveryID   string        `json:"deliveryId"`
+	WebhookID    string        `json:"webhookId"`
+	Type         string        `json:"type"`
+	Seq          uint64        `json:"seq"`
+	Attempt      int           `json:"attempt"`
+	Status       string        `json:"status"` // delivered, retrying or dead
+	ResponseCode int           `json:"responseCode,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Duration     time.Duration `json:"duration"`
+	Timestamp    time.Time     `json:"timestamp"`
+}
+
+// DeadLetter is a payload whose attempts all failed. It can be retried.
+type DeadLetter struct {
+	Payload   WebhookPayload `json:"payload"`
+	Attempts  int            `json:"attempts"`
+	LastError string         `json:"lastError"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+type pendingDelivery struct {
+	payload WebhookPayload
+	body    []byte
+	attempt int
+}
+
+// webhookState is a registered webhook with its parsed filter
+type webhookState struct {
+	hook  *Webhook
+	topic *streamTopic
+	sub   *streamSubscription // tracks what passed the filter, so deletes do too
+}
+
+// WebhookDispatcher turns the events on the bus into webhook deliveries
+type WebhookDispatcher struct {
+	server *Server
+	client *http.Client
+	queue  chan *pendingDelivery
+
+	mu          sync.Mutex
+	hooks       map[string]*webhookState
+	deliveries  []WebhookDelivery // the latest attempts, oldest first
+	deadLetters map[string]*DeadLetter
+
+	// deadLettersMu keeps a save of the dead letters from being written after
+	// a later one; the saves happen without holding mu
+	deadLettersMu sync.Mutex
+
+	// What the dispatcher knows of the seeds, to tell transactions and proposal
+	// status changes apart, deletes included
+	seedConcepts   map[string]ConceptGUID
+	proposalStatus map[string]string
+}
+
+func NewWebhookDispatcher(s *Server) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		server:         s,
+		client:         &http.Client{Timeout: webhookTimeout},
+		queue:          make(chan *pendingDelivery, webhookQueueSize),
+		hooks:          make(map[string]*webhookState),
+		deadLetters:    make(map[string]*DeadLetter),
+		seedConcepts:   make(map[string]ConceptGUID),
+		proposalStatus: make(map[string]string),
+	}
+}
+
+// validate checks a registration and parses its filter
+func (hook *Webhook) validate() (*streamTopic, error) {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, pattern := range hook.Events {
+		if !slices.ContainsFunc(webhookEventTypes, func(t string) bool { return matchesEventType(pattern, t) }) {
+			return nil, fmt.Errorf("unknown event type %q", pattern)
+		}
+	}
+	if hook.Filter == "" {
+		return nil, nil
+	}
+	return parseTopic(hook.Filter)
+}
+
+// matchesEventType matches an event type against "*", "<prefix>.*" or a type
+func matchesEventType(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, ".*")
+	return ok && strings.HasPrefix(eventType, prefix+".")
+}
+
+func (hook *Webhook) wants(eventType string) bool {
+	return len(hook.Events) == 0 || slices.ContainsFunc(hook.Events, func(p string) bool { return matchesEventType(p, eventType) })
+}
+
+// public is the webhook as the API shows it, without its secret
+func (hook Webhook) public() Webhook {
+	hook.Secret = ""
+	return hook
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (d *WebhookDispatcher) newState(hook *Webhook, topic *streamTopic) *webhookState {
+	state := &webhookState{hook: hook, topic: topic}
+	if topic != nil {
+		state.sub = newStreamSubscription()
+		state.sub.add(topic, 0, topic.state(d.server))
+	}
+	return state
+}
+
+// load reads the registrations and dead letters
+func (d *WebhookDispatcher) load(ctx context.Context) {
+	var hooks []*Webhook
+	if err := loadData(ctx, webhooksPath, &hooks); err != nil {
+		log.Printf("No webhooks loaded: %v\n", err)
+	}
+	var deadLetters map[string]*DeadLetter
+	if err := loadData(ctx, webhookDeadLettersPath, &deadLetters); err != nil {
+		deadLetters = make(map[string]*DeadLetter)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, hook := range hooks {
+		topic, err := hook.validate()
+		if err != nil {
+			log.Printf("Skipping webhook %s: %v", hook.ID, err)
+			continue
+		}
+		d.hooks[hook.ID] = d.newState(hook, topic)
+	}
+	d.deadLetters = deadLetters
+	d.pruneDeadLetters(time.Now())
+	for id, seed := range d.server.seeds.Snapshot() {
+		d.noteSeed(string(id), seed)
+	}
+}
+
+// save writes the registrations; the caller holds d.mu
+func (d *WebhookDispatcher) save(ctx context.Context) error {
+	hooks := make([]*Webhook, 0, len(d.hooks))
+	for _, state := range d.hooks {
+		hooks = append(hooks, state.hook)
+	}
+	slices.SortFunc(hooks, func(a, b *Webhook) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return saveData(ctx, webhooksPath, hooks)
+}
+
+// saveDeadLetters writes the dead letters; the caller does not hold d.mu
+func (d *WebhookDispatcher) saveDeadLetters(ctx context.Context) {
+	d.deadLettersMu.Lock()
+	defer d.deadLettersMu.Unlock()
+	d.mu.Lock()
+	letters := maps.Clone(d.deadLetters)
+	d.mu.Unlock()
+	if err := saveData(ctx, webhookDeadLettersPath, letters); err != nil {
+		log.Printf("Failed to save webhook dead letters: %v", err)
+	}
+}
+
+// pruneDeadLetters drops the dead letters past webhookDeadLetterAge and then
+// the oldest beyond webhookDeadLetterLimit; the caller holds d.mu
+func (d *WebhookDispatcher) pruneDeadLetters(now time.Time) {
+	dropped := 0
+	for id, letter := range d.deadLetters {
+		if now.Sub(letter.Timestamp) > webhookDeadLetterAge {
+			delete(d.deadLetters, id)
+			dropped++
+		}
+	}
+	if excess := len(d.deadLetters) - webhookDeadLetterLimit; excess > 0 {
+		letters := make([]*DeadLetter, 0, len(d.deadLetters))
+		for _, letter := range d.deadLetters {
+			letters = append(letters, letter)
+		}
+		slices.SortFunc(letters, func(a, b *DeadLetter) int { return a.Timestamp.Compare(b.Timestamp) })
+		for _, letter := range letters[:excess] {
+			delete(d.deadLetters, letter.Payload.ID)
+		}
+		dropped += excess
+	}
+	if dropped > 0 {
+		log.Printf("Dropped %d webhook dead letters", dropped)
+	}
+}
+
+// Run delivers events until ctx ends
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	for i := 0; i < webhookWorkers; i++ {
+		go d.worker(ctx)
+	}
+
+	var since uint64
+	for ctx.Err() == nil {
+		events, missed, seq, resumed := d.server.events.Subscribe(since)
+		if since != 0 && !resumed {
+			log.Printf("Webhooks missed the events after %d", since)
+		}
+		since = seq
+		for _, event := range missed {
+			d.dispatch(event)
+			since = event.Seq
+		}
+		for open := true; open; {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					open = false // fell behind; resume from the last event handled
+					break
+				}
+				d.dispatch(event)
+				since = event.Seq
+			case <-ctx.Done():
+				d.server.events.Unsubscribe(events)
+				return
+			}
+		}
+	}
+}
+
+// dispatch queues a delivery of the event to each webhook that wants it
+func (d *WebhookDispatcher) dispatch(event Event) {
+	if event.Kind == "peer" {
+		return
+	}
+	d.mu.Lock()
+	types, previousStatus := d.eventTypes(event)
+	var pending []*pendingDelivery
+	for _, state := range d.hooks {
+		if state.sub != nil && !state.sub.wants(event) {
+			continue
+		}
+		for _, eventType := range types {
+			if !state.hook.Active || !state.hook.wants(eventType) {
+				continue
+			}
+			payload := WebhookPayload{
+				ID:        uuid.New().String(),
+				Type:      eventType,
+				WebhookID: state.hook.ID,
+				Timestamp: time.Now(),
+				Event:     event,
+			}
+			if eventType == "proposal.status" {
+				payload.PreviousStatus = previousStatus
+			}
+			body, err := json.Marshal(payload)
+			if err != nil {
+				log.Printf("Failed to encode webhook payload: %v", err)
+				continue
+			}
+			pending = append(pending, &pendingDelivery{payload: payload, body: body})
+		}
+	}
+	d.mu.Unlock()
+
+	for _, p := range pending {
+		d.enqueue(context.Background(), p)
+	}
+}
+
+// enqueue queues a delivery without waiting; when the queue is full the
+// delivery goes to the dead letters, to be retried later
+func (d *WebhookDispatcher) enqueue(ctx context.Context, p *pendingDelivery) {
+	select {
+	case d.queue <- p:
+	default:
+		d.mu.Lock()
+		d.addDeadLetter(p, errWebhookQueueFull.Error())
+		d.mu.Unlock()
+		d.saveDeadLetters(ctx)
+	}
+}
+
+// addDeadLetter gives up on a delivery; the caller holds d.mu and saves the
+// dead letters once it lets go of it
+func (d *WebhookDispatcher) addDeadLetter(p *pendingDelivery, reason string) {
+	now := time.Now()
+	d.deadLetters[p.payload.ID] = &DeadLetter{
+		Payload:   p.payload,
+		Attempts:  p.attempt,
+		LastError: reason,
+		Timestamp: now,
+	}
+	d.pruneDeadLetters(now)
+	log.Printf("Webhook %s: giving up on delivery %s after %d attempts: %s", p.payload.WebhookID, p.payload.ID, p.attempt, reason)
+}
+
+// eventTypes names the webhook events a change is, and for a proposal the
+// status it had before; the caller holds d.mu
+func (d *WebhookDispatcher) eventTypes(event Event) ([]string, string) {
+	types := []string{event.Kind + "." + event.Op}
+	if event.Kind != "seed" {
+		return types, ""
+	}
+
+	if event.Op == eventDeleted {
+		if d.seedConcepts[event.ID] == TransactionConcept {
+			types = append(types, "transaction."+event.Op)
+		}
+		delete(d.seedConcepts, event.ID)
+		delete(d.proposalStatus, event.ID)
+		return types, ""
+	}
+
+	seed, ok := event.Data.(Seed_i)
+	if !ok {
+		return types, ""
+	}
+	previous, known := d.proposalStatus[event.ID]
+	d.noteSeed(event.ID, seed)
+	if seed.GetCoreSeed().ConceptID == TransactionConcept {
+		types = append(types, "transaction."+event.Op)
+	}
+	if proposal, ok := seed.(*Proposal); ok && (proposal.Status != previous || (!known && proposal.Status != "")) {
+		types = append(types, "proposal.status")
+	}
+	return types, previous
+}
+
+// noteSeed records a seed's concept and, for a proposal, its status; the
+// caller holds d.mu
+func (d *WebhookDispatcher) noteSeed(id string, seed Seed_i) {
+	d.seedConcepts[id] = seed.GetCoreSeed().ConceptID
+	if proposal, ok := seed.(*Proposal); ok {
+		d.proposalStatus[id] = proposal.Status
+	}
+}
+
+func (d *WebhookDispatcher) worker(ctx context.Context) {
+	for {
+		select {
+		case p := <-d.queue:
+			d.deliver(ctx, p)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// signWebhook is the signature header value: the hex HMAC-SHA256 of the
+// timestamp header, a dot and the body. Signing the timestamp lets receivers
+// turn away replayed deliveries.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, p *pendingDelivery) {
+	d.mu.Lock()
+	state, ok := d.hooks[p.payload.WebhookID]
+	d.mu.Unlock()
+	if !ok || !state.hook.Active {
+		return // removed or paused since the event
+	}
+
+	p.attempt++
+	record := WebhookDelivery{
+		DeliveryID: p.payload.ID,
+		WebhookID:  p.payload.WebhookID,
+		Type:       p.payload.Type,
+		Seq:        p.payload.Event.Seq,
+		Attempt:    p.attempt,
+		Timestamp:  time.Now(),
+	}
+	err := d.post(ctx, state.hook, p, &record)
+	record.Duration = time.Since(record.Timestamp)
+
+	switch {
+	case err == nil:
+		record.Status = "delivered"
+	case p.attempt < webhookMaxAttempts:
+		record.Status = "retrying"
+		record.Error = err.Error()
+		delay := webhookInitialDelay << (p.attempt - 1)
+		if delay > webhookMaxDelay {
+			delay = webhookMaxDelay
+		}
+		time.AfterFunc(delay, func() {
+			if ctx.Err() == nil {
+				d.enqueue(ctx, p)
+			}
+		})
+	default:
+		record.Status = "dead"
+		record.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	if len(d.deliveries) == webhookDeliveryLog {
+		d.deliveries = append(d.deliveries[:0], d.deliveries[1:]...)
+	}
+	d.deliveries = append(d.deliveries, record)
+	if record.Status == "dead" {
+		d.addDeadLetter(p, record.Error)
+	}
+	d.mu.Unlock()
+	if record.Status == "dead" {
+		d.saveDeadLetters(ctx)
+	}
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, hook *Webhook, p *pendingDelivery, record *WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(p.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CCN-Event", p.payload.Type)
+	req.Header.Set("X-CCN-Delivery", p.payload.ID)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if hook.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(hook.Secret, timestamp, p.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	record.ResponseCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// retryDeadLetter queues a dead letter again with a fresh set of attempts
+func (d *WebhookDispatcher) retryDeadLetter(ctx context.Context, id string) error {
+	d.mu.Lock()
+	letter, ok := d.deadLetters[id]
+	delete(d.deadLetters, id)
+	d.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("dead letter %w: %s", errEntityNotFound, id)
+	}
+	d.saveDeadLetters(ctx)
+
+	body, err := json.Marshal(letter.Payload)
+	if err != nil {
+		return err
+	}
+	select {
+	case d.queue <- &pendingDelivery{payload: letter.Payload, body: body}:
+		return nil
+	default:
+		d.mu.Lock()
+		d.deadLetters[id] = letter
+		d.mu.Unlock()
+		d.saveDeadLetters(ctx)
+		return errWebhookQueueFull
+	}
+}
+
+// register adds a webhook, generating its ID and, if none is given, its secret
+func (d *WebhookDispatcher) register(ctx context.Context, hook Webhook) (*Webhook, error) {
+	topic, err := hook.validate()
+	if err != nil {
+		return nil, err
+	}
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = time.Now()
+	if hook.Secret == "" {
+		hook.Secret = newWebhookSecret()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks[hook.ID] = d.newState(&hook, topic)
+	if err := d.save(ctx); err != nil {
+		delete(d.hooks, hook.ID)
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// replace changes a webhook's registration, keeping its secret unless a new
+// one is given. A changed filter starts again from the entities it selects now.
+func (d *WebhookDispatcher) replace(ctx context.Context, id string, hook Webhook) (*Webhook, error) {
+	topic, err := hook.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	existing, ok := d.hooks[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook %w: %s", errEntityNotFound, id)
+	}
+	hook.ID = id
+	hook.CreatedAt = existing.hook.CreatedAt
+	if hook.Secret == "" {
+		hook.Secret = existing.hook.Secret
+	}
+	state := d.newState(&hook, topic)
+	if existing.hook.Filter == hook.Filter {
+		state.sub = existing.sub
+	}
+	d.hooks[id] = state
+	if err := d.save(ctx); err != nil {
+		d.hooks[id] = existing
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (d *WebhookDispatcher) remove(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	existing, ok := d.hooks[id]
+	if !ok {
+		return fmt.Errorf("webhook %w: %s", errEntityNotFound, id)
+	}
+	delete(d.hooks, id)
+	if err := d.save(ctx); err != nil {
+		d.hooks[id] = existing
+		return err
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) get(id string) (*Webhook, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.hooks[id]
+	if !ok {
+		return nil, false
+	}
+	return state.hook, true
+}
+
+// list returns the webhooks, oldest first
+func (d *WebhookDispatcher) list() []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	hooks := make([]Webhook, 0, len(d.hooks))
+	for _, state := range d.hooks {
+		hooks = append(hooks, state.hook.public())
+	}
+	slices.SortFunc(hooks, func(a, b Webhook) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return hooks
+}
+
+// deliveriesOf returns a webhook's logged attempts, latest first
+func (d *WebhookDispatcher) deliveriesOf(id string) []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deliveries := []WebhookDelivery{}
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].WebhookID == id {
+			deliveries = append(deliveries, d.deliveries[i])
+		}
+	}
+	return deliveries
+}
+
+// listDeadLetters returns the dead letters, latest first
+func (d *WebhookDispatcher) listDeadLetters() []*DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	letters := make([]*DeadLetter, 0, len(d.deadLetters))
+	for _, letter := range d.deadLetters {
+		letters = append(letters, letter)
+	}
+	slices.SortFunc(letters, func(a, b *DeadLetter) int { return b.Timestamp.Compare(a.Timestamp) })
+	return letters
+}
+
+func (d *WebhookDispatcher) removeDeadLetter(ctx context.Context, id string) error {
+	d.mu.Lock()
+	_, ok := d.deadLetters[id]
+	delete(d.deadLetters, id)
+	d.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("dead letter %w: %s", errEntityNotFound, id)
+	}
+	d.saveDeadLetters(ctx)
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWebhookDelivery sends one payload to an endpoint that fails until told
+// otherwise: it is retried, goes to the dead letters after the last attempt and
+// is delivered when the dead letter is retried. Every attempt is signed.
+func TestWebhookDelivery(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // drops the retry the failed attempt scheduled
+	d := s.webhooks
+
+	const secret = "s3cret"
+	var status, attempts atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "%s.%s", r.Header.Get(webhookTimestampHeader), body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(r.Header.Get(webhookSignatureHeader)), []byte(want)) {
+			t.Errorf("signature %q, want %q", r.Header.Get(webhookSignatureHeader), want)
+		}
+		if r.Header.Get("X-CCN-Delivery") != "delivery-1" {
+			t.Errorf("delivery ID %q", r.Header.Get("X-CCN-Delivery"))
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer endpoint.Close()
+
+	hook, err := d.register(ctx, Webhook{URL: endpoint.URL, Secret: secret, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := WebhookPayload{ID: "delivery-1", Type: "concept.updated", WebhookID: hook.ID, Timestamp: time.Now()}
+	body, _ := json.Marshal(payload)
+	p := &pendingDelivery{payload: payload, body: body}
+
+	latest := func() WebhookDelivery {
+		deliveries := d.deliveriesOf(hook.ID)
+		if len(deliveries) == 0 {
+			t.Fatal("no delivery logged")
+		}
+		return deliveries[0]
+	}
+
+	d.deliver(ctx, p)
+	if got := latest(); got.Status != "retrying" || got.ResponseCode != http.StatusInternalServerError || got.Attempt != 1 {
+		t.Errorf("first attempt logged as %+v", got)
+	}
+
+	p.attempt = webhookMaxAttempts - 1
+	d.deliver(ctx, p)
+	if got := latest(); got.Status != "dead" {
+		t.Errorf("last attempt logged as %s", got.Status)
+	}
+	letters := d.listDeadLetters()
+	if len(letters) != 1 || letters[0].Payload.ID != payload.ID || letters[0].Attempts != webhookMaxAttempts {
+		t.Fatalf("dead letters %+v", letters)
+	}
+	var stored map[string]*DeadLetter
+	if err := loadData(ctx, webhookDeadLettersPath, &stored); err != nil || stored[payload.ID] == nil {
+		t.Errorf("dead letter not saved: %v %v", stored, err)
+	}
+
+	status.Store(http.StatusOK)
+	if err := d.retryDeadLetter(ctx, payload.ID); err != nil {
+		t.Fatal(err)
+	}
+	d.deliver(ctx, <-d.queue)
+	if got := latest(); got.Status != "delivered" || got.Attempt != 1 {
+		t.Errorf("retried dead letter logged as %+v", got)
+	}
+	if letters := d.listDeadLetters(); len(letters) != 0 {
+		t.Errorf("dead letters after a retry: %+v", letters)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("endpoint called %d times, want 3", n)
+	}
+}
+
+func TestDeadLetterLimits(t *testing.T) {
+	s, _ := newTestServer(t)
+	d := s.webhooks
+	letter := func(id string) *pendingDelivery {
+		return &pendingDelivery{payload: WebhookPayload{ID: id}, attempt: webhookMaxAttempts}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadLetters["old"] = &DeadLetter{Payload: WebhookPayload{ID: "old"}, Timestamp: time.Now().Add(-webhookDeadLetterAge - time.Hour)}
+	d.addDeadLetter(letter("first"), "failed")
+	if _, ok := d.deadLetters["old"]; ok {
+		t.Error("dead letter past its age kept")
+	}
+
+	for i := 0; i < webhookDeadLetterLimit; i++ {
+		d.addDeadLetter(letter(fmt.Sprint(i)), "failed")
+	}
+	if len(d.deadLetters) != webhookDeadLetterLimit {
+		t.Errorf("%d dead letters kept, want %d", len(d.deadLetters), webhookDeadLetterLimit)
+	}
+	if _, ok := d.deadLetters["first"]; ok {
+		t.Error("the oldest dead letter was kept past the limit")
+	}
+	if _, ok := d.deadLetters[fmt.Sprint(webhookDeadLetterLimit-1)]; !ok {
+		t.Error("the latest dead letter was dropped")
+	}
+}
@@ -1,28 +1,95 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// upgrader accepts connections from the node's own pages and the origins CORS
+// allows, so other sites cannot use a visitor's access
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for this example
+		origin := r.Header.Get("Origin")
+		if origin == "" || corsAllowed(origin) {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
 	},
 }
 
-func handleWebSocket_h(c *gin.Context) {
-	handleWebSocketConnection(c, sendConceptList)
+// StreamMessage is sent to WebSocket clients: first a snapshot of the state
+// as of Seq, unless the client resumed, then one event per change, and an ack
+// or error for each message the client sends
+type StreamMessage struct {
+	Type      string         `json:"type"` // snapshot, event, ack or error
+	Seq       uint64         `json:"seq,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
+	Topic     string         `json:"topic,omitempty"`
+	State     map[string]any `json:"state,omitempty"` // entities by ID for each kind, e.g. "concepts"
+	Event     *Event         `json:"event,omitempty"`
+	Result    *BatchResult   `json:"result,omitempty"`
+	Status    int            `json:"status,omitempty"` // the HTTP status the error would have had
+	Error     string         `json:"error,omitempty"`
 }
 
-func handlePeerWebSocket_h(c *gin.Context) {
-	handleWebSocketConnection(c, sendPeerList)
+// ClientMessage is sent by WebSocket clients. Subscribe answers with an ack
+// carrying the topic's current state; a command is one batch operation.
+type ClientMessage struct {
+	RequestID string          `json:"requestId"`
+	Type      string          `json:"type"` // subscribe, unsubscribe or command
+	Topic     string          `json:"topic,omitempty"`
+	Command   *BatchOperation `json:"command,omitempty"`
 }
 
-func handleWebSocketConnection(c *gin.Context, sendFunc func(*websocket.Conn)) {
+func (s *Server) handleWebSocket_h(c *gin.Context) {
+	s.handleWebSocketConnection(c, []string{"concepts"})
+}
+
+func (s *Server) handlePeerWebSocket_h(c *gin.Context) {
+	s.handleWebSocketConnection(c, []string{"peers"})
+}
+
+// handleWebSocketConnection streams changes to the given topics, or to the
+// kinds in ?kinds=, and to whatever the client subscribes to later. A client
+// that reconnects with ?since=<seq of the last event it got> is sent the events
+// it missed instead of a new snapshot, as long as the server still has them;
+// topics it subscribed to on the old connection have to be subscribed again.
+func (s *Server) handleWebSocketConnection(c *gin.Context, topicNames []string) {
+	if kinds := c.Query("kinds"); kinds != "" {
+		topicNames = nil
+		for _, kind := range strings.Split(kinds, ",") {
+			topicNames = append(topicNames, kind+"s")
+		}
+	}
+	topics := make([]*streamTopic, 0, len(topicNames))
+	for _, name := range topicNames {
+		topic, err := parseTopic(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		topics = append(topics, topic)
+	}
+	var since uint64
+	if q := c.Query("since"); q != "" {
+		var err error
+		if since, err = strconv.ParseUint(q, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a sequence number"})
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
@@ -32,11 +99,157 @@ func handleWebSocketConnection(c *gin.Context, sendFunc func(*websocket.Conn)) {
 
 	log.Printf("New WebSocket connection established")
 
-	sendFunc(conn)
+	events, missed, seq, resumed := s.events.Subscribe(since)
+	defer s.events.Unsubscribe(events)
 
-	go periodicSend(conn, sendFunc)
+	sub := newStreamSubscription()
+	if resumed {
+		for _, topic := range topics {
+			sub.add(topic, since, nil)
+		}
+	} else {
+		state := make(map[string]any)
+		for _, topic := range topics {
+			topicState := topic.state(s)
+			sub.add(topic, seq, topicState)
+			mergeState(state, topicState)
+		}
+		if err := conn.WriteJSON(StreamMessage{Type: "snapshot", Seq: seq, State: state}); err != nil {
+			log.Printf("Failed to send snapshot: %v", err)
+			return
+		}
+	}
+	for _, event := range missed {
+		if err := sendEvent(conn, sub, event); err != nil {
+			log.Printf("Failed to send event: %v", err)
+			return
+		}
+	}
 
-	keepAlive(conn)
+	// Only this goroutine writes to the connection; the reader and running
+	// commands hand their messages over
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Commands act for whoever opened the connection
+	commandCtx := context.Background()
+	if p, ok := principalFrom(c.Request.Context()); ok {
+		commandCtx = withPrincipal(commandCtx, p)
+	}
+	requests := make(chan ClientMessage)
+	replies := make(chan StreamMessage)
+	closed := make(chan struct{})
+	go readClientMessages(ctx, conn, requests, closed)
 
-	log.Printf("WebSocket connection closed")
+	for {
+		var reply StreamMessage
+		select {
+		case event, ok := <-events:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind; reconnect with since"))
+				log.Printf("WebSocket client fell behind")
+				return
+			}
+			if err := sendEvent(conn, sub, event); err != nil {
+				log.Printf("Failed to send event: %v", err)
+				return
+			}
+			continue
+		case request := <-requests:
+			if request.Type == "command" && request.Command != nil {
+				// A command runs to the end even if the client goes away meanwhile
+				go func() {
+					reply := s.applyCommand(commandCtx, request)
+					select {
+					case replies <- reply:
+					case <-ctx.Done():
+					}
+				}()
+				continue
+			}
+			reply = s.handleSubscription(sub, request)
+		case reply = <-replies:
+		case <-closed:
+			log.Printf("WebSocket connection closed")
+			return
+		}
+		if err := conn.WriteJSON(reply); err != nil {
+			log.Printf("Failed to send reply: %v", err)
+			return
+		}
+	}
+}
+
+// readClientMessages passes the client's messages on until the connection
+// fails, then closes closed. Messages that cannot be read are answered with an
+// error without a request ID.
+func readClientMessages(ctx context.Context, conn *websocket.Conn, requests chan<- ClientMessage, closed chan<- struct{}) {
+	defer close(closed)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("WebSocket read error: %v", err)
+			return
+		}
+		var request ClientMessage
+		if err := json.Unmarshal(data, &request); err != nil {
+			request = ClientMessage{Type: "invalid"}
+		}
+		select {
+		case requests <- request:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func streamError(request ClientMessage, status int, err error) StreamMessage {
+	return StreamMessage{Type: "error", RequestID: request.RequestID, Topic: request.Topic, Status: status, Error: err.Error()}
+}
+
+func (s *Server) handleSubscription(sub *streamSubscription, request ClientMessage) StreamMessage {
+	switch request.Type {
+	case "subscribe":
+		topic, err := parseTopic(request.Topic)
+		if err != nil {
+			return streamError(request, http.StatusBadRequest, err)
+		}
+		seq := s.events.Seq()
+		state := topic.state(s)
+		sub.add(topic, seq, state)
+		return StreamMessage{Type: "ack", RequestID: request.RequestID, Topic: topic.name, Seq: seq, State: state}
+
+	case "unsubscribe":
+		if !sub.remove(request.Topic) {
+			return streamError(request, http.StatusNotFound, fmt.Errorf("not subscribed to %q", request.Topic))
+		}
+		return StreamMessage{Type: "ack", RequestID: request.RequestID, Topic: request.Topic}
+
+	case "command":
+		return streamError(request, http.StatusBadRequest, fmt.Errorf("command is required"))
+	case "invalid":
+		return streamError(request, http.StatusBadRequest, fmt.Errorf("message is not valid JSON"))
+	}
+	return streamError(request, http.StatusBadRequest, fmt.Errorf("unknown message type %q", request.Type))
+}
+
+// applyCommand applies a client's command as a batch of one operation
+func (s *Server) applyCommand(ctx context.Context, request ClientMessage) StreamMessage {
+	results, err := s.applyBatch(ctx, []BatchOperation{*request.Command})
+	if err != nil {
+		status := batchErrorStatus(err)
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			err = batchErr.Err
+		}
+		return streamError(request, status, err)
+	}
+	return StreamMessage{Type: "ack", RequestID: request.RequestID, Result: results[0]}
+}
+
+func sendEvent(conn *websocket.Conn, sub *streamSubscription, event Event) error {
+	if !sub.wants(event) {
+		return nil
+	}
+	return conn.WriteJSON(StreamMessage{Type: "event", Seq: event.Seq, Event: &event})
 }
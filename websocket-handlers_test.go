@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// wsClient is a test client of the WebSocket protocol
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialStream(t *testing.T, server *httptest.Server, path, token string) *wsClient {
+	t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn}
+}
+
+func (c *wsClient) send(msg ClientMessage) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) read() StreamMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg StreamMessage
+	if err := c.conn.ReadJSON(&msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// reply reads up to the answer to requestID, returning it and the events
+// received before it
+func (c *wsClient) reply(requestID string) (StreamMessage, []StreamMessage) {
+	c.t.Helper()
+	var events []StreamMessage
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			events = append(events, msg)
+			continue
+		}
+		if msg.RequestID != requestID {
+			c.t.Fatalf("got %+v while waiting for %s", msg, requestID)
+		}
+		return msg, events
+	}
+}
+
+// nextEvent reads up to the next event of kind, returning it and the events
+// of other kinds received before it
+func (c *wsClient) nextEvent(kind string) (StreamMessage, []StreamMessage) {
+	c.t.Helper()
+	var others []StreamMessage
+	for {
+		msg := c.read()
+		if msg.Type == "event" && msg.Event.Kind == kind {
+			return msg, others
+		}
+		others = append(others, msg)
+	}
+}
+
+func TestWebSocketProtocol(t *testing.T) {
+	s, _ := newTestServer(t)
+	_, adminToken, _ := s.auth.createToken(context.Background(), "admin", defaultSteward(), true)
+	r := gin.New()
+	s.setupRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	c := dialStream(t, server, "/ws?kinds=seed", adminToken)
+	if snapshot := c.read(); snapshot.Type != "snapshot" || snapshot.State["seeds"] == nil || snapshot.State["concepts"] != nil {
+		t.Fatalf("first message %+v, want a snapshot of the seeds", snapshot)
+	}
+
+	c.send(ClientMessage{RequestID: "sub", Type: "subscribe", Topic: "concept-type:Gadget"})
+	if ack, _ := c.reply("sub"); ack.Type != "ack" || ack.Topic != "concept-type:Gadget" || ack.State["concepts"] == nil {
+		t.Errorf("subscribe answered %+v", ack)
+	}
+
+	create := func(requestID, name string) {
+		op := batchOp("create", "concept", "", "", map[string]any{"name": name, "type": "Gadget"})
+		c.send(ClientMessage{RequestID: requestID, Type: "command", Command: &op})
+	}
+	create("create", "Widget")
+	ack, events := c.reply("create")
+	if ack.Type != "ack" || ack.Result == nil || ack.Result.Kind != "concept" {
+		t.Fatalf("command answered %+v", ack)
+	}
+	if len(events) == 0 {
+		event, _ := c.nextEvent("concept")
+		events = append(events, event)
+	}
+	if event := events[0].Event; event.Kind != "concept" || event.ID != ack.Result.ID {
+		t.Errorf("event %+v, want the new concept", event)
+	}
+
+	create("duplicate", "Widget")
+	if reply, _ := c.reply("duplicate"); reply.Type != "error" || reply.Status != http.StatusConflict {
+		t.Errorf("command with a name in use answered %+v", reply)
+	}
+
+	tests := []struct {
+		msg    ClientMessage
+		status int
+	}{
+		{ClientMessage{RequestID: "bad-topic", Type: "subscribe", Topic: "gadgets"}, http.StatusBadRequest},
+		{ClientMessage{RequestID: "not-subscribed", Type: "unsubscribe", Topic: "peers"}, http.StatusNotFound},
+		{ClientMessage{RequestID: "no-command", Type: "command"}, http.StatusBadRequest},
+		{ClientMessage{RequestID: "bad-type", Type: "shout"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		c.send(tt.msg)
+		if reply, _ := c.reply(tt.msg.RequestID); reply.Type != "error" || reply.Status != tt.status {
+			t.Errorf("%s answered %+v, want error %d", tt.msg.RequestID, reply, tt.status)
+		}
+	}
+	c.conn.WriteMessage(websocket.TextMessage, []byte("{"))
+	if reply, _ := c.reply(""); reply.Type != "error" || reply.Status != http.StatusBadRequest {
+		t.Errorf("invalid JSON answered %+v", reply)
+	}
+
+	c.send(ClientMessage{RequestID: "unsub", Type: "unsubscribe", Topic: "concept-type:Gadget"})
+	if ack, _ := c.reply("unsub"); ack.Type != "ack" {
+		t.Errorf("unsubscribe answered %+v", ack)
+	}
+	create("after", "Sprocket")
+	if ack, _ := c.reply("after"); ack.Type != "ack" {
+		t.Fatalf("command answered %+v", ack)
+	}
+	newTestSteward(t, s, "Alice")
+	if _, others := c.nextEvent("seed"); len(others) != 0 {
+		t.Errorf("sent %+v after unsubscribing", others)
+	}
+
+	anonymous := dialStream(t, server, "/ws", "")
+	anonymous.read()
+	op := batchOp("create", "concept", "", "", map[string]any{"name": "Anonymous", "type": "Gadget"})
+	anonymous.send(ClientMessage{RequestID: "anonymous", Type: "command", Command: &op})
+	if reply, _ := anonymous.reply("anonymous"); reply.Type != "error" || reply.Status != http.StatusUnauthorized {
+		t.Errorf("command on an anonymous connection answered %+v", reply)
+	}
+}